@@ -1,19 +1,26 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"pho/internal/config"
+	"pho/internal/hashing"
 	"pho/internal/logging"
 	"pho/internal/pho"
 	"pho/internal/render"
+	"pho/internal/restore"
+	"slices"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli/v3"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
@@ -104,9 +111,77 @@ Shows a diff of what will be changed without applying the changes.`,
 					Aliases: []string{"a"},
 					Usage:   "Apply changes to MongoDB",
 					Description: `Apply changes that have been made to documents back to MongoDB.
-This will execute the actual database operations.`,
+This will execute the actual database operations.
+Edits of documents modified in the database since they were dumped are three-way merged
+with their current versions. Conflicts that can't be merged automatically are written into
+the dump with conflict markers and nothing is applied, unless --force is given.
+With --atomic all changes are applied in a single transaction (requires a replica set):
+the first failed change rolls back everything.
+Large change sets (see --bulk-threshold) are applied in batches via BulkWrite.`,
 					Action: applyAction,
-					Flags:  getConnectionFlags(),
+					Flags:  getApplyFlags(),
+				},
+				{
+					Name:    "undo",
+					Aliases: []string{"u"},
+					Usage:   "Revert the last applied changes",
+					Description: `Revert the last applied changes by replaying their inverse change set:
+updated documents are restored, deleted ones are re-inserted and added ones are deleted.
+The inverse change set is captured on every apply. Use 'pho review --undo' to preview it.`,
+					Action: undoAction,
+					Flags:  append(getSessionFlags(), getVerbosityFlags()...),
+				},
+				{
+					Name:    "status",
+					Aliases: []string{"st"},
+					Usage:   "Show the state of the current session",
+					Description: `Show the current session: its query, age, dump file, number of documents
+and how many of them are updated, added, deleted or left untouched in the dump.
+Use --json for machine-readable output.`,
+					Action: statusAction,
+					Flags:  getStatusFlags(),
+				},
+				{
+					Name:    "sessions",
+					Aliases: []string{"s"},
+					Usage:   "Manage named sessions",
+					Description: `Manage editing sessions. Every session has its own dump and data directory,
+so several queries can be edited concurrently. Use --session <name> to start or use a named session.`,
+					Commands: []*cli.Command{
+						{
+							Name:    "list",
+							Aliases: []string{"ls"},
+							Usage:   "List all sessions",
+							Action:  sessionsListAction,
+						},
+						{
+							Name:      "switch",
+							Usage:     "Make the given session the active one",
+							ArgsUsage: "<name>",
+							Action:    sessionsSwitchAction,
+						},
+						{
+							Name:      "drop",
+							Aliases:   []string{"rm"},
+							Usage:     "Drop the given session with all its data",
+							ArgsUsage: "<name>",
+							Description: `Drop the given session: its registry entry and its data files.
+Use --stale to drop all sessions which data files are missing.`,
+							Action: sessionsDropAction,
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:  "stale",
+									Usage: "Drop all sessions with missing data files",
+								},
+							},
+						},
+						{
+							Name:      "show",
+							Usage:     "Show details of the given session (active one by default)",
+							ArgsUsage: "[name]",
+							Action:    sessionsShowAction,
+						},
+					},
 				},
 				{
 					Name:    "config",
@@ -148,7 +223,7 @@ Examples:
   pho config list mongo     # List only MongoDB configuration
   pho config list app       # List only Application configuration
 
-Available sections: mongo, database, query, app, output, directories`,
+Available sections: mongo, database, query, protect, mask, app, output, directories`,
 							Action: configListAction,
 						},
 					},
@@ -176,6 +251,12 @@ func getRenderFlags() []cli.Flag {
 	}
 
 	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "format",
+			Value:   cfg.Output.Format,
+			Usage:   "Output format: json, yaml (BSON types kept via tags), csv or tsv (flat documents as table rows)",
+			Sources: cli.EnvVars("PHO_OUTPUT_FORMAT"),
+		},
 		&cli.StringFlag{
 			Name:    "extjson-mode",
 			Aliases: []string{"m"},
@@ -226,6 +307,17 @@ func getVerbosityFlags() []cli.Flag {
 	}
 }
 
+// getSessionFlags returns flags for selecting the session to work with.
+func getSessionFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "session",
+			Usage:   "Name of the session to work with (defaults to the active one, see 'pho sessions')",
+			Sources: cli.EnvVars("PHO_SESSION"),
+		},
+	}
+}
+
 // getConnectionFlags returns flags for MongoDB connection.
 func getConnectionFlags() []cli.Flag {
 	// Load config to get defaults
@@ -291,18 +383,156 @@ func getEditFlags() []cli.Flag {
 		},
 	}
 
-	// Combine editor-specific flags with shared render and verbosity flags
-	flags := append(append(editorFlags, getRenderFlags()...), getVerbosityFlags()...)
+	// Combine editor-specific flags with shared session, render and verbosity flags
+	flags := append(append(append(editorFlags, getSessionFlags()...), getRenderFlags()...), getVerbosityFlags()...)
 	return flags
 }
 
 // getReviewFlags returns flags for the review command.
 func getReviewFlags() []cli.Flag {
-	// Combine shared render and verbosity flags
-	flags := append(getRenderFlags(), getVerbosityFlags()...)
+	// Documents are read in the format of the session dump, so --format stands for the review format instead
+	renderFlags := slices.DeleteFunc(getRenderFlags(), func(f cli.Flag) bool {
+		return slices.Contains(f.Names(), "format")
+	})
+
+	// Combine shared session, render and verbosity flags
+	flags := append(append(getSessionFlags(), renderFlags...), getVerbosityFlags()...)
+	flags = append(flags,
+		&cli.BoolFlag{
+			Name:  "undo",
+			Usage: "Show commands that revert the last applied changes",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Value: string(pho.ReviewFormats.Shell),
+			Usage: "Review format: shell (mongo shell commands), diff (unified diff of documents, " +
+				"colorized on terminals unless NO_COLOR is set), or a patch to be applied later " +
+				"via 'pho apply --from': json-patch (RFC 6902), merge-patch (RFC 7396) or changes-json",
+		},
+		&cli.StringFlag{
+			Name: "script",
+			Usage: "Write changes into the given file as a standalone mongosh script " +
+				"(e.g. to be run where pho can't connect to)",
+		},
+		&cli.BoolFlag{
+			Name:  "atomic",
+			Usage: "Wrap writes of the --script into a single transaction (requires a replica set)",
+		},
+	)
 	return flags
 }
 
+// getStatusFlags returns flags for the status command.
+func getStatusFlags() []cli.Flag {
+	flags := append(append(getSessionFlags(), getRenderFlags()...), getVerbosityFlags()...)
+	flags = append(flags, &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Output status as JSON",
+	})
+	return flags
+}
+
+// getApplyFlags returns flags for the apply command.
+func getApplyFlags() []cli.Flag {
+	// Load config to get defaults
+	cfg, _ := config.Load()
+	if cfg == nil {
+		cfg = config.NewDefault()
+	}
+
+	applyFlags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "Apply changes even if documents were modified in the database since the dump",
+		},
+		&cli.BoolFlag{
+			Name:  "atomic",
+			Usage: "Apply all changes in a single transaction, rolling back everything on the first failure",
+		},
+		&cli.IntFlag{
+			Name:  "bulk-threshold",
+			Value: pho.DefaultBulkThreshold,
+			Usage: "Number of changes starting from which they are applied via BulkWrite (0 disables bulk mode)",
+		},
+		&cli.IntFlag{
+			Name:  "batch-size",
+			Value: restore.DefaultBatchSize,
+			Usage: "Max number of changes sent in a single BulkWrite call",
+		},
+		&cli.BoolFlag{
+			Name:  "unordered",
+			Usage: "Continue applying changes in bulk mode after a failed one",
+		},
+		&cli.BoolFlag{
+			Name: "dry-run",
+			Usage: "Check every change against the database without writing anything " +
+				"(in transactions that are rolled back, requires a replica set) and print a verdict per change",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-validation",
+			Usage: "Apply changes without checking documents against the collection's $jsonSchema validator first",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-protected-edits",
+			Usage: "Apply changes even if they edit protected fields (see --protect)",
+		},
+		&cli.StringFlag{
+			Name: "from",
+			Usage: "Apply a patch file written by 'pho review --format json-patch|merge-patch|changes-json' " +
+				"instead of the session changes (documents of --db and --collection, or of the session's collection)",
+		},
+	}
+
+	return append(append(append(getConnectionFlags(), getSessionFlags()...), applyFlags...), getFieldRulesFlags(cfg)...)
+}
+
+// getFieldRulesFlags returns flags of protected and masked fields.
+// Query sets them for the session, apply sets them for patches applied via --from.
+func getFieldRulesFlags(cfg *config.Config) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "protect",
+			Value:   cfg.Protect.Fields,
+			Usage:   "Comma-separated paths of fields that must not be edited, e.g. 'createdAt,audit.by'",
+			Sources: cli.EnvVars("PHO_PROTECT"),
+		},
+		&cli.StringFlag{
+			Name:    "mask",
+			Value:   cfg.Mask.Fields,
+			Usage:   "Comma-separated paths of sensitive fields replaced with a placeholder in the dump",
+			Sources: cli.EnvVars("PHO_MASK"),
+		},
+		&cli.StringFlag{
+			Name:    "mask-pattern",
+			Value:   cfg.Mask.Pattern,
+			Usage:   "Regex of sensitive field names (at any depth) masked like --mask, e.g. '(?i)password|token'",
+			Sources: cli.EnvVars("PHO_MASK_PATTERN"),
+		},
+	}
+}
+
+// getFieldRulesOptions returns options of protected and masked fields given by their flags.
+func getFieldRulesOptions(cmd *cli.Command) ([]pho.Option, error) {
+	protected, err := pho.ParseFieldPaths(cmd.String("protect"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid protected fields: %w", err)
+	}
+	masked, err := pho.ParseFieldPaths(cmd.String("mask"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid masked fields: %w", err)
+	}
+	maskPattern, err := pho.ParseMaskPattern(cmd.String("mask-pattern"))
+	if err != nil {
+		return nil, err
+	}
+
+	return []pho.Option{
+		pho.WithProtected(protected),
+		pho.WithMaskedFields(masked),
+		pho.WithMaskPattern(maskPattern),
+	}, nil
+}
+
 // getCommonFlags returns all flags including connection and query flags.
 func getCommonFlags() []cli.Flag {
 	// Load config to get defaults
@@ -339,6 +569,18 @@ func getCommonFlags() []cli.Flag {
 			Usage:   "Projection for documents (JSON format, e.g. '{\"field\": 1}')",
 			Sources: cli.EnvVars("PHO_PROJECTION"),
 		},
+		&cli.StringFlag{
+			Name: "pipeline",
+			Usage: "Aggregation pipeline selecting documents, as a JSON array or a path to a file " +
+				"(instead of --query, --sort and --projection)",
+			Sources: cli.EnvVars("PHO_PIPELINE"),
+		},
+		&cli.StringFlag{
+			Name:    "identify-by",
+			Value:   cfg.Query.IdentifyBy,
+			Usage:   "Field documents are identified by, or comma-separated fields of a composite key (default: _id)",
+			Sources: cli.EnvVars("PHO_IDENTIFY_BY"),
+		},
 		&cli.StringFlag{
 			Name:    "editor",
 			Aliases: []string{"e"},
@@ -350,10 +592,16 @@ func getCommonFlags() []cli.Flag {
 			Name:  "edit",
 			Usage: "Immediately open editor after query (combines query+edit stages)",
 		},
+		&cli.BoolFlag{
+			Name:    "dump-dir",
+			Usage:   "Dump each document into its own <id>.json file of a directory (delete a file to delete the doc)",
+			Sources: cli.EnvVars("PHO_DUMP_DIR"),
+		},
 	}
 
 	// Combine all flag types
-	allFlags := append(append(append(connectionFlags, queryFlags...), getRenderFlags()...), getVerbosityFlags()...)
+	allFlags := append(append(append(connectionFlags, getSessionFlags()...), queryFlags...), getFieldRulesFlags(cfg)...)
+	allFlags = append(append(allFlags, getRenderFlags()...), getVerbosityFlags()...)
 	return allFlags
 }
 
@@ -377,6 +625,50 @@ func validateAndParseExtJSONMode(cmd *cli.Command) (render.ExtJSONMode, error) {
 	return parseExtJSONMode(extjsonModeStr)
 }
 
+// validateAndParseFormat parses and validates output format from CLI command.
+// Returns the parsed format or JSON as default if the format string is empty.
+func validateAndParseFormat(cmd *cli.Command) (render.Format, error) {
+	format := cmd.String("format")
+	if format == "" {
+		return render.Formats.JSON, nil
+	}
+	return parseFormat(format)
+}
+
+// getSessionName returns the validated session name given via --session flag (empty if not given).
+func getSessionName(cmd *cli.Command) (string, error) {
+	name := cmd.String("session")
+	if name == "" {
+		return "", nil
+	}
+
+	return name, pho.ValidateSessionName(name)
+}
+
+// resolvePipeline returns the pipeline given inline (as a JSON array) or read from the given file.
+// Pipeline is compacted, so it can be stored in the session as a single line.
+func resolvePipeline(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	data := []byte(value)
+	if !strings.HasPrefix(value, "[") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return "", fmt.Errorf("failed to read pipeline file: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return "", fmt.Errorf("pipeline must be a JSON array: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
 // queryAction handles the main query and edit workflow.
 func queryAction(ctx context.Context, cmd *cli.Command) error {
 	// Create logger with appropriate verbosity level
@@ -390,8 +682,41 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 		logger.Error("Invalid ExtJSON mode: %s", err)
 		return err
 	}
+	format, err := validateAndParseFormat(cmd)
+	if err != nil {
+		logger.Error("Invalid format: %s", err)
+		return err
+	}
+
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
 	logger.Debug("ExtJSON mode: %s", cmd.String("extjson-mode"))
 
+	pipeline, err := resolvePipeline(cmd.String("pipeline"))
+	if err != nil {
+		logger.Error("Invalid pipeline: %s", err)
+		return err
+	}
+	if pipeline != "" && (cmd.IsSet("query") || cmd.IsSet("sort") || cmd.IsSet("projection")) {
+		logger.Error("--pipeline can't be combined with --query, --sort or --projection")
+		return errors.New("--pipeline can't be combined with --query, --sort or --projection")
+	}
+
+	identifyBy, err := hashing.ParseIdentifyBy(cmd.String("identify-by"))
+	if err != nil {
+		logger.Error("Invalid identity: %s", err)
+		return err
+	}
+
+	fieldRules, err := getFieldRulesOptions(cmd)
+	if err != nil {
+		logger.Error("%s", err)
+		return err
+	}
+
 	// Create pho app with configuration
 	uri := prepareMongoURI(cmd.String("uri"), cmd.String("host"), cmd.String("port"))
 	db := cmd.String("db")
@@ -400,16 +725,20 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 	logger.Debug("Configuration: URI=%s, DB=%s, Collection=%s", uri, db, collection)
 	logger.Verbose("Creating pho application instance")
 
-	p := pho.NewApp(
+	p := pho.NewApp(append([]pho.Option{
+		pho.WithSession(sessionName),
 		pho.WithURI(uri),
 		pho.WithDatabase(db),
 		pho.WithCollection(collection),
+		pho.WithDirectoryDump(cmd.Bool("dump-dir")),
+		pho.WithIdentifyBy(identifyBy),
 		pho.WithRenderer(render.NewRenderer(
+			render.WithFormat(format),
 			render.WithExtJSONMode(extjsonMode),
 			render.WithShowLineNumbers(cmd.Bool("line-numbers")),
 			render.WithCompactJSON(cmd.Bool("compact")),
 		)),
-	)
+	}, fieldRules...)...)
 
 	// Setup context with signal handling
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
@@ -427,12 +756,18 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 	defer p.Close(ctx)
 	logger.Success("Connected to MongoDB database")
 
-	// Execute query
+	// Execute query (or pipeline)
 	query := cmd.String("query")
 	limit := cmd.Int64("limit")
-	logger.Verbose("Executing query: %s (limit: %d)", query, limit)
 
-	cursor, err := p.RunQuery(ctx, query, limit, cmd.String("sort"), cmd.String("projection"))
+	var cursor *mongo.Cursor
+	if pipeline != "" {
+		logger.Verbose("Executing pipeline: %s (limit: %d)", pipeline, limit)
+		cursor, err = p.RunPipeline(ctx, pipeline, limit)
+	} else {
+		logger.Verbose("Executing query: %s (limit: %d)", query, limit)
+		cursor, err = p.RunQuery(ctx, query, limit, cmd.String("sort"), cmd.String("projection"))
+	}
 	if err != nil {
 		logger.Error("Query execution failed: %s", err)
 		return fmt.Errorf("failed to execute query: %w", err)
@@ -474,22 +809,10 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	// Setup dump destination
-	logger.Verbose("Setting up dump destination")
-	out, dumpPath, err := p.SetupDumpDestination()
+	dumpPath, err := dumpToDestination(ctx, p, cursor, cmd.Bool("dump-dir"), logger)
 	if err != nil {
-		logger.Error("Failed to setup dump destination: %s", err)
-		return fmt.Errorf("failed to set dump destination: %w", err)
-	}
-	defer out.Close()
-	logger.Debug("Dump file path: %s", dumpPath)
-
-	logger.Verbose("Dumping documents to file")
-	if err := p.Dump(ctx, cursor, out); err != nil {
-		logger.Error("Failed to dump to file: %s", err)
-		return fmt.Errorf("failed to dump: %w", err)
+		return err
 	}
-	logger.Success("Documents dumped to file")
 
 	// Save session metadata after successful dump
 	logger.Verbose("Saving session metadata")
@@ -501,6 +824,10 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 		Limit:      limit,
 		Sort:       cmd.String("sort"),
 		Projection: cmd.String("projection"),
+		Pipeline:   pipeline,
+	}
+	if pipeline != "" {
+		queryParams.Query, queryParams.Sort, queryParams.Projection = "", "", ""
 	}
 
 	if err := p.SaveSession(ctx, queryParams); err != nil {
@@ -527,6 +854,54 @@ func queryAction(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// dumpToDestination dumps documents of the cursor into the session dump file (or directory)
+// and returns its path.
+func dumpToDestination(
+	ctx context.Context,
+	p *pho.App,
+	cursor *mongo.Cursor,
+	dumpDir bool,
+	logger *logging.Logger,
+) (string, error) {
+	if dumpDir {
+		logger.Verbose("Setting up dump directory")
+		dumpPath, err := p.SetupDumpDirectory()
+		if err != nil {
+			logger.Error("Failed to setup dump directory: %s", err)
+			return "", fmt.Errorf("failed to set dump destination: %w", err)
+		}
+		logger.Debug("Dump directory path: %s", dumpPath)
+
+		logger.Verbose("Dumping documents to directory")
+		if err := p.DumpToDirectory(ctx, cursor, dumpPath); err != nil {
+			logger.Error("Failed to dump to directory: %s", err)
+			return "", fmt.Errorf("failed to dump: %w", err)
+		}
+		logger.Success("Documents dumped to directory")
+
+		return dumpPath, nil
+	}
+
+	// Setup dump destination
+	logger.Verbose("Setting up dump destination")
+	out, dumpPath, err := p.SetupDumpDestination()
+	if err != nil {
+		logger.Error("Failed to setup dump destination: %s", err)
+		return "", fmt.Errorf("failed to set dump destination: %w", err)
+	}
+	defer out.Close()
+	logger.Debug("Dump file path: %s", dumpPath)
+
+	logger.Verbose("Dumping documents to file")
+	if err := p.Dump(ctx, cursor, out); err != nil {
+		logger.Error("Failed to dump to file: %s", err)
+		return "", fmt.Errorf("failed to dump: %w", err)
+	}
+	logger.Success("Documents dumped to file")
+
+	return dumpPath, nil
+}
+
 // editAction handles opening editor for existing session.
 func editAction(ctx context.Context, cmd *cli.Command) error {
 	logger := createLogger(cmd)
@@ -539,10 +914,23 @@ func editAction(ctx context.Context, cmd *cli.Command) error {
 		logger.Error("Invalid ExtJSON mode: %s", err)
 		return err
 	}
+	format, err := validateAndParseFormat(cmd)
+	if err != nil {
+		logger.Error("Invalid format: %s", err)
+		return err
+	}
+
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
 
 	// Create pho app with renderer configuration
 	p := pho.NewApp(
+		pho.WithSession(sessionName),
 		pho.WithRenderer(render.NewRenderer(
+			render.WithFormat(format),
 			render.WithExtJSONMode(extjsonMode),
 			render.WithShowLineNumbers(cmd.Bool("line-numbers")),
 			render.WithCompactJSON(cmd.Bool("compact")),
@@ -598,6 +986,17 @@ func reviewAction(ctx context.Context, cmd *cli.Command) error {
 
 	logger.Verbose("Starting review action")
 
+	reviewFormat, err := pho.ParseReviewFormat(cmd.String("format"))
+	if err != nil {
+		logger.Error("Invalid review format: %s", err)
+		return err
+	}
+
+	// Patches are meant to be redirected into files, so progress messages must not get mixed into them
+	if reviewFormat.IsPatch() {
+		logger.SetOutput(os.Stderr)
+	}
+
 	// Parse and validate ExtJSON mode (needed for renderer)
 	extjsonMode, err := validateAndParseExtJSONMode(cmd)
 	if err != nil {
@@ -605,8 +1004,15 @@ func reviewAction(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
+
 	// Create pho app with renderer configuration
 	p := pho.NewApp(
+		pho.WithSession(sessionName),
 		pho.WithRenderer(render.NewRenderer(
 			render.WithExtJSONMode(extjsonMode),
 			render.WithShowLineNumbers(cmd.Bool("line-numbers")),
@@ -614,6 +1020,19 @@ func reviewAction(ctx context.Context, cmd *cli.Command) error {
 		)),
 	)
 
+	// Undo data is kept per session (in its data dir), but doesn't need the session's dump to be reviewed
+	if cmd.Bool("undo") {
+		if err := p.ReviewUndo(ctx); err != nil {
+			if errors.Is(err, pho.ErrNoUndo) {
+				logger.Error("No undo data found")
+				return errors.New("no undo data found. Run 'pho apply' first")
+			}
+			logger.Error("Failed to review undo changes: %s", err)
+			return fmt.Errorf("failed to review undo changes: %w", err)
+		}
+		return nil
+	}
+
 	// Check if there's an active session and load metadata
 	hasSession, _, err := p.HasActiveSession(ctx)
 	if err != nil {
@@ -630,8 +1049,14 @@ func reviewAction(ctx context.Context, cmd *cli.Command) error {
 		return errors.New("no active session found. Run 'pho query' first to create a session")
 	}
 
-	// Load session metadata to configure the app
-	if err := p.ConnectDBForApply(ctx); err != nil {
+	// Scripts are meant to be run elsewhere, so the database doesn't need to be reachable
+	script := cmd.String("script")
+	if script != "" {
+		if err := p.LoadSessionTarget(ctx); err != nil {
+			logger.Error("Failed to load session: %s", err)
+			return fmt.Errorf("failed to load session: %w", err)
+		}
+	} else if err := p.ConnectDBForApply(ctx); err != nil {
 		// Check if this is a connection error that needs formatting
 		if strings.Contains(err.Error(), "failed to connect to MongoDB") {
 			// For review action, we need to get the URI from session metadata
@@ -644,7 +1069,12 @@ func reviewAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	logger.Verbose("Reviewing changes in documents")
-	if err := p.ReviewChanges(ctx); err != nil {
+	if err := p.ReviewChanges(ctx,
+		pho.WithReviewFormat(reviewFormat),
+		pho.WithColor(useColor(os.Stdout)),
+		pho.WithScript(script),
+		pho.WithScriptTransaction(cmd.Bool("atomic")),
+	); err != nil {
 		logger.Error("Failed to review changes: %s", err)
 		return fmt.Errorf("failed to review changes: %w", err)
 	}
@@ -665,8 +1095,19 @@ func applyAction(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
+
+	if from := cmd.String("from"); from != "" {
+		return applyPatchFile(ctx, cmd, sessionName, from)
+	}
+
 	// Create pho app with renderer configuration
 	p := pho.NewApp(
+		pho.WithSession(sessionName),
 		pho.WithRenderer(render.NewRenderer(
 			render.WithExtJSONMode(extjsonMode),
 			render.WithShowLineNumbers(cmd.Bool("line-numbers")),
@@ -712,14 +1153,223 @@ func applyAction(ctx context.Context, cmd *cli.Command) error {
 	logger.Success("Connected to database")
 
 	logger.Verbose("Applying changes to MongoDB")
-	if err := p.ApplyChanges(ctx); err != nil {
+	if err := p.ApplyChanges(ctx, getApplyOptions(cmd)...); err != nil {
 		logger.Error("Failed to apply changes: %s", err)
 		return fmt.Errorf("failed to apply changes: %w", err)
 	}
+	if cmd.Bool("dry-run") {
+		logger.Success("Dry run passed, nothing was written")
+		return nil
+	}
 	logger.Success("Changes applied successfully")
 	return nil
 }
 
+// applyPatchFile applies the patch file written by `pho review` in one of the patch formats.
+// Patched documents are looked up in the collection given by --db and --collection,
+// falling back to the collection of the session (the session itself is not needed otherwise).
+func applyPatchFile(ctx context.Context, cmd *cli.Command, sessionName, path string) error {
+	logger := createLogger(cmd)
+
+	// Setup context with signal handling
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	fieldRules, err := getFieldRulesOptions(cmd)
+	if err != nil {
+		logger.Error("%s", err)
+		return err
+	}
+
+	var p *pho.App
+	if cmd.IsSet("db") && cmd.IsSet("collection") {
+		uri := prepareMongoURI(cmd.String("uri"), cmd.String("host"), cmd.String("port"))
+		p = pho.NewApp(append([]pho.Option{
+			pho.WithURI(uri),
+			pho.WithDatabase(cmd.String("db")),
+			pho.WithCollection(cmd.String("collection")),
+		}, fieldRules...)...)
+
+		logger.Verbose("Connecting to MongoDB database")
+		if err := p.ConnectDB(ctx); err != nil {
+			if strings.Contains(err.Error(), "failed to connect to MongoDB") {
+				return formatConnectionError(uri, err)
+			}
+			return err
+		}
+	} else {
+		p = pho.NewApp(append([]pho.Option{pho.WithSession(sessionName)}, fieldRules...)...)
+
+		hasSession, _, err := p.HasActiveSession(ctx)
+		if err != nil && !errors.Is(err, pho.ErrSessionLost) {
+			return fmt.Errorf("failed to check for existing session: %w", err)
+		}
+		if !hasSession {
+			logger.Error("No collection to apply the patch to")
+			return errors.New("no active session found. Give --db and --collection the patch is applied to")
+		}
+
+		logger.Verbose("Connecting to database of the session")
+		if err := p.ConnectDBForApply(ctx); err != nil {
+			return err
+		}
+	}
+	defer p.Close(ctx)
+	logger.Success("Connected to database")
+
+	logger.Verbose("Applying patch file %s", path)
+	if err := p.ApplyPatchFile(ctx, path, getApplyOptions(cmd)...); err != nil {
+		logger.Error("Failed to apply patch: %s", err)
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	if cmd.Bool("dry-run") {
+		logger.Success("Dry run passed, nothing was written")
+		return nil
+	}
+	logger.Success("Patch applied successfully")
+	return nil
+}
+
+// getApplyOptions returns options of applying changes given by apply flags.
+func getApplyOptions(cmd *cli.Command) []pho.ApplyOption {
+	return []pho.ApplyOption{
+		pho.WithForce(cmd.Bool("force")),
+		pho.WithAtomic(cmd.Bool("atomic")),
+		pho.WithBulkThreshold(cmd.Int("bulk-threshold")),
+		pho.WithBatchSize(cmd.Int("batch-size")),
+		pho.WithUnordered(cmd.Bool("unordered")),
+		pho.WithDryRun(cmd.Bool("dry-run")),
+		pho.WithSkipValidation(cmd.Bool("skip-validation")),
+		pho.WithAllowProtectedEdits(cmd.Bool("allow-protected-edits")),
+	}
+}
+
+// undoAction handles reverting the last applied changes.
+func undoAction(ctx context.Context, cmd *cli.Command) error {
+	logger := createLogger(cmd)
+
+	logger.Verbose("Starting undo action")
+
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
+
+	p := pho.NewApp(pho.WithSession(sessionName))
+
+	// Setup context with signal handling
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// Connect to the database the changes were applied to
+	logger.Verbose("Connecting to database for undoing changes")
+	if err := p.ConnectDBForUndo(ctx); err != nil {
+		if errors.Is(err, pho.ErrNoUndo) {
+			logger.Error("No undo data found")
+			return errors.New("no undo data found. Run 'pho apply' first")
+		}
+		logger.Error("Failed to connect to database: %s", err)
+		return err
+	}
+	defer p.Close(ctx)
+	logger.Success("Connected to database")
+
+	logger.Verbose("Reverting applied changes")
+	if err := p.Undo(ctx); err != nil {
+		logger.Error("Failed to undo changes: %s", err)
+		return fmt.Errorf("failed to undo changes: %w", err)
+	}
+	logger.Success("Changes reverted successfully")
+	return nil
+}
+
+// statusAction handles showing the state of the current session.
+func statusAction(ctx context.Context, cmd *cli.Command) error {
+	logger := createLogger(cmd)
+
+	extjsonMode, err := validateAndParseExtJSONMode(cmd)
+	if err != nil {
+		logger.Error("Invalid ExtJSON mode: %s", err)
+		return err
+	}
+	format, err := validateAndParseFormat(cmd)
+	if err != nil {
+		logger.Error("Invalid format: %s", err)
+		return err
+	}
+
+	sessionName, err := getSessionName(cmd)
+	if err != nil {
+		logger.Error("Invalid session name: %s", err)
+		return err
+	}
+
+	p := pho.NewApp(
+		pho.WithSession(sessionName),
+		pho.WithRenderer(render.NewRenderer(
+			render.WithFormat(format),
+			render.WithExtJSONMode(extjsonMode),
+			render.WithShowLineNumbers(cmd.Bool("line-numbers")),
+			render.WithCompactJSON(cmd.Bool("compact")),
+		)),
+	)
+
+	report, err := p.Status(ctx)
+	if err != nil {
+		if errors.Is(err, pho.ErrNoSession) {
+			logger.Error("No active session found")
+			return errors.New("no active session found. Run 'pho query' first to create a session")
+		}
+		logger.Error("Failed to get session status: %s", err)
+		return fmt.Errorf("failed to get session status: %w", err)
+	}
+
+	if cmd.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Fprintf(os.Stdout, "Session:    %s (%s)\n", report.Session, report.Status)
+	fmt.Fprintf(os.Stdout, "Created:    %s (%s ago)\n", report.Created.Format(time.RFC3339), formatDuration(report.Age()))
+	printQueryParams(report.QueryParams)
+	fmt.Fprintf(os.Stdout, "Dump file:  %s\n", report.DumpPath)
+	fmt.Fprintf(os.Stdout, "Documents:  %d\n", report.DocumentCount)
+	switch {
+	case report.Changes != nil:
+		fmt.Fprintf(os.Stdout, "Changes:    %s\n", report.Changes)
+	case report.ChangesError != "":
+		fmt.Fprintf(os.Stdout, "Changes:    unknown (%s)\n", report.ChangesError)
+	}
+
+	if report.Status == pho.SessionStatusLost {
+		logger.Warning("Session data lost. Re-run your query to create a new session")
+	}
+
+	return nil
+}
+
+// printQueryParams prints the query parameters of a session.
+func printQueryParams(params pho.QueryParameters) {
+	fmt.Fprintf(os.Stdout, "Database:   %s\n", params.Database)
+	fmt.Fprintf(os.Stdout, "Collection: %s\n", params.Collection)
+	if params.Pipeline != "" {
+		fmt.Fprintf(os.Stdout, "Pipeline:   %s\n", params.Pipeline)
+	} else {
+		fmt.Fprintf(os.Stdout, "Query:      %s\n", params.Query)
+	}
+	if params.Limit > 0 {
+		fmt.Fprintf(os.Stdout, "Limit:      %d\n", params.Limit)
+	}
+	if params.Sort != "" {
+		fmt.Fprintf(os.Stdout, "Sort:       %s\n", params.Sort)
+	}
+	if params.Projection != "" {
+		fmt.Fprintf(os.Stdout, "Projection: %s\n", params.Projection)
+	}
+}
+
 // getVerbosityLevel determines the verbosity level from CLI flags.
 func getVerbosityLevel(cmd cliCommandInterface) logging.VerbosityLevel {
 	verbose := cmd.Bool("verbose")
@@ -763,6 +1413,22 @@ func parseExtJSONMode(mode string) (render.ExtJSONMode, error) {
 	}
 }
 
+// parseFormat validates and returns the output format.
+func parseFormat(format string) (render.Format, error) {
+	switch format {
+	case "json":
+		return render.Formats.JSON, nil
+	case "yaml":
+		return render.Formats.YAML, nil
+	case "csv":
+		return render.Formats.CSV, nil
+	case "tsv":
+		return render.Formats.TSV, nil
+	default:
+		return render.Formats.JSON, fmt.Errorf("invalid format: %s (valid options: json, yaml, csv, tsv)", format)
+	}
+}
+
 // formatDuration formats a duration in a human-readable way.
 func formatDuration(d time.Duration) string {
 	if d < time.Minute {
@@ -799,6 +1465,21 @@ func prepareMongoURI(uri, host, port string) string {
 	return result
 }
 
+// useColor reports if the output written to the given file can be colorized:
+// it must be a terminal, and colors must not be disabled via NO_COLOR (see https://no-color.org).
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 // formatConnectionError creates a user-friendly error message for connection failures.
 func formatConnectionError(uri string, err error) error {
 	errStr := strings.ToLower(err.Error())
@@ -864,6 +1545,9 @@ func defaultAction(ctx context.Context, cmd *cli.Command) error {
 		fmt.Fprintf(os.Stderr, "  edit     Edit documents from previous query\n")
 		fmt.Fprintf(os.Stderr, "  review   Review changes made to documents\n")
 		fmt.Fprintf(os.Stderr, "  apply    Apply changes to MongoDB\n")
+		fmt.Fprintf(os.Stderr, "  undo     Revert the last applied changes\n")
+		fmt.Fprintf(os.Stderr, "  status   Show the state of the current session\n")
+		fmt.Fprintf(os.Stderr, "  sessions Manage named sessions\n")
 		fmt.Fprintf(os.Stderr, "  config   Manage pho configuration\n")
 		fmt.Fprintf(os.Stderr, "  version  Show version information\n\n")
 		fmt.Fprintf(os.Stderr, "Run 'pho --help' for detailed usage information.\n")
@@ -957,7 +1641,13 @@ func configListAction(ctx context.Context, cmd *cli.Command) error {
 			"database.type",
 		},
 		"Query": {
-			"query.query", "query.limit", "query.sort", "query.projection",
+			"query.query", "query.limit", "query.sort", "query.projection", "query.identify_by",
+		},
+		"Protection": {
+			"protect.fields",
+		},
+		"Masking": {
+			"mask.fields", "mask.pattern",
 		},
 		"Application": {
 			"app.editor", "app.timeout",
@@ -975,6 +1665,8 @@ func configListAction(ctx context.Context, cmd *cli.Command) error {
 		"mongo":       "MongoDB",
 		"database":    "Database",
 		"query":       "Query",
+		"protect":     "Protection",
+		"mask":        "Masking",
 		"app":         "Application",
 		"output":      "Output",
 		"directories": "Directories",
@@ -991,7 +1683,7 @@ func configListAction(ctx context.Context, cmd *cli.Command) error {
 			return nil
 		}
 		fmt.Fprintf(os.Stderr, "Error: Unknown section '%s'\n", sectionName)
-		fmt.Fprintf(os.Stderr, "Available sections: mongo, database, query, app, output, directories\n")
+		fmt.Fprintf(os.Stderr, "Available sections: mongo, database, query, protect, mask, app, output, directories\n")
 		return fmt.Errorf("unknown section: %s", sectionName)
 	}
 
@@ -1020,3 +1712,124 @@ func printConfigSection(cfg *config.Config, category string, categoryKeys []stri
 	}
 	fmt.Fprintf(os.Stdout, "\n")
 }
+
+// sessionsListAction handles the sessions list command.
+func sessionsListAction(ctx context.Context, cmd *cli.Command) error {
+	_ = cmd
+
+	p := pho.NewApp()
+	sessions, err := p.ListSessions(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing sessions: %v\n", err)
+		return err
+	}
+
+	if len(sessions) == 0 {
+		fmt.Fprintf(os.Stdout, "No sessions found\n")
+		return nil
+	}
+
+	slices.SortFunc(sessions, func(a, b *pho.SessionRegistry) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	activeID := p.SessionID()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  NAME\tSTATUS\tAGE\tDOCS\tQUERY\n")
+	for _, s := range sessions {
+		marker := " "
+		if s.ID == activeID {
+			marker = "*"
+		}
+
+		_, sessionStatus, _ := p.GetSession(ctx, s.ID)
+
+		query := s.QueryParams.Query
+		if s.QueryParams.Pipeline != "" {
+			query = s.QueryParams.Pipeline
+		}
+
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%d\t%s.%s %s\n",
+			marker, s.ID, sessionStatus, formatDuration(time.Since(s.Created)), s.DocumentCount,
+			s.QueryParams.Database, s.QueryParams.Collection, query)
+	}
+
+	return w.Flush()
+}
+
+// sessionsSwitchAction handles the sessions switch command.
+func sessionsSwitchAction(ctx context.Context, cmd *cli.Command) error {
+	args := cmd.Args()
+	if args.Len() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: session name is required\n")
+		fmt.Fprintf(os.Stderr, "Usage: pho sessions switch <name>\n")
+		return errors.New("session name is required")
+	}
+
+	name := args.First()
+	if err := pho.NewApp().SwitchSession(ctx, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error switching session: %v\n", err)
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Switched to session %s\n", name)
+	return nil
+}
+
+// sessionsDropAction handles the sessions drop command.
+func sessionsDropAction(ctx context.Context, cmd *cli.Command) error {
+	p := pho.NewApp()
+
+	if cmd.Bool("stale") {
+		if err := p.CleanupStaleSessions(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error dropping stale sessions: %v\n", err)
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "Stale sessions dropped\n")
+		return nil
+	}
+
+	args := cmd.Args()
+	if args.Len() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: session name is required\n")
+		fmt.Fprintf(os.Stderr, "Usage: pho sessions drop <name>\n")
+		return errors.New("session name is required")
+	}
+
+	name := args.First()
+	if err := p.DropSession(ctx, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error dropping session: %v\n", err)
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Dropped session %s\n", name)
+	return nil
+}
+
+// sessionsShowAction handles the sessions show command.
+func sessionsShowAction(ctx context.Context, cmd *cli.Command) error {
+	p := pho.NewApp()
+
+	name := p.SessionID()
+	if cmd.Args().Len() > 0 {
+		name = cmd.Args().First()
+	}
+
+	registry, status, err := p.GetSession(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting session: %v\n", err)
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Session:    %s\n", registry.ID)
+	fmt.Fprintf(os.Stdout, "Status:     %s\n", status)
+	fmt.Fprintf(os.Stdout, "Created:    %s (%s ago)\n",
+		registry.Created.Format(time.RFC3339), formatDuration(time.Since(registry.Created)))
+	printQueryParams(registry.QueryParams)
+	fmt.Fprintf(os.Stdout, "Documents:  %d\n", registry.DocumentCount)
+	fmt.Fprintf(os.Stdout, "Dump file:  %s\n", registry.DumpFile)
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package app_test
 
 import (
+	"os"
+	"path/filepath"
 	"pho/internal/app"
 	"pho/internal/logging"
 	"pho/internal/render"
@@ -18,7 +20,7 @@ func TestNew(t *testing.T) {
 	require.NotNil(t, cmd)
 	assert.Equal(t, "pho", cmd.Name)
 	assert.Equal(t, "MongoDB document editor - query, edit, and apply changes interactively", cmd.Usage)
-	assert.Len(t, cmd.Commands, 6) // version, query, edit, review, apply, config
+	assert.Len(t, cmd.Commands, 9) // version, query, edit, review, apply, undo, status, sessions, config
 }
 
 func TestParseExtJSONMode(t *testing.T) {
@@ -68,6 +70,34 @@ func TestParseExtJSONMode(t *testing.T) {
 	}
 }
 
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		expected    render.Format
+		expectError bool
+	}{
+		{name: "json", format: "json", expected: render.Formats.JSON},
+		{name: "yaml", format: "yaml", expected: render.Formats.YAML},
+		{name: "csv", format: "csv", expected: render.Formats.CSV},
+		{name: "tsv", format: "tsv", expected: render.Formats.TSV},
+		{name: "invalid", format: "xml", expected: render.Formats.JSON, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := app.ParseFormat(tt.format)
+			if tt.expectError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid format")
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -228,9 +258,62 @@ func TestGetConnectionFlags(t *testing.T) {
 	}
 }
 
+func TestGetApplyFlags(t *testing.T) {
+	flags := app.GetApplyFlags()
+	// 5 connection flags + session + force + atomic + 3 bulk flags + 3 check flags + from + 4 field rules flags
+	assert.Len(t, flags, 18)
+
+	flagNames := make([]string, len(flags))
+	for i, flag := range flags {
+		flagNames[i] = flag.Names()[0]
+	}
+
+	expectedFlags := []string{
+		"uri", "host", "port", "db", "collection", "session",
+		"force", "atomic", "bulk-threshold", "batch-size", "unordered",
+		"dry-run", "skip-validation", "allow-protected-edits", "from", "protect", "mask", "mask-pattern",
+	}
+	for _, expected := range expectedFlags {
+		assert.Contains(t, flagNames, expected)
+	}
+}
+
+func TestGetReviewFlags(t *testing.T) {
+	flagNames := make([]string, 0)
+	for _, flag := range app.GetReviewFlags() {
+		flagNames = append(flagNames, flag.Names()[0])
+	}
+
+	assert.Contains(t, flagNames, "undo")
+	assert.Contains(t, flagNames, "session")
+	assert.Contains(t, flagNames, "script")
+	assert.Contains(t, flagNames, "atomic")
+
+	// --format is the review format (dump format is taken from the session)
+	formatFlags := 0
+	for _, name := range flagNames {
+		if name == "format" {
+			formatFlags++
+		}
+	}
+	assert.Equal(t, 1, formatFlags)
+}
+
+func TestUseColor(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Regular files are not terminals
+	assert.False(t, app.UseColor(f))
+
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, app.UseColor(os.Stdout))
+}
+
 func TestGetCommonFlags(t *testing.T) {
 	flags := app.GetCommonFlags()
-	assert.Len(t, flags, 16) // 5 connection flags + 11 query flags
+	assert.Len(t, flags, 24) // 5 connection flags + session + 15 query flags + 3 field rules flags
 
 	flagNames := make([]string, len(flags))
 	for i, flag := range flags {
@@ -238,8 +321,10 @@ func TestGetCommonFlags(t *testing.T) {
 	}
 
 	expectedFlags := []string{
-		"uri", "host", "port", "db", "collection", // connection flags
-		"query", "limit", "sort", "projection", "editor", "edit", "extjson-mode", "compact", "line-numbers", "verbose", "quiet", // query flags
+		"uri", "host", "port", "db", "collection", "session", // connection and session flags
+		"query", "limit", "sort", "projection", "pipeline", "identify-by", "editor", "edit", "dump-dir", // query flags
+		"protect", "mask", "mask-pattern", // field rules flags
+		"format", "extjson-mode", "compact", "line-numbers", "verbose", "quiet", // render and verbosity flags
 	}
 	for _, expected := range expectedFlags {
 		assert.Contains(t, flagNames, expected, "Flag %s should be present", expected)
@@ -282,3 +367,51 @@ func (m *mockCLICommand) Int64(name string) int64 {
 	}
 	return 0
 }
+
+func TestGetSessionFlags(t *testing.T) {
+	flags := app.GetSessionFlags()
+	require.Len(t, flags, 1)
+	assert.Equal(t, "session", flags[0].Names()[0])
+}
+
+func TestGetStatusFlags(t *testing.T) {
+	flagNames := make([]string, 0)
+	for _, flag := range app.GetStatusFlags() {
+		flagNames = append(flagNames, flag.Names()[0])
+	}
+
+	for _, expected := range []string{"session", "json", "extjson-mode", "verbose"} {
+		assert.Contains(t, flagNames, expected)
+	}
+}
+
+func TestResolvePipeline(t *testing.T) {
+	pipelineFile := filepath.Join(t.TempDir(), "pipeline.json")
+	require.NoError(t, os.WriteFile(pipelineFile, []byte("[\n  {\"$match\": {\"active\": true}}\n]\n"), 0600))
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "empty", value: "", expected: ""},
+		{name: "inline", value: ` [{"$match": {}}] `, expected: `[{"$match":{}}]`},
+		{name: "from file", value: pipelineFile, expected: `[{"$match":{"active":true}}]`},
+		{name: "missing file", value: filepath.Join(t.TempDir(), "missing.json"), wantErr: true},
+		{name: "invalid JSON", value: `[{"$match": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := app.ResolvePipeline(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, pipeline)
+		})
+	}
+}
@@ -3,9 +3,16 @@ package app
 var (
 	GetCommonFlags     = getCommonFlags
 	GetConnectionFlags = getConnectionFlags
+	GetApplyFlags      = getApplyFlags
+	GetReviewFlags     = getReviewFlags
+	GetSessionFlags    = getSessionFlags
+	GetStatusFlags     = getStatusFlags
 	GetVerbosityLevel  = getVerbosityLevel
 	CreateLogger       = createLogger
 	ParseExtJSONMode   = parseExtJSONMode
+	ParseFormat        = parseFormat
 	FormatDuration     = formatDuration
 	PrepareMongoURI    = prepareMongoURI
+	ResolvePipeline    = resolvePipeline
+	UseColor           = useColor
 )
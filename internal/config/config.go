@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -24,6 +25,12 @@ type Config struct {
 	Database DatabaseConfig `toml:"database"`
 	Query    QueryConfig    `toml:"query"`
 
+	// Fields that must not be edited
+	Protect ProtectConfig `toml:"protect"`
+
+	// Sensitive fields that are masked in dumps
+	Mask MaskConfig `toml:"mask"`
+
 	// Application settings
 	App AppConfig `toml:"app"`
 
@@ -55,6 +62,18 @@ type QueryConfig struct {
 	Limit      int64  `toml:"limit"`
 	Sort       string `toml:"sort"`
 	Projection string `toml:"projection"`
+	IdentifyBy string `toml:"identify_by"` // field(s) documents are identified by, e.g. "tenant_id,sku"
+}
+
+// ProtectConfig contains settings of fields that must not be edited.
+type ProtectConfig struct {
+	Fields string `toml:"fields"` // dotted paths of protected fields, e.g. "createdAt,audit.by"
+}
+
+// MaskConfig contains settings of sensitive fields whose values never land in dumps.
+type MaskConfig struct {
+	Fields  string `toml:"fields"`  // dotted paths of masked fields, e.g. "password,auth.token"
+	Pattern string `toml:"pattern"` // regex of masked field names, e.g. "(?i)secret|token"
 }
 
 // AppConfig contains application behavior settings.
@@ -65,7 +84,7 @@ type AppConfig struct {
 
 // OutputConfig contains output formatting settings.
 type OutputConfig struct {
-	Format      string `toml:"format"` // "json", "yaml", "csv", etc.
+	Format      string `toml:"format"` // "json", "yaml", "csv" or "tsv"
 	LineNumbers bool   `toml:"line_numbers"`
 	Compact     bool   `toml:"compact"`
 	Verbose     bool   `toml:"verbose"`
@@ -204,6 +223,22 @@ func (c *Config) applyEnvironmentOverrides() {
 	if val := os.Getenv("PHO_PROJECTION"); val != "" {
 		c.Query.Projection = val
 	}
+	if val := os.Getenv("PHO_IDENTIFY_BY"); val != "" {
+		c.Query.IdentifyBy = val
+	}
+
+	// Protected fields
+	if val := os.Getenv("PHO_PROTECT"); val != "" {
+		c.Protect.Fields = val
+	}
+
+	// Masked fields
+	if val := os.Getenv("PHO_MASK"); val != "" {
+		c.Mask.Fields = val
+	}
+	if val := os.Getenv("PHO_MASK_PATTERN"); val != "" {
+		c.Mask.Pattern = val
+	}
 
 	// App settings
 	if val := os.Getenv("PHO_EDITOR"); val != "" {
@@ -289,6 +324,21 @@ func (c *Config) Set(key, value string) error {
 		c.Query.Sort = value
 	case "query.projection":
 		c.Query.Projection = value
+	case "query.identify_by", "query.identify-by":
+		c.Query.IdentifyBy = value
+
+	// Protected fields
+	case "protect.fields":
+		c.Protect.Fields = value
+
+	// Masked fields
+	case "mask.fields":
+		c.Mask.Fields = value
+	case "mask.pattern":
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid mask pattern: %w", err)
+		}
+		c.Mask.Pattern = value
 
 	// App settings
 	case "app.editor":
@@ -303,8 +353,8 @@ func (c *Config) Set(key, value string) error {
 	// Output settings
 	case "output.format":
 		// Accept common format types
-		if value != "json" && value != "yaml" && value != "csv" {
-			return fmt.Errorf("invalid format: %s (valid: json, yaml, csv)", value)
+		if value != "json" && value != "yaml" && value != "csv" && value != "tsv" {
+			return fmt.Errorf("invalid format: %s (valid: json, yaml, csv, tsv)", value)
 		}
 		c.Output.Format = value
 	case "output.line_numbers", "output.line-numbers":
@@ -375,6 +425,18 @@ func (c *Config) Get(key string) (interface{}, error) {
 		return c.Query.Sort, nil
 	case "query.projection":
 		return c.Query.Projection, nil
+	case "query.identify_by", "query.identify-by":
+		return c.Query.IdentifyBy, nil
+
+	// Protected fields
+	case "protect.fields":
+		return c.Protect.Fields, nil
+
+	// Masked fields
+	case "mask.fields":
+		return c.Mask.Fields, nil
+	case "mask.pattern":
+		return c.Mask.Pattern, nil
 
 	// App settings
 	case "app.editor":
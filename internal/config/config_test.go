@@ -52,6 +52,10 @@ func TestConfig_SetAndGet(t *testing.T) {
 		{"database.type", "mongodb", "mongodb"},
 		{"query.query", "{\"test\": 1}", "{\"test\": 1}"},
 		{"query.limit", "5000", int64(5000)},
+		{"query.identify_by", "tenant_id,sku", "tenant_id,sku"},
+		{"protect.fields", "createdAt,audit.by", "createdAt,audit.by"},
+		{"mask.fields", "password,auth.token", "password,auth.token"},
+		{"mask.pattern", "(?i)secret|token", "(?i)secret|token"},
 		{"app.editor", "nano", "nano"},
 		{"app.timeout", "30s", "30s"},
 		{"output.format", "yaml", "yaml"},
@@ -84,6 +88,7 @@ func TestConfig_SetInvalidValues(t *testing.T) {
 		{"output.format", "invalid"},
 		{"database.type", "invalid"},
 		{"output.line_numbers", "not-bool"},
+		{"mask.pattern", "(unclosed"},
 		{"unknown.key", "value"},
 	}
 
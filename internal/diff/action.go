@@ -11,6 +11,7 @@ const (
 	ActionUpdated
 	ActionDeleted
 	ActionAdded
+	ActionRenamed
 )
 
 // String returns the string representation of the Action.
@@ -24,6 +25,8 @@ func (a Action) String() string {
 		return "DELETED"
 	case ActionAdded:
 		return "ADDED"
+	case ActionRenamed:
+		return "RENAMED"
 	default:
 		return fmt.Sprintf("Action(%d)", uint8(a))
 	}
@@ -31,7 +34,7 @@ func (a Action) String() string {
 
 // IsValid returns true if the Action value is valid.
 func (a Action) IsValid() bool {
-	return a <= ActionAdded
+	return a <= ActionRenamed
 }
 
 // IsEffective returns true if the Action represents an actual change.
@@ -49,7 +52,7 @@ func (a *Action) UnmarshalText(text []byte) error {
 	input := string(text)
 
 	// Try each action by comparing with its String() representation
-	for candidate := ActionNoop; candidate <= ActionAdded; candidate++ {
+	for candidate := ActionNoop; candidate <= ActionRenamed; candidate++ {
 		if input == candidate.String() {
 			*a = candidate
 			return nil
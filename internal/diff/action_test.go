@@ -36,6 +36,11 @@ func TestAction_String(t *testing.T) {
 			action:   diff.ActionAdded,
 			expected: "ADDED",
 		},
+		{
+			name:     "diff.ActionRenamed",
+			action:   diff.ActionRenamed,
+			expected: "RENAMED",
+		},
 		{
 			name:     "Invalid action",
 			action:   diff.Action(99),
@@ -77,6 +82,11 @@ func TestAction_IsValid(t *testing.T) {
 			action:   diff.ActionAdded,
 			expected: true,
 		},
+		{
+			name:     "diff.ActionRenamed is valid",
+			action:   diff.ActionRenamed,
+			expected: true,
+		},
 		{
 			name:     "Invalid high value",
 			action:   diff.Action(99),
@@ -327,4 +337,5 @@ func TestAction_EnumValues(t *testing.T) {
 	assert.Equal(t, diff.ActionUpdated, diff.Action(1))
 	assert.Equal(t, diff.ActionDeleted, diff.Action(2))
 	assert.Equal(t, diff.ActionAdded, diff.Action(3))
+	assert.Equal(t, diff.ActionRenamed, diff.Action(4))
 }
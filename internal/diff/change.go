@@ -1,27 +1,47 @@
 package diff
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"pho/internal/hashing"
+	"slices"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// ErrDuplicateIdentifier is the error of documents sharing the same identifier: changes of one of them
+// could be written to another (e.g. when documents are identified by non-unique fields).
+var ErrDuplicateIdentifier = errors.New("documents share the same identifier")
+
 // Change holds information about one document change
-// It stores data enough to perform the change
-// Note: we do not need original document state (as we perform only FullUpdates only).
+// It stores data enough to perform the change.
 type Change struct {
 	// Action that was applied
 	Action Action
 
-	// Data is the data changed (for Action=Updated/Added)
-	Data bson.M
+	// Data is the data changed (for Action=Updated/Added/Renamed)
+	Data bson.D
+
+	// Original is the document state at the moment of dump (if known)
+	// For Action=Renamed it's the document under its previous identifier
+	Original bson.D
+
+	// FieldChanges are per-path changes between Original and Data (for Action=Updated)
+	// When empty, the update replaces the whole document with Data
+	FieldChanges FieldChanges
 
 	IdentifiedBy    string
 	IdentifierValue any
+
+	// RenamedFrom is the previous identifier value of the document (for Action=Renamed)
+	RenamedFrom any
+
+	// ProtectedEdits are changes of protected fields (see WithProtected), they make the change not applicable
+	ProtectedEdits FieldChanges
 }
 
-func NewChange(identifiedBy string, identifierValue any, action Action, data ...bson.M) *Change {
+func NewChange(identifiedBy string, identifierValue any, action Action, data ...bson.D) *Change {
 	change := &Change{IdentifiedBy: identifiedBy, IdentifierValue: identifierValue, Action: action}
 	if len(data) > 0 {
 		change.Data = data[0]
@@ -36,6 +56,52 @@ func (ch *Change) IsEffective() bool {
 	return ch.Action.IsEffective()
 }
 
+// Identifier returns the full identifier of the changed document (e.g. `_id::1`),
+// the same one that is used as a key of hashed lines.
+func (ch *Change) Identifier() string {
+	return ch.identifierOf(ch.IdentifierValue)
+}
+
+// RenamedFromIdentifier returns the full identifier the renamed document had at the moment of dump.
+func (ch *Change) RenamedFromIdentifier() string {
+	return ch.identifierOf(ch.RenamedFrom)
+}
+
+func (ch *Change) identifierOf(value any) string {
+	identifierValue := &hashing.IdentifierValue{Value: value}
+	return ch.IdentifiedBy + hashing.IdentifierSeparator + identifierValue.String()
+}
+
+// IsComposite tells whether the document is identified by several fields.
+func (ch *Change) IsComposite() bool {
+	return len(hashing.IdentityFields(ch.IdentifiedBy)) > 1
+}
+
+// Filter returns the filter matching the changed document by its identity.
+// Documents with a composite identity (e.g. `tenant_id,sku`) are matched by each of its fields.
+func (ch *Change) Filter() bson.M {
+	return ch.filterOf(ch.IdentifierValue)
+}
+
+// RenamedFromFilter returns the filter matching the renamed document by its previous identity.
+func (ch *Change) RenamedFromFilter() bson.M {
+	return ch.filterOf(ch.RenamedFrom)
+}
+
+func (ch *Change) filterOf(value any) bson.M {
+	composite, ok := value.(bson.D)
+	if !ch.IsComposite() || !ok {
+		return bson.M{ch.IdentifiedBy: value}
+	}
+
+	filter := make(bson.M, len(composite))
+	for _, e := range composite {
+		filter[e.Key] = e.Value
+	}
+
+	return filter
+}
+
 func (chs Changes) Len() int { return len(chs) }
 
 // Filter returns a filtered list of changes (by a given filter func).
@@ -64,20 +130,32 @@ func (chs Changes) EffectiveOnes() Changes {
 
 // CalculateChanges calculates changes that represent difference between
 // given `source` hashed lines and `destination` list of current versions of documents.
-func CalculateChanges(source map[string]*hashing.HashData, destination []bson.M) (Changes, error) {
+// When original documents are given (via WithOriginals), updates are calculated per field
+// and documents whose identifier was edited are detected as renamed (instead of deleted+added).
+// Edits of protected fields (see WithProtected) are flagged on changes of documents with known originals.
+func CalculateChanges(
+	source map[string]*hashing.HashData,
+	destination []bson.D,
+	opts ...Option,
+) (Changes, error) {
+	cfg := newOptions(opts...)
+
 	n := len(destination)
 	changes := make(Changes, 0, n+len(source)) // Pre-allocate with capacity for worst case
 
 	// hashmap for documents that were processed
 	idsLUT := make(map[string]struct{})
 	for i, doc := range destination {
-		hashData, err := hashing.Hash(doc)
+		hashData, err := hashing.Hash(doc, cfg.identifyBy...)
 		if err != nil {
 			return nil, fmt.Errorf("corrupted obj[%d] could not hash: %w", i, err)
 		}
 
 		// Using full _id::1 identifier as a LUT key
 		id := hashData.GetIdentifier()
+		if _, ok := idsLUT[id]; ok {
+			return nil, fmt.Errorf("obj[%d] %s: %w", i, id, ErrDuplicateIdentifier)
+		}
 		idsLUT[id] = struct{}{}
 
 		identifiedBy, identifierValue := hashData.GetIdentifierParts()
@@ -97,17 +175,28 @@ func CalculateChanges(source map[string]*hashing.HashData, destination []bson.M)
 		}
 
 		// Otherwise it was an update:
-		changes = append(changes, NewChange(identifiedBy, identifierValue, ActionUpdated, doc))
+		change := NewChange(identifiedBy, identifierValue, ActionUpdated, doc)
+		if original, ok := cfg.originals[id]; ok {
+			change.Original = original
+
+			// Documents with keys that can't be used in dot notation are replaced as a whole
+			if isPathSafe(original) && isPathSafe(doc) {
+				change.FieldChanges = CompareDocuments(original, doc)
+			}
+		}
+		changes = append(changes, change)
 	}
 
 	// To get delete changes we have to do the other way round:
 	// Source => Destination
-	// Note: order of deletion documents will not be respected
-	for sourceDocIdentifier, hashData := range source {
+	// Note: order of deletion documents will not be respected (they are sorted by identifiers)
+	for _, sourceDocIdentifier := range slices.Sorted(maps.Keys(source)) {
 		if _, ok := idsLUT[sourceDocIdentifier]; ok {
 			continue
 		}
 
+		hashData := source[sourceDocIdentifier]
+
 		// Skip if hashData is nil or malformed
 		if hashData == nil {
 			continue
@@ -117,8 +206,13 @@ func CalculateChanges(source map[string]*hashing.HashData, destination []bson.M)
 		// or take it again from hashData
 		identifiedBy, identifierValue := hashData.GetIdentifierParts()
 
-		changes = append(changes, NewChange(identifiedBy, identifierValue, ActionDeleted))
+		change := NewChange(identifiedBy, identifierValue, ActionDeleted)
+		change.Original = cfg.originals[sourceDocIdentifier]
+		changes = append(changes, change)
 	}
 
+	changes = detectRenames(changes)
+	FlagProtectedEdits(changes, cfg.protected)
+
 	return changes, nil
 }
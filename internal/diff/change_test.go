@@ -17,7 +17,7 @@ func TestNewChange(t *testing.T) {
 		identifiedBy    string
 		identifierValue any
 		action          diff.Action
-		data            []bson.M
+		data            []bson.D
 		expectData      bool
 	}{
 		{
@@ -33,7 +33,7 @@ func TestNewChange(t *testing.T) {
 			identifiedBy:    "_id",
 			identifierValue: "test-2",
 			action:          diff.ActionUpdated,
-			data:            []bson.M{{"name": "updated"}},
+			data:            []bson.D{{{Key: "name", Value: "updated"}}},
 			expectData:      true,
 		},
 		{
@@ -41,7 +41,7 @@ func TestNewChange(t *testing.T) {
 			identifiedBy:    "_id",
 			identifierValue: "test-3",
 			action:          diff.ActionAdded,
-			data:            []bson.M{{"name": "first"}, {"name": "second"}},
+			data:            []bson.D{{{Key: "name", Value: "first"}}, {{Key: "name", Value: "second"}}},
 			expectData:      true,
 		},
 	}
@@ -177,10 +177,10 @@ func TestChanges_EffectiveOnes(t *testing.T) {
 
 func TestCalculateChanges(t *testing.T) {
 	// Create test documents
-	doc1 := bson.M{"_id": "doc1", "name": "Document 1", "value": 100}
-	doc2 := bson.M{"_id": "doc2", "name": "Document 2", "value": 200}
-	doc3 := bson.M{"_id": "doc3", "name": "Document 3 Modified", "value": 300}
-	doc4 := bson.M{"_id": "doc4", "name": "Document 4 New", "value": 400}
+	doc1 := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1"}, {Key: "value", Value: 100}}
+	doc2 := bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "Document 2"}, {Key: "value", Value: 200}}
+	doc3 := bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "Document 3 Modified"}, {Key: "value", Value: 300}}
+	doc4 := bson.D{{Key: "_id", Value: "doc4"}, {Key: "name", Value: "Document 4 New"}, {Key: "value", Value: 400}}
 
 	// Create source hashes (simulating original state)
 	source := make(map[string]*hashing.HashData)
@@ -188,9 +188,13 @@ func TestCalculateChanges(t *testing.T) {
 	// doc1 and doc2 unchanged, doc3 will be modified, doc5 will be deleted
 	hash1, _ := hashing.Hash(doc1)
 	hash2, _ := hashing.Hash(doc2)
-	originalDoc3 := bson.M{"_id": "doc3", "name": "Document 3", "value": 300}
+	originalDoc3 := bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "Document 3"}, {Key: "value", Value: 300}}
 	hash3, _ := hashing.Hash(originalDoc3)
-	deletedDoc := bson.M{"_id": "doc5", "name": "Document 5 Deleted", "value": 500}
+	deletedDoc := bson.D{
+		{Key: "_id", Value: "doc5"},
+		{Key: "name", Value: "Document 5 Deleted"},
+		{Key: "value", Value: 500},
+	}
 	hash5, _ := hashing.Hash(deletedDoc)
 
 	source[hash1.GetIdentifier()] = hash1
@@ -199,7 +203,7 @@ func TestCalculateChanges(t *testing.T) {
 	source[hash5.GetIdentifier()] = hash5
 
 	// Current destination (after editing)
-	destination := []bson.M{doc1, doc2, doc3, doc4}
+	destination := []bson.D{doc1, doc2, doc3, doc4}
 
 	changes, err := diff.CalculateChanges(source, destination)
 	require.NoError(t, err)
@@ -227,9 +231,9 @@ func TestCalculateChanges(t *testing.T) {
 func TestCalculateChanges_EmptySource(t *testing.T) {
 	// All documents are new
 	source := make(map[string]*hashing.HashData)
-	destination := []bson.M{
-		{"_id": "new1", "name": "New Document 1"},
-		{"_id": "new2", "name": "New Document 2"},
+	destination := []bson.D{
+		{{Key: "_id", Value: "new1"}, {Key: "name", Value: "New Document 1"}},
+		{{Key: "_id", Value: "new2"}, {Key: "name", Value: "New Document 2"}},
 	}
 
 	changes, err := diff.CalculateChanges(source, destination)
@@ -243,8 +247,8 @@ func TestCalculateChanges_EmptySource(t *testing.T) {
 
 func TestCalculateChanges_EmptyDestination(t *testing.T) {
 	// All documents are deleted
-	doc1 := bson.M{"_id": "deleted1", "name": "Deleted Document 1"}
-	doc2 := bson.M{"_id": "deleted2", "name": "Deleted Document 2"}
+	doc1 := bson.D{{Key: "_id", Value: "deleted1"}, {Key: "name", Value: "Deleted Document 1"}}
+	doc2 := bson.D{{Key: "_id", Value: "deleted2"}, {Key: "name", Value: "Deleted Document 2"}}
 
 	source := make(map[string]*hashing.HashData)
 	hash1, _ := hashing.Hash(doc1)
@@ -252,7 +256,7 @@ func TestCalculateChanges_EmptyDestination(t *testing.T) {
 	source[hash1.GetIdentifier()] = hash1
 	source[hash2.GetIdentifier()] = hash2
 
-	destination := []bson.M{}
+	destination := []bson.D{}
 
 	changes, err := diff.CalculateChanges(source, destination)
 	require.NoError(t, err)
@@ -266,8 +270,8 @@ func TestCalculateChanges_EmptyDestination(t *testing.T) {
 func TestCalculateChanges_InvalidDocument(t *testing.T) {
 	// Document without _id should cause error
 	source := make(map[string]*hashing.HashData)
-	destination := []bson.M{
-		{"name": "Document without ID"},
+	destination := []bson.D{
+		{{Key: "name", Value: "Document without ID"}},
 	}
 
 	_, err := diff.CalculateChanges(source, destination)
@@ -279,15 +283,15 @@ func TestCalculateChanges_ObjectIDSupport(t *testing.T) {
 	oid1 := primitive.NewObjectID()
 	oid2 := primitive.NewObjectID()
 
-	doc1 := bson.M{"_id": oid1, "name": "Document with ObjectID 1"}
-	doc2 := bson.M{"_id": oid2, "name": "Document with ObjectID 2"}
+	doc1 := bson.D{{Key: "_id", Value: oid1}, {Key: "name", Value: "Document with ObjectID 1"}}
+	doc2 := bson.D{{Key: "_id", Value: oid2}, {Key: "name", Value: "Document with ObjectID 2"}}
 
 	source := make(map[string]*hashing.HashData)
 	hash1, _ := hashing.Hash(doc1)
 	source[hash1.GetIdentifier()] = hash1
 
 	// doc2 is new
-	destination := []bson.M{doc1, doc2}
+	destination := []bson.D{doc1, doc2}
 
 	changes, err := diff.CalculateChanges(source, destination)
 	require.NoError(t, err)
@@ -298,3 +302,108 @@ func TestCalculateChanges_ObjectIDSupport(t *testing.T) {
 	assert.Len(t, effective, 1)
 	assert.Equal(t, diff.ActionAdded, effective[0].Action)
 }
+
+func TestCalculateChanges_WithOriginals(t *testing.T) {
+	original := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Document 1"},
+		{Key: "obsolete", Value: true},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+	}
+	deleted := bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "Document 2"}}
+
+	source := make(map[string]*hashing.HashData)
+	originals := make(map[string]bson.D)
+	for _, doc := range []bson.D{original, deleted} {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		source[hashData.GetIdentifier()] = hashData
+		originals[hashData.GetIdentifier()] = doc
+	}
+
+	edited := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Document 1"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}}},
+	}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{edited}, diff.WithOriginals(originals))
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	updated := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updated, 1)
+	assert.Equal(t, original, updated[0].Original)
+	assert.Equal(t, []string{"address.city", "obsolete"}, updated[0].FieldChanges.Paths())
+
+	deletedChanges := changes.FilterByAction(diff.ActionDeleted)
+	require.Len(t, deletedChanges, 1)
+	assert.Equal(t, deleted, deletedChanges[0].Original)
+}
+
+func TestCalculateChanges_WithoutOriginals(t *testing.T) {
+	original := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1"}}
+	hashData, err := hashing.Hash(original)
+	require.NoError(t, err)
+
+	source := map[string]*hashing.HashData{hashData.GetIdentifier(): hashData}
+	edited := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1 Modified"}}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{edited})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	// Without originals the update is a full document update
+	assert.Equal(t, diff.ActionUpdated, changes[0].Action)
+	assert.Nil(t, changes[0].Original)
+	assert.Empty(t, changes[0].FieldChanges)
+}
+
+func TestCalculateChanges_WithIdentifyBy(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: int32(10)}},
+		{{Key: "tenant_id", Value: "globex"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: int32(20)}},
+	}
+	identifyBy := []string{"tenant_id", "sku"}
+
+	source := make(map[string]*hashing.HashData)
+	for _, doc := range docs {
+		hashData, err := hashing.Hash(doc, identifyBy...)
+		require.NoError(t, err)
+		source[hashData.GetIdentifier()] = hashData
+	}
+
+	// Same sku of another tenant is a different document
+	edited := bson.D{
+		{Key: "tenant_id", Value: "globex"},
+		{Key: "sku", Value: "SKU-1"},
+		{Key: "price", Value: int32(25)},
+	}
+	changes, err := diff.CalculateChanges(source, []bson.D{docs[0], edited}, diff.WithIdentifyBy(identifyBy))
+	require.NoError(t, err)
+
+	updated := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updated, 1)
+	assert.Equal(t, "tenant_id,sku", updated[0].IdentifiedBy)
+	assert.True(t, updated[0].IsComposite())
+	assert.Equal(t, bson.M{"tenant_id": "globex", "sku": "SKU-1"}, updated[0].Filter())
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	// Documents missing any of identity fields can't be identified
+	_, err = diff.CalculateChanges(source, []bson.D{{{Key: "sku", Value: "SKU-2"}}}, diff.WithIdentifyBy(identifyBy))
+	assert.Error(t, err)
+
+	// Changes of documents sharing an identifier could be written to each other
+	_, err = diff.CalculateChanges(source, []bson.D{docs[0], edited}, diff.WithIdentifyBy([]string{"sku"}))
+	assert.ErrorIs(t, err, diff.ErrDuplicateIdentifier)
+}
+
+func TestChange_Filter(t *testing.T) {
+	assert.Equal(t, bson.M{"_id": "doc1"}, diff.NewChange("_id", "doc1", diff.ActionDeleted).Filter())
+
+	// Embedded document _id is a single value, not a composite identity
+	embedded := bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}}
+	change := diff.NewChange("_id", embedded, diff.ActionDeleted)
+	assert.False(t, change.IsComposite())
+	assert.Equal(t, bson.M{"_id": embedded}, change.Filter())
+}
@@ -0,0 +1,231 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"pho/pkg/extjson"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PathSeparator separates nested field names in a field path (MongoDB dot notation).
+const PathSeparator = "."
+
+// FieldAction represents the type of change applied to a single field of a document.
+type FieldAction uint8
+
+const (
+	FieldAdded FieldAction = iota
+	FieldModified
+	FieldRemoved
+)
+
+// String returns the string representation of the FieldAction.
+func (a FieldAction) String() string {
+	switch a {
+	case FieldAdded:
+		return "ADDED"
+	case FieldModified:
+		return "MODIFIED"
+	case FieldRemoved:
+		return "REMOVED"
+	default:
+		return fmt.Sprintf("FieldAction(%d)", uint8(a))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler for JSON/YAML serialization.
+func (a FieldAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for JSON/YAML deserialization.
+func (a *FieldAction) UnmarshalText(text []byte) error {
+	input := string(text)
+
+	for candidate := FieldAdded; candidate <= FieldRemoved; candidate++ {
+		if input == candidate.String() {
+			*a = candidate
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid field action: %s", input)
+}
+
+// FieldChange holds information about a change of one field (by its dotted path).
+type FieldChange struct {
+	// Path is a dotted path to the field, e.g. `address.city`
+	Path string
+
+	// Action that was applied to the field
+	Action FieldAction
+
+	// Before is the original value (for Action=Modified/Removed)
+	Before any
+
+	// After is the new value (for Action=Added/Modified)
+	After any
+}
+
+type FieldChanges []*FieldChange
+
+func (fcs FieldChanges) Len() int { return len(fcs) }
+
+// Paths returns the list of changed paths.
+func (fcs FieldChanges) Paths() []string {
+	paths := make([]string, 0, len(fcs))
+	for _, fc := range fcs {
+		paths = append(paths, fc.Path)
+	}
+	return paths
+}
+
+// CompareDocuments calculates per-path changes that turn `before` document into `after` one.
+// Nested documents are compared recursively, so changes inside them are reported via dotted paths.
+// Arrays (and any other values) are compared as a whole.
+// Fields holding MaskPlaceholder keep their original values, so they are never changed.
+// Resulting changes are sorted by path, so the output is stable.
+func CompareDocuments(before, after bson.D) FieldChanges {
+	var changes FieldChanges
+	compareDocuments("", before, after, &changes)
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes
+}
+
+func compareDocuments(prefix string, before, after bson.D, changes *FieldChanges) {
+	for _, e := range before {
+		path := prefix + e.Key
+
+		afterValue, ok := lookup(after, e.Key)
+		if ok && IsMaskPlaceholder(afterValue) {
+			// Masked field keeps its original value
+			continue
+		}
+		if !ok {
+			*changes = append(*changes, &FieldChange{Path: path, Action: FieldRemoved, Before: e.Value})
+			continue
+		}
+
+		beforeDoc, beforeIsDoc := asDocument(e.Value)
+		afterDoc, afterIsDoc := asDocument(afterValue)
+		if beforeIsDoc && afterIsDoc && isPathSafe(beforeDoc) && isPathSafe(afterDoc) {
+			compareDocuments(path+PathSeparator, beforeDoc, afterDoc, changes)
+			continue
+		}
+
+		if !ValuesEqual(e.Value, afterValue) {
+			*changes = append(*changes, &FieldChange{
+				Path:   path,
+				Action: FieldModified,
+				Before: e.Value,
+				After:  afterValue,
+			})
+		}
+	}
+
+	for _, e := range after {
+		if _, ok := lookup(before, e.Key); ok || IsMaskPlaceholder(e.Value) {
+			continue
+		}
+
+		*changes = append(*changes, &FieldChange{Path: prefix + e.Key, Action: FieldAdded, After: e.Value})
+	}
+}
+
+// LookupPath returns the value under the given dotted path of the document.
+func LookupPath(doc bson.D, path string) (any, bool) {
+	keys := strings.Split(path, PathSeparator)
+
+	current := doc
+	for i, key := range keys {
+		value, ok := lookup(current, key)
+		if !ok {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return value, true
+		}
+
+		if current, ok = asDocument(value); !ok {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// lookup returns the value of the top-level field of the document.
+func lookup(doc bson.D, key string) (any, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// asDocument returns given value as bson.D if it's an embedded document.
+// Maps are turned into documents with sorted keys.
+func asDocument(v any) (bson.D, bool) {
+	switch t := v.(type) {
+	case bson.D:
+		return t, true
+	case bson.M:
+		return sortedDocument(t), true
+	case map[string]any:
+		return sortedDocument(t), true
+	}
+
+	// Named map types (e.g. decoded nested documents keep the type of the parent one)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	m := make(map[string]any, rv.Len())
+	for _, key := range rv.MapKeys() {
+		m[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return sortedDocument(m), true
+}
+
+// sortedDocument returns the map as a document with sorted keys.
+func sortedDocument(m map[string]any) bson.D {
+	doc := make(bson.D, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		doc = append(doc, bson.E{Key: key, Value: m[key]})
+	}
+	return doc
+}
+
+// isPathSafe reports if all keys of the document can be addressed via dot notation.
+// Keys containing dots or starting with `$` can't, so such documents are compared as a whole.
+func isPathSafe(doc bson.D) bool {
+	for _, e := range doc {
+		if key := e.Key; key == "" || strings.Contains(key, PathSeparator) || strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// ValuesEqual reports if two BSON values are equal (both by type and by value).
+// Comparison is done via stable canonical ExtJSON representation (so the order of fields doesn't matter).
+func ValuesEqual(a, b any) bool {
+	marshaller := extjson.NewCanonicalMarshaller().WithSortedKeys(true)
+	aBytes, aErr := marshaller.Marshal(bson.D{{Key: "v", Value: a}})
+	bBytes, bErr := marshaller.Marshal(bson.D{{Key: "v", Value: b}})
+	if aErr != nil || bErr != nil {
+		return false
+	}
+
+	return bytes.Equal(aBytes, bBytes)
+}
@@ -0,0 +1,185 @@
+package diff_test
+
+import (
+	"pho/internal/diff"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFieldAction_String(t *testing.T) {
+	assert.Equal(t, "ADDED", diff.FieldAdded.String())
+	assert.Equal(t, "MODIFIED", diff.FieldModified.String())
+	assert.Equal(t, "REMOVED", diff.FieldRemoved.String())
+	assert.Equal(t, "FieldAction(42)", diff.FieldAction(42).String())
+}
+
+func TestFieldAction_TextRoundTrip(t *testing.T) {
+	for _, action := range []diff.FieldAction{diff.FieldAdded, diff.FieldModified, diff.FieldRemoved} {
+		text, err := action.MarshalText()
+		require.NoError(t, err)
+
+		var parsed diff.FieldAction
+		require.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, action, parsed)
+	}
+
+	var invalid diff.FieldAction
+	assert.Error(t, invalid.UnmarshalText([]byte("RENAMED")))
+}
+
+func TestCompareDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   bson.D
+		after    bson.D
+		expected []diff.FieldChange
+	}{
+		{
+			name: "identical documents",
+			before: bson.D{
+				{Key: "_id", Value: "1"},
+				{Key: "name", Value: "a"},
+				{Key: "nested", Value: bson.D{{Key: "x", Value: int32(1)}}},
+			},
+			after: bson.D{
+				{Key: "_id", Value: "1"},
+				{Key: "name", Value: "a"},
+				{Key: "nested", Value: bson.D{{Key: "x", Value: int32(1)}}},
+			},
+			expected: nil,
+		},
+		{
+			name:   "top-level modified, added and removed",
+			before: bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "a"}, {Key: "obsolete", Value: true}},
+			after:  bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "b"}, {Key: "fresh", Value: int32(5)}},
+			expected: []diff.FieldChange{
+				{Path: "fresh", Action: diff.FieldAdded, After: int32(5)},
+				{Path: "name", Action: diff.FieldModified, Before: "a", After: "b"},
+				{Path: "obsolete", Action: diff.FieldRemoved, Before: true},
+			},
+		},
+		{
+			name: "nested changes use dotted paths",
+			before: bson.D{
+				{Key: "_id", Value: "1"},
+				{Key: "address", Value: bson.D{
+					{Key: "city", Value: "Kyiv"},
+					{Key: "zip", Value: "01001"},
+					{Key: "geo", Value: bson.D{{Key: "lat", Value: 1.5}}},
+				}},
+			},
+			after: bson.D{
+				{Key: "_id", Value: "1"},
+				{Key: "address", Value: bson.D{
+					{Key: "city", Value: "Lviv"},
+					{Key: "geo", Value: bson.D{{Key: "lat", Value: 1.5}, {Key: "lng", Value: 2.5}}},
+				}},
+			},
+			expected: []diff.FieldChange{
+				{Path: "address.city", Action: diff.FieldModified, Before: "Kyiv", After: "Lviv"},
+				{Path: "address.geo.lng", Action: diff.FieldAdded, After: 2.5},
+				{Path: "address.zip", Action: diff.FieldRemoved, Before: "01001"},
+			},
+		},
+		{
+			name:   "arrays are compared as a whole",
+			before: bson.D{{Key: "_id", Value: "1"}, {Key: "tags", Value: bson.A{"a", "b"}}},
+			after:  bson.D{{Key: "_id", Value: "1"}, {Key: "tags", Value: bson.A{"a", "c"}}},
+			expected: []diff.FieldChange{
+				{Path: "tags", Action: diff.FieldModified, Before: bson.A{"a", "b"}, After: bson.A{"a", "c"}},
+			},
+		},
+		{
+			name:   "type change is a modification",
+			before: bson.D{{Key: "_id", Value: "1"}, {Key: "count", Value: int32(1)}},
+			after:  bson.D{{Key: "_id", Value: "1"}, {Key: "count", Value: int64(1)}},
+			expected: []diff.FieldChange{
+				{Path: "count", Action: diff.FieldModified, Before: int32(1), After: int64(1)},
+			},
+		},
+		{
+			name:   "document replaced with scalar",
+			before: bson.D{{Key: "_id", Value: "1"}, {Key: "meta", Value: bson.D{{Key: "a", Value: "b"}}}},
+			after:  bson.D{{Key: "_id", Value: "1"}, {Key: "meta", Value: "none"}},
+			expected: []diff.FieldChange{
+				{Path: "meta", Action: diff.FieldModified, Before: bson.D{{Key: "a", Value: "b"}}, After: "none"},
+			},
+		},
+		{
+			name:   "nested document with dotted keys is compared as a whole",
+			before: bson.D{{Key: "_id", Value: "1"}, {Key: "meta", Value: bson.D{{Key: "a.b", Value: "c"}}}},
+			after:  bson.D{{Key: "_id", Value: "1"}, {Key: "meta", Value: bson.D{{Key: "a.b", Value: "d"}}}},
+			expected: []diff.FieldChange{
+				{Path: "meta", Action: diff.FieldModified, Before: bson.D{
+					{Key: "a.b", Value: "c"},
+				}, After: bson.D{{Key: "a.b", Value: "d"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diff.CompareDocuments(tt.before, tt.after)
+
+			require.Len(t, changes, len(tt.expected))
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected, *changes[i])
+			}
+		})
+	}
+}
+
+func TestFieldChanges_Paths(t *testing.T) {
+	changes := diff.CompareDocuments(
+		bson.D{{Key: "a", Value: 1}, {Key: "b", Value: bson.D{{Key: "c", Value: 1}}}},
+		bson.D{{Key: "a", Value: 2}, {Key: "b", Value: bson.D{{Key: "c", Value: 2}}}},
+	)
+
+	assert.Equal(t, 2, changes.Len())
+	assert.Equal(t, []string{"a", "b.c"}, changes.Paths())
+}
+
+func TestValuesEqual(t *testing.T) {
+	assert.True(t, diff.ValuesEqual("a", "a"))
+	assert.True(t, diff.ValuesEqual(bson.A{"a", int32(1)}, []any{"a", int32(1)}))
+	assert.True(t, diff.ValuesEqual(bson.D{
+		{Key: "x", Value: 1},
+		{Key: "y", Value: 2},
+	}, bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 1}}))
+	assert.False(t, diff.ValuesEqual(int32(1), int64(1)))
+	assert.False(t, diff.ValuesEqual("a", nil))
+}
+
+func TestLookupPath(t *testing.T) {
+	doc := bson.D{
+		{Key: "name", Value: "test"},
+		{Key: "address", Value: bson.D{
+			{Key: "city", Value: "Kyiv"},
+			{Key: "geo", Value: bson.D{{Key: "lat", Value: 50.45}}},
+		}},
+	}
+
+	tests := []struct {
+		path          string
+		expected      any
+		expectedFound bool
+	}{
+		{path: "name", expected: "test", expectedFound: true},
+		{path: "address.city", expected: "Kyiv", expectedFound: true},
+		{path: "address.geo.lat", expected: 50.45, expectedFound: true},
+		{path: "address.zip", expectedFound: false},
+		{path: "name.first", expectedFound: false},
+		{path: "missing", expectedFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			value, found := diff.LookupPath(doc, tt.path)
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package diff
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// MaskPlaceholder replaces values of masked (sensitive) fields in dumps.
+// It stands for "keep the original value": fields holding it are never changed by the calculated changes.
+const MaskPlaceholder = "<pho:masked>"
+
+// IsMaskPlaceholder reports whether the value is the placeholder of a masked field.
+func IsMaskPlaceholder(v any) bool {
+	s, ok := v.(string)
+	return ok && s == MaskPlaceholder
+}
+
+// HasMaskPlaceholder reports whether the value is the placeholder or contains it (in documents and arrays).
+// Changes writing such values as a whole (e.g. inserts of renamed documents) need masked values filled in first.
+func HasMaskPlaceholder(v any) bool {
+	if IsMaskPlaceholder(v) {
+		return true
+	}
+
+	if doc, ok := asDocument(v); ok {
+		for _, e := range doc {
+			if HasMaskPlaceholder(e.Value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if arr, ok := v.(bson.A); ok {
+		for _, item := range arr {
+			if HasMaskPlaceholder(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package diff_test
+
+import (
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCompareDocuments_MaskPlaceholder(t *testing.T) {
+	before := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Document 1"},
+		{Key: "password", Value: "hash"},
+		{Key: "auth", Value: bson.D{{Key: "token", Value: "secret"}}},
+	}
+	after := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Renamed"},
+		{Key: "password", Value: diff.MaskPlaceholder},
+		{Key: "auth", Value: bson.D{{Key: "token", Value: diff.MaskPlaceholder}}},
+		{Key: "apiKey", Value: diff.MaskPlaceholder},
+	}
+
+	// Placeholders keep original values, so only the name is changed
+	changes := diff.CompareDocuments(before, after)
+	assert.Equal(t, []string{"name"}, changes.Paths())
+
+	// Removing a masked field is an explicit edit
+	changes = diff.CompareDocuments(after, before[:2])
+	assert.Equal(t, []string{"apiKey", "auth", "name", "password"}, changes.Paths())
+}
+
+func TestCalculateChanges_MaskPlaceholder(t *testing.T) {
+	original := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1"}, {Key: "token", Value: "t1"}}
+	hashData, err := hashing.Hash(original)
+	require.NoError(t, err)
+
+	edited := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Renamed"},
+		{Key: "token", Value: diff.MaskPlaceholder},
+	}
+	changes, err := diff.CalculateChanges(
+		map[string]*hashing.HashData{hashData.GetIdentifier(): hashData},
+		[]bson.D{edited},
+		diff.WithOriginals(map[string]bson.D{hashData.GetIdentifier(): original}),
+	)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, diff.ActionUpdated, changes[0].Action)
+	assert.Equal(t, []string{"name"}, changes[0].FieldChanges.Paths())
+}
+
+func TestHasMaskPlaceholder(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected bool
+	}{
+		{name: "placeholder", value: diff.MaskPlaceholder, expected: true},
+		{name: "other string", value: "masked", expected: false},
+		{name: "nested document", value: bson.D{{Key: "a", Value: bson.D{{Key: "b", Value: diff.MaskPlaceholder}}}},
+			expected: true},
+		{name: "array item", value: bson.A{int32(1), bson.D{{Key: "b", Value: diff.MaskPlaceholder}}}, expected: true},
+		{name: "no placeholder", value: bson.D{{Key: "a", Value: bson.A{"x"}}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, diff.HasMaskPlaceholder(tt.value))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FieldConflict describes a path that was changed differently on both sides of a three-way merge.
+type FieldConflict struct {
+	// Path is the conflicting path (the shorter one, if changes were done on different nesting levels)
+	Path string
+
+	// Ours is the change made by the user
+	Ours *FieldChange
+
+	// Theirs is the change made in the database
+	Theirs *FieldChange
+}
+
+// MergeResult holds the result of a three-way merge of a document.
+type MergeResult struct {
+	// Merged is `theirs` document with all non-conflicting `ours` changes applied
+	Merged bson.D
+
+	// Conflicts are changes that could not be merged automatically
+	Conflicts []*FieldConflict
+}
+
+// HasConflicts returns true if merge could not be done automatically.
+func (r *MergeResult) HasConflicts() bool { return len(r.Conflicts) > 0 }
+
+// ConflictingPaths returns paths of all the conflicts.
+func (r *MergeResult) ConflictingPaths() []string {
+	paths := make([]string, 0, len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// OursChanges returns user's side of all the conflicts.
+func (r *MergeResult) OursChanges() FieldChanges {
+	changes := make(FieldChanges, 0, len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		changes = append(changes, c.Ours)
+	}
+	return changes
+}
+
+// Merge performs a three-way merge of the `base` document changed into `ours` and `theirs` versions.
+// Changes are compared per path, so edits of different fields are merged automatically.
+// Paths changed on both sides are conflicts, unless both sides made exactly the same change.
+func Merge(base, ours, theirs bson.D) *MergeResult {
+	oursChanges := CompareDocuments(base, ours)
+	theirsChanges := CompareDocuments(base, theirs)
+
+	result := &MergeResult{}
+	var mergeable FieldChanges
+	for _, oc := range oursChanges {
+		conflict := findConflict(oc, theirsChanges)
+		if conflict == nil {
+			mergeable = append(mergeable, oc)
+			continue
+		}
+
+		// Both sides did the same: nothing to merge
+		if conflict.Theirs.Path == oc.Path &&
+			conflict.Theirs.Action == oc.Action && ValuesEqual(conflict.Theirs.After, oc.After) {
+			continue
+		}
+
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+
+	result.Merged = ApplyFieldChanges(theirs, mergeable)
+
+	return result
+}
+
+// findConflict returns a conflict of the given change with the first overlapping change (if any).
+func findConflict(change *FieldChange, others FieldChanges) *FieldConflict {
+	for _, other := range others {
+		if !pathsOverlap(change.Path, other.Path) {
+			continue
+		}
+
+		path := change.Path
+		if len(other.Path) < len(path) {
+			path = other.Path
+		}
+
+		return &FieldConflict{Path: path, Ours: change, Theirs: other}
+	}
+
+	return nil
+}
+
+// pathsOverlap reports if paths are the same or one of them is nested into the other.
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+PathSeparator) || strings.HasPrefix(b, a+PathSeparator)
+}
+
+// ApplyFieldChanges returns a copy of the given document with field changes applied.
+// Fields keep their order, added ones are appended. The given document itself is not mutated.
+func ApplyFieldChanges(doc bson.D, changes FieldChanges) bson.D {
+	result := slices.Clone(doc)
+	if result == nil {
+		result = bson.D{}
+	}
+
+	for _, fc := range changes {
+		result = applyFieldChange(result, strings.Split(fc.Path, PathSeparator), fc)
+	}
+
+	return result
+}
+
+// applyFieldChange applies a single field change into the (already cloned) document.
+// Nested documents on the way are cloned before being changed.
+func applyFieldChange(doc bson.D, keys []string, fc *FieldChange) bson.D {
+	key := keys[0]
+	i := slices.IndexFunc(doc, func(e bson.E) bool { return e.Key == key })
+	if len(keys) == 1 {
+		switch {
+		case fc.Action == FieldRemoved:
+			if i >= 0 {
+				doc = slices.Delete(doc, i, i+1)
+			}
+		case i >= 0:
+			doc[i].Value = fc.After
+		default:
+			doc = append(doc, bson.E{Key: key, Value: fc.After})
+		}
+		return doc
+	}
+
+	var child bson.D
+	ok := false
+	if i >= 0 {
+		child, ok = asDocument(doc[i].Value)
+	}
+	if !ok {
+		if fc.Action == FieldRemoved {
+			return doc
+		}
+		child = bson.D{}
+	} else {
+		child = slices.Clone(child)
+	}
+
+	child = applyFieldChange(child, keys[1:], fc)
+	if i >= 0 {
+		doc[i].Value = child
+	} else {
+		doc = append(doc, bson.E{Key: key, Value: child})
+	}
+
+	return doc
+}
+
+// MergeChange performs a three-way merge of the update change with the live version of its document:
+// the change's original document is the common base of the user's edit and the live document.
+// The returned result is nil if the change can't be merged per field (e.g. original document is unknown).
+// When the merge has no conflicts, the returned change is the update rebased onto the live document
+// (or nil, if the live document already contains all the changes).
+func MergeChange(ch *Change, live bson.D) (*Change, *MergeResult) {
+	if ch.Action != ActionUpdated || ch.Original == nil || ch.FieldChanges.Len() == 0 || !isPathSafe(live) {
+		return nil, nil
+	}
+
+	result := Merge(ch.Original, ch.Data, live)
+	if result.HasConflicts() {
+		return nil, result
+	}
+
+	fieldChanges := CompareDocuments(live, result.Merged)
+	if fieldChanges.Len() == 0 {
+		return nil, result
+	}
+
+	rebased := NewChange(ch.IdentifiedBy, ch.IdentifierValue, ActionUpdated, result.Merged)
+	rebased.Original = live
+	rebased.FieldChanges = fieldChanges
+
+	return rebased, result
+}
@@ -0,0 +1,270 @@
+package diff_test
+
+import (
+	"pho/internal/diff"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMerge(t *testing.T) {
+	kyiv := bson.D{{Key: "city", Value: "Kyiv"}, {Key: "zip", Value: "01001"}}
+	lviv := bson.D{{Key: "city", Value: "Lviv"}, {Key: "zip", Value: "01001"}}
+	base := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "test"},
+		{Key: "age", Value: 30},
+		{Key: "address", Value: kyiv},
+	}
+
+	tests := []struct {
+		name              string
+		ours              bson.D
+		theirs            bson.D
+		expectedMerged    bson.D
+		expectedConflicts []string
+	}{
+		{
+			name: "different fields are merged",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: lviv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 31},
+				{Key: "address", Value: kyiv},
+			},
+			expectedMerged: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 31},
+				{Key: "address", Value: lviv},
+			},
+		},
+		{
+			name: "different nested fields are merged",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: lviv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}, {Key: "zip", Value: "79000"}}},
+			},
+			expectedMerged: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}, {Key: "zip", Value: "79000"}}},
+			},
+		},
+		{
+			name: "same change on both sides is not a conflict",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "renamed"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: kyiv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "renamed"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: kyiv},
+			},
+			expectedMerged: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "renamed"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: kyiv},
+			},
+		},
+		{
+			name: "same field changed differently",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "ours"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: kyiv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "theirs"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: kyiv},
+			},
+			expectedConflicts: []string{"name"},
+		},
+		{
+			name: "removed on one side and modified on the other",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "address", Value: kyiv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 31},
+				{Key: "address", Value: kyiv},
+			},
+			expectedConflicts: []string{"age"},
+		},
+		{
+			name: "nested field changed while parent is replaced",
+			ours: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: lviv},
+			},
+			theirs: bson.D{
+				{Key: "_id", Value: "doc1"},
+				{Key: "name", Value: "test"},
+				{Key: "age", Value: 30},
+				{Key: "address", Value: "unknown"},
+			},
+			expectedConflicts: []string{"address"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := diff.Merge(base, tt.ours, tt.theirs)
+
+			if len(tt.expectedConflicts) == 0 {
+				assert.False(t, result.HasConflicts())
+				assert.Equal(t, tt.expectedMerged, result.Merged)
+				return
+			}
+
+			assert.True(t, result.HasConflicts())
+			assert.Equal(t, tt.expectedConflicts, result.ConflictingPaths())
+		})
+	}
+}
+
+func TestMerge_ConflictKeepsNonConflictingChanges(t *testing.T) {
+	base := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "test"}, {Key: "age", Value: 30}}
+	ours := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "ours"},
+		{Key: "age", Value: 30},
+		{Key: "email", Value: "a@b.c"},
+	}
+	theirs := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "theirs"}, {Key: "age", Value: 31}}
+
+	result := diff.Merge(base, ours, theirs)
+	require.True(t, result.HasConflicts())
+
+	// Merged version keeps database side of the conflict
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "theirs"},
+		{Key: "age", Value: 31},
+		{Key: "email", Value: "a@b.c"},
+	}, result.Merged)
+
+	// While user's side of conflicts can be applied on top of it
+	assert.Equal(t,
+		bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "ours"},
+			{Key: "age", Value: 31},
+			{Key: "email", Value: "a@b.c"},
+		},
+		diff.ApplyFieldChanges(result.Merged, result.OursChanges()),
+	)
+}
+
+func TestApplyFieldChanges(t *testing.T) {
+	doc := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "legacy", Value: true},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+	}
+
+	result := diff.ApplyFieldChanges(doc, diff.FieldChanges{
+		{Path: "address.city", Action: diff.FieldModified, Before: "Kyiv", After: "Lviv"},
+		{Path: "contacts.email", Action: diff.FieldAdded, After: "a@b.c"},
+		{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+		{Path: "missing.field", Action: diff.FieldRemoved},
+	})
+
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}}},
+		{Key: "contacts", Value: bson.D{{Key: "email", Value: "a@b.c"}}},
+	}, result)
+
+	// Given document is not mutated
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "legacy", Value: true},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+	}, doc)
+}
+
+func TestMergeChange(t *testing.T) {
+	original := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "test"}, {Key: "age", Value: 30}}
+	edited := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "renamed"}, {Key: "age", Value: 30}}
+
+	newUpdate := func() *diff.Change {
+		change := diff.NewChange("_id", "doc1", diff.ActionUpdated, edited)
+		change.Original = original
+		change.FieldChanges = diff.CompareDocuments(original, edited)
+		return change
+	}
+
+	t.Run("rebased onto live document", func(t *testing.T) {
+		live := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "test"}, {Key: "age", Value: 31}}
+
+		rebased, result := diff.MergeChange(newUpdate(), live)
+		require.NotNil(t, result)
+		require.NotNil(t, rebased)
+
+		assert.Equal(t, bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "renamed"},
+			{Key: "age", Value: 31},
+		}, rebased.Data)
+		assert.Equal(t, live, rebased.Original)
+		assert.Equal(t, []string{"name"}, rebased.FieldChanges.Paths())
+	})
+
+	t.Run("live document already has the change", func(t *testing.T) {
+		live := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "renamed"}, {Key: "age", Value: 31}}
+
+		rebased, result := diff.MergeChange(newUpdate(), live)
+		require.NotNil(t, result)
+		assert.False(t, result.HasConflicts())
+		assert.Nil(t, rebased)
+	})
+
+	t.Run("conflicting change", func(t *testing.T) {
+		live := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "other"}, {Key: "age", Value: 30}}
+
+		rebased, result := diff.MergeChange(newUpdate(), live)
+		require.NotNil(t, result)
+		assert.True(t, result.HasConflicts())
+		assert.Nil(t, rebased)
+	})
+
+	t.Run("original is unknown", func(t *testing.T) {
+		change := diff.NewChange("_id", "doc1", diff.ActionUpdated, edited)
+
+		rebased, result := diff.MergeChange(change, bson.D{{Key: "_id", Value: "doc1"}})
+		assert.Nil(t, rebased)
+		assert.Nil(t, result)
+	})
+}
@@ -0,0 +1,37 @@
+package diff
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// options holds optional settings of changes calculation.
+type options struct {
+	// originals are original documents (per identifier) as they were at the moment of dump
+	originals map[string]bson.D
+
+	// identifyBy are fields documents are identified by (default identity if empty)
+	identifyBy []string
+
+	// protected are dotted paths of fields that must not be edited
+	protected []string
+}
+
+// Option is a functional option for changes calculation.
+type Option func(*options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithOriginals sets original documents (keyed by full identifier, e.g. `_id::1`).
+func WithOriginals(v map[string]bson.D) Option { return func(o *options) { o.originals = v } }
+
+// WithIdentifyBy sets fields documents are identified by (several ones for a composite identity).
+// It must be the same identity the source hashed lines were calculated with.
+func WithIdentifyBy(v []string) Option { return func(o *options) { o.identifyBy = v } }
+
+// WithProtected sets dotted paths of fields that must not be edited (e.g. `createdAt`, `audit`).
+// Changes editing them are flagged via ProtectedEdits.
+func WithProtected(v []string) Option { return func(o *options) { o.protected = v } }
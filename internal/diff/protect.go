@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrProtectedEdit is the error of changes editing protected fields (see WithProtected).
+var ErrProtectedEdit = errors.New("protected fields are edited")
+
+// Err returns the error that makes the change not applicable (nil if there is none).
+func (ch *Change) Err() error {
+	if len(ch.ProtectedEdits) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrProtectedEdit, strings.Join(ch.ProtectedEdits.Paths(), ", "))
+}
+
+// WithProtectedEdits returns changes editing protected fields.
+func (chs Changes) WithProtectedEdits() Changes {
+	return chs.Filter(func(ch *Change) bool { return len(ch.ProtectedEdits) > 0 })
+}
+
+// FlagProtectedEdits sets ProtectedEdits of updated and renamed documents whose originals are known.
+// CalculateChanges does it given WithProtected, changes made otherwise (e.g. read from a patch) are flagged via it.
+// Updates with known field changes are checked by the fields they change, as only those are written.
+func FlagProtectedEdits(changes Changes, protected []string) {
+	if len(protected) == 0 {
+		return
+	}
+
+	for _, ch := range changes {
+		if (ch.Action != ActionUpdated && ch.Action != ActionRenamed) || ch.Original == nil {
+			continue
+		}
+
+		// Updates without field changes replace the whole document (fields missing in it are removed)
+		after := ch.Data
+		if ch.Action == ActionUpdated && ch.FieldChanges.Len() > 0 {
+			after = ApplyFieldChanges(ch.Original, ch.FieldChanges)
+		}
+		ch.ProtectedEdits = protectedEdits(ch.Original, after, protected)
+	}
+}
+
+// protectedEdits returns changes of the protected paths between `before` and `after` versions of a document.
+// A protected path covers everything nested into it, e.g. `audit` protects `audit.by` as well.
+func protectedEdits(before, after bson.D, protected []string) FieldChanges {
+	var edits FieldChanges
+	for _, path := range protected {
+		beforeValue, hadBefore := LookupPath(before, path)
+		afterValue, hasAfter := LookupPath(after, path)
+
+		switch {
+		case !hadBefore && !hasAfter, hasAfter && IsMaskPlaceholder(afterValue):
+			continue
+		case !hadBefore:
+			edits = append(edits, &FieldChange{Path: path, Action: FieldAdded, After: afterValue})
+		case !hasAfter:
+			edits = append(edits, &FieldChange{Path: path, Action: FieldRemoved, Before: beforeValue})
+		case !ValuesEqual(beforeValue, afterValue):
+			edits = append(edits, &FieldChange{
+				Path: path, Action: FieldModified, Before: beforeValue, After: afterValue,
+			})
+		}
+	}
+
+	return edits
+}
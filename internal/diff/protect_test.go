@@ -0,0 +1,150 @@
+package diff_test
+
+import (
+	"errors"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCalculateChanges_WithProtected(t *testing.T) {
+	originals := map[string]bson.D{}
+	source := map[string]*hashing.HashData{}
+	for _, doc := range []bson.D{
+		{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "Document 1"},
+			{Key: "createdAt", Value: "2024-01-01"},
+			{Key: "audit", Value: bson.D{{Key: "by", Value: "alice"}, {Key: "at", Value: "2024-01-02"}}},
+		},
+		{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "Document 2"}, {Key: "createdAt", Value: "2024-01-03"}},
+		{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "Document 3"}},
+	} {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		source[hashData.GetIdentifier()] = hashData
+		originals[hashData.GetIdentifier()] = doc
+	}
+
+	edited := []bson.D{
+		// Nested field of a protected one is edited, protected one is removed, unprotected one is edited
+		{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "Document 1 Modified"},
+			{Key: "audit", Value: bson.D{{Key: "by", Value: "mallory"}, {Key: "at", Value: "2024-01-02"}}},
+		},
+		// Only unprotected fields are edited
+		{
+			{Key: "_id", Value: "doc2"},
+			{Key: "name", Value: "Document 2 Modified"},
+			{Key: "createdAt", Value: "2024-01-03"},
+		},
+		// Protected field is added
+		{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "Document 3"}, {Key: "createdAt", Value: "2024-01-04"}},
+		// New documents may have protected fields
+		{{Key: "_id", Value: "doc4"}, {Key: "createdAt", Value: "2024-01-05"}},
+	}
+
+	changes, err := diff.CalculateChanges(source, edited,
+		diff.WithOriginals(originals),
+		diff.WithProtected([]string{"createdAt", "audit"}),
+	)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+
+	assert.Equal(t, []string{"createdAt", "audit"}, changes[0].ProtectedEdits.Paths())
+	assert.Equal(t, diff.FieldRemoved, changes[0].ProtectedEdits[0].Action)
+	assert.Equal(t, diff.FieldModified, changes[0].ProtectedEdits[1].Action)
+	require.Error(t, changes[0].Err())
+	assert.True(t, errors.Is(changes[0].Err(), diff.ErrProtectedEdit))
+	assert.Equal(t, "protected fields are edited: createdAt, audit", changes[0].Err().Error())
+
+	require.NoError(t, changes[1].Err())
+
+	assert.Equal(t, []string{"createdAt"}, changes[2].ProtectedEdits.Paths())
+	assert.Equal(t, diff.FieldAdded, changes[2].ProtectedEdits[0].Action)
+
+	assert.Equal(t, diff.ActionAdded, changes[3].Action)
+	require.NoError(t, changes[3].Err())
+
+	assert.Len(t, changes.WithProtectedEdits(), 2)
+}
+
+func TestCalculateChanges_WithProtected_Rename(t *testing.T) {
+	original := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1"}, {Key: "total", Value: 10.5}}
+	hashData, err := hashing.Hash(original)
+	require.NoError(t, err)
+	source := map[string]*hashing.HashData{hashData.GetIdentifier(): hashData}
+	originals := map[string]bson.D{hashData.GetIdentifier(): original}
+
+	// Documents differing in protected fields are not paired as renamed: the new one is a plain insert
+	added := bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "Document 1"}, {Key: "total", Value: 99.5}}
+	changes, err := diff.CalculateChanges(source, []bson.D{added},
+		diff.WithOriginals(originals),
+		diff.WithProtected([]string{"total"}),
+	)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, diff.ActionAdded, changes[0].Action)
+	assert.Equal(t, diff.ActionDeleted, changes[1].Action)
+	assert.Empty(t, changes.WithProtectedEdits())
+
+	renamed := bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "Document 1"}, {Key: "total", Value: 10.5}}
+	changes, err = diff.CalculateChanges(source, []bson.D{renamed},
+		diff.WithOriginals(originals),
+		diff.WithProtected([]string{"total"}),
+	)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	assert.Equal(t, diff.ActionRenamed, changes[0].Action)
+	assert.Empty(t, changes[0].ProtectedEdits)
+}
+
+func TestFlagProtectedEdits(t *testing.T) {
+	original := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "Document 1"},
+		{Key: "createdAt", Value: "2024-01-01"},
+	}
+
+	// Updates are checked by the field changes they write, their data may be partial
+	fieldsUpdate := diff.NewChange("_id", "doc1", diff.ActionUpdated)
+	fieldsUpdate.Original = original
+	fieldsUpdate.Data = bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1 Modified"}}
+	fieldsUpdate.FieldChanges = diff.FieldChanges{
+		{Path: "name", Action: diff.FieldModified, After: "Document 1 Modified"},
+	}
+
+	protectedUpdate := diff.NewChange("_id", "doc1", diff.ActionUpdated)
+	protectedUpdate.Original = original
+	protectedUpdate.FieldChanges = diff.FieldChanges{{Path: "createdAt", Action: diff.FieldRemoved}}
+
+	dataUpdate := diff.NewChange("_id", "doc1", diff.ActionUpdated)
+	dataUpdate.Original = original
+	dataUpdate.Data = bson.D{{Key: "_id", Value: "doc1"}, {Key: "createdAt", Value: "2024-01-02"}}
+
+	// Updates without field changes replace the whole document, so fields missing in it are removed
+	replacingUpdate := diff.NewChange("_id", "doc1", diff.ActionUpdated)
+	replacingUpdate.Original = original
+	replacingUpdate.Data = bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Document 1"}}
+
+	// Changes without originals can't be checked
+	unknownUpdate := diff.NewChange("_id", "doc2", diff.ActionUpdated)
+	unknownUpdate.Data = bson.D{{Key: "_id", Value: "doc2"}}
+
+	changes := diff.Changes{fieldsUpdate, protectedUpdate, dataUpdate, replacingUpdate, unknownUpdate}
+	diff.FlagProtectedEdits(changes, []string{"createdAt"})
+
+	assert.Empty(t, fieldsUpdate.ProtectedEdits)
+	assert.Equal(t, []string{"createdAt"}, protectedUpdate.ProtectedEdits.Paths())
+	assert.Equal(t, []string{"createdAt"}, dataUpdate.ProtectedEdits.Paths())
+	require.Len(t, replacingUpdate.ProtectedEdits, 1)
+	assert.Equal(t, diff.FieldRemoved, replacingUpdate.ProtectedEdits[0].Action)
+	assert.Empty(t, unknownUpdate.ProtectedEdits)
+}
@@ -0,0 +1,79 @@
+package diff
+
+import (
+	"pho/internal/hashing"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// detectRenames replaces pairs of deleted and added documents that are the same documents under new identifiers
+// with a single renamed change: editing identifier in the dump is seen as deleted+added otherwise.
+// Documents are paired only if all their fields (identity ones aside) are equal: pairing merely similar ones
+// would turn an unrelated delete and insert into an edit of the deleted document.
+// Only deleted documents with known originals can be detected as renamed.
+// Each added document is paired with the first equal deleted one.
+func detectRenames(changes Changes) Changes {
+	var deleted Changes
+	for _, ch := range changes {
+		if ch.Action == ActionDeleted && ch.Original != nil {
+			deleted = append(deleted, ch)
+		}
+	}
+	if len(deleted) == 0 {
+		return changes
+	}
+
+	renamed := make(map[*Change]struct{})
+	for _, ch := range changes {
+		if ch.Action != ActionAdded || len(deleted) == 0 {
+			continue
+		}
+
+		i := slices.IndexFunc(deleted, func(candidate *Change) bool {
+			return sameContent(candidate.Original, ch.Data, ch.IdentifiedBy)
+		})
+		if i < 0 {
+			continue
+		}
+
+		from := deleted[i]
+		deleted = slices.Delete(deleted, i, i+1)
+		renamed[from] = struct{}{}
+
+		ch.Action = ActionRenamed
+		ch.RenamedFrom = from.IdentifierValue
+		ch.Original = from.Original
+		if isPathSafe(ch.Original) && isPathSafe(ch.Data) {
+			ch.FieldChanges = CompareDocuments(ch.Original, ch.Data)
+		}
+	}
+
+	return slices.DeleteFunc(changes, func(ch *Change) bool {
+		_, ok := renamed[ch]
+		return ok
+	})
+}
+
+// sameContent reports whether the given documents have the same top-level fields with equal values.
+// Identity fields are not compared, as they are expected to differ.
+func sameContent(a, b bson.D, identifiedBy string) bool {
+	identityFields := hashing.IdentityFields(identifiedBy)
+	isCompared := func(key string) bool { return key != "_id" && !slices.Contains(identityFields, key) }
+
+	for _, e := range a {
+		if !isCompared(e.Key) {
+			continue
+		}
+		if value, ok := lookup(b, e.Key); !ok || !ValuesEqual(e.Value, value) {
+			return false
+		}
+	}
+	for _, e := range b {
+		if _, ok := lookup(a, e.Key); !ok && isCompared(e.Key) {
+			return false
+		}
+	}
+
+	return true
+}
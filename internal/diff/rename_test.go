@@ -0,0 +1,120 @@
+package diff_test
+
+import (
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// hashedSource returns hashed lines and originals of the given dumped documents.
+func hashedSource(t *testing.T, docs ...bson.D) (map[string]*hashing.HashData, map[string]bson.D) {
+	t.Helper()
+
+	source := make(map[string]*hashing.HashData, len(docs))
+	originals := make(map[string]bson.D, len(docs))
+	for _, doc := range docs {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		source[hashData.GetIdentifier()] = hashData
+		originals[hashData.GetIdentifier()] = doc
+	}
+
+	return source, originals
+}
+
+func TestCalculateChanges_DetectsRenames(t *testing.T) {
+	alice := bson.D{{Key: "_id", Value: "alice"}, {Key: "name", Value: "Alice"}, {Key: "age", Value: 30}}
+	bob := bson.D{{Key: "_id", Value: "bob"}, {Key: "name", Value: "Bob"}, {Key: "age", Value: 40}}
+	source, originals := hashedSource(t, alice, bob)
+
+	renamed := bson.D{{Key: "_id", Value: "alice2"}, {Key: "name", Value: "Alice"}, {Key: "age", Value: 30}}
+	added := bson.D{{Key: "_id", Value: "carol"}, {Key: "name", Value: "Bob"}, {Key: "age", Value: 41}}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{renamed, added}, diff.WithOriginals(originals))
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+
+	renamedChanges := changes.FilterByAction(diff.ActionRenamed)
+	require.Len(t, renamedChanges, 1)
+	ch := renamedChanges[0]
+	assert.Equal(t, "alice2", ch.IdentifierValue)
+	assert.Equal(t, "alice", ch.RenamedFrom)
+	assert.Equal(t, "_id::alice", ch.RenamedFromIdentifier())
+	assert.Equal(t, bson.M{"_id": "alice"}, ch.RenamedFromFilter())
+	assert.Equal(t, alice, ch.Original)
+	assert.Equal(t, renamed, ch.Data)
+	assert.Equal(t, []string{"_id"}, ch.FieldChanges.Paths())
+
+	// Similar, but not the same as Bob: unrelated delete and insert
+	addedChanges := changes.FilterByAction(diff.ActionAdded)
+	require.Len(t, addedChanges, 1)
+	assert.Equal(t, "carol", addedChanges[0].IdentifierValue)
+
+	deletedChanges := changes.FilterByAction(diff.ActionDeleted)
+	require.Len(t, deletedChanges, 1)
+	assert.Equal(t, "bob", deletedChanges[0].IdentifierValue)
+}
+
+func TestCalculateChanges_DetectsRenames_SameContent(t *testing.T) {
+	first := bson.D{{Key: "_id", Value: int32(1)}, {Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "c", Value: 3}}
+	second := bson.D{{Key: "_id", Value: int32(2)}, {Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "c", Value: 4}}
+	source, originals := hashedSource(t, first, second)
+
+	renamed := bson.D{{Key: "_id", Value: int32(3)}, {Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "c", Value: 4}}
+	// Fields missing on either side make documents different
+	extended := bson.D{{Key: "_id", Value: int32(4)}, {Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "c", Value: 4},
+		{Key: "d", Value: 5}}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{first, renamed, extended}, diff.WithOriginals(originals))
+	require.NoError(t, err)
+
+	renamedChanges := changes.FilterByAction(diff.ActionRenamed)
+	require.Len(t, renamedChanges, 1)
+	assert.Equal(t, int32(2), renamedChanges[0].RenamedFrom)
+	assert.Equal(t, int32(3), renamedChanges[0].IdentifierValue)
+	assert.Equal(t, []string{"_id"}, renamedChanges[0].FieldChanges.Paths())
+	assert.Empty(t, changes.FilterByAction(diff.ActionDeleted))
+
+	addedChanges := changes.FilterByAction(diff.ActionAdded)
+	require.Len(t, addedChanges, 1)
+	assert.Equal(t, int32(4), addedChanges[0].IdentifierValue)
+}
+
+func TestCalculateChanges_RenamesNeedOriginals(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: "old"}, {Key: "name", Value: "Same"}}
+	source, _ := hashedSource(t, doc)
+
+	renamed := bson.D{{Key: "_id", Value: "new"}, {Key: "name", Value: "Same"}}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{renamed})
+	require.NoError(t, err)
+	assert.Empty(t, changes.FilterByAction(diff.ActionRenamed))
+	assert.Len(t, changes.FilterByAction(diff.ActionAdded), 1)
+	assert.Len(t, changes.FilterByAction(diff.ActionDeleted), 1)
+}
+
+func TestCalculateChanges_DetectsRenames_CompositeIdentity(t *testing.T) {
+	identifyBy := []string{"tenant_id", "sku"}
+	doc := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: 10}}
+
+	hashData, err := hashing.Hash(doc, identifyBy...)
+	require.NoError(t, err)
+	source := map[string]*hashing.HashData{hashData.GetIdentifier(): hashData}
+	originals := map[string]bson.D{hashData.GetIdentifier(): doc}
+
+	renamed := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-2"}, {Key: "price", Value: 10}}
+
+	changes, err := diff.CalculateChanges(source, []bson.D{renamed},
+		diff.WithOriginals(originals), diff.WithIdentifyBy(identifyBy))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	ch := changes[0]
+	assert.Equal(t, diff.ActionRenamed, ch.Action)
+	assert.Equal(t, bson.M{"tenant_id": "acme", "sku": "SKU-1"}, ch.RenamedFromFilter())
+	assert.Equal(t, bson.M{"tenant_id": "acme", "sku": "SKU-2"}, ch.Filter())
+}
@@ -0,0 +1,181 @@
+package diff
+
+import "fmt"
+
+// DefaultContextLines is the default number of unchanged lines shown around changed ones in a unified diff.
+const DefaultContextLines = 3
+
+// LineOp is the operation of a single line of a unified diff.
+type LineOp uint8
+
+const (
+	LineContext LineOp = iota
+	LineRemoved
+	LineAdded
+)
+
+// Prefix returns the prefix the line is marked with in a unified diff.
+func (op LineOp) Prefix() string {
+	switch op {
+	case LineRemoved:
+		return "-"
+	case LineAdded:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+// Line is a single line of a unified diff.
+type Line struct {
+	Op   LineOp
+	Text string
+}
+
+// String returns the line as it's written in a unified diff (e.g. `+"name": "new"`).
+func (l Line) String() string { return l.Op.Prefix() + l.Text }
+
+// Hunk is a group of changed lines along with unchanged lines around them.
+type Hunk struct {
+	// OldStart and NewStart are 1-based numbers of the first lines of the hunk in old and new texts
+	// (if the hunk has no lines of a text, it's the number of the line the hunk goes after)
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	Lines []Line
+}
+
+// Header returns the header of the hunk, e.g. `@@ -1,3 +1,4 @@`.
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// UnifiedDiff calculates the line-by-line difference between old and new texts
+// and groups it into hunks with the given number of unchanged context lines around changed ones.
+// No hunks are returned for equal texts.
+func UnifiedDiff(oldLines, newLines []string, contextLines int) []*Hunk {
+	lines := diffLines(oldLines, newLines)
+
+	var hunks []*Hunk
+	var hunk *Hunk
+	oldNum, newNum := 0, 0 // numbers of lines processed so far
+	lastChanged := -1
+	for i, line := range lines {
+		if line.Op != LineContext {
+			if hunk == nil || i-lastChanged > 2*contextLines+1 {
+				if hunk != nil {
+					hunk.Lines = appendContext(hunk, lines[lastChanged+1:min(lastChanged+1+contextLines, i)])
+				}
+
+				// Context lines before the change: they are unchanged, so they are the same in both texts
+				before := min(contextLines, i-lastChanged-1)
+				hunk = &Hunk{OldStart: oldNum - before + 1, NewStart: newNum - before + 1}
+				hunks = append(hunks, hunk)
+				hunk.Lines = appendContext(hunk, lines[i-before:i])
+			} else {
+				hunk.Lines = appendContext(hunk, lines[lastChanged+1:i])
+			}
+
+			hunk.Lines = append(hunk.Lines, line)
+			if line.Op == LineRemoved {
+				hunk.OldLines++
+			} else {
+				hunk.NewLines++
+			}
+			lastChanged = i
+		}
+
+		switch line.Op {
+		case LineContext:
+			oldNum++
+			newNum++
+		case LineRemoved:
+			oldNum++
+		case LineAdded:
+			newNum++
+		}
+	}
+
+	if hunk != nil {
+		hunk.Lines = appendContext(hunk, lines[lastChanged+1:min(lastChanged+1+contextLines, len(lines))])
+	}
+
+	// Hunks with no lines of a text point to the line they go after
+	for _, h := range hunks {
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+	}
+
+	return hunks
+}
+
+// appendContext appends unchanged lines to the hunk.
+func appendContext(h *Hunk, lines []Line) []Line {
+	h.OldLines += len(lines)
+	h.NewLines += len(lines)
+	return append(h.Lines, lines...)
+}
+
+// diffLines returns the shortest edit script turning old lines into new ones
+// (via the longest common subsequence). Removed lines of a change go before the added ones.
+func diffLines(oldLines, newLines []string) []Line {
+	// Common prefix and suffix are cut off, so only the changed middle part is compared
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]Line, 0, len(oldLines)+len(newLines)-prefix-suffix)
+	for _, text := range oldLines[:prefix] {
+		lines = append(lines, Line{Op: LineContext, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, Line{Op: LineContext, Text: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, Line{Op: LineRemoved, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: LineAdded, Text: b[j]})
+			j++
+		}
+	}
+
+	for _, text := range oldLines[len(oldLines)-suffix:] {
+		lines = append(lines, Line{Op: LineContext, Text: text})
+	}
+
+	return lines
+}
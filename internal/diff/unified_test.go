@@ -0,0 +1,100 @@
+package diff_test
+
+import (
+	"pho/internal/diff"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unifiedText renders hunks the way they are written in a unified diff.
+func unifiedText(hunks []*diff.Hunk) string {
+	var sb strings.Builder
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			sb.WriteString(line.String() + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldText  string
+		newText  string
+		context  int
+		expected string
+	}{
+		{
+			name:     "equal texts",
+			oldText:  "a\nb\nc",
+			newText:  "a\nb\nc",
+			context:  3,
+			expected: "",
+		},
+		{
+			name:     "modified line with context",
+			oldText:  "{\n\"a\": 1,\n\"b\": 2,\n\"c\": 3\n}",
+			newText:  "{\n\"a\": 1,\n\"b\": 5,\n\"c\": 3\n}",
+			context:  1,
+			expected: "@@ -2,3 +2,3 @@\n \"a\": 1,\n-\"b\": 2,\n+\"b\": 5,\n \"c\": 3\n",
+		},
+		{
+			name:     "added and removed lines",
+			oldText:  "a\nb\nc\nd",
+			newText:  "a\nc\nd\ne",
+			context:  0,
+			expected: "@@ -2,1 +1,0 @@\n-b\n@@ -4,0 +4,1 @@\n+e\n",
+		},
+		{
+			name:     "close changes share a hunk",
+			oldText:  "1\n2\n3\n4\n5",
+			newText:  "1\nX\n3\nY\n5",
+			context:  1,
+			expected: "@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n-4\n+Y\n 5\n",
+		},
+		{
+			name:     "distant changes are split into hunks",
+			oldText:  "1\n2\n3\n4\n5\n6\n7",
+			newText:  "X\n2\n3\n4\n5\n6\nY",
+			context:  1,
+			expected: "@@ -1,2 +1,2 @@\n-1\n+X\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+Y\n",
+		},
+		{
+			name:     "whole new text",
+			oldText:  "",
+			newText:  "a\nb",
+			context:  3,
+			expected: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var oldLines, newLines []string
+			if tt.oldText != "" {
+				oldLines = strings.Split(tt.oldText, "\n")
+			}
+			if tt.newText != "" {
+				newLines = strings.Split(tt.newText, "\n")
+			}
+
+			assert.Equal(t, tt.expected, unifiedText(diff.UnifiedDiff(oldLines, newLines, tt.context)))
+		})
+	}
+}
+
+func TestUnifiedDiff_RemovedBeforeAdded(t *testing.T) {
+	hunks := diff.UnifiedDiff([]string{"a", "b"}, []string{"c", "d"}, 0)
+	require.Len(t, hunks, 1)
+	assert.Equal(t, []diff.Line{
+		{Op: diff.LineRemoved, Text: "a"},
+		{Op: diff.LineRemoved, Text: "b"},
+		{Op: diff.LineAdded, Text: "c"},
+		{Op: diff.LineAdded, Text: "d"},
+	}, hunks[0].Lines)
+}
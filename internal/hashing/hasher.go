@@ -5,53 +5,54 @@ import (
 	"errors"
 	"fmt"
 	"pho/pkg/extjson"
+	"slices"
 	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 const (
-	IdentifierSeparator = "::"
-	ChecksumSeparator   = "|"
+	IdentifierSeparator     = "::"
+	ChecksumSeparator       = "|"
+	IdentityFieldsSeparator = ","
 )
 
 type HashData struct {
 	// IdentifiedBy stores the field, which data is identified by
+	// (comma-separated fields for a composite identity)
 	IdentifiedBy string `json:"identified_by"`
 
-	// IdentifierValue currently can be a string or ObjectID
+	// IdentifierValue is a value of any supported type (see IdentifierValue), or a document of values
+	// for a composite identity
 	IdentifierValue *IdentifierValue `json:"identifier_value"`
 
 	// Checksum of the whole doc
 	Checksum string `json:"checksum"`
 }
 
+// DefaultIdentityFields are fields a document is identified by (the first found one), unless others are given.
+var DefaultIdentityFields = []string{"_id", "id"}
+
 // Hash performs hashing of the given db object
-// It identifies it (by _id or id field) and calculates checksum for whole its content via SHA256
+// It identifies it and calculates checksum for whole its content via SHA256
 // Each db object is represented via hash line: _id::123|checksum.
-func Hash(result bson.M) (*HashData, error) {
-	// TODO: allow via config to rewrite it
-	possibleIDFields := []string{"_id", "id"}
-
-	var identifiedBy string
-	var unknown any
-	var ok bool
-	for _, possibleIDField := range possibleIDFields {
-		if unknown, ok = result[possibleIDField]; ok {
-			identifiedBy = possibleIDField
-			break
-		}
-	}
-	if !ok {
-		return nil, fmt.Errorf(
-			"no identifierValue field is found. Object must contain one of %v fields",
-			possibleIDFields,
-		)
+// Checksum doesn't depend on the order of fields.
+//
+// By default, object is identified by _id or id field (see DefaultIdentityFields).
+// If identifyBy fields are given, object must contain all of them:
+// a single field is a regular identity, several fields form a composite one (e.g. tenant_id,sku).
+func Hash(result bson.D, identifyBy ...string) (*HashData, error) {
+	identifiedBy, unknown, err := identify(result, identifyBy)
+	if err != nil {
+		return nil, err
 	}
 
-	identifierValue := NewIdentifierValue(unknown)
+	identifierValue, err := NewIdentifierValue(unknown)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", identifiedBy, err)
+	}
 
-	canonicalExtJSON, err := extjson.NewCanonicalMarshaller().Marshal(result)
+	canonicalExtJSON, err := extjson.NewCanonicalMarshaller().WithSortedKeys(true).Marshal(result)
 	if err != nil {
 		return nil, fmt.Errorf("invalid bson result: %w", err)
 	}
@@ -68,6 +69,76 @@ func Hash(result bson.M) (*HashData, error) {
 	}, nil
 }
 
+// identify returns the identity (field or comma-separated fields) of the given object and its value.
+// Value of a composite identity is a document of its fields (in the given order).
+func identify(result bson.D, identifyBy []string) (string, any, error) {
+	lookup := func(field string) (any, bool) {
+		i := slices.IndexFunc(result, func(e bson.E) bool { return e.Key == field })
+		if i < 0 {
+			return nil, false
+		}
+		return result[i].Value, true
+	}
+
+	if len(identifyBy) == 0 {
+		for _, field := range DefaultIdentityFields {
+			if value, ok := lookup(field); ok {
+				return field, value, nil
+			}
+		}
+
+		return "", nil, fmt.Errorf(
+			"no identifierValue field is found. Object must contain one of %v fields",
+			DefaultIdentityFields,
+		)
+	}
+
+	composite := make(bson.D, 0, len(identifyBy))
+	for _, field := range identifyBy {
+		value, ok := lookup(field)
+		if !ok {
+			return "", nil, fmt.Errorf("identity field %s is not found", field)
+		}
+		composite = append(composite, bson.E{Key: field, Value: value})
+	}
+
+	if len(composite) == 1 {
+		return composite[0].Key, composite[0].Value, nil
+	}
+
+	return strings.Join(identifyBy, IdentityFieldsSeparator), composite, nil
+}
+
+// ParseIdentifyBy parses comma-separated list of identity fields (e.g. `tenant_id,sku`).
+// Empty string means the default identity (see DefaultIdentityFields).
+func ParseIdentifyBy(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(s, IdentityFieldsSeparator) {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("invalid identity %q: empty field name", s)
+		}
+		if strings.Contains(field, IdentifierSeparator) || strings.Contains(field, ChecksumSeparator) {
+			return nil, fmt.Errorf("invalid identity field %q", field)
+		}
+		if slices.Contains(fields, field) {
+			return nil, fmt.Errorf("invalid identity %q: duplicated field %s", s, field)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// IdentityFields splits the given identifiedBy into fields (several ones for a composite identity).
+func IdentityFields(identifiedBy string) []string {
+	return strings.Split(identifiedBy, IdentityFieldsSeparator)
+}
+
 func (h *HashData) GetIdentifierParts() (string, any) {
 	if h.IdentifierValue == nil {
 		return h.IdentifiedBy, nil
@@ -88,10 +159,12 @@ func (h *HashData) String() string {
 }
 
 func Parse(hashStr string) (*HashData, error) {
-	identifierPart, checksum, found := strings.Cut(hashStr, ChecksumSeparator)
-	if !found {
+	// Checksum is a hex string, while identifier values may contain the separator
+	i := strings.LastIndex(hashStr, ChecksumSeparator)
+	if i < 0 {
 		return nil, errors.New("hash string must contain checksum separator |")
 	}
+	identifierPart, checksum := hashStr[:i], hashStr[i+len(ChecksumSeparator):]
 
 	identifiedBy, identifierValueStr, found := strings.Cut(identifierPart, IdentifierSeparator)
 	if !found {
@@ -14,38 +14,38 @@ import (
 func TestHash(t *testing.T) {
 	tests := []struct {
 		name    string
-		doc     bson.M
+		doc     bson.D
 		wantErr bool
 	}{
 		{
 			name: "document with ObjectID",
-			doc: bson.M{
-				"_id":  primitive.NewObjectID(),
-				"name": "test",
-				"data": map[string]any{"nested": "value"},
+			doc: bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "name", Value: "test"},
+				{Key: "data", Value: map[string]any{"nested": "value"}},
 			},
 			wantErr: false,
 		},
 		{
 			name: "document with string ID",
-			doc: bson.M{
-				"_id":    "string-id",
-				"value":  42,
-				"active": true,
+			doc: bson.D{
+				{Key: "_id", Value: "string-id"},
+				{Key: "value", Value: 42},
+				{Key: "active", Value: true},
 			},
 			wantErr: false,
 		},
 		{
 			name: "document without _id",
-			doc: bson.M{
-				"name": "no-id",
-				"data": "value",
+			doc: bson.D{
+				{Key: "name", Value: "no-id"},
+				{Key: "data", Value: "value"},
 			},
 			wantErr: true,
 		},
 		{
 			name:    "empty document",
-			doc:     bson.M{},
+			doc:     bson.D{},
 			wantErr: true,
 		},
 	}
@@ -76,9 +76,9 @@ func TestHash(t *testing.T) {
 
 func TestHashData_String(t *testing.T) {
 	// Create a test document
-	doc := bson.M{
-		"_id":  "test-id",
-		"name": "test document",
+	doc := bson.D{
+		{Key: "_id", Value: "test-id"},
+		{Key: "name", Value: "test document"},
 	}
 
 	hashData, err := hashing.Hash(doc)
@@ -151,11 +151,11 @@ func TestParse(t *testing.T) {
 
 func TestHashConsistency(t *testing.T) {
 	// Test that the same document produces the same hash
-	doc := bson.M{
-		"_id":    "consistent-test",
-		"field1": "value1",
-		"field2": 42,
-		"field3": true,
+	doc := bson.D{
+		{Key: "_id", Value: "consistent-test"},
+		{Key: "field1", Value: "value1"},
+		{Key: "field2", Value: 42},
+		{Key: "field3", Value: true},
 	}
 
 	hash1, err := hashing.Hash(doc)
@@ -169,14 +169,14 @@ func TestHashConsistency(t *testing.T) {
 
 func TestHashSensitivity(t *testing.T) {
 	// Test that different documents produce different hashes
-	doc1 := bson.M{
-		"_id":   "test-1",
-		"value": "original",
+	doc1 := bson.D{
+		{Key: "_id", Value: "test-1"},
+		{Key: "value", Value: "original"},
 	}
 
-	doc2 := bson.M{
-		"_id":   "test-1",
-		"value": "modified",
+	doc2 := bson.D{
+		{Key: "_id", Value: "test-1"},
+		{Key: "value", Value: "modified"},
 	}
 
 	hash1, err := hashing.Hash(doc1)
@@ -188,3 +188,122 @@ func TestHashSensitivity(t *testing.T) {
 	assert.NotEqual(t, hash1.GetChecksum(), hash2.GetChecksum())
 	assert.Equal(t, hash1.GetIdentifier(), hash2.GetIdentifier())
 }
+
+func TestHashFieldOrder(t *testing.T) {
+	// Checksum doesn't depend on the order of fields (including nested ones)
+	doc1 := bson.D{
+		{Key: "_id", Value: "test-1"},
+		{Key: "name", Value: "first"},
+		{Key: "nested", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+	}
+
+	doc2 := bson.D{
+		{Key: "nested", Value: bson.D{{Key: "b", Value: int32(2)}, {Key: "a", Value: int32(1)}}},
+		{Key: "name", Value: "first"},
+		{Key: "_id", Value: "test-1"},
+	}
+
+	hash1, err := hashing.Hash(doc1)
+	require.NoError(t, err)
+
+	hash2, err := hashing.Hash(doc2)
+	require.NoError(t, err)
+
+	assert.Equal(t, hash1.String(), hash2.String())
+}
+
+func TestHash_IdentifyBy(t *testing.T) {
+	doc := bson.D{
+		{Key: "_id", Value: "ignored"},
+		{Key: "tenant_id", Value: "acme"},
+		{Key: "sku", Value: int32(42)},
+		{Key: "price", Value: 10.5},
+	}
+
+	t.Run("single field", func(t *testing.T) {
+		hashData, err := hashing.Hash(doc, "tenant_id")
+		require.NoError(t, err)
+		assert.Equal(t, "tenant_id::acme", hashData.GetIdentifier())
+	})
+
+	t.Run("composite", func(t *testing.T) {
+		hashData, err := hashing.Hash(doc, "tenant_id", "sku")
+		require.NoError(t, err)
+
+		identifiedBy, identifierValue := hashData.GetIdentifierParts()
+		assert.Equal(t, "tenant_id,sku", identifiedBy)
+		assert.Equal(t, bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: int32(42)}}, identifierValue)
+
+		// Hash line is parsed back with types of composite values kept
+		parsed, err := hashing.Parse(hashData.String())
+		require.NoError(t, err)
+		assert.Equal(t, hashData, parsed)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := hashing.Hash(doc, "tenant_id", "region")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseIdentifyBy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "sku", want: []string{"sku"}},
+		{input: "tenant_id, sku", want: []string{"tenant_id", "sku"}},
+		{input: "tenant_id,", wantErr: true},
+		{input: "sku,sku", wantErr: true},
+		{input: "a|b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := hashing.ParseIdentifyBy(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHash_IdentifierTypes(t *testing.T) {
+	decimal, err := primitive.ParseDecimal128("1.5")
+	require.NoError(t, err)
+
+	ids := []any{
+		int32(1),
+		int64(1),
+		1.5,
+		decimal,
+		"plain-string",
+		primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: make([]byte, 16)},
+		bson.D{{Key: "region", Value: "eu"}, {Key: "seq", Value: int32(1)}},
+	}
+
+	identifiers := make(map[string]struct{})
+	for _, id := range ids {
+		hashData, err := hashing.Hash(bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "doc"}})
+		require.NoError(t, err)
+
+		// Hash line is parsed back into the same value of the same type
+		parsed, err := hashing.Parse(hashData.String())
+		require.NoError(t, err)
+		assert.Equal(t, id, parsed.IdentifierValue.Value)
+
+		identifiers[hashData.GetIdentifier()] = struct{}{}
+	}
+
+	// Values of different types never share an identifier (e.g. int32(1) and int64(1))
+	assert.Len(t, identifiers, len(ids))
+
+	_, err = hashing.Hash(bson.D{{Key: "_id", Value: primitive.Regex{Pattern: "x"}}})
+	assert.Error(t, err)
+}
@@ -1,64 +1,225 @@
 package hashing
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// isoDateLayout is the layout of ISODate(...) identifiers (BSON dates have millisecond precision).
+const isoDateLayout = "2006-01-02T15:04:05.000Z"
+
+// constructorRx matches typed identifiers, e.g. `NumberLong("42")` or `BinData(0,"AQI=")`.
+var constructorRx = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)\((.*)\)$`)
+
 // IdentifierValue stores the X value of `{_id:X}` identifying pair.
 type IdentifierValue struct {
-	// Value possibly now: string | primitive.ObjectID
+	// Value possibly now: string | primitive.ObjectID | int32 | int64 | float64 | primitive.Decimal128 |
+	// primitive.Binary (e.g. UUID) | primitive.DateTime | bson.D (embedded document or a composite identity)
 	Value any `json:"value"`
 }
 
-func NewIdentifierValue(v any) *IdentifierValue {
+// NewIdentifierValue returns identifier of the given value.
+// Error is returned if the value can't be used as an identifier.
+func NewIdentifierValue(v any) (*IdentifierValue, error) {
 	id := &IdentifierValue{Value: v}
+	if _, err := id.encode(); err != nil {
+		return nil, err
+	}
 
-	// TODO: reconsider as this smells too much
-	// String() contains validation as well, so let's panic as earlier as possible
-	_ = id.String()
-
-	return id
+	return id, nil
 }
 
 // String returns string representation used in meta and output.
+// Encoding is typed and reversible (see ParseIdentifierValue):
+//   - plain strings are kept as is (quoted only if they could be confused with other types)
+//   - other types are written via constructors: ObjectID("..."), NumberInt("1"), NumberLong("1"),
+//     Double("1.5"), NumberDecimal("1.5"), UUID("..."), BinData(0,"..."), ISODate("...")
+//   - documents (embedded _id or a composite identity) are written as canonical ExtJSON.
+//
+// Values of unsupported types (that NewIdentifierValue rejects) are written via %v, so it never panics.
 func (id *IdentifierValue) String() string {
+	s, err := id.encode()
+	if err != nil {
+		return fmt.Sprintf("%v", id.Value)
+	}
+
+	return s
+}
+
+// encode returns typed string representation of the value.
+func (id *IdentifierValue) encode() (string, error) {
 	switch t := id.Value.(type) {
 	case string:
-		return t
-	case fmt.Stringer: // primitive.ObjectID is a stringer, but any stringer is fine
-		return t.String()
-
+		if isAmbiguousString(t) {
+			return strconv.Quote(t), nil
+		}
+		return t, nil
+	case primitive.ObjectID:
+		return typed("ObjectID", t.Hex()), nil
+	case int32:
+		return typed("NumberInt", strconv.FormatInt(int64(t), 10)), nil
+	case int64:
+		return typed("NumberLong", strconv.FormatInt(t, 10)), nil
+	case float64:
+		return typed("Double", strconv.FormatFloat(t, 'g', -1, 64)), nil
+	case primitive.Decimal128:
+		return typed("NumberDecimal", t.String()), nil
+	case primitive.DateTime:
+		return typed("ISODate", t.Time().UTC().Format(isoDateLayout)), nil
+	case primitive.Binary:
+		if t.Subtype == bson.TypeBinaryUUID && len(t.Data) == 16 {
+			return typed("UUID", formatUUID(t.Data)), nil
+		}
+		data := base64.StdEncoding.EncodeToString(t.Data)
+		return fmt.Sprintf("BinData(%d,%s)", t.Subtype, strconv.Quote(data)), nil
+	case bson.D:
+		b, err := bson.MarshalExtJSON(t, true, false)
+		if err != nil {
+			return "", fmt.Errorf("invalid document identifier: %w", err)
+		}
+		return string(b), nil
+	case nil:
+		return "", errors.New("identifier value is missing")
 	default:
-		panic(fmt.Sprintf("invalid identifier data type: %T", t))
+		return "", fmt.Errorf("invalid identifier data type: %T", t)
 	}
 }
 
 // ParseIdentifierValue here does the reverse operation of String()
 // e.g. string `ObjectID("X")` will become an actual primitive.ObjectID.
 func ParseIdentifierValue(s string) (*IdentifierValue, error) {
-	// TODO: rewrite via regex
-	if strings.HasPrefix(s, `ObjectID("`) && strings.HasSuffix(s, `")`) {
-		hex, found := strings.CutPrefix(s, `ObjectID("`)
-		if found {
-			hex, _ = strings.CutSuffix(hex, `")`)
+	switch {
+	case s == "":
+		return nil, errors.New("identifier value is empty")
+	case strings.HasPrefix(s, `"`):
+		str, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string identifier: %w", err)
+		}
+		return &IdentifierValue{Value: str}, nil
+	case strings.HasPrefix(s, "{"):
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON([]byte(s), true, &doc); err != nil {
+			return nil, fmt.Errorf("invalid document identifier: %w", err)
+		}
+		return &IdentifierValue{Value: doc}, nil
+	}
+
+	match := constructorRx.FindStringSubmatch(s)
+	if match == nil {
+		// Any other string is simply a string identifier
+		return &IdentifierValue{Value: s}, nil
+	}
+
+	value, err := parseTyped(match[1], match[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s identifier: %w", match[1], err)
+	}
+
+	return &IdentifierValue{Value: value}, nil
+}
+
+// parseTyped parses the value of the given constructor with its raw arguments.
+func parseTyped(constructor, args string) (any, error) {
+	if constructor == "BinData" {
+		subtype, data, found := strings.Cut(args, ",")
+		if !found {
+			return nil, errors.New("subtype and data are expected")
+		}
+		b, err := strconv.ParseUint(subtype, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subtype: %w", err)
 		}
+		decoded, err := unquoteBase64(data)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Subtype: byte(b), Data: decoded}, nil
+	}
 
-		oid, err := primitive.ObjectIDFromHex(hex)
+	arg, err := strconv.Unquote(args)
+	if err != nil {
+		return nil, fmt.Errorf("quoted argument is expected: %w", err)
+	}
+
+	switch constructor {
+	case "ObjectID":
+		oid, err := primitive.ObjectIDFromHex(arg)
 		if err != nil {
 			return nil, fmt.Errorf("invalid hex: %w", err)
 		}
+		return oid, nil
+	case "NumberInt":
+		v, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return int32(v), nil
+	case "NumberLong":
+		return strconv.ParseInt(arg, 10, 64)
+	case "Double":
+		return strconv.ParseFloat(arg, 64)
+	case "NumberDecimal":
+		return primitive.ParseDecimal128(arg)
+	case "ISODate":
+		t, err := time.Parse(isoDateLayout, arg)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	case "UUID":
+		data, err := hex.DecodeString(strings.ReplaceAll(arg, "-", ""))
+		if err != nil || len(data) != 16 {
+			return nil, fmt.Errorf("invalid UUID: %s", arg)
+		}
+		return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: data}, nil
+	default:
+		return nil, fmt.Errorf("unknown identifier type %s", constructor)
+	}
+}
+
+// isAmbiguousString tells if the string identifier must be quoted:
+// it could be confused with other types, or it would be corrupted in the session file.
+func isAmbiguousString(s string) bool {
+	return s == "" ||
+		strings.HasPrefix(s, `"`) ||
+		strings.HasPrefix(s, "{") ||
+		constructorRx.MatchString(s) ||
+		strings.TrimSpace(s) != s ||
+		strconv.Quote(s) != `"`+s+`"`
+}
 
-		return &IdentifierValue{Value: oid}, nil
+// typed returns representation of the value via the given constructor.
+func typed(constructor, arg string) string {
+	return constructor + "(" + strconv.Quote(arg) + ")"
+}
+
+// formatUUID formats 16 bytes as a canonical UUID string.
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// unquoteBase64 decodes the quoted base64 string.
+func unquoteBase64(s string) ([]byte, error) {
+	unquoted, err := strconv.Unquote(s)
+	if err != nil {
+		return nil, fmt.Errorf("quoted data is expected: %w", err)
 	}
 
-	// TODO: allow via flag plaintext string ids
-	// For now: any other string is considered to be simply a hex string
-	oid, err := primitive.ObjectIDFromHex(s)
+	data, err := base64.StdEncoding.DecodeString(unquoted)
 	if err != nil {
-		return nil, fmt.Errorf("invalid hex: %w", err)
+		return nil, fmt.Errorf("invalid base64 data: %w", err)
 	}
-	return &IdentifierValue{Value: oid.Hex()}, nil
+
+	return data, nil
 }
@@ -1,12 +1,14 @@
 package hashing_test
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"pho/internal/hashing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -26,9 +28,19 @@ func TestNewIdentifierValue(t *testing.T) {
 			value:   primitive.NewObjectID(),
 			wantErr: false,
 		},
+		{
+			name:    "int64 identifier",
+			value:   int64(123),
+			wantErr: false,
+		},
+		{
+			name:    "embedded document identifier",
+			value:   bson.D{{Key: "region", Value: "eu"}, {Key: "n", Value: int32(1)}},
+			wantErr: false,
+		},
 		{
 			name:    "invalid type",
-			value:   123, // int is not supported
+			value:   123, // int is not a BSON type (BSON integers are int32 or int64)
 			wantErr: true,
 		},
 		{
@@ -40,22 +52,14 @@ func TestNewIdentifierValue(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defer func() {
-				if r := recover(); r != nil {
-					if !tt.wantErr {
-						assert.Fail(t, "hashing.NewIdentifierValue() unexpected panic", r)
-					}
-				}
-			}()
-
-			id := hashing.NewIdentifierValue(tt.value)
+			id, err := hashing.NewIdentifierValue(tt.value)
 
 			if tt.wantErr {
-				assert.Fail(t, "hashing.NewIdentifierValue() expected panic, got success")
+				assert.Error(t, err)
 				return
 			}
 
-			assert.NotNil(t, id)
+			require.NoError(t, err)
 			assert.Equal(t, tt.value, id.Value)
 		})
 	}
@@ -77,6 +81,46 @@ func TestIdentifierValue_String(t *testing.T) {
 			value:    mustObjectIDFromHex("507f1f77bcf86cd799439011"),
 			expected: "ObjectID(\"507f1f77bcf86cd799439011\")",
 		},
+		{
+			name:     "ambiguous string value",
+			value:    `NumberInt("1")`,
+			expected: `"NumberInt(\"1\")"`,
+		},
+		{
+			name:     "string with spaces around",
+			value:    " padded ",
+			expected: `" padded "`,
+		},
+		{
+			name:     "int32 value",
+			value:    int32(42),
+			expected: `NumberInt("42")`,
+		},
+		{
+			name:     "int64 value",
+			value:    int64(-7),
+			expected: `NumberLong("-7")`,
+		},
+		{
+			name:     "double value",
+			value:    2.5,
+			expected: `Double("2.5")`,
+		},
+		{
+			name:     "UUID value",
+			value:    mustUUID("0123456789abcdef0123456789abcdef"),
+			expected: `UUID("01234567-89ab-cdef-0123-456789abcdef")`,
+		},
+		{
+			name:     "document value",
+			value:    bson.D{{Key: "region", Value: "eu"}, {Key: "n", Value: int32(1)}},
+			expected: `{"region":"eu","n":{"$numberInt":"1"}}`,
+		},
+		{
+			name:     "unsupported value",
+			value:    123,
+			expected: "123",
+		},
 	}
 
 	for _, tt := range tests {
@@ -115,8 +159,26 @@ func TestParseIdentifierValue(t *testing.T) {
 			wantErr:   true,
 		},
 		{
-			name:      "invalid hex string",
+			name:      "plain string",
 			input:     "not-a-valid-hex",
+			wantValue: "not-a-valid-hex",
+			wantErr:   false,
+		},
+		{
+			name:      "int out of int32 range",
+			input:     `NumberInt("3000000000")`,
+			wantValue: nil,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown constructor",
+			input:     `Symbol("x")`,
+			wantValue: nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid UUID",
+			input:     `UUID("0123")`,
 			wantValue: nil,
 			wantErr:   true,
 		},
@@ -166,6 +228,9 @@ func TestParseIdentifierValue(t *testing.T) {
 }
 
 func TestIdentifierValue_RoundTrip(t *testing.T) {
+	decimal, err := primitive.ParseDecimal128("12.50")
+	require.NoError(t, err)
+
 	tests := []struct {
 		name  string
 		value any
@@ -174,37 +239,70 @@ func TestIdentifierValue_RoundTrip(t *testing.T) {
 			name:  "string round trip",
 			value: "507f1f77bcf86cd799439013", // Use valid hex string
 		},
+		{
+			name:  "plain string round trip",
+			value: "user@example.com",
+		},
+		{
+			name:  "ambiguous string round trip",
+			value: `{"looks": "like a document"}`,
+		},
+		{
+			name:  "string with separators round trip",
+			value: "a|b::c\nd",
+		},
 		{
 			name:  "ObjectID round trip",
 			value: mustObjectIDFromHex("507f1f77bcf86cd799439011"),
 		},
+		{
+			name:  "int32 round trip",
+			value: int32(42),
+		},
+		{
+			name:  "int64 round trip",
+			value: int64(9007199254740993),
+		},
+		{
+			name:  "double round trip",
+			value: 0.1,
+		},
+		{
+			name:  "Decimal128 round trip",
+			value: decimal,
+		},
+		{
+			name:  "UUID round trip",
+			value: mustUUID("0123456789abcdef0123456789abcdef"),
+		},
+		{
+			name:  "binary round trip",
+			value: primitive.Binary{Subtype: 0x80, Data: []byte{1, 2, 3}},
+		},
+		{
+			name:  "date round trip",
+			value: primitive.DateTime(1736605800123),
+		},
+		{
+			name:  "compound _id round trip",
+			value: bson.D{{Key: "region", Value: "eu"}, {Key: "seq", Value: int64(7)}},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create identifier value
-			original := &hashing.IdentifierValue{Value: tt.value}
+			original, err := hashing.NewIdentifierValue(tt.value)
+			require.NoError(t, err)
 
 			// Convert to string
 			str := original.String()
 
-			// Parse back
+			// Parse back with type kept
 			parsed, err := hashing.ParseIdentifierValue(str)
 			require.NoError(t, err)
-
-			// Compare values
-			switch originalVal := tt.value.(type) {
-			case primitive.ObjectID:
-				if parsedOID, ok := parsed.Value.(primitive.ObjectID); ok {
-					assert.Equal(t, originalVal, parsedOID)
-				} else {
-					assert.IsType(t, primitive.ObjectID{}, parsed.Value)
-				}
-			case string:
-				// Note: string values get converted to ObjectID hex if they're valid hex
-				// So we compare the string representation instead
-				assert.Equal(t, original.String(), parsed.String())
-			}
+			assert.Equal(t, tt.value, parsed.Value)
+			assert.Equal(t, str, parsed.String())
 		})
 	}
 }
@@ -217,3 +315,12 @@ func mustObjectIDFromHex(hex string) primitive.ObjectID {
 	}
 	return oid
 }
+
+// Helper function to create UUID binary from hex string, panics on error.
+func mustUUID(s string) primitive.Binary {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: data}
+}
@@ -1,6 +1,8 @@
 package pho
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -14,7 +16,10 @@ import (
 	"pho/internal/hashing"
 	"pho/internal/render"
 	"pho/internal/restore"
+	"pho/pkg/bsonyaml"
+	"pho/pkg/extjson"
 	"pho/pkg/jsonl"
+	"regexp"
 	"strings"
 	"time"
 
@@ -26,6 +31,9 @@ import (
 const (
 	phoSessionConf    = "session.conf"         // Session config file
 	phoDumpBase       = "_dump"                // Base filename without extension
+	phoOriginalsFile  = "_originals.jsonl"     // Original documents snapshot (canonical ExtJSON lines)
+	phoUndoFile       = "_undo.json"           // Inverse change set of the last apply
+	phoSchemaFile     = "_dump.schema.json"    // JSON Schema of dumped documents (for editors)
 	connectionTimeout = 500 * time.Millisecond // Timeout for connection preflight check
 	sessionsSubDir    = "sessions"             // Sessions subdirectory in config dir
 )
@@ -41,6 +49,31 @@ type App struct {
 	dbName         string
 	collectionName string
 
+	// sessionName is the explicitly requested session (empty means the active one)
+	sessionName string
+
+	// directoryDump makes the dump a directory with a file per document
+	directoryDump bool
+
+	// identifyBy are fields documents are identified by (default identity if empty)
+	identifyBy []string
+
+	// readOnlyFields are context fields added by the pipeline (see RunPipeline)
+	readOnlyFields []string
+
+	// projectedFields are fields included by the projection (see RunQuery), they go first in tabular dumps
+	projectedFields []string
+
+	// projection of the dump changes are extracted from, fields it hides are kept (see keepHiddenFields)
+	projection string
+
+	// protectedFields are dotted paths of fields that must not be edited (see WithProtected)
+	protectedFields []string
+
+	// maskedFields and maskPattern select sensitive fields, their values are not dumped (see WithMaskedFields)
+	maskedFields []string
+	maskPattern  *regexp.Regexp
+
 	dbClient *mongo.Client
 
 	render *render.Renderer
@@ -98,6 +131,21 @@ func NewApp(opts ...Option) *App {
 func (app *App) getDumpFileExtension() string {
 	config := app.render.GetConfiguration()
 
+	// Directory has no extension, files of documents have their own ones
+	if app.directoryDump {
+		return ""
+	}
+
+	// YAML documents are written as a multi-document stream
+	if config.Format == render.Formats.YAML {
+		return ".yaml"
+	}
+
+	// Tabular formats are named after themselves: .csv or .tsv
+	if app.render.IsTabular() {
+		return "." + string(config.Format)
+	}
+
 	// If output is valid JSON (array format), use .json extension
 	if config.AsValidJSON {
 		return ".json"
@@ -187,6 +235,43 @@ func (app *App) ConnectDBForApply(ctx context.Context) error {
 	return app.ConnectDB(ctx)
 }
 
+// LoadSessionTarget configures the app with the database and collection of the session without connecting to them
+// (e.g. to review changes of a database that is not reachable).
+func (app *App) LoadSessionTarget(ctx context.Context) error {
+	metadata, err := app.readMeta(ctx)
+	if err != nil {
+		return err
+	}
+	if metadata.Database == "" || metadata.Collection == "" {
+		return errors.New("session has no database or collection")
+	}
+
+	app.uri = metadata.URI
+	app.dbName = metadata.Database
+	app.collectionName = metadata.Collection
+
+	return nil
+}
+
+// adoptDumpSyntax switches the renderer to the format (and the app to the layout) the session dump was written in,
+// so it's read back correctly even if current command was given other render flags.
+func (app *App) adoptDumpSyntax(meta *ParsedMeta) {
+	if meta.DirectoryDump {
+		app.directoryDump = true
+	}
+	if app.render == nil {
+		return
+	}
+
+	config := app.render.GetConfiguration()
+	if meta.Format != "" {
+		config.Format = meta.Format
+	}
+	if meta.ExtJSONMode != "" {
+		config.ExtJSONMode = meta.ExtJSONMode
+	}
+}
+
 // Close closes the MongoDB connection.
 func (app *App) Close(ctx context.Context) error {
 	if app.dbClient == nil {
@@ -219,7 +304,9 @@ func (app *App) RunQuery(
 		findOptions.SetSort(parseSort(sort))
 	}
 	if projection != "" {
-		findOptions.SetProjection(parseProjection(projection))
+		projectionD := parseProjection(projection)
+		findOptions.SetProjection(projectionD)
+		app.projectedFields = projectedFields(projectionD)
 	}
 
 	queryBson, err := parseQuery(query)
@@ -244,22 +331,48 @@ func (app *App) RunQuery(
 //		`// changes (X updates, Y deletes, Z inserts, N noops) were applied`
 //		This may be an overwhelming for this function, so  think how to implement this properly
 func (app *App) Dump(ctx context.Context, cursor *mongo.Cursor, out io.Writer) error {
-	renderCfg := app.render.GetConfiguration()
+	var writer dumpWriter = &streamDumpWriter{app: app, out: out}
+	if app.render.IsTabular() {
+		writer = &tableDumpWriter{app: app, out: out}
+	}
 
 	// Collect metadata when dumping to file (not stdout)
+	return app.dump(ctx, cursor, writer, out != os.Stdout)
+}
+
+// dump decodes documents of the cursor and writes them via the given writer.
+// If withMetadata is set, hashes and originals of documents are stored, so the dump can be edited and applied.
+func (app *App) dump(ctx context.Context, cursor *mongo.Cursor, writer dumpWriter, withMetadata bool) error {
+	renderCfg := app.render.GetConfiguration()
+
 	var metadata *ParsedMeta
-	if out != os.Stdout {
+	var originals *originalsWriter
+	if withMetadata {
 		metadata = &ParsedMeta{
 			URI:        app.uri,
 			Database:   app.dbName,
 			Collection: app.collectionName,
+			IdentifyBy: app.identifyBy,
+			ReadOnly:   app.readOnlyFields,
+			Protected:  app.protectedFields,
+			Masked:     app.maskedFields,
 			Lines:      make(map[string]*hashing.HashData),
 		}
+		if app.maskPattern != nil {
+			metadata.MaskPattern = app.maskPattern.String()
+		}
+
+		// Original documents are streamed into the snapshot (in dump order), so changes can be calculated per field
+		var err error
+		if originals, err = app.newOriginalsWriter(); err != nil {
+			return err
+		}
+		defer originals.discard()
 	}
 
 	lineNumber := 0
 	for cursor.Next(ctx) {
-		var result bson.M
+		var result bson.D
 		if err := cursor.Decode(&result); err != nil {
 			if renderCfg.IgnoreFailures {
 				continue
@@ -267,10 +380,14 @@ func (app *App) Dump(ctx context.Context, cursor *mongo.Cursor, out io.Writer) e
 
 			return fmt.Errorf("failed to decode line [%d]: %w", lineNumber, err)
 		}
+		// Sensitive values never leave the database: the dump and session files have placeholders instead
+		result = app.mask(result)
 
 		// Store hash data in metadata when dumping to file
+		// Read-only context fields are not a part of the document, so they are not hashed nor kept as original
 		if metadata != nil {
-			resultHashData, err := hashing.Hash(result)
+			original := withoutFields(result, app.readOnlyFields)
+			resultHashData, err := hashing.Hash(original, app.identifyBy...)
 			if err != nil {
 				if renderCfg.IgnoreFailures {
 					// TODO: reconsider and refactor
@@ -281,33 +398,32 @@ func (app *App) Dump(ctx context.Context, cursor *mongo.Cursor, out io.Writer) e
 
 				return fmt.Errorf("failed to hash line [%d]: %w", lineNumber, err)
 			}
+			// Documents are written back by their identifiers, so they must be unique (e.g. --identify-by fields)
+			if _, ok := metadata.Lines[resultHashData.GetIdentifier()]; ok {
+				return fmt.Errorf("line [%d] %s: %w, identify documents by unique fields",
+					lineNumber, resultHashData.GetIdentifier(), diff.ErrDuplicateIdentifier)
+			}
 			metadata.Lines[resultHashData.GetIdentifier()] = resultHashData
-		}
-
-		resultBytes, err := app.render.FormatResult(result)
-		if err != nil {
-			if renderCfg.IgnoreFailures {
-				continue
+			if err := originals.write(original); err != nil {
+				return err
 			}
-
-			return fmt.Errorf("failed to format line [%d]: %w", lineNumber, err)
-		}
-
-		if lineNumberBytes := app.render.FormatLineNumber(lineNumber); lineNumberBytes != nil {
-			resultBytes = append(lineNumberBytes, resultBytes...)
 		}
 
-		if _, err = out.Write(resultBytes); err != nil {
+		if err := writer.writeDoc(result, lineNumber); err != nil {
 			if renderCfg.IgnoreFailures {
 				continue
 			}
 
-			return fmt.Errorf("failed to write line [%d]: %w", lineNumber, err)
+			return err
 		}
 
 		lineNumber++
 	}
 
+	if err := writer.flush(); err != nil {
+		return err
+	}
+
 	// Write metadata file after processing all documents
 	if metadata != nil {
 		if err := app.writeMetadata(metadata); err != nil {
@@ -315,14 +431,87 @@ func (app *App) Dump(ctx context.Context, cursor *mongo.Cursor, out io.Writer) e
 			//       so we still dump data, but not letting to edit it
 			return fmt.Errorf("failed writing metadata: %w", err)
 		}
+
+		if err := originals.commit(); err != nil {
+			return fmt.Errorf("failed writing originals: %w", err)
+		}
+
+		if err := app.writeSchema(ctx); err != nil {
+			return fmt.Errorf("failed writing schema: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// GetPhoDir returns the pho data directory path.
+// dumpWriter writes documents of the dump one by one.
+type dumpWriter interface {
+	writeDoc(doc bson.D, lineNumber int) error
+	flush() error
+}
+
+// formatFieldComments renders comments marking read-only context fields and protected fields of the document.
+func (app *App) formatFieldComments(doc bson.D) []byte {
+	readOnly := app.render.FormatReadOnlyFields(doc, app.readOnlyFields)
+	return append(readOnly, app.render.FormatProtectedFields(doc, app.protectedFields)...)
+}
+
+// streamDumpWriter writes documents into a single stream as soon as they are formatted.
+type streamDumpWriter struct {
+	app *App
+	out io.Writer
+}
+
+func (w *streamDumpWriter) writeDoc(doc bson.D, lineNumber int) error {
+	resultBytes, err := w.app.render.FormatResult(doc)
+	if err != nil {
+		return fmt.Errorf("failed to format line [%d]: %w", lineNumber, err)
+	}
+
+	if commentBytes := w.app.formatFieldComments(doc); commentBytes != nil {
+		resultBytes = append(commentBytes, resultBytes...)
+	}
+	if lineNumberBytes := w.app.render.FormatLineNumber(lineNumber); lineNumberBytes != nil {
+		resultBytes = append(lineNumberBytes, resultBytes...)
+	}
+
+	if _, err = w.out.Write(resultBytes); err != nil {
+		return fmt.Errorf("failed to write line [%d]: %w", lineNumber, err)
+	}
+
+	return nil
+}
+
+func (w *streamDumpWriter) flush() error { return nil }
+
+// tableDumpWriter collects documents and writes them as a table,
+// as columns of the table depend on all the documents.
+type tableDumpWriter struct {
+	app  *App
+	out  io.Writer
+	rows []bson.D
+}
+
+func (w *tableDumpWriter) writeDoc(doc bson.D, _ int) error {
+	w.rows = append(w.rows, doc)
+	return nil
+}
+
+func (w *tableDumpWriter) flush() error {
+	table, err := w.app.render.FormatTable(w.rows, w.app.projectedFields)
+	if err != nil {
+		return fmt.Errorf("failed to format table: %w", err)
+	}
+	if _, err := w.out.Write(table); err != nil {
+		return fmt.Errorf("failed to write table: %w", err)
+	}
+
+	return nil
+}
+
+// GetPhoDir returns the data directory path of the app's session.
 func (app *App) GetPhoDir() (string, error) {
-	return getPhoDataDir()
+	return app.getDataDir()
 }
 
 // ensureDirectoryExists is a generic function to ensure a directory exists or create it.
@@ -348,9 +537,9 @@ func ensureDirectoryExists(getDirFunc func() (string, error), dirName string) er
 	return nil
 }
 
-// setupPhoDir ensures pho data directory exists or creates it.
+// setupPhoDir ensures data directory of the app's session exists or creates it.
 func (app *App) setupPhoDir() error {
-	return ensureDirectoryExists(getPhoDataDir, "pho data dir")
+	return ensureDirectoryExists(app.getDataDir, "pho data dir")
 }
 
 // setupConfigDir ensures pho config directory exists or creates it.
@@ -374,7 +563,7 @@ func (app *App) writeMetadata(metadata *ParsedMeta) error {
 	}
 
 	// Get data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return fmt.Errorf("could not get pho data dir: %w", err)
 	}
@@ -403,6 +592,11 @@ func (app *App) writeMetadata(metadata *ParsedMeta) error {
 	sessionConfig.URI = metadata.URI
 	sessionConfig.Database = metadata.Database
 	sessionConfig.Collection = metadata.Collection
+	sessionConfig.IdentifyBy = metadata.IdentifyBy
+	sessionConfig.ReadOnly = metadata.ReadOnly
+	sessionConfig.Protected = metadata.Protected
+	sessionConfig.Masked = metadata.Masked
+	sessionConfig.MaskPattern = metadata.MaskPattern
 	sessionConfig.Lines = metadata.Lines
 
 	// Update document count based on the number of hash lines
@@ -421,6 +615,132 @@ func (app *App) writeMetadata(metadata *ParsedMeta) error {
 	return nil
 }
 
+// writeOriginals writes snapshot of original documents next to the session.conf file.
+func (app *App) writeOriginals(docs []bson.D) error {
+	originals, err := app.newOriginalsWriter()
+	if err != nil {
+		return err
+	}
+	defer originals.discard()
+
+	for _, doc := range docs {
+		if err := originals.write(doc); err != nil {
+			return err
+		}
+	}
+
+	if err := originals.commit(); err != nil {
+		return fmt.Errorf("failed writing originals: %w", err)
+	}
+
+	return nil
+}
+
+// originalsWriter streams snapshot of original documents into a file, so they are not kept in memory.
+// Documents are stored as canonical ExtJSON (one per line), so no type information is lost.
+// The snapshot of the previous dump is only replaced on commit.
+type originalsWriter struct {
+	path       string
+	file       *os.File
+	buf        *bufio.Writer
+	marshaller *extjson.Marshaller
+	count      int
+}
+
+// newOriginalsWriter creates a temporary file for the snapshot next to the session.conf file.
+func (app *App) newOriginalsWriter() (*originalsWriter, error) {
+	if err := app.setupPhoDir(); err != nil {
+		return nil, err
+	}
+
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get pho data dir: %w", err)
+	}
+
+	file, err := os.CreateTemp(dataDir, phoOriginalsFile+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed creating originals file: %w", err)
+	}
+
+	return &originalsWriter{
+		path:       filepath.Join(dataDir, phoOriginalsFile),
+		file:       file,
+		buf:        bufio.NewWriter(file),
+		marshaller: extjson.NewCanonicalMarshaller().WithCompact(true),
+	}, nil
+}
+
+// write appends the document to the snapshot.
+func (w *originalsWriter) write(doc bson.D) error {
+	b, err := w.marshaller.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal original doc [%d]: %w", w.count, err)
+	}
+	w.count++
+
+	if _, err := w.buf.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed writing original doc [%d]: %w", w.count-1, err)
+	}
+
+	return nil
+}
+
+// commit replaces the snapshot of the previous dump with the written documents.
+func (w *originalsWriter) commit() error {
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("failed writing originals file: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed writing originals file: %w", err)
+	}
+
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		return fmt.Errorf("failed replacing originals file: %w", err)
+	}
+
+	return nil
+}
+
+// discard removes the temporary file unless the snapshot was committed.
+func (w *originalsWriter) discard() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+// readOriginals reads snapshot of original documents keyed by their identifiers (of the given identity).
+// Sessions created without originals snapshot are still valid, so nil is returned for them.
+func readOriginals(dataDir string, identifyBy []string) (map[string]bson.D, error) {
+	originalsFile, err := os.Open(filepath.Join(dataDir, phoOriginalsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // missing originals is a valid state
+		}
+		return nil, fmt.Errorf("could not open originals: %w", err)
+	}
+	defer originalsFile.Close()
+
+	originals := make(map[string]bson.D)
+	decoder := jsonl.NewDecoder(originalsFile)
+	for i := 0; ; i++ {
+		var doc DumpDoc
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("could not decode originals: %w", err)
+		}
+
+		hashData, err := hashing.Hash(bson.D(doc), identifyBy...)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted original doc [%d]: %w", i, err)
+		}
+		originals[hashData.GetIdentifier()] = bson.D(doc)
+	}
+
+	return originals, nil
+}
+
 // SetupDumpDestination sets up writer (*os.File) for dump to be written in.
 func (app *App) SetupDumpDestination() (*os.File, string, error) {
 	if err := app.setupPhoDir(); err != nil {
@@ -428,7 +748,7 @@ func (app *App) SetupDumpDestination() (*os.File, string, error) {
 	}
 
 	// Get data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return nil, "", fmt.Errorf("could not get pho data dir: %w", err)
 	}
@@ -453,7 +773,14 @@ func (app *App) OpenEditor(editorCmd string, filePath string) error {
 	commandArgs := parts[1:]
 
 	switch editor {
-	case "vim", "nvim", "vi":
+	case "nvim":
+		// Associate documents of the dump with their JSON Schema in the JSON language server
+		if schemaPath, ok := app.getSchemaPath(); ok {
+			// Only directory dumps have a schema, so files of documents are in the opened directory
+			filePattern := filepath.Join(filePath, "*"+app.getDocFileExtension())
+			commandArgs = append(commandArgs, "--cmd", nvimSchemaCommand(filePattern, schemaPath))
+		}
+	case "vim", "vi":
 		// Set syntax JSON
 	default:
 		// more cases
@@ -479,7 +806,7 @@ func (app *App) readMeta(_ context.Context) (*ParsedMeta, error) {
 	}
 
 	// Get data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return nil, fmt.Errorf("could not get pho data dir: %w", err)
 	}
@@ -499,22 +826,62 @@ func (app *App) readMeta(_ context.Context) (*ParsedMeta, error) {
 		return nil, fmt.Errorf("failed to parse session config: %w", err)
 	}
 
-	return sessionConfig.ToParsedMeta(), nil
+	meta := sessionConfig.ToParsedMeta()
+	if meta.Originals, err = readOriginals(dataDir, meta.IdentifyBy); err != nil {
+		return nil, fmt.Errorf("failed to read originals: %w", err)
+	}
+
+	return meta, nil
+}
+
+func (app *App) readDump(ctx context.Context) ([]bson.D, error) {
+	files, err := app.readDumpFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []bson.D
+	for _, file := range files {
+		results = append(results, file.docs...)
+	}
+
+	return results, nil
+}
+
+// dumpFile is a file of the dump along with documents decoded from it.
+type dumpFile struct {
+	path string
+	docs []bson.D
 }
 
-func (app *App) readDump(ctx context.Context) ([]bson.M, error) {
+// readDumpFiles reads files of the dump: either the single dump file or files of the directory dump.
+func (app *App) readDumpFiles(ctx context.Context) ([]*dumpFile, error) {
 	if err := app.setupPhoDir(); err != nil {
 		return nil, err
 	}
 
 	// Get data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return nil, fmt.Errorf("could not get pho data dir: %w", err)
 	}
 
+	if app.directoryDump {
+		return app.readDumpDirectory(ctx, filepath.Join(dataDir, app.getDumpFilename()))
+	}
+
 	dumpFilePath := filepath.Join(dataDir, app.getDumpFilename())
-	dumpReader, err := os.Open(dumpFilePath)
+	docs, err := app.readDumpFile(ctx, dumpFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*dumpFile{{path: dumpFilePath, docs: docs}}, nil
+}
+
+// readDumpFile reads and decodes documents of a single dump file.
+func (app *App) readDumpFile(ctx context.Context, dumpFilePath string) ([]bson.D, error) {
+	dumpData, err := os.ReadFile(dumpFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("could not open dump: %w", ErrNoMeta)
@@ -522,6 +889,11 @@ func (app *App) readDump(ctx context.Context) ([]bson.M, error) {
 		return nil, fmt.Errorf("could not open dump: %w", err)
 	}
 
+	// Conflicts written by apply must be resolved by the user first
+	if hasConflictMarkers(dumpData) {
+		return nil, fmt.Errorf("could not decode dump: %w", ErrUnresolvedConflicts)
+	}
+
 	// Check for context cancellation before decoding
 	select {
 	case <-ctx.Done():
@@ -529,10 +901,52 @@ func (app *App) readDump(ctx context.Context) ([]bson.M, error) {
 	default:
 	}
 
-	var results []bson.M
+	return app.decodeDump(dumpData)
+}
+
+// decodeDump decodes documents written in the format of the renderer.
+func (app *App) decodeDump(dumpData []byte) ([]bson.D, error) {
+	dumpReader := bytes.NewReader(dumpData)
+
+	var results []bson.D
 
 	// Handle different file formats based on extension
-	if app.getDumpFileExtension() == ".json" {
+	switch {
+	case app.render.IsTabular():
+		// Rows are turned back into documents using types declared in the header
+		var err error
+		if results, err = app.render.ParseTable(dumpData); err != nil {
+			return nil, fmt.Errorf("could not decode tabular dump: %w", err)
+		}
+	case app.render.IsYAML():
+		// YAML keeps BSON types via tags, so it's decoded directly into BSON values
+		decoder := bsonyaml.NewDecoder(dumpReader)
+		for {
+			var doc bson.D
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not decode YAML dump: %w", err)
+			}
+			results = append(results, doc)
+		}
+	case app.render.GetConfiguration().ExtJSONMode == render.ExtJSONModes.Shell:
+		// Shell syntax (ExtJSON v1) is not a valid JSON, so it's decoded with its own parser
+		decoder := extjson.NewShellDecoder(dumpReader)
+		for {
+			var doc bson.D
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not decode shell dump: %w", err)
+			}
+			results = append(results, doc)
+		}
+	case !app.directoryDump && app.getDumpFileExtension() == ".json":
 		// For JSON array format
 		var jsonArray []DumpDoc
 		decoder := json.NewDecoder(dumpReader)
@@ -540,20 +954,20 @@ func (app *App) readDump(ctx context.Context) ([]bson.M, error) {
 			return nil, fmt.Errorf("could not decode JSON array dump: %w", err)
 		}
 
-		results = make([]bson.M, len(jsonArray))
+		results = make([]bson.D, len(jsonArray))
 		for i, raw := range jsonArray {
-			results[i] = bson.M(raw)
+			results[i] = bson.D(raw)
 		}
-	} else {
+	default:
 		// For JSONL format (default)
 		raws, err := jsonl.DecodeAll[DumpDoc](dumpReader)
 		if err != nil {
 			return nil, fmt.Errorf("could not decode JSONL dump: %w", err)
 		}
 
-		results = make([]bson.M, len(raws))
+		results = make([]bson.D, len(raws))
 		for i, raw := range raws {
-			results[i] = bson.M(raw)
+			results[i] = bson.D(raw)
 		}
 	}
 
@@ -565,17 +979,44 @@ func (app *App) extractChanges(ctx context.Context) (diff.Changes, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read meta: %w", err)
 	}
+	app.adoptDumpSyntax(meta)
+
+	// Documents are identified and protected the same way they were at the moment of dump
+	app.identifyBy = meta.IdentifyBy
+	app.protectedFields = meta.Protected
+	app.readOnlyFields = meta.ReadOnly
+	app.projection = meta.Projection
+	app.maskedFields = meta.Masked
+	if app.maskPattern, err = ParseMaskPattern(meta.MaskPattern); err != nil {
+		return nil, err
+	}
 
 	dump, err := app.readDump(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read dump: %w", err)
 	}
 
-	return diff.CalculateChanges(meta.Lines, dump)
+	// Edits of read-only context fields are ignored
+	if len(meta.ReadOnly) > 0 {
+		for i, doc := range dump {
+			dump[i] = withoutFields(doc, meta.ReadOnly)
+		}
+	}
+
+	return diff.CalculateChanges(meta.Lines, dump,
+		diff.WithOriginals(meta.Originals),
+		diff.WithIdentifyBy(meta.IdentifyBy),
+		diff.WithProtected(meta.Protected),
+	)
 }
 
-// ReviewChanges output changes in mongo-shell format.
-func (app *App) ReviewChanges(ctx context.Context) error {
+// ReviewChanges output changes in mongo-shell format
+// or as unified diffs of documents (see WithReviewFormat).
+// With WithScript, changes are written into a standalone mongosh script instead.
+// Violations of the collection's $jsonSchema validator are shown as warnings.
+func (app *App) ReviewChanges(ctx context.Context, opts ...ReviewOption) error {
+	reviewOpts := newReviewOptions(opts...)
+
 	if app.collectionName == "" {
 		return errors.New("collection name is required")
 	}
@@ -590,8 +1031,50 @@ func (app *App) ReviewChanges(ctx context.Context) error {
 
 	changes := allChanges.EffectiveOnes()
 
+	// Patches are machine-readable, so nothing but the patch itself is written
+	if reviewOpts.format.IsPatch() {
+		writeProtectedEdits(os.Stderr, changes.WithProtectedEdits())
+		app.reviewViolations(ctx, os.Stderr, changes)
+		return writePatch(os.Stdout, changes, reviewOpts.format)
+	}
+
 	_, _ = fmt.Fprintf(os.Stdout, "// Effective changes: %d\n", changes.Len())
 	_, _ = fmt.Fprintf(os.Stdout, "// Noop changes: %d\n", allChanges.FilterByAction(diff.ActionNoop).Len())
+	writeProtectedEdits(os.Stdout, changes.WithProtectedEdits())
+	app.reviewViolations(ctx, os.Stdout, changes)
+
+	if reviewOpts.script != "" {
+		if err := checkMaskedWrites(changes); err != nil {
+			return err
+		}
+		if err := app.checkProjectedWrites(changes); err != nil {
+			return err
+		}
+		script, err := restore.NewMongoShellScript(app.dbName, app.collectionName,
+			restore.WithTransaction(reviewOpts.scriptTransaction),
+		).Build(changes)
+		if err != nil {
+			return fmt.Errorf("could not build mongo shell script: %w", err)
+		}
+
+		if err := os.WriteFile(reviewOpts.script, []byte(script), 0600); err != nil {
+			return fmt.Errorf("could not write mongo shell script: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(os.Stdout, "// Script is written to %s\n", reviewOpts.script)
+		return nil
+	}
+
+	if reviewOpts.format == ReviewFormats.Diff {
+		diffWriter := app.newDiffWriter(os.Stdout, reviewOpts.color)
+		for _, ch := range changes {
+			if err := diffWriter.Write(ch); err != nil {
+				return fmt.Errorf("could not write diff of %s: %w", ch.Identifier(), err)
+			}
+		}
+
+		return nil
+	}
 
 	mongoShellRestorer := restore.NewMongoShellRestorer(app.collectionName)
 
@@ -607,7 +1090,18 @@ func (app *App) ReviewChanges(ctx context.Context) error {
 }
 
 // ApplyChanges applies (executes) the changes.
-func (app *App) ApplyChanges(ctx context.Context) error {
+// Before writing anything, documents affected by updates and deletes are checked against the database:
+// if any of them were modified since the dump, user's edits are three-way merged with the live versions.
+// Conflicts that can't be merged automatically are written into the dump with conflict markers
+// and nothing is applied (unless WithForce is given).
+// With WithAtomic, all changes are applied in a single transaction: the first failure rolls back everything.
+// Otherwise, large change sets (see WithBulkThreshold) are applied in batches via BulkWrite.
+// The inverse change set is stored before writing, so applied changes can be reverted via Undo.
+// Documents are validated against the collection's $jsonSchema validator first (unless WithSkipValidation is given):
+// violations are reported all at once and nothing is applied.
+// With WithDryRun, changes are only checked against the database (see WithDryRun).
+// Nothing is applied if protected fields are edited (unless WithAllowProtectedEdits is given).
+func (app *App) ApplyChanges(ctx context.Context, opts ...ApplyOption) error {
 	if app.collectionName == "" {
 		return errors.New("collection name is required")
 	}
@@ -615,6 +1109,8 @@ func (app *App) ApplyChanges(ctx context.Context) error {
 		return errors.New("db name is required")
 	}
 
+	applyOpts := newApplyOptions(opts...)
+
 	col := app.dbClient.Database(app.dbName).Collection(app.collectionName)
 
 	allChanges, err := app.extractChanges(ctx)
@@ -632,22 +1128,57 @@ func (app *App) ApplyChanges(ctx context.Context) error {
 	_, _ = fmt.Fprintf(os.Stdout, "// Effective changes: %d\n", changes.Len())
 	_, _ = fmt.Fprintf(os.Stdout, "// Noop changes: %d\n", allChanges.FilterByAction(diff.ActionNoop).Len())
 
-	mongoClientRestorer := restore.NewMongoClientRestorer(col)
+	if err := checkProtectedEdits(changes, applyOpts.allowProtectedEdits); err != nil {
+		return err
+	}
 
-	var applyErrors []error
-	for _, ch := range changes {
-		if mongoCmd, err := mongoClientRestorer.Build(ch); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "could not build mongo shell command: %v\n", err)
-			applyErrors = append(applyErrors, err)
-		} else {
-			err := mongoCmd(ctx)
-			if err != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "failed to apply change: %v\n", err)
-				applyErrors = append(applyErrors, err)
+	// Conflicts are only reported by the dry run: merging them would modify the dump
+	if applyOpts.dryRun {
+		if err := app.unmaskChanges(ctx, col, changes); err != nil {
+			return err
+		}
+		if err := app.keepHiddenFields(ctx, col, changes); err != nil {
+			return err
+		}
+		return app.dryRun(ctx, col, changes, !applyOpts.force)
+	}
+
+	if !applyOpts.force {
+		meta, err := app.readMeta(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read meta: %w", err)
+		}
+
+		conflicts, err := app.detectConflicts(ctx, col, changes, meta)
+		if err != nil {
+			return fmt.Errorf("failed to check for conflicts: %w", err)
+		}
+
+		if len(conflicts) > 0 {
+			if changes, err = app.resolveConflicts(ctx, changes, conflicts, meta); err != nil {
+				return err
 			}
 		}
 	}
 
+	if err := app.unmaskChanges(ctx, col, changes); err != nil {
+		return err
+	}
+	if err := app.keepHiddenFields(ctx, col, changes); err != nil {
+		return err
+	}
+
+	if !applyOpts.skipValidation {
+		if err := app.validateChanges(ctx, col, changes); err != nil {
+			return err
+		}
+	}
+
+	applyErrors, err := app.writeChanges(ctx, col, changes, applyOpts)
+	if err != nil {
+		return err
+	}
+
 	// Only clear the session if all changes were applied successfully
 	if len(applyErrors) == 0 {
 		if err := app.ClearSession(ctx); err != nil {
@@ -661,3 +1192,109 @@ func (app *App) ApplyChanges(ctx context.Context) error {
 
 	return nil
 }
+
+// writeChanges writes the changes to the collection the way apply options say.
+// Inverse changes of the ones that were applied are stored afterwards, so they can be reverted via Undo.
+// Failures of individual changes are returned as a list, while the error means nothing was applied.
+func (app *App) writeChanges(
+	ctx context.Context,
+	col *mongo.Collection,
+	changes diff.Changes,
+	applyOpts *applyOptions,
+) ([]*ChangeError, error) {
+	if changes.Len() == 0 {
+		return nil, nil
+	}
+
+	// Pre-apply state is captured before anything is written, so applied changes can be reverted
+	inverses, err := app.captureUndo(ctx, col, changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture undo data: %w", err)
+	}
+
+	var applyErrors []*ChangeError
+	switch {
+	case applyOpts.atomic:
+		if err := app.applyAtomically(ctx, col, changes); err != nil {
+			// Nothing was applied, so undo data of the previous apply is kept
+			return nil, fmt.Errorf("nothing applied, all changes were rolled back: %w", err)
+		}
+	case applyOpts.bulkThreshold > 0 && changes.Len() >= applyOpts.bulkThreshold:
+		applyErrors = app.applyInBulk(ctx, col, changes, applyOpts)
+	default:
+		applyErrors = app.applyOneByOne(ctx, col, changes)
+	}
+
+	// Only applied changes are reverted, if nothing was applied undo data of the previous apply is kept
+	if undo := succeededUndo(inverses, applyErrors); undo.Len() > 0 {
+		if err := app.writeUndo(undo); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: failed to write undo data: %v\n", err)
+		}
+	}
+
+	return applyErrors, nil
+}
+
+// applyOneByOne applies changes one by one, continuing on failures.
+func (app *App) applyOneByOne(ctx context.Context, col *mongo.Collection, changes diff.Changes) []*ChangeError {
+	mongoClientRestorer := restore.NewMongoClientRestorer(col)
+
+	var applyErrors []*ChangeError
+	for i, ch := range changes {
+		if mongoCmd, err := mongoClientRestorer.Build(ch); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "could not build mongo shell command: %v\n", err)
+			applyErrors = append(applyErrors, &ChangeError{Index: i, Change: ch, Err: err})
+		} else {
+			err := mongoCmd(ctx)
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to apply change: %v\n", err)
+				applyErrors = append(applyErrors, &ChangeError{Index: i, Change: ch, Err: err})
+			}
+		}
+	}
+
+	return applyErrors
+}
+
+// applyInBulk applies changes in batches via BulkWrite, reporting failures per document.
+func (app *App) applyInBulk(
+	ctx context.Context,
+	col *mongo.Collection,
+	changes diff.Changes,
+	applyOpts *applyOptions,
+) []*ChangeError {
+	mongoBulkRestorer := restore.NewMongoBulkRestorer(col,
+		restore.WithBatchSize(applyOpts.batchSize),
+		restore.WithOrdered(!applyOpts.unordered),
+	)
+
+	results, err := mongoBulkRestorer.Restore(ctx, changes)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to apply changes in bulk: %v\n", err)
+	}
+	// Nothing was executed if there are no results
+	if results == nil {
+		applyErrors := make([]*ChangeError, 0, changes.Len())
+		for i, ch := range changes {
+			applyErrors = append(applyErrors, &ChangeError{Index: i, Change: ch, Err: err})
+		}
+		return applyErrors
+	}
+
+	var applyErrors []*ChangeError
+	for i, result := range results {
+		if result.Err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to apply change %s %s: %v\n",
+				result.Change.Action, result.Identifier(), result.Err)
+			applyErrors = append(applyErrors, &ChangeError{Index: i, Change: result.Change, Err: result.Err})
+			continue
+		}
+		// Such changes are most likely applied, so they are kept in undo data
+		if result.Unconfirmed != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "// WARNING: change %s %s may not have been applied: %v\n",
+				result.Change.Action, result.Identifier(), result.Unconfirmed)
+		}
+	}
+
+	return applyErrors
+}
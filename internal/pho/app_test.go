@@ -4,16 +4,28 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"pho/internal/diff"
+	"pho/internal/hashing"
 	"pho/internal/pho"
 	"pho/internal/render"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// field returns the top-level field of the document (nil when missing).
+func field(doc bson.D, key string) any {
+	value, _ := diff.LookupPath(doc, key)
+	return value
+}
+
 func TestNewApp(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -112,6 +124,19 @@ func TestApp_getDumpFileExtension(t *testing.T) {
 			assert.Equal(t, tt.expectedExt, result)
 		})
 	}
+
+	for format, expectedExt := range map[render.Format]string{
+		render.Formats.YAML: ".yaml",
+		render.Formats.CSV:  ".csv",
+		render.Formats.TSV:  ".tsv",
+	} {
+		t.Run(string(format)+" format", func(t *testing.T) {
+			renderer := render.NewRenderer(render.WithFormat(format), render.WithAsValidJSON(true))
+
+			ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(renderer))}
+			assert.Equal(t, expectedExt, ar.GetDumpFileExtension())
+		})
+	}
 }
 
 func TestApp_getDumpFilename(t *testing.T) {
@@ -598,6 +623,245 @@ func TestApp_extractChanges_errors(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestApp_extractChanges_fieldLevel(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	renderer := render.NewRenderer(render.WithAsValidJSON(false))
+	app := pho.NewApp(pho.WithRenderer(renderer))
+	ctx := context.Background()
+
+	original := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"test","legacy":true,"address":{"city":"Kyiv"}}`
+	edited := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"test","address":{"city":"Lviv"}}`
+
+	var originalDoc pho.DumpDoc
+	require.NoError(t, originalDoc.UnmarshalJSON([]byte(original)))
+	hashData, err := hashing.Hash(bson.D(originalDoc))
+	require.NoError(t, err)
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Lines:      map[string]*hashing.HashData{hashData.GetIdentifier(): hashData},
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoOriginalsFile()), []byte(original+"\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.jsonl"), []byte("/* 0 */\n"+edited+"\n"), 0600))
+
+	ar := pho.AppReflect{App: app}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	assert.Equal(t, diff.ActionUpdated, changes[0].Action)
+	assert.Equal(t, bson.D(originalDoc), changes[0].Original)
+	assert.Equal(t, []string{"address.city", "legacy"}, changes[0].FieldChanges.Paths())
+}
+
+func TestApp_extractChanges_shellMode(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	renderer := render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Shell), render.WithShowLineNumbers(true))
+	app := pho.NewApp(pho.WithRenderer(renderer))
+	ctx := context.Background()
+
+	created := primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 0, time.UTC))
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "test"},
+			{Key: "count", Value: int64(1)},
+			{Key: "created", Value: created},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "other"},
+			{Key: "count", Value: int64(2)},
+			{Key: "created", Value: created},
+		},
+	}
+
+	lines := make(map[string]*hashing.HashData)
+	var dump []byte
+	for i, doc := range docs {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+
+		formatted, err := renderer.FormatResult(doc)
+		require.NoError(t, err)
+		dump = append(append(dump, renderer.FormatLineNumber(i)...), formatted...)
+	}
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	edited := strings.Replace(string(dump), `"test"`, `"renamed"`, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.jsonl"), []byte(edited), 0600))
+
+	ar := pho.AppReflect{App: app}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	// Shell constructors keep types, so the untouched document is a noop
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "renamed", field(updates[0].Data, "name"))
+	assert.Equal(t, int64(1), field(updates[0].Data, "count"))
+	assert.Equal(t, created, field(updates[0].Data, "created"))
+}
+
+func TestApp_extractChanges_yamlFormat(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	yamlRenderer := render.NewRenderer(render.WithFormat(render.Formats.YAML), render.WithShowLineNumbers(true))
+	ctx := context.Background()
+
+	created := primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 0, time.UTC))
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "test"},
+			{Key: "count", Value: int64(1)},
+			{Key: "created", Value: created},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "other"},
+			{Key: "count", Value: int64(2)},
+			{Key: "created", Value: created},
+		},
+	}
+
+	lines := make(map[string]*hashing.HashData)
+	var dump []byte
+	for i, doc := range docs {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+
+		formatted, err := yamlRenderer.FormatResult(doc)
+		require.NoError(t, err)
+		dump = append(append(dump, yamlRenderer.FormatLineNumber(i)...), formatted...)
+	}
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		Format:     string(render.Formats.YAML),
+		DumpFile:   "_dump.yaml",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	edited := strings.Replace(string(dump), "name: test", "name: renamed", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.yaml"), []byte(edited), 0600))
+
+	// Format the dump was written in is taken from the session, not from the current renderer
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Canonical))))
+	ar := pho.AppReflect{App: app}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	// YAML tags keep types, so the untouched document is a noop
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "renamed", field(updates[0].Data, "name"))
+	assert.Equal(t, int64(1), field(updates[0].Data, "count"))
+	assert.Equal(t, created, field(updates[0].Data, "created"))
+}
+
+func TestApp_extractChanges_tabularFormat(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	renderer := render.NewRenderer(render.WithFormat(render.Formats.CSV))
+	ctx := context.Background()
+
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "pen"},
+			{Key: "price", Value: 1.5},
+			{Key: "stock", Value: bson.D{{Key: "count", Value: int32(1)}}},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "pencil"},
+			{Key: "price", Value: 0.5},
+			{Key: "stock", Value: bson.D{{Key: "count", Value: int32(2)}}},
+		},
+	}
+
+	lines := make(map[string]*hashing.HashData)
+	for _, doc := range docs {
+		hashData, err := hashing.Hash(doc)
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+	}
+
+	table, err := renderer.FormatTable(docs, []string{"price"})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(table), "_id:oid,price:double,name:string,stock.count:int\n"))
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "products",
+		Format:     string(render.Formats.CSV),
+		DumpFile:   "_dump.csv",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	edited := strings.Replace(string(table), ",1.5,pen,1", ",2.25,pen,5", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.csv"), []byte(edited), 0600))
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer()))}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	// Typed columns keep types, so the untouched row is a noop
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, 2.25, field(updates[0].Data, "price"))
+	assert.Equal(t, bson.D{{Key: "count", Value: int32(5)}}, field(updates[0].Data, "stock"))
+}
+
 func TestConstants(t *testing.T) {
 	phoDir, err := pho.GetPhoDir()
 	require.NoError(t, err)
@@ -611,3 +875,244 @@ func TestErrors(t *testing.T) {
 	assert.Equal(t, "meta file is missing", pho.GetErrNoMeta().Error())
 	assert.Equal(t, "dump file is missing", pho.GetErrNoDump().Error())
 }
+
+func TestApp_extractChanges_directoryDump(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ctx := context.Background()
+	kept, edited, deleted := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	cursor, err := mongo.NewCursorFromDocuments([]any{
+		bson.M{"_id": kept, "name": "kept"},
+		bson.M{"_id": edited, "name": "edited"},
+		bson.M{"_id": deleted, "name": "deleted"},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	dumper := pho.NewApp(
+		pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Relaxed))),
+		pho.WithDirectoryDump(true),
+	)
+	dirPath, err := dumper.SetupDumpDirectory()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, pho.GetPhoDumpBase()), dirPath)
+	require.NoError(t, dumper.DumpToDirectory(ctx, cursor, dirPath))
+
+	entries, err := os.ReadDir(dirPath)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	// Layout is recorded in the session, as commands reading the dump know nothing about it
+	sessionPath := filepath.Join(tempDir, pho.GetPhoSessionConf())
+	data, err := os.ReadFile(sessionPath)
+	require.NoError(t, err)
+	sessionConfig := &pho.SessionConfig{}
+	require.NoError(t, sessionConfig.FromSessionConf(data))
+	sessionConfig.DumpLayout = "directory"
+	data, err = sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sessionPath, data, 0600))
+
+	editedPath := filepath.Join(dirPath, edited.Hex()+".json")
+	content, err := os.ReadFile(editedPath)
+	require.NoError(t, err)
+	content = []byte(strings.Replace(string(content), `"edited"`, `"renamed"`, 1))
+	require.NoError(t, os.WriteFile(editedPath, content, 0600))
+	require.NoError(t, os.Remove(filepath.Join(dirPath, deleted.Hex()+".json")))
+	newDoc := []byte(`{"_id": "added-1", "name": "added"}`)
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, "new.json"), newDoc, 0600))
+	// Editor leftovers are not documents
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, ".new.json.swp"), []byte("garbage"), 0600))
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer()))}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "renamed", field(updates[0].Data, "name"))
+
+	deletes := changes.FilterByAction(diff.ActionDeleted)
+	require.Len(t, deletes, 1)
+	assert.Equal(t, deleted, deletes[0].IdentifierValue)
+
+	adds := changes.FilterByAction(diff.ActionAdded)
+	require.Len(t, adds, 1)
+	assert.Equal(t, "added", field(adds[0].Data, "name"))
+}
+
+func TestApp_extractChanges_identifyBy(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ctx := context.Background()
+	cursor, err := mongo.NewCursorFromDocuments([]any{
+		bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: int32(10)}},
+		bson.D{{Key: "tenant_id", Value: "globex"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: int32(20)}},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	dumper := pho.NewApp(
+		pho.WithRenderer(render.NewRenderer(
+			render.WithExtJSONMode(render.ExtJSONModes.Relaxed),
+			render.WithCompactJSON(true),
+		)),
+		pho.WithIdentifyBy([]string{"tenant_id", "sku"}),
+	)
+	out, dumpPath, err := dumper.SetupDumpDestination()
+	require.NoError(t, err)
+	require.NoError(t, dumper.Dump(ctx, cursor, out))
+	require.NoError(t, out.Close())
+
+	// Identity is recorded in the session, as commands reading the dump know nothing about it
+	sessionConf, err := os.ReadFile(filepath.Join(tempDir, pho.GetPhoSessionConf()))
+	require.NoError(t, err)
+	assert.Contains(t, string(sessionConf), "IdentifyBy: tenant_id,sku\n")
+
+	dump, err := os.ReadFile(dumpPath)
+	require.NoError(t, err)
+	edited := strings.Replace(string(dump), `"price":20`, `"price":25`, 1)
+	require.NoError(t, os.WriteFile(dumpPath, []byte(edited), 0600))
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer()))}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "tenant_id,sku", updates[0].IdentifiedBy)
+	assert.Equal(t, bson.M{"tenant_id": "globex", "sku": "SKU-1"}, updates[0].Filter())
+	assert.Equal(t, []string{"price"}, updates[0].FieldChanges.Paths())
+}
+
+func TestApp_Dump_duplicateIdentifiers(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	cursor, err := mongo.NewCursorFromDocuments([]any{
+		bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}},
+		bson.D{{Key: "tenant_id", Value: "globex"}, {Key: "sku", Value: "SKU-1"}},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	// Documents identified by non-unique fields can't be written back safely
+	dumper := pho.NewApp(
+		pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Relaxed))),
+		pho.WithIdentifyBy([]string{"sku"}),
+	)
+	out, _, err := dumper.SetupDumpDestination()
+	require.NoError(t, err)
+	defer out.Close()
+
+	err = dumper.Dump(context.Background(), cursor, out)
+	require.ErrorIs(t, err, diff.ErrDuplicateIdentifier)
+	assert.Contains(t, err.Error(), "sku::SKU-1")
+}
+
+func TestApp_Dump_originals(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	dump := func(docs ...any) error {
+		cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+		require.NoError(t, err)
+
+		dumper := pho.NewApp(
+			pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Relaxed))),
+			pho.WithIdentifyBy([]string{"sku"}),
+		)
+		out, _, err := dumper.SetupDumpDestination()
+		require.NoError(t, err)
+		defer out.Close()
+
+		return dumper.Dump(context.Background(), cursor, out)
+	}
+
+	// Originals are written in dump order as canonical ExtJSON lines
+	require.NoError(t, dump(
+		bson.D{{Key: "sku", Value: "SKU-2"}, {Key: "price", Value: int32(20)}},
+		bson.D{{Key: "sku", Value: "SKU-1"}, {Key: "price", Value: int32(10)}},
+	))
+	originalsPath := filepath.Join(tempDir, pho.GetPhoOriginalsFile())
+	originals, err := os.ReadFile(originalsPath)
+	require.NoError(t, err)
+	assert.Equal(t, `{"sku":"SKU-2","price":{"$numberInt":"20"}}`+"\n"+
+		`{"sku":"SKU-1","price":{"$numberInt":"10"}}`+"\n", string(originals))
+
+	// Failed dumps keep originals of the previous one and leave no temporary files behind
+	err = dump(bson.D{{Key: "sku", Value: "SKU-3"}}, bson.D{{Key: "sku", Value: "SKU-3"}})
+	require.ErrorIs(t, err, diff.ErrDuplicateIdentifier)
+
+	kept, err := os.ReadFile(originalsPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(originals), string(kept))
+
+	temporary, err := filepath.Glob(originalsPath + ".*")
+	require.NoError(t, err)
+	assert.Empty(t, temporary)
+}
+
+func TestApp_SetupDumpDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer()), pho.WithDirectoryDump(true))
+	dirPath, err := app.SetupDumpDirectory()
+	require.NoError(t, err)
+
+	// Files of the previous dump are removed, otherwise they would be read as new documents
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, "stale.json"), []byte(`{}`), 0600))
+	_, err = app.SetupDumpDirectory()
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dirPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	tabular := pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithFormat(render.Formats.CSV))))
+	_, err = tabular.SetupDumpDirectory()
+	require.Error(t, err)
+}
+
+func TestApp_docFileName(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer()))}
+	taken := make(map[string]struct{})
+
+	tests := []struct {
+		name     string
+		doc      bson.D
+		expected string
+	}{
+		{name: "object id", doc: bson.D{{Key: "_id", Value: oid}}, expected: "507f1f77bcf86cd799439011.json"},
+		{name: "string id", doc: bson.D{{Key: "_id", Value: "user-1"}}, expected: "user-1.json"},
+		{name: "numeric id", doc: bson.D{{Key: "_id", Value: int32(42)}}, expected: "42.json"},
+		{name: "unsafe characters", doc: bson.D{{Key: "_id", Value: "../a/b c"}}, expected: "_a_b_c.json"},
+		{name: "no id", doc: bson.D{{Key: "name", Value: "x"}}, expected: "new.json"},
+		{name: "duplicate", doc: bson.D{{Key: "_id", Value: "user-1"}}, expected: "user-1-2.json"},
+		{name: "duplicate ignoring case", doc: bson.D{{Key: "_id", Value: "User-1"}}, expected: "User-1-3.json"},
+		{name: "object id ignoring case", doc: bson.D{{Key: "_id", Value: "507F1F77BCF86CD799439011"}},
+			expected: "507F1F77BCF86CD799439011-2.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ar.DocFileName(tt.doc, taken))
+		})
+	}
+}
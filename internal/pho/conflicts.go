@@ -0,0 +1,104 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrConflicts = errors.New("conflicting changes detected")
+
+// Conflict describes a change which target document was changed in the database after it was dumped.
+type Conflict struct {
+	// Change that can't be safely applied
+	Change *diff.Change
+
+	// Live is the current version of the document in the database (nil if it doesn't exist anymore)
+	Live bson.D
+
+	// Reason is a human-readable explanation of the conflict
+	Reason string
+}
+
+// String returns a human-readable description of the conflict.
+func (c *Conflict) String() string {
+	return fmt.Sprintf("%s %s:%v: %s", c.Change.Action, c.Change.IdentifiedBy, c.Change.IdentifierValue, c.Reason)
+}
+
+// detectConflicts re-fetches documents affected by updates, deletes and renames (by their previous identifiers)
+// and compares their current checksums with the ones stored in the session.
+// Documents are re-fetched with the session's projection, so checksums are comparable.
+func (app *App) detectConflicts(
+	ctx context.Context,
+	col *mongo.Collection,
+	changes diff.Changes,
+	meta *ParsedMeta,
+) ([]*Conflict, error) {
+	findOptions := options.FindOne()
+	if meta.Projection != "" {
+		findOptions.SetProjection(parseProjection(meta.Projection))
+	}
+
+	var conflicts []*Conflict
+	for _, ch := range changes {
+		filter := ch.Filter()
+		switch ch.Action {
+		case diff.ActionUpdated, diff.ActionDeleted:
+		case diff.ActionRenamed:
+			// Renamed document is expected to exist under its previous identifier
+			filter = ch.RenamedFromFilter()
+		default:
+			continue
+		}
+
+		var live bson.D
+		err := col.FindOne(ctx, filter, findOptions).Decode(&live)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("failed to fetch live document %s:%v: %w", ch.IdentifiedBy, ch.IdentifierValue, err)
+		}
+
+		conflict, err := app.checkConflict(ch, live, meta)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts, nil
+}
+
+// checkConflict compares the checksum of the live version of the change's document (nil if it doesn't exist anymore)
+// with the one stored in the session, it returns nil if the document was not changed since it was dumped.
+func (app *App) checkConflict(ch *diff.Change, live bson.D, meta *ParsedMeta) (*Conflict, error) {
+	if live == nil {
+		return &Conflict{Change: ch, Reason: "document no longer exists"}, nil
+	}
+
+	// Read-only context fields are not hashed at dump time, so they are not compared,
+	// and masked ones are hashed as placeholders
+	live = app.mask(withoutFields(live, meta.ReadOnly))
+
+	liveHashData, err := hashing.Hash(live, meta.IdentifyBy...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash live document %s:%v: %w", ch.IdentifiedBy, ch.IdentifierValue, err)
+	}
+
+	dumped, ok := meta.Lines[liveHashData.GetIdentifier()]
+	if ok && dumped.GetChecksum() == liveHashData.GetChecksum() {
+		return nil, nil //nolint:nilnil // no conflict is not an error
+	}
+
+	return &Conflict{
+		Change: ch,
+		Live:   live,
+		Reason: "document was modified in the database since it was dumped",
+	}, nil
+}
@@ -0,0 +1,127 @@
+package pho_test
+
+import (
+	"errors"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/internal/pho"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConflict_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		conflict *pho.Conflict
+		expected string
+	}{
+		{
+			name: "modified document",
+			conflict: &pho.Conflict{
+				Change: diff.NewChange("_id", "doc1", diff.ActionUpdated),
+				Reason: "document was modified in the database since it was dumped",
+			},
+			expected: "UPDATED _id:doc1: document was modified in the database since it was dumped",
+		},
+		{
+			name: "missing document",
+			conflict: &pho.Conflict{
+				Change: diff.NewChange("_id", "doc2", diff.ActionDeleted),
+				Reason: "document no longer exists",
+			},
+			expected: "DELETED _id:doc2: document no longer exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.conflict.String())
+		})
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	dumped := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Alice"}, {Key: "password", Value: "hash"}}
+	hashData, err := hashing.Hash(dumped)
+	require.NoError(t, err)
+	meta := &pho.ParsedMeta{
+		Lines:    map[string]*hashing.HashData{hashData.GetIdentifier(): hashData},
+		ReadOnly: []string{"owner"},
+	}
+
+	tests := []struct {
+		name           string
+		live           bson.D
+		expectedReason string
+	}{
+		{
+			name: "unchanged document",
+			live: dumped,
+		},
+		{
+			name: "read-only fields are not compared",
+			live: append(bson.D{{Key: "owner", Value: bson.D{{Key: "name", Value: "Bob"}}}}, dumped...),
+		},
+		{
+			name: "changed document",
+			live: bson.D{
+				{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Alicia"}, {Key: "password", Value: "hash"},
+			},
+			expectedReason: "document was modified in the database since it was dumped",
+		},
+		{
+			name:           "deleted in the database",
+			live:           nil,
+			expectedReason: "document no longer exists",
+		},
+	}
+
+	ar := pho.AppReflect{App: pho.NewApp()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, dumped)
+
+			conflict, err := ar.CheckConflict(ch, tt.live, meta)
+			require.NoError(t, err)
+			if tt.expectedReason == "" {
+				assert.Nil(t, conflict)
+				return
+			}
+
+			require.NotNil(t, conflict)
+			assert.Same(t, ch, conflict.Change)
+			assert.Equal(t, tt.expectedReason, conflict.Reason)
+		})
+	}
+
+	t.Run("masked fields are compared as placeholders", func(t *testing.T) {
+		maskedDump := bson.D{{Key: "_id", Value: "doc1"}, {Key: "password", Value: diff.MaskPlaceholder}}
+		maskedHash, err := hashing.Hash(maskedDump)
+		require.NoError(t, err)
+		maskedMeta := &pho.ParsedMeta{Lines: map[string]*hashing.HashData{maskedHash.GetIdentifier(): maskedHash}}
+
+		masking := pho.AppReflect{App: pho.NewApp(pho.WithMaskedFields([]string{"password"}))}
+		live := bson.D{{Key: "_id", Value: "doc1"}, {Key: "password", Value: "rotated"}}
+
+		conflict, err := masking.CheckConflict(diff.NewChange("_id", "doc1", diff.ActionDeleted), live, maskedMeta)
+		require.NoError(t, err)
+		assert.Nil(t, conflict)
+	})
+}
+
+func TestErrConflicts(t *testing.T) {
+	wrapped := errors.Join(errors.New("context"), pho.ErrConflicts)
+	assert.ErrorIs(t, wrapped, pho.ErrConflicts)
+	assert.Equal(t, "conflicting changes detected", pho.ErrConflicts.Error())
+}
+
+func TestSessionConfig_ToParsedMeta_Projection(t *testing.T) {
+	sc := &pho.SessionConfig{Collection: "users", Projection: `{"name": 1}`}
+
+	meta := sc.ToParsedMeta()
+	assert.Equal(t, `{"name": 1}`, meta.Projection)
+}
@@ -0,0 +1,192 @@
+package pho
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"pho/internal/diff"
+	"pho/internal/restore"
+	"text/tabwriter"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DryRunVerdict is the result of checking a single change by the dry run.
+type DryRunVerdict struct {
+	Change *diff.Change
+
+	// Err is the reason the change would fail to be applied (nil if it would be applied)
+	Err error
+}
+
+// dryRun checks the changes against the database without writing them and prints a verdict per change.
+// Documents modified in the database since the dump are reported as conflicts (unless checkConflicts is off).
+func (app *App) dryRun(ctx context.Context, col *mongo.Collection, changes diff.Changes, checkConflicts bool) error {
+	conflicts := make(map[*diff.Change]*Conflict)
+	if checkConflicts && changes.Len() > 0 {
+		meta, err := app.readMeta(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read meta: %w", err)
+		}
+
+		detected, err := app.detectConflicts(ctx, col, changes, meta)
+		if err != nil {
+			return fmt.Errorf("failed to check for conflicts: %w", err)
+		}
+		for _, conflict := range detected {
+			conflicts[conflict.Change] = conflict
+		}
+	}
+
+	verdicts, err := app.checkChanges(ctx, col, changes, conflicts)
+	if err != nil {
+		return err
+	}
+
+	failed := writeVerdicts(os.Stdout, verdicts)
+	if failed > 0 {
+		return fmt.Errorf("dry run: %d of %d change(s) would fail", failed, len(verdicts))
+	}
+
+	return nil
+}
+
+// checkChanges validates the changes against the database without committing anything.
+// Changes are executed in order via MongoClientRestorer inside a single transaction that is always aborted,
+// so the server checks each of them exactly as on apply, including its dependencies on the previous ones
+// (e.g. swapped values of a unique field or chained renames): unique indexes, the collection's validator, etc.
+// A failed write aborts the transaction, so it's restarted with the changes that passed so far,
+// same as they would be applied one by one. Conflicting changes are not executed.
+// Documents that are updated or deleted are checked to be matched by exactly one document beforehand.
+// Note: transactions require MongoDB replica set or sharded cluster.
+func (app *App) checkChanges(
+	ctx context.Context,
+	col *mongo.Collection,
+	changes diff.Changes,
+	conflicts map[*diff.Change]*Conflict,
+) ([]*DryRunVerdict, error) {
+	session, err := app.dbClient.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	mongoClientRestorer := restore.NewMongoClientRestorer(col)
+
+	if err := session.StartTransaction(); err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Nothing is ever committed (transaction may be already aborted by the server on failures)
+	defer func() { _ = session.AbortTransaction(ctx) }()
+
+	var passed diff.Changes
+	verdicts := make([]*DryRunVerdict, 0, changes.Len())
+	for _, ch := range changes {
+		if conflict, ok := conflicts[ch]; ok {
+			err := fmt.Errorf("document was modified in the database since the dump: %s", conflict.Reason)
+			verdicts = append(verdicts, &DryRunVerdict{Change: ch, Err: err})
+			continue
+		}
+
+		err := checkChange(mongo.NewSessionContext(ctx, session), col, mongoClientRestorer, ch)
+		if restore.IsTransactionUnsupported(err) {
+			return nil, fmt.Errorf("dry run requires a replica set (changes are checked in aborted transactions): %w",
+				err)
+		}
+		verdicts = append(verdicts, &DryRunVerdict{Change: ch, Err: err})
+
+		if err == nil {
+			passed = append(passed, ch)
+			continue
+		}
+		if err := restartTransaction(ctx, session, col, mongoClientRestorer, passed); err != nil {
+			return nil, fmt.Errorf("failed to restart dry run transaction: %w", err)
+		}
+	}
+
+	return verdicts, nil
+}
+
+// restartTransaction aborts the current transaction and starts a new one with the given changes executed.
+func restartTransaction(
+	ctx context.Context,
+	session mongo.Session,
+	col *mongo.Collection,
+	mongoClientRestorer *restore.MongoClientRestorer,
+	changes diff.Changes,
+) error {
+	_ = session.AbortTransaction(ctx)
+	if err := session.StartTransaction(); err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	sessCtx := mongo.NewSessionContext(ctx, session)
+	for _, ch := range changes {
+		if err := checkChange(sessCtx, col, mongoClientRestorer, ch); err != nil {
+			return fmt.Errorf("%s: %w", ch.Identifier(), err)
+		}
+	}
+
+	return nil
+}
+
+// checkChange executes the change inside the transaction of the session context.
+func checkChange(
+	sessCtx mongo.SessionContext,
+	col *mongo.Collection,
+	mongoClientRestorer *restore.MongoClientRestorer,
+	ch *diff.Change,
+) error {
+	mongoCmd, err := mongoClientRestorer.Build(ch)
+	if err != nil {
+		return err
+	}
+
+	filter := ch.Filter()
+	switch ch.Action {
+	case diff.ActionUpdated, diff.ActionDeleted:
+	case diff.ActionRenamed:
+		filter = ch.RenamedFromFilter()
+	default:
+		filter = nil
+	}
+	if filter != nil {
+		matched, err := col.CountDocuments(sessCtx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to count matched documents: %w", err)
+		}
+		if matched != 1 {
+			return fmt.Errorf("filter matches %d documents instead of exactly one", matched)
+		}
+	}
+
+	return mongoCmd(sessCtx)
+}
+
+// writeVerdicts writes verdicts as a table and returns the number of changes that would fail.
+func writeVerdicts(out io.Writer, verdicts []*DryRunVerdict) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ACTION\tDOCUMENT\tVERDICT\tREASON")
+
+	failed := 0
+	for _, verdict := range verdicts {
+		document := verdict.Change.Identifier()
+		if verdict.Change.Action == diff.ActionRenamed {
+			document = verdict.Change.RenamedFromIdentifier() + " -> " + document
+		}
+
+		if verdict.Err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "%s\t%s\tFAIL\t%v\n", verdict.Change.Action, document, verdict.Err)
+		} else {
+			_, _ = fmt.Fprintf(w, "%s\t%s\tOK\t-\n", verdict.Change.Action, document)
+		}
+	}
+	_ = w.Flush()
+
+	_, _ = fmt.Fprintf(out, "// Dry run: %d change(s) would be applied, %d would fail, nothing was written\n",
+		len(verdicts)-failed, failed)
+
+	return failed
+}
@@ -0,0 +1,34 @@
+package pho_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteVerdicts(t *testing.T) {
+	renamed := diff.NewChange("_id", "b", diff.ActionRenamed)
+	renamed.RenamedFrom = "a"
+
+	verdicts := []*pho.DryRunVerdict{
+		{Change: diff.NewChange("_id", "doc1", diff.ActionUpdated)},
+		{Change: diff.NewChange("_id", "doc2", diff.ActionAdded), Err: errors.New("duplicate key")},
+		{Change: renamed},
+	}
+
+	var out bytes.Buffer
+	failed := pho.WriteVerdicts(&out, verdicts)
+
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, `ACTION   DOCUMENT          VERDICT  REASON
+UPDATED  _id::doc1         OK       -
+ADDED    _id::doc2         FAIL     duplicate key
+RENAMED  _id::a -> _id::b  OK       -
+// Dry run: 2 change(s) would be applied, 1 would fail, nothing was written
+`, out.String())
+}
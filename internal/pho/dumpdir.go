@@ -0,0 +1,159 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pho/internal/diff"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Directory dump: each document is written into its own `<id>.json` (or `<id>.yaml`) file,
+// so editors' file trees, grep and git diff work per document.
+// Deleting a file deletes the document, new files are inserted as new documents.
+
+// dumpLayoutDirectory is the DumpLayout of sessions with the directory dump.
+const dumpLayoutDirectory = "directory"
+
+// unsafeFileNameChars are replaced in file names made of document identifiers.
+var unsafeFileNameChars = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_",
+	" ", "_", "\n", "_", "\t", "_",
+)
+
+// getDocFileExtension returns the extension of document files in the directory dump.
+func (app *App) getDocFileExtension() string {
+	if app.render.IsYAML() {
+		return ".yaml"
+	}
+
+	return ".json"
+}
+
+// docFileName returns a unique (among taken ones, ignoring case) file name for the document, made of its _id.
+func (app *App) docFileName(doc bson.D, taken map[string]struct{}) string {
+	id, _ := diff.LookupPath(doc, "_id")
+
+	var base string
+	switch id := id.(type) {
+	case nil:
+		base = "new"
+	case primitive.ObjectID:
+		base = id.Hex()
+	case string:
+		base = id
+	default:
+		base = fmt.Sprint(id)
+	}
+
+	base = unsafeFileNameChars.Replace(base)
+	base = strings.TrimLeft(base, ".") // hidden files are ignored when reading the dump
+	if base == "" {
+		base = "_"
+	}
+
+	// Names are taken case-insensitively, as file systems may be case-insensitive (e.g. on macOS or Windows)
+	name := base + app.getDocFileExtension()
+	for i := 2; ; i++ {
+		if _, ok := taken[strings.ToLower(name)]; !ok {
+			break
+		}
+		name = base + "-" + strconv.Itoa(i) + app.getDocFileExtension()
+	}
+	taken[strings.ToLower(name)] = struct{}{}
+
+	return name
+}
+
+// SetupDumpDirectory prepares an empty directory for the directory dump.
+func (app *App) SetupDumpDirectory() (string, error) {
+	if app.render.IsTabular() {
+		return "", errors.New("tabular formats can't be dumped as a file per document")
+	}
+
+	if err := app.setupPhoDir(); err != nil {
+		return "", err
+	}
+
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get pho data dir: %w", err)
+	}
+
+	// Files left from the previous dump would be considered as new documents
+	dirPath := filepath.Join(dataDir, app.getDumpFilename())
+	if err := os.RemoveAll(dirPath); err != nil {
+		return "", fmt.Errorf("failed cleaning dump directory: %w", err)
+	}
+	if err := os.MkdirAll(dirPath, 0750); err != nil {
+		return "", fmt.Errorf("failed creating dump directory: %w", err)
+	}
+
+	return dirPath, nil
+}
+
+// DumpToDirectory dumps decoded mongo cursor into the given directory, a file per document.
+func (app *App) DumpToDirectory(ctx context.Context, cursor *mongo.Cursor, dirPath string) error {
+	writer := &dirDumpWriter{app: app, dirPath: dirPath, taken: make(map[string]struct{})}
+	return app.dump(ctx, cursor, writer, true)
+}
+
+// dirDumpWriter writes each document into its own file of the dump directory.
+type dirDumpWriter struct {
+	app     *App
+	dirPath string
+	taken   map[string]struct{}
+}
+
+func (w *dirDumpWriter) writeDoc(doc bson.D, lineNumber int) error {
+	resultBytes, err := w.app.render.FormatResult(doc)
+	if err != nil {
+		return fmt.Errorf("failed to format line [%d]: %w", lineNumber, err)
+	}
+	resultBytes = append(w.app.formatFieldComments(doc), resultBytes...)
+
+	path := filepath.Join(w.dirPath, w.app.docFileName(doc, w.taken))
+	if err := os.WriteFile(path, resultBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write line [%d]: %w", lineNumber, err)
+	}
+
+	return nil
+}
+
+func (w *dirDumpWriter) flush() error { return nil }
+
+// readDumpDirectory reads document files of the directory dump (sorted by name).
+// Hidden files and files with other extensions (e.g. editor swap files) are skipped.
+func (app *App) readDumpDirectory(ctx context.Context, dirPath string) ([]*dumpFile, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not open dump: %w", ErrNoMeta)
+		}
+		return nil, fmt.Errorf("could not open dump: %w", err)
+	}
+
+	var files []*dumpFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != app.getDocFileExtension() {
+			continue
+		}
+
+		path := filepath.Join(dirPath, name)
+		docs, err := app.readDumpFile(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, &dumpFile{path: path, docs: docs})
+	}
+
+	return files, nil
+}
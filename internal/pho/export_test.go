@@ -2,6 +2,7 @@ package pho
 
 import (
 	"context"
+	"io"
 	"pho/internal/diff"
 	"pho/internal/render"
 
@@ -25,22 +26,136 @@ func (a *AppReflect) GetRender() *render.Renderer { return a.App.render }
 func ParseQuery(queryStr string) (bson.M, error) { return parseQuery(queryStr) }
 func ParseSort(sortStr string) bson.D            { return parseSort(sortStr) }
 func ParseProjection(in string) bson.D           { return parseProjection(in) }
+func ProjectedFields(projection bson.D) []string { return projectedFields(projection) }
 
 // Export private methods for testing.
 func (a *AppReflect) GetDumpFileExtension() string                      { return a.App.getDumpFileExtension() }
 func (a *AppReflect) GetDumpFilename() string                           { return a.App.getDumpFilename() }
 func (a *AppReflect) SetupPhoDir() error                                { return a.App.setupPhoDir() }
 func (a *AppReflect) ReadMeta(ctx context.Context) (*ParsedMeta, error) { return a.App.readMeta(ctx) }
-func (a *AppReflect) ReadDump(ctx context.Context) ([]bson.M, error)    { return a.App.readDump(ctx) }
+func (a *AppReflect) ReadDump(ctx context.Context) ([]bson.D, error)    { return a.App.readDump(ctx) }
+func (a *AppReflect) DocFileName(doc bson.D, taken map[string]struct{}) string {
+	return a.App.docFileName(doc, taken)
+}
 func (a *AppReflect) ExtractChanges(ctx context.Context) (diff.Changes, error) {
 	return a.App.extractChanges(ctx)
 }
+func (a *AppReflect) CheckConflict(ch *diff.Change, live bson.D, meta *ParsedMeta) (*Conflict, error) {
+	return a.App.checkConflict(ch, live, meta)
+}
+func (a *AppReflect) ResolveConflicts(
+	ctx context.Context, changes diff.Changes, conflicts []*Conflict, meta *ParsedMeta,
+) (diff.Changes, error) {
+	return a.App.resolveConflicts(ctx, changes, conflicts, meta)
+}
+
+func (a *AppReflect) SetDBClient(client *mongo.Client) { a.App.dbClient = client }
+func (a *AppReflect) WriteChanges(
+	ctx context.Context, col *mongo.Collection, changes diff.Changes, opts ...ApplyOption,
+) ([]*ChangeError, error) {
+	return a.App.writeChanges(ctx, col, changes, newApplyOptions(opts...))
+}
+
+func (a *AppReflect) GetDataDir() (string, error)          { return a.App.getDataDir() }
+func (a *AppReflect) WriteUndo(changes diff.Changes) error { return a.App.writeUndo(changes) }
+func (a *AppReflect) ReadUndo() (*UndoData, error)         { return a.App.readUndo() }
+func (a *AppReflect) InvertChange(ch *diff.Change, before bson.D) *diff.Change {
+	return a.App.invertChange(ch, before)
+}
+func (a *AppReflect) MaskChange(ch *diff.Change) *diff.Change {
+	return a.App.maskChange(ch)
+}
+func (a *AppReflect) UnmaskChanges(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	return a.App.unmaskChanges(ctx, col, changes)
+}
+func (a *AppReflect) WriteDiff(out io.Writer, ch *diff.Change, color bool) error {
+	return a.App.newDiffWriter(out, color).Write(ch)
+}
+
+var (
+	InvertUpdate  = invertUpdate
+	SucceededUndo = succeededUndo
+)
+
+var (
+	WritePatch              = writePatch
+	DecodePatch             = decodePatch
+	ParseJSONPatch          = parseJSONPatch
+	ParseChangesJSON        = parseChangesJSON
+	CalculatePatchedChanges = calculatePatchedChanges
+	BuildJSONPatch          = buildJSONPatch
+	BuildMergePatch         = buildMergePatch
+	StaleChange             = staleChange
+)
+
+var (
+	UpdatedDocument  = updatedDocument
+	FillMaskedValues = fillMaskedValues
+	WriteViolations  = writeViolations
+
+	WriteUncheckedPatterns = writeUncheckedPatterns
+)
+
+// ParseValidator parses the validator of collection options, returning its validation action and schema violations
+// of the given document (ok is false if there is no validator).
+func ParseValidator(collectionOptions, doc bson.D) (string, []string, bool) {
+	validator := parseValidator(collectionOptions)
+	if validator == nil {
+		return "", nil, false
+	}
+
+	var violations []string
+	for _, violation := range validator.schema.Validate(doc) {
+		violations = append(violations, violation.String())
+	}
+	return validator.action, violations, true
+}
+
+// ValidatorChecksUpdateOf reports if the validator of collection options checks updates of the live document.
+func ValidatorChecksUpdateOf(collectionOptions, live bson.D) bool {
+	return parseValidator(collectionOptions).checksUpdateOf(live)
+}
+
+var WriteVerdicts = writeVerdicts
+
+var NvimSchemaCommand = nvimSchemaCommand
 
 // Export constants for testing via getter functions.
-func GetPhoDir() (string, error) { return getPhoDataDir() }
-func GetPhoSessionConf() string  { return phoSessionConf }
-func GetPhoDumpBase() string     { return phoDumpBase }
+func GetPhoDir() (string, error)  { return getPhoDataDir() }
+func GetPhoSessionConf() string   { return phoSessionConf }
+func GetPhoDumpBase() string      { return phoDumpBase }
+func GetPhoOriginalsFile() string { return phoOriginalsFile }
+func GetPhoUndoFile() string      { return phoUndoFile }
+func GetPhoSchemaFile() string    { return phoSchemaFile }
 
 // Export errors for testing via getter functions.
 func GetErrNoMeta() error { return ErrNoMeta }
 func GetErrNoDump() error { return ErrNoDump }
+
+var (
+	ParsePipeline          = parsePipeline
+	ValidatePipeline       = validatePipeline
+	OverwriteCheckPipeline = overwriteCheckPipeline
+)
+
+func (a *AppReflect) SetReadOnlyFields(fields []string) { a.App.readOnlyFields = fields }
+
+var (
+	CheckProtectedEdits = checkProtectedEdits
+	WriteProtectedEdits = writeProtectedEdits
+)
+
+var (
+	UnmaskChange      = unmaskChange
+	CheckMaskedWrites = checkMaskedWrites
+)
+
+func (a *AppReflect) SetProjection(projection string) { a.App.projection = projection }
+
+func (a *AppReflect) CheckProjectedWrites(changes diff.Changes) error {
+	return a.App.checkProjectedWrites(changes)
+}
+
+var WithHiddenFields = withHiddenFields
+
+var GetSessionRegistryPath = getSessionRegistryPath
@@ -90,3 +90,33 @@ func parseProjection(in string) bson.D {
 	}
 	return projection
 }
+
+// projectedFields returns fields included by the projection (nil for exclusion projections).
+func projectedFields(projection bson.D) []string {
+	var fields []string
+	for _, e := range projection {
+		if !isExcludedByProjection(e.Value) {
+			fields = append(fields, e.Key)
+		}
+	}
+
+	return fields
+}
+
+// isExcludedByProjection tells if the projection value excludes the field (0 or false).
+func isExcludedByProjection(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return !v
+	case int:
+		return v == 0
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	default:
+		return false
+	}
+}
@@ -333,3 +333,43 @@ func TestParseProjection_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestProjectedFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		projection bson.D
+		expected   []string
+	}{
+		{
+			name:       "inclusion projection",
+			projection: pho.ParseProjection("name,+price,-_id"),
+			expected:   []string{"name", "price"},
+		},
+		{
+			name: "mixed value types",
+			projection: bson.D{
+				{Key: "a", Value: true},
+				{Key: "b", Value: false},
+				{Key: "c", Value: int32(1)},
+				{Key: "d", Value: 0.0},
+				{Key: "e", Value: bson.M{"$slice": 1}},
+			},
+			expected: []string{"a", "c", "e"},
+		},
+		{
+			name:       "exclusion projection",
+			projection: pho.ParseProjection("-secret"),
+			expected:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := pho.ProjectedFields(tt.projection)
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("projectedFields() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
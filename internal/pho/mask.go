@@ -0,0 +1,289 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrMaskedValueLost is returned when a masked value can't be kept, as there is no original value to take it from.
+var ErrMaskedValueLost = errors.New("masked value has no original to keep")
+
+// ParseMaskPattern parses the pattern of sensitive field names (nil for an empty pattern).
+func ParseMaskPattern(s string) (*regexp.Regexp, error) {
+	if s == "" {
+		return nil, nil //nolint:nilnil // no pattern is not an error
+	}
+
+	pattern, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mask pattern: %w", err)
+	}
+
+	return pattern, nil
+}
+
+// mask returns a copy of the document with values of sensitive fields (see WithMaskedFields, WithMaskPattern)
+// replaced by diff.MaskPlaceholder. Fields of documents nested into arrays are masked by the same paths.
+// Identity fields are never masked, as documents could not be matched with their originals otherwise.
+func (app *App) mask(doc bson.D) bson.D {
+	if len(app.maskedFields) == 0 && app.maskPattern == nil {
+		return doc
+	}
+
+	identityFields := []string{"_id"}
+	if len(app.identifyBy) > 0 {
+		identityFields = app.identifyBy
+	}
+
+	masked := make(bson.D, len(doc))
+	for i, e := range doc {
+		if !slices.Contains(identityFields, e.Key) {
+			e.Value = app.maskValue(e.Key, e.Key, e.Value)
+		}
+		masked[i] = e
+	}
+
+	return masked
+}
+
+// maskValue masks the value of the field with the given name under the given path.
+func (app *App) maskValue(path, name string, value any) any {
+	if slices.Contains(app.maskedFields, path) || (app.maskPattern != nil && app.maskPattern.MatchString(name)) {
+		return diff.MaskPlaceholder
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		masked := make(bson.D, len(v))
+		for i, e := range v {
+			e.Value = app.maskValue(path+diff.PathSeparator+e.Key, e.Key, e.Value)
+			masked[i] = e
+		}
+		return masked
+	case bson.A:
+		masked := make(bson.A, len(v))
+		for i, item := range v {
+			masked[i] = app.maskValue(path, "", item)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+// unmaskChanges fills masked values that changes would write as a whole (e.g. renamed documents,
+// or arrays with masked items) from the live documents, so placeholders keep the original values.
+// Masked values of inserted documents can't be kept, as they have no live documents.
+func (app *App) unmaskChanges(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	for _, ch := range changes {
+		if !needsUnmask(ch) {
+			continue
+		}
+
+		filter := ch.Filter()
+		switch ch.Action {
+		case diff.ActionUpdated:
+		case diff.ActionRenamed:
+			filter = ch.RenamedFromFilter()
+		default:
+			return fmt.Errorf("document %s is inserted with masked values: %w", ch.Identifier(), ErrMaskedValueLost)
+		}
+
+		var live bson.D
+		if err := col.FindOne(ctx, filter).Decode(&live); err != nil {
+			return fmt.Errorf("failed to fetch masked values of %s: %w", ch.Identifier(), err)
+		}
+
+		if err := unmaskChange(ch, live); err != nil {
+			return fmt.Errorf("document %s: %w", ch.Identifier(), err)
+		}
+	}
+
+	return nil
+}
+
+// needsUnmask reports whether the change writes placeholders of masked values.
+func needsUnmask(ch *diff.Change) bool {
+	switch {
+	case ch.Action == diff.ActionDeleted || ch.Action == diff.ActionNoop:
+		return false
+	case ch.Action == diff.ActionUpdated && ch.FieldChanges.Len() > 0:
+		return slices.ContainsFunc(ch.FieldChanges, func(fc *diff.FieldChange) bool {
+			return diff.HasMaskPlaceholder(fc.After)
+		})
+	default:
+		return diff.HasMaskPlaceholder(ch.Data)
+	}
+}
+
+// unmaskChange replaces placeholders written by the change with the values of the live document.
+func unmaskChange(ch *diff.Change, live bson.D) error {
+	if ch.Action == diff.ActionUpdated && ch.FieldChanges.Len() > 0 {
+		for _, fc := range ch.FieldChanges {
+			liveValue, ok := diff.LookupPath(live, fc.Path)
+			after, err := unmaskValue(fc.Path, fc.After, liveValue, ok)
+			if err != nil {
+				return err
+			}
+			fc.After = after
+		}
+		return nil
+	}
+
+	data, err := unmaskValue("", ch.Data, live, true)
+	if err != nil {
+		return err
+	}
+	ch.Data, _ = data.(bson.D)
+
+	return nil
+}
+
+// unmaskValue replaces placeholders in the value with the values at the same places of the live one
+// (hasLive is false if there is no live value).
+func unmaskValue(path string, value, live any, hasLive bool) (any, error) {
+	if diff.IsMaskPlaceholder(value) {
+		if !hasLive {
+			return nil, fmt.Errorf("%w: %s", ErrMaskedValueLost, path)
+		}
+		return live, nil
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		liveDoc, _ := live.(bson.D)
+		unmasked := make(bson.D, len(v))
+		for i, e := range v {
+			var liveValue any
+			j := slices.IndexFunc(liveDoc, func(l bson.E) bool { return l.Key == e.Key })
+			if j >= 0 {
+				liveValue = liveDoc[j].Value
+			}
+			value, err := unmaskValue(joinPath(path, e.Key), e.Value, liveValue, j >= 0)
+			if err != nil {
+				return nil, err
+			}
+			unmasked[i] = bson.E{Key: e.Key, Value: value}
+		}
+		return unmasked, nil
+	case bson.A:
+		liveArr, _ := live.(bson.A)
+		unmasked := make(bson.A, len(v))
+		for i, item := range v {
+			if !diff.HasMaskPlaceholder(item) {
+				unmasked[i] = item
+				continue
+			}
+			liveItem, ok := matchLiveItem(item, liveArr)
+			value, err := unmaskValue(joinPath(path, strconv.Itoa(i)), item, liveItem, ok)
+			if err != nil {
+				return nil, err
+			}
+			unmasked[i] = value
+		}
+		return unmasked, nil
+	default:
+		return value, nil
+	}
+}
+
+// matchLiveItem finds the live array item the given item with masked values stands for: the one with the same
+// identity (_id or id field), otherwise the only one with the same non-masked content.
+// Items are never matched by their positions, as they change once items are removed or reordered.
+func matchLiveItem(item any, liveArr bson.A) (any, bool) {
+	if doc, ok := item.(bson.D); ok {
+		for _, key := range hashing.DefaultIdentityFields {
+			id, ok := diff.LookupPath(doc, key)
+			if !ok || diff.HasMaskPlaceholder(id) {
+				continue
+			}
+			for _, liveItem := range liveArr {
+				liveDoc, _ := liveItem.(bson.D)
+				if liveID, ok := diff.LookupPath(liveDoc, key); ok && diff.ValuesEqual(id, liveID) {
+					return liveItem, true
+				}
+			}
+			return nil, false
+		}
+	}
+
+	var found any
+	matched := false
+	for _, liveItem := range liveArr {
+		if !sameUnmaskedContent(item, liveItem) {
+			continue
+		}
+		// Items differing only in masked values can't be told apart
+		if matched && !diff.ValuesEqual(found, liveItem) {
+			return nil, false
+		}
+		found, matched = liveItem, true
+	}
+
+	return found, matched
+}
+
+// sameUnmaskedContent reports whether the value equals the live one, except for its masked values.
+func sameUnmaskedContent(value, live any) bool {
+	if diff.IsMaskPlaceholder(value) {
+		return true
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		liveDoc, ok := live.(bson.D)
+		if !ok || len(v) != len(liveDoc) {
+			return false
+		}
+		for _, e := range v {
+			liveValue, ok := diff.LookupPath(liveDoc, e.Key)
+			if !ok || !sameUnmaskedContent(e.Value, liveValue) {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		liveArr, ok := live.(bson.A)
+		if !ok || len(v) != len(liveArr) {
+			return false
+		}
+		for i, item := range v {
+			if !sameUnmaskedContent(item, liveArr[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return diff.ValuesEqual(value, live)
+	}
+}
+
+// joinPath appends the key to the dotted path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + diff.PathSeparator + key
+}
+
+// checkMaskedWrites returns an error if changes write placeholders of masked values,
+// for outputs that can't fill them from live documents (e.g. mongosh scripts).
+func checkMaskedWrites(changes diff.Changes) error {
+	for _, ch := range changes {
+		if needsUnmask(ch) {
+			return fmt.Errorf("document %s writes masked values as a whole, apply it via pho instead: %w",
+				ch.Identifier(), ErrMaskedValueLost)
+		}
+	}
+
+	return nil
+}
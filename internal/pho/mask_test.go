@@ -0,0 +1,168 @@
+package pho_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+	"pho/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestApp_Dump_masksFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ctx := context.Background()
+	cursor, err := mongo.NewCursorFromDocuments([]any{
+		bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "name", Value: "alice"},
+			{Key: "password", Value: "pbkdf2-hash"},
+			{Key: "auth", Value: bson.D{{Key: "provider", Value: "github"}, {Key: "token", Value: "gho-secret"}}},
+			{Key: "keys", Value: bson.A{bson.D{{Key: "label", Value: "ci"}, {Key: "apiSecret", Value: "s3cr3t"}}}},
+		},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	dumper := pho.NewApp(
+		pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Relaxed))),
+		pho.WithMaskedFields([]string{"password", "auth.token"}),
+		pho.WithMaskPattern(regexp.MustCompile(`(?i)secret`)),
+	)
+	out, _, err := dumper.SetupDumpDestination()
+	require.NoError(t, err)
+	require.NoError(t, dumper.Dump(ctx, cursor, out))
+	require.NoError(t, out.Close())
+
+	// Sensitive values land in none of the session files
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(tempDir, entry.Name()))
+		require.NoError(t, err)
+		for _, secret := range []string{"pbkdf2-hash", "gho-secret", "s3cr3t"} {
+			assert.NotContains(t, string(content), secret, entry.Name())
+		}
+	}
+
+	dumpPath := filepath.Join(tempDir, "_dump.jsonl")
+	dump, err := os.ReadFile(dumpPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(dump), `"password": "<pho:masked>"`)
+	assert.Contains(t, string(dump), `"provider": "github"`)
+
+	sessionConf, err := os.ReadFile(filepath.Join(tempDir, pho.GetPhoSessionConf()))
+	require.NoError(t, err)
+	assert.Contains(t, string(sessionConf), "Masked: password, auth.token\nMaskPattern: (?i)secret\n")
+
+	// Placeholders left as they are keep the original values
+	edited := []byte(strings.Replace(string(dump), `"alice"`, `"bob"`, 1))
+	require.NoError(t, os.WriteFile(dumpPath, edited, 0600))
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer()))}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"name"}, changes[0].FieldChanges.Paths())
+}
+
+func TestUnmaskChange(t *testing.T) {
+	live := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "password", Value: "hash"},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "label", Value: "ci"}, {Key: "secret", Value: "s1"}}}},
+	}
+
+	// Renamed documents are inserted as a whole
+	renamed := diff.NewChange("_id", int32(2), diff.ActionRenamed, bson.D{
+		{Key: "_id", Value: int32(2)},
+		{Key: "password", Value: diff.MaskPlaceholder},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "label", Value: "ci"}, {Key: "secret", Value: diff.MaskPlaceholder}}}},
+	})
+	renamed.RenamedFrom = int32(1)
+	require.Error(t, pho.CheckMaskedWrites(diff.Changes{renamed}))
+	require.NoError(t, pho.UnmaskChange(renamed, live))
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: int32(2)},
+		{Key: "password", Value: "hash"},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "label", Value: "ci"}, {Key: "secret", Value: "s1"}}}},
+	}, renamed.Data)
+	require.NoError(t, pho.CheckMaskedWrites(diff.Changes{renamed}))
+
+	// Arrays are updated as a whole
+	updated := diff.NewChange("_id", int32(1), diff.ActionUpdated, nil)
+	updated.FieldChanges = diff.FieldChanges{{
+		Path:   "keys",
+		Action: diff.FieldModified,
+		After: bson.A{
+			bson.D{{Key: "label", Value: "ci"}, {Key: "secret", Value: diff.MaskPlaceholder}},
+			bson.D{{Key: "label", Value: "new"}, {Key: "secret", Value: diff.MaskPlaceholder}},
+		},
+	}}
+	err := pho.UnmaskChange(updated, live)
+	require.ErrorIs(t, err, pho.ErrMaskedValueLost)
+	assert.Contains(t, err.Error(), "keys.1.secret")
+}
+
+func TestUnmaskChange_arrays(t *testing.T) {
+	user := func(name, token any) bson.D {
+		return bson.D{{Key: "name", Value: name}, {Key: "token", Value: token}}
+	}
+	live := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "users", Value: bson.A{user("a", "tokA"), user("b", "tokB")}},
+		{Key: "keys", Value: bson.A{
+			bson.D{{Key: "id", Value: "k1"}, {Key: "label", Value: "ci"}, {Key: "secret", Value: "s1"}},
+			bson.D{{Key: "id", Value: "k2"}, {Key: "label", Value: "cd"}, {Key: "secret", Value: "s2"}},
+		}},
+	}
+	updated := func(path string, after bson.A) *diff.Change {
+		ch := diff.NewChange("_id", int32(1), diff.ActionUpdated, nil)
+		ch.FieldChanges = diff.FieldChanges{{Path: path, Action: diff.FieldModified, After: after}}
+		return ch
+	}
+
+	// Items are matched by their non-masked content, not by their positions
+	removed := updated("users", bson.A{user("b", diff.MaskPlaceholder)})
+	require.NoError(t, pho.UnmaskChange(removed, live))
+	assert.Equal(t, bson.A{user("b", "tokB")}, removed.FieldChanges[0].After)
+
+	reordered := updated("users", bson.A{user("b", diff.MaskPlaceholder), user("a", diff.MaskPlaceholder)})
+	require.NoError(t, pho.UnmaskChange(reordered, live))
+	assert.Equal(t, bson.A{user("b", "tokB"), user("a", "tokA")}, reordered.FieldChanges[0].After)
+
+	// Edited items are matched by their identity
+	relabeled := updated("keys", bson.A{
+		bson.D{{Key: "id", Value: "k2"}, {Key: "label", Value: "deploy"}, {Key: "secret", Value: diff.MaskPlaceholder}},
+	})
+	require.NoError(t, pho.UnmaskChange(relabeled, live))
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "id", Value: "k2"}, {Key: "label", Value: "deploy"}, {Key: "secret", Value: "s2"}},
+	}, relabeled.FieldChanges[0].After)
+
+	// Edited items without identity can't be matched
+	renamed := updated("users", bson.A{user("c", diff.MaskPlaceholder), user("b", diff.MaskPlaceholder)})
+	err := pho.UnmaskChange(renamed, live)
+	require.ErrorIs(t, err, pho.ErrMaskedValueLost)
+	assert.Contains(t, err.Error(), "users.0.token")
+
+	// Items differing only in masked values can't be told apart
+	twins := bson.D{{Key: "users", Value: bson.A{user("a", "tokA"), user("a", "tokB")}}}
+	err = pho.UnmaskChange(updated("users", bson.A{user("a", diff.MaskPlaceholder)}), twins)
+	require.ErrorIs(t, err, pho.ErrMaskedValueLost)
+}
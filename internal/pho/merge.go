@@ -0,0 +1,347 @@
+package pho
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Conflict markers written into the dump for conflicts that need manual resolution.
+// The user keeps one of the versions (or combines them) and removes the markers.
+const (
+	conflictMarkerOurs      = "<<<<<<< yours"
+	conflictMarkerSeparator = "======="
+	conflictMarkerTheirs    = ">>>>>>> database"
+)
+
+var ErrUnresolvedConflicts = errors.New("dump contains unresolved conflict markers")
+
+// mergeOutcome is the result of three-way merging of a single conflict.
+type mergeOutcome struct {
+	conflict *Conflict
+
+	// merged is the document that should be in the dump when the conflict is resolved
+	// (nil if the document is deleted on both sides)
+	merged bson.D
+
+	// resolved is the change rebased onto the live document (nil if there is nothing to apply)
+	resolved *diff.Change
+
+	// unresolved is true when the conflict needs manual resolution
+	unresolved bool
+
+	// ours and theirs are versions of the document to be written between conflict markers
+	// (nil means the document is deleted on that side)
+	ours, theirs bson.D
+
+	// paths are the conflicting fields (empty if the whole document conflicts)
+	paths []string
+}
+
+// String returns a human-readable description of the outcome.
+func (o *mergeOutcome) String() string {
+	if len(o.paths) == 0 {
+		return o.conflict.String()
+	}
+
+	return fmt.Sprintf("%s (fields: %s)", o.conflict, strings.Join(o.paths, ", "))
+}
+
+// mergeConflict three-way merges a conflicting change with the live version of its document.
+func mergeConflict(c *Conflict) *mergeOutcome {
+	ch := c.Change
+
+	// Deleted on both sides: nothing to do anymore
+	if ch.Action == diff.ActionDeleted && c.Live == nil {
+		return &mergeOutcome{conflict: c}
+	}
+
+	if c.Live != nil {
+		rebased, result := diff.MergeChange(ch, c.Live)
+		switch {
+		case result == nil:
+			// Can't be merged per field: handled as a whole document conflict below
+		case result.HasConflicts():
+			return &mergeOutcome{
+				conflict:   c,
+				unresolved: true,
+				ours:       diff.ApplyFieldChanges(result.Merged, result.OursChanges()),
+				theirs:     result.Merged,
+				paths:      result.ConflictingPaths(),
+			}
+		default:
+			return &mergeOutcome{conflict: c, merged: result.Merged, resolved: rebased}
+		}
+	}
+
+	// Deleted on one side and modified on the other one (or original version is unknown)
+	return &mergeOutcome{conflict: c, unresolved: true, ours: ch.Data, theirs: c.Live}
+}
+
+// resolveConflicts three-way merges conflicting changes with live documents.
+// If every conflict is merged automatically, the resulting list of changes to be applied is returned.
+// Otherwise, the dump is rewritten with conflict markers, the session is rebased onto live documents
+// and ErrConflicts is returned, so the user can resolve conflicts in the editor and apply again.
+func (app *App) resolveConflicts(
+	ctx context.Context,
+	changes diff.Changes,
+	conflicts []*Conflict,
+	meta *ParsedMeta,
+) (diff.Changes, error) {
+	outcomes := make(map[string]*mergeOutcome, len(conflicts))
+	unresolved := 0
+	for _, c := range conflicts {
+		outcome := mergeConflict(c)
+		outcomes[c.Change.Identifier()] = outcome
+
+		if outcome.unresolved {
+			unresolved++
+			_, _ = fmt.Fprintf(os.Stderr, "conflict: %s\n", outcome)
+		} else {
+			_, _ = fmt.Fprintf(os.Stdout, "// auto-merged: %s\n", outcome)
+		}
+	}
+
+	if unresolved == 0 {
+		resolved := make(diff.Changes, 0, len(changes))
+		for _, ch := range changes {
+			outcome, ok := outcomes[ch.Identifier()]
+			if !ok {
+				resolved = append(resolved, ch)
+				continue
+			}
+			if outcome.resolved != nil {
+				resolved = append(resolved, outcome.resolved)
+			}
+		}
+
+		return resolved, nil
+	}
+
+	if err := app.writeConflictedDump(ctx, outcomes); err != nil {
+		return nil, fmt.Errorf("failed to write conflicts into dump: %w", err)
+	}
+
+	if err := app.rebaseSession(meta, conflicts); err != nil {
+		return nil, fmt.Errorf("failed to rebase session: %w", err)
+	}
+
+	return nil, fmt.Errorf("%w: %d conflict(s) were written into the dump, resolve them and apply again",
+		ErrConflicts, unresolved)
+}
+
+// writeConflictedDump rewrites the dump with merge outcomes:
+// auto-merged documents are replaced with their merged versions,
+// unresolved ones are written as blocks with conflict markers.
+// In the directory dump each file is rewritten on its own.
+func (app *App) writeConflictedDump(ctx context.Context, outcomes map[string]*mergeOutcome) error {
+	// Table has no place for conflict blocks, so the dump is left untouched
+	if app.render.IsTabular() {
+		return errors.New("conflicts can't be written into a tabular (CSV/TSV) dump, use JSON or YAML format")
+	}
+
+	files, err := app.readDumpFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	bufs := make([]*bytes.Buffer, len(files))
+	lineNumbers := make([]int, len(files))
+	touched := make([]bool, len(files))
+	written := make(map[string]struct{}, len(outcomes))
+	for i, file := range files {
+		bufs[i] = &bytes.Buffer{}
+		for j, doc := range file.docs {
+			hashData, err := hashing.Hash(doc, app.identifyBy...)
+			if err != nil {
+				return fmt.Errorf("corrupted obj[%d] could not hash: %w", j, err)
+			}
+
+			id := hashData.GetIdentifier()
+			outcome, ok := outcomes[id]
+			if !ok {
+				if err := app.writeDumpDoc(bufs[i], &lineNumbers[i], doc); err != nil {
+					return err
+				}
+				continue
+			}
+
+			written[id] = struct{}{}
+			touched[i] = true
+			if err := app.writeMergeOutcome(bufs[i], &lineNumbers[i], outcome); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Documents deleted by the user are not in the dump anymore,
+	// so they go to the end of the dump (or to new files of the directory dump)
+	ids := make([]string, 0, len(outcomes))
+	for id := range outcomes {
+		if _, ok := written[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return fmt.Errorf("could not get pho data dir: %w", err)
+	}
+	dumpPath := filepath.Join(dataDir, app.getDumpFilename())
+
+	taken := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		taken[filepath.Base(file.path)] = struct{}{}
+	}
+	for _, id := range ids {
+		outcome := outcomes[id]
+		if !app.directoryDump {
+			// Single dump file is the only one
+			touched[0] = true
+			if err := app.writeMergeOutcome(bufs[0], &lineNumbers[0], outcome); err != nil {
+				return err
+			}
+			continue
+		}
+
+		doc := outcome.theirs
+		if doc == nil {
+			doc = outcome.ours
+		}
+		buf := &bytes.Buffer{}
+		if err := app.writeMergeOutcome(buf, new(int), outcome); err != nil {
+			return err
+		}
+		if buf.Len() > 0 {
+			files = append(files, &dumpFile{path: filepath.Join(dumpPath, app.docFileName(doc, taken))})
+			bufs = append(bufs, buf)
+			touched = append(touched, true)
+		}
+	}
+
+	// Files of the directory dump with no conflicts are left as the user edited them
+	for i, file := range files {
+		if !touched[i] {
+			continue
+		}
+		if err := os.WriteFile(file.path, bufs[i].Bytes(), 0600); err != nil {
+			return fmt.Errorf("failed writing dump file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeMergeOutcome writes merged document or a conflict block of the given outcome.
+func (app *App) writeMergeOutcome(buf *bytes.Buffer, lineNumber *int, outcome *mergeOutcome) error {
+	if !outcome.unresolved {
+		if outcome.merged == nil {
+			return nil
+		}
+		return app.writeDumpDoc(buf, lineNumber, outcome.merged)
+	}
+
+	buf.Write(app.render.FormatComment(fmt.Sprintf("conflict: %s", outcome)))
+	buf.WriteString(conflictMarkerOurs + "\n")
+	if outcome.ours != nil {
+		if err := app.writeDumpDoc(buf, lineNumber, outcome.ours); err != nil {
+			return err
+		}
+	}
+	buf.WriteString(conflictMarkerSeparator + "\n")
+	if outcome.theirs != nil {
+		if err := app.writeDumpDoc(buf, lineNumber, outcome.theirs); err != nil {
+			return err
+		}
+	}
+	buf.WriteString(conflictMarkerTheirs + "\n")
+
+	return nil
+}
+
+// writeDumpDoc renders a single document the same way as Dump does.
+func (app *App) writeDumpDoc(buf *bytes.Buffer, lineNumber *int, doc bson.D) error {
+	docBytes, err := app.render.FormatResult(doc)
+	if err != nil {
+		return fmt.Errorf("failed to format line [%d]: %w", *lineNumber, err)
+	}
+
+	buf.Write(app.render.FormatLineNumber(*lineNumber))
+	buf.Write(app.formatFieldComments(doc))
+	buf.Write(docBytes)
+	if !bytes.HasSuffix(docBytes, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	*lineNumber++
+	return nil
+}
+
+// rebaseSession makes live versions of conflicting documents the new base of the session,
+// so after conflicts are resolved in the dump, changes are calculated against the database state.
+func (app *App) rebaseSession(meta *ParsedMeta, conflicts []*Conflict) error {
+	if meta.Originals == nil {
+		meta.Originals = make(map[string]bson.D)
+	}
+
+	for _, c := range conflicts {
+		id := c.Change.Identifier()
+		if c.Change.Action == diff.ActionRenamed {
+			// The base of a renamed document is the one under its previous identifier
+			id = c.Change.RenamedFromIdentifier()
+		}
+		if c.Live == nil {
+			delete(meta.Lines, id)
+			delete(meta.Originals, id)
+			continue
+		}
+
+		hashData, err := hashing.Hash(c.Live, meta.IdentifyBy...)
+		if err != nil {
+			return fmt.Errorf("failed to hash live document %s: %w", id, err)
+		}
+		meta.Lines[id] = hashData
+		meta.Originals[id] = c.Live
+	}
+
+	if err := app.writeMetadata(meta); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(meta.Originals))
+	for id := range meta.Originals {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	originals := make([]bson.D, 0, len(ids))
+	for _, id := range ids {
+		originals = append(originals, meta.Originals[id])
+	}
+
+	return app.writeOriginals(originals)
+}
+
+// hasConflictMarkers reports if the dump contains conflict markers left unresolved.
+func hasConflictMarkers(data []byte) bool {
+	for line := range bytes.Lines(data) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte(conflictMarkerOurs)) ||
+			bytes.Equal(line, []byte(conflictMarkerSeparator)) ||
+			bytes.HasPrefix(line, []byte(conflictMarkerTheirs)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,174 @@
+package pho_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/internal/pho"
+	"pho/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// setupMergeSession writes session files with the given originals and dump contents.
+func setupMergeSession(t *testing.T, dir string, originals []string, dump string) {
+	t.Helper()
+
+	lines := make(map[string]*hashing.HashData)
+	for _, original := range originals {
+		var doc pho.DumpDoc
+		require.NoError(t, doc.UnmarshalJSON([]byte(original)))
+		hashData, err := hashing.Hash(bson.D(doc))
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+	}
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	var originalsData []byte
+	for _, original := range originals {
+		originalsData = append(originalsData, original+"\n"...)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, pho.GetPhoOriginalsFile()), originalsData, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "_dump.jsonl"), []byte(dump), 0600))
+}
+
+func TestApp_resolveConflicts_autoMerged(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	setupMergeSession(t, tempDir,
+		[]string{`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"test","age":30}`},
+		`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"renamed","age":30}`+"\n",
+	)
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithAsValidJSON(false))))}
+	ctx := context.Background()
+
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	live := bson.D{{Key: "_id", Value: oid}, {Key: "name", Value: "test"}, {Key: "age", Value: int32(31)}}
+
+	meta, err := ar.ReadMeta(ctx)
+	require.NoError(t, err)
+
+	conflicts := []*pho.Conflict{{Change: changes[0], Live: live, Reason: "modified"}}
+	resolved, err := ar.ResolveConflicts(ctx, changes, conflicts, meta)
+	require.NoError(t, err)
+	require.Len(t, resolved, 1)
+
+	assert.Equal(t, diff.ActionUpdated, resolved[0].Action)
+	assert.Equal(t, live, resolved[0].Original)
+	assert.Equal(t, []string{"name"}, resolved[0].FieldChanges.Paths())
+	assert.Equal(t, "renamed", field(resolved[0].Data, "name"))
+	assert.Equal(t, int32(31), field(resolved[0].Data, "age"))
+}
+
+func TestApp_resolveConflicts_writesConflictMarkers(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	setupMergeSession(t, tempDir,
+		[]string{
+			`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"first","age":30}`,
+			`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"second"}`,
+		},
+		`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"first","age":40}`+"\n"+
+			`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"ours"}`+"\n",
+	)
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer(
+		render.WithAsValidJSON(false),
+		render.WithExtJSONMode(render.ExtJSONModes.Canonical),
+		render.WithCompactJSON(true),
+	)))}
+	ctx := context.Background()
+
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+	changes = changes.EffectiveOnes()
+	require.Len(t, changes, 2)
+
+	oid1, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	oid2, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439012")
+	require.NoError(t, err)
+
+	lives := map[string]bson.D{
+		"first":  {{Key: "_id", Value: oid1}, {Key: "name", Value: "first renamed"}, {Key: "age", Value: int32(30)}},
+		"second": {{Key: "_id", Value: oid2}, {Key: "name", Value: "theirs"}},
+	}
+
+	var conflicts []*pho.Conflict
+	for _, ch := range changes {
+		live := lives["second"]
+		if field(ch.Original, "name") == "first" {
+			live = lives["first"]
+		}
+		conflicts = append(conflicts, &pho.Conflict{Change: ch, Live: live, Reason: "modified"})
+	}
+
+	meta, err := ar.ReadMeta(ctx)
+	require.NoError(t, err)
+
+	_, err = ar.ResolveConflicts(ctx, changes, conflicts, meta)
+	require.ErrorIs(t, err, pho.ErrConflicts)
+
+	// Dump now contains the auto-merged document and the conflict block
+	dump, err := os.ReadFile(filepath.Join(tempDir, "_dump.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"first renamed","age":{"$numberInt":"40"}}`+"\n"+
+			`/* conflict: UPDATED _id:ObjectID("507f1f77bcf86cd799439012"): modified (fields: name) */`+"\n"+
+			"<<<<<<< yours\n"+
+			`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"ours"}`+"\n"+
+			"=======\n"+
+			`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"theirs"}`+"\n"+
+			">>>>>>> database\n",
+		string(dump),
+	)
+
+	// Unresolved dump can't be used for calculating changes
+	_, err = ar.ReadDump(ctx)
+	require.ErrorIs(t, err, pho.ErrUnresolvedConflicts)
+
+	// Once resolved (user's version is kept), changes are calculated against live documents
+	resolvedDump := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"first renamed","age":{"$numberInt":"40"}}` + "\n" +
+		`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"ours"}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.jsonl"), []byte(resolvedDump), 0600))
+
+	changes, err = ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	updated := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updated, 2)
+	for _, ch := range updated {
+		if field(ch.Data, "name") == "ours" {
+			assert.Equal(t, []string{"name"}, ch.FieldChanges.Paths())
+		} else {
+			assert.Equal(t, []string{"age"}, ch.FieldChanges.Paths())
+		}
+	}
+}
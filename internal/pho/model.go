@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"pho/internal/hashing"
+	"pho/internal/render"
 	"strconv"
 	"strings"
 	"time"
@@ -19,18 +20,53 @@ type ParsedMeta struct {
 	Database   string
 	Collection string
 
+	// Projection used for the dump (documents must be re-fetched with it to compare checksums)
+	Projection string
+
+	// IdentifyBy are fields documents are identified by (empty for the default _id/id identity)
+	IdentifyBy []string
+
+	// ReadOnly are context fields added by the pipeline: they are in the dump, but not in the collection
+	ReadOnly []string
+
+	// Protected are dotted paths of fields that must not be edited
+	Protected []string
+
+	// Masked and MaskPattern select sensitive fields that have placeholders instead of values in the dump
+	Masked      []string
+	MaskPattern string
+
+	// Format and ExtJSONMode the dump was rendered in (empty for older sessions)
+	Format      render.Format
+	ExtJSONMode render.ExtJSONMode
+
+	// DirectoryDump tells that the dump is a directory with a file per document
+	DirectoryDump bool
+
 	// Lines are hashes per identifier.
 	// Identifier here is considered to be identified_by field + identifier value
 	// etc. _id::111111
 	Lines map[string]*hashing.HashData
+
+	// Originals are original documents per identifier (same keys as in Lines).
+	// They are stored separately from session.conf, so may be nil for older sessions.
+	Originals map[string]bson.D `json:"-"`
 }
 
-type DumpDoc bson.M
+// DumpDoc is a document of the dump. Fields keep their order.
+type DumpDoc bson.D
 
 // UnmarshalJSON implements json.Unmarshaler to properly handle MongoDB ExtJSON format.
 // This ensures DumpDoc can be correctly parsed from ExtJSON into BSON.
 func (tx *DumpDoc) UnmarshalJSON(raw []byte) error {
-	return bson.UnmarshalExtJSON(raw, true, tx)
+	// Decoded into bson.D, so nested documents are bson.D as well (not DumpDoc)
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON(raw, true, &doc); err != nil {
+		return err
+	}
+
+	*tx = DumpDoc(doc)
+	return nil
 }
 
 // ToJSON serializes the metadata to JSON format.
@@ -54,6 +90,15 @@ type SessionConfig struct {
 	Limit         int64     `conf:"Limit"`
 	Sort          string    `conf:"Sort,omitempty"`
 	Projection    string    `conf:"Projection,omitempty"`
+	Pipeline      string    `conf:"Pipeline,omitempty"`
+	IdentifyBy    []string  `conf:"IdentifyBy,omitempty"`
+	ReadOnly      []string  `conf:"ReadOnly,omitempty"`
+	Protected     []string  `conf:"Protected,omitempty"`
+	Masked        []string  `conf:"Masked,omitempty"`
+	MaskPattern   string    `conf:"MaskPattern,omitempty"`
+	Format        string    `conf:"Format,omitempty"`
+	ExtJSONMode   string    `conf:"ExtJSONMode,omitempty"`
+	DumpLayout    string    `conf:"DumpLayout,omitempty"`
 	DumpFile      string    `conf:"DumpFile"`
 	DocumentCount int       `conf:"DocumentCount"`
 
@@ -79,6 +124,34 @@ func (sc *SessionConfig) ToSessionConf() ([]byte, error) {
 	if sc.Projection != "" {
 		result.WriteString(fmt.Sprintf("Projection: %s\n", sc.Projection))
 	}
+	if sc.Pipeline != "" {
+		result.WriteString(fmt.Sprintf("Pipeline: %s\n", sc.Pipeline))
+	}
+	if len(sc.IdentifyBy) > 0 {
+		identifyBy := strings.Join(sc.IdentifyBy, hashing.IdentityFieldsSeparator)
+		result.WriteString(fmt.Sprintf("IdentifyBy: %s\n", identifyBy))
+	}
+	if len(sc.ReadOnly) > 0 {
+		result.WriteString(fmt.Sprintf("ReadOnly: %s\n", strings.Join(sc.ReadOnly, ", ")))
+	}
+	if len(sc.Protected) > 0 {
+		result.WriteString(fmt.Sprintf("Protected: %s\n", strings.Join(sc.Protected, ", ")))
+	}
+	if len(sc.Masked) > 0 {
+		result.WriteString(fmt.Sprintf("Masked: %s\n", strings.Join(sc.Masked, ", ")))
+	}
+	if sc.MaskPattern != "" {
+		result.WriteString(fmt.Sprintf("MaskPattern: %s\n", sc.MaskPattern))
+	}
+	if sc.Format != "" {
+		result.WriteString(fmt.Sprintf("Format: %s\n", sc.Format))
+	}
+	if sc.ExtJSONMode != "" {
+		result.WriteString(fmt.Sprintf("ExtJSONMode: %s\n", sc.ExtJSONMode))
+	}
+	if sc.DumpLayout != "" {
+		result.WriteString(fmt.Sprintf("DumpLayout: %s\n", sc.DumpLayout))
+	}
 
 	result.WriteString(fmt.Sprintf("DumpFile: %s\n", sc.DumpFile))
 	result.WriteString(fmt.Sprintf("DocumentCount: %d\n", sc.DocumentCount))
@@ -174,6 +247,43 @@ func (sc *SessionConfig) parseFrontmatterField(key, value string) error {
 		sc.Sort = value
 	case "Projection":
 		sc.Projection = value
+	case "Pipeline":
+		sc.Pipeline = value
+	case "IdentifyBy":
+		identifyBy, err := hashing.ParseIdentifyBy(value)
+		if err != nil {
+			return err
+		}
+		sc.IdentifyBy = identifyBy
+	case "ReadOnly":
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				sc.ReadOnly = append(sc.ReadOnly, field)
+			}
+		}
+	case "Protected":
+		protected, err := ParseFieldPaths(value)
+		if err != nil {
+			return err
+		}
+		sc.Protected = protected
+	case "Masked":
+		masked, err := ParseFieldPaths(value)
+		if err != nil {
+			return err
+		}
+		sc.Masked = masked
+	case "MaskPattern":
+		if _, err := ParseMaskPattern(value); err != nil {
+			return err
+		}
+		sc.MaskPattern = value
+	case "Format":
+		sc.Format = value
+	case "ExtJSONMode":
+		sc.ExtJSONMode = value
+	case "DumpLayout":
+		sc.DumpLayout = value
 	case "DumpFile":
 		sc.DumpFile = value
 	case "DocumentCount":
@@ -198,6 +308,7 @@ func (sc *SessionConfig) ToSessionMetadata() *SessionMetadata {
 			Limit:      sc.Limit,
 			Sort:       sc.Sort,
 			Projection: sc.Projection,
+			Pipeline:   sc.Pipeline,
 		},
 		DumpFile:      sc.DumpFile,
 		MetaFile:      "session.conf", // Always use session.conf now
@@ -211,7 +322,18 @@ func (sc *SessionConfig) ToParsedMeta() *ParsedMeta {
 		URI:        sc.URI,
 		Database:   sc.Database,
 		Collection: sc.Collection,
+		Projection: sc.Projection,
+		IdentifyBy: sc.IdentifyBy,
+		ReadOnly:   sc.ReadOnly,
+		Protected:  sc.Protected,
+		Masked:     sc.Masked,
 		Lines:      sc.Lines,
+
+		MaskPattern: sc.MaskPattern,
+
+		Format:        render.Format(sc.Format),
+		ExtJSONMode:   render.ExtJSONMode(sc.ExtJSONMode),
+		DirectoryDump: sc.DumpLayout == dumpLayoutDirectory,
 	}
 }
 
@@ -225,6 +347,12 @@ func (sc *SessionConfig) FromSessionMetadataAndParsedMeta(session *SessionMetada
 	sc.Limit = session.QueryParams.Limit
 	sc.Sort = session.QueryParams.Sort
 	sc.Projection = session.QueryParams.Projection
+	sc.Pipeline = session.QueryParams.Pipeline
+	sc.IdentifyBy = meta.IdentifyBy
+	sc.ReadOnly = meta.ReadOnly
+	sc.Protected = meta.Protected
+	sc.Masked = meta.Masked
+	sc.MaskPattern = meta.MaskPattern
 	sc.DumpFile = session.DumpFile
 	sc.DocumentCount = session.DocumentCount
 	sc.Lines = meta.Lines
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"pho/internal/diff"
 	"pho/internal/hashing"
 	"pho/internal/pho"
 
@@ -13,12 +14,12 @@ import (
 
 func TestParsedMeta(t *testing.T) {
 	// Test ParsedMeta struct creation and usage
-	hashData1, err := hashing.Hash(bson.M{"_id": "test1", "name": "doc1"})
+	hashData1, err := hashing.Hash(bson.D{{Key: "_id", Value: "test1"}, {Key: "name", Value: "doc1"}})
 	if err != nil {
 		t.Fatalf("Failed to create hash data: %v", err)
 	}
 
-	hashData2, err := hashing.Hash(bson.M{"_id": "test2", "name": "doc2"})
+	hashData2, err := hashing.Hash(bson.D{{Key: "_id", Value: "test2"}, {Key: "name", Value: "doc2"}})
 	if err != nil {
 		t.Fatalf("Failed to create hash data: %v", err)
 	}
@@ -51,19 +52,19 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		name     string
 		jsonData string
-		expected pho.DumpDoc
+		expected bson.M
 		wantErr  bool
 	}{
 		{
 			name:     "simple document",
 			jsonData: `{"name": "test", "value": 123}`,
-			expected: pho.DumpDoc{"name": "test", "value": 123},
+			expected: bson.M{"name": "test", "value": 123},
 			wantErr:  false,
 		},
 		{
 			name:     "document with ObjectId",
 			jsonData: `{"_id": {"$oid": "507f1f77bcf86cd799439011"}, "name": "test"}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				"_id":  func() primitive.ObjectID { oid, _ := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011"); return oid }(),
 				"name": "test",
 			},
@@ -72,7 +73,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "document with Date",
 			jsonData: `{"created": {"$date": {"$numberLong": "1672531200000"}}, "name": "test"}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				// Note: The exact date parsing depends on BSON ExtJSON implementation
 				"name": "test",
 			},
@@ -81,7 +82,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "document with NumberLong",
 			jsonData: `{"count": {"$numberLong": "9223372036854775807"}, "name": "test"}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				"count": int64(9223372036854775807),
 				"name":  "test",
 			},
@@ -90,7 +91,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "document with NumberDecimal",
 			jsonData: `{"price": {"$numberDecimal": "123.45"}, "name": "test"}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				"name": "test",
 				// Note: NumberDecimal handling depends on BSON implementation
 			},
@@ -99,7 +100,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "nested document",
 			jsonData: `{"user": {"name": "test", "age": 25}, "active": true}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				"user": bson.M{
 					"name": "test",
 					"age":  25,
@@ -111,7 +112,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "array field",
 			jsonData: `{"tags": ["go", "mongodb", "json"], "count": 3}`,
-			expected: pho.DumpDoc{
+			expected: bson.M{
 				"tags":  bson.A{"go", "mongodb", "json"},
 				"count": 3,
 			},
@@ -120,7 +121,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "empty document",
 			jsonData: `{}`,
-			expected: pho.DumpDoc{},
+			expected: bson.M{},
 			wantErr:  false,
 		},
 		{
@@ -132,7 +133,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 		{
 			name:     "invalid ExtJSON",
 			jsonData: `{"_id": {"$invalid": "value"}}`,
-			expected: pho.DumpDoc{},
+			expected: bson.M{},
 			wantErr:  false, // BSON.UnmarshalExtJSON might handle this gracefully
 		},
 	}
@@ -159,7 +160,7 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 						// Skip complex BSON types that might not match exactly
 						continue
 					}
-					if _, exists := doc[key]; !exists {
+					if _, exists := diff.LookupPath(bson.D(doc), key); !exists {
 						t.Errorf("DumpDoc.UnmarshalJSON() missing expected key: %s", key)
 					}
 				}
@@ -169,20 +170,20 @@ func TestDumpDoc_UnmarshalJSON(t *testing.T) {
 }
 
 func TestDumpDoc_conversion(t *testing.T) {
-	// Test that DumpDoc can be converted to bson.M
-	originalBson := bson.M{
-		"_id":    "test123",
-		"name":   "test document",
-		"value":  42,
-		"active": true,
-		"tags":   []string{"test", "document"},
+	// Test that DumpDoc can be converted to bson.D
+	originalBson := bson.D{
+		{Key: "_id", Value: "test123"},
+		{Key: "name", Value: "test document"},
+		{Key: "value", Value: 42},
+		{Key: "active", Value: true},
+		{Key: "tags", Value: []string{"test", "document"}},
 	}
 
 	// Convert to DumpDoc
 	dumpDoc := pho.DumpDoc(originalBson)
 
-	// Convert back to bson.M
-	resultBson := bson.M(dumpDoc)
+	// Convert back to bson.D
+	resultBson := bson.D(dumpDoc)
 
 	if !reflect.DeepEqual(originalBson, resultBson) {
 		t.Errorf("DumpDoc conversion failed")
@@ -191,6 +192,23 @@ func TestDumpDoc_conversion(t *testing.T) {
 	}
 }
 
+func TestDumpDoc_keepsFieldOrder(t *testing.T) {
+	var doc pho.DumpDoc
+	err := doc.UnmarshalJSON([]byte(`{"_id": 1, "zeta": {"b": 1, "a": 2}, "alpha": true}`))
+	if err != nil {
+		t.Fatalf("DumpDoc.UnmarshalJSON() unexpected error: %v", err)
+	}
+
+	expected := pho.DumpDoc{
+		{Key: "_id", Value: int32(1)},
+		{Key: "zeta", Value: bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(2)}}},
+		{Key: "alpha", Value: true},
+	}
+	if !reflect.DeepEqual(expected, doc) {
+		t.Errorf("DumpDoc.UnmarshalJSON() = %v, want %v", doc, expected)
+	}
+}
+
 func TestDumpDoc_withRealExtJSON(t *testing.T) {
 	// Test with real MongoDB ExtJSON examples
 	tests := []struct {
@@ -202,7 +220,7 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 			name:     "ObjectId field",
 			jsonData: `{"_id": {"$oid": "507f1f77bcf86cd799439011"}}`,
 			checkFn: func(doc pho.DumpDoc) bool {
-				id, exists := doc["_id"]
+				id, exists := diff.LookupPath(bson.D(doc), "_id")
 				return exists && id != nil
 			},
 		},
@@ -210,7 +228,7 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 			name:     "String field",
 			jsonData: `{"name": "test"}`,
 			checkFn: func(doc pho.DumpDoc) bool {
-				name, exists := doc["name"]
+				name, exists := diff.LookupPath(bson.D(doc), "name")
 				return exists && name == "test"
 			},
 		},
@@ -218,7 +236,7 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 			name:     "Number field",
 			jsonData: `{"value": 42}`,
 			checkFn: func(doc pho.DumpDoc) bool {
-				value, exists := doc["value"]
+				value, exists := diff.LookupPath(bson.D(doc), "value")
 				return exists && value != nil
 			},
 		},
@@ -226,7 +244,7 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 			name:     "Boolean field",
 			jsonData: `{"active": true}`,
 			checkFn: func(doc pho.DumpDoc) bool {
-				active, exists := doc["active"]
+				active, exists := diff.LookupPath(bson.D(doc), "active")
 				return exists && active == true
 			},
 		},
@@ -234,7 +252,7 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 			name:     "Null field",
 			jsonData: `{"deleted": null}`,
 			checkFn: func(doc pho.DumpDoc) bool {
-				_, exists := doc["deleted"]
+				_, exists := diff.LookupPath(bson.D(doc), "deleted")
 				return exists // null fields should exist as keys
 			},
 		},
@@ -259,28 +277,28 @@ func TestDumpDoc_withRealExtJSON(t *testing.T) {
 
 // Test edge cases and type safety.
 func TestDumpDoc_typeSafety(t *testing.T) {
-	// Test that DumpDoc is indeed bson.M underneath
-	var doc = pho.DumpDoc(make(bson.M))
+	// Test that DumpDoc is indeed bson.D underneath
+	var doc = pho.DumpDoc(make(bson.D, 0))
 
-	// Should be able to add fields like a regular bson.M
-	doc["test"] = "value"
-	doc["number"] = 42
-	doc["bool"] = true
+	// Should be able to add fields like a regular bson.D
+	doc = append(doc, bson.E{Key: "test", Value: "value"})
+	doc = append(doc, bson.E{Key: "number", Value: 42})
+	doc = append(doc, bson.E{Key: "bool", Value: true})
 
 	if len(doc) != 3 {
 		t.Errorf("DumpDoc length = %d, want 3", len(doc))
 	}
 
-	if doc["test"] != "value" {
-		t.Errorf("DumpDoc[\"test\"] = %v, want \"value\"", doc["test"])
+	if doc[0].Key != "test" || doc[0].Value != "value" {
+		t.Errorf("DumpDoc[0] = %v, want {test value}", doc[0])
 	}
 
-	if doc["number"] != 42 {
-		t.Errorf("DumpDoc[\"number\"] = %v, want 42", doc["number"])
+	if doc[1].Key != "number" || doc[1].Value != 42 {
+		t.Errorf("DumpDoc[1] = %v, want {number 42}", doc[1])
 	}
 
-	if doc["bool"] != true {
-		t.Errorf("DumpDoc[\"bool\"] = %v, want true", doc["bool"])
+	if doc[2].Key != "bool" || doc[2].Value != true {
+		t.Errorf("DumpDoc[2] = %v, want {bool true}", doc[2])
 	}
 }
 
@@ -295,7 +313,7 @@ func TestParsedMeta_emptyLines(t *testing.T) {
 	}
 
 	// Test adding to empty map
-	hashData, err := hashing.Hash(bson.M{"_id": "test", "name": "doc"})
+	hashData, err := hashing.Hash(bson.D{{Key: "_id", Value: "test"}, {Key: "name", Value: "doc"}})
 	if err != nil {
 		t.Fatalf("Failed to create hash data: %v", err)
 	}
@@ -1,6 +1,10 @@
 package pho
 
-import "pho/internal/render"
+import (
+	"pho/internal/render"
+	"pho/internal/restore"
+	"regexp"
+)
 
 // Option represents an option for configuring the Pho client.
 type Option func(*App)
@@ -14,5 +18,94 @@ func WithDatabase(v string) Option { return func(c *App) { c.dbName = v } }
 // WithCollection sets the MongoDB collection for the Pho client.
 func WithCollection(v string) Option { return func(c *App) { c.collectionName = v } }
 
+// WithSession sets the name of the session to work with (instead of the active one).
+func WithSession(v string) Option { return func(c *App) { c.sessionName = v } }
+
 // WithRenderer sets the Renderer instance for the Pho App.
 func WithRenderer(v *render.Renderer) Option { return func(c *App) { c.render = v } }
+
+// WithDirectoryDump makes the dump a directory with a file per document instead of a single file.
+func WithDirectoryDump(v bool) Option { return func(c *App) { c.directoryDump = v } }
+
+// WithIdentifyBy sets fields documents are identified by (several ones make a composite identity).
+// By default, documents are identified by _id (or id) field.
+func WithIdentifyBy(v []string) Option { return func(c *App) { c.identifyBy = v } }
+
+// WithProtected sets dotted paths of fields that must not be edited (e.g. `createdAt`, `audit`).
+// They are marked in the dump, and edits of them block applying changes (see WithAllowProtectedEdits).
+func WithProtected(v []string) Option { return func(c *App) { c.protectedFields = v } }
+
+// WithMaskedFields sets dotted paths of sensitive fields (e.g. `password`, `auth.token`).
+// Their values are replaced with diff.MaskPlaceholder in the dump, and the placeholder keeps the original value.
+func WithMaskedFields(v []string) Option { return func(c *App) { c.maskedFields = v } }
+
+// WithMaskPattern sets the pattern of sensitive field names (matched at any depth), masked like WithMaskedFields.
+func WithMaskPattern(v *regexp.Regexp) Option { return func(c *App) { c.maskPattern = v } }
+
+// DefaultBulkThreshold is the default number of changes starting from which they are applied via BulkWrite.
+const DefaultBulkThreshold = 100
+
+// applyOptions holds settings of a single ApplyChanges run.
+type applyOptions struct {
+	// force skips checking live documents against checksums stored in the session
+	force bool
+
+	// atomic applies all changes in a single transaction
+	atomic bool
+
+	// bulkThreshold is the number of changes starting from which they are applied via BulkWrite
+	bulkThreshold int
+
+	// batchSize is the max number of changes in a single BulkWrite call
+	batchSize int
+
+	// unordered lets BulkWrite continue applying changes after a failed one
+	unordered bool
+
+	// dryRun checks changes against the database without writing them
+	dryRun bool
+
+	// skipValidation skips checking documents against the collection's validator before writing
+	skipValidation bool
+
+	// allowProtectedEdits applies changes even if they edit protected fields
+	allowProtectedEdits bool
+}
+
+// ApplyOption represents an option for configuring ApplyChanges.
+type ApplyOption func(*applyOptions)
+
+func newApplyOptions(opts ...ApplyOption) *applyOptions {
+	o := &applyOptions{bulkThreshold: DefaultBulkThreshold, batchSize: restore.DefaultBatchSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithForce makes ApplyChanges write changes even if documents were modified in the database since the dump.
+func WithForce(v bool) ApplyOption { return func(o *applyOptions) { o.force = v } }
+
+// WithAtomic makes ApplyChanges run all changes inside a multi-document transaction.
+func WithAtomic(v bool) ApplyOption { return func(o *applyOptions) { o.atomic = v } }
+
+// WithBulkThreshold sets the number of changes starting from which they are applied via BulkWrite.
+func WithBulkThreshold(v int) ApplyOption { return func(o *applyOptions) { o.bulkThreshold = v } }
+
+// WithBatchSize sets the max number of changes in a single BulkWrite call.
+func WithBatchSize(v int) ApplyOption { return func(o *applyOptions) { o.batchSize = v } }
+
+// WithUnordered lets BulkWrite continue applying changes after a failed one.
+func WithUnordered(v bool) ApplyOption { return func(o *applyOptions) { o.unordered = v } }
+
+// WithDryRun makes ApplyChanges check every change against the database without writing anything:
+// changes are executed in transactions that are aborted, and a verdict per change is printed.
+func WithDryRun(v bool) ApplyOption { return func(o *applyOptions) { o.dryRun = v } }
+
+// WithSkipValidation makes ApplyChanges write changes without checking them against the collection's validator.
+func WithSkipValidation(v bool) ApplyOption { return func(o *applyOptions) { o.skipValidation = v } }
+
+// WithAllowProtectedEdits applies changes editing protected fields (see WithProtected) instead of rejecting them.
+func WithAllowProtectedEdits(v bool) ApplyOption {
+	return func(o *applyOptions) { o.allowProtectedEdits = v }
+}
@@ -0,0 +1,687 @@
+package pho
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/pkg/bsonpatch"
+	"pho/pkg/extjson"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// changesKey is the key of the changes list in changes-json format.
+const changesKey = "changes"
+
+// ErrStalePatch is the error of patches whose documents were changed after the patch was written.
+var ErrStalePatch = errors.New("patch is stale")
+
+// writePatch writes the changes in the given machine-readable format.
+// Patches describe the collection as a single JSON object keyed by full identifiers of documents
+// (e.g. `_id::1` or `_id::ObjectID("...")`), so standard patch formats can address documents:
+//   - JSON Patch (RFC 6902): `{"op":"replace","path":"/_id::1/address/city","value":"Lviv"}`
+//   - JSON Merge Patch (RFC 7396): `{"_id::1":{"address":{"city":"Lviv"}},"_id::2":null}`
+//
+// Values are written as canonical ExtJSON, so no type information is lost.
+func writePatch(out io.Writer, changes diff.Changes, format ReviewFormat) error {
+	var data []byte
+	var err error
+	switch format {
+	case ReviewFormats.JSONPatch:
+		data, err = marshalJSONPatch(buildJSONPatch(changes))
+	case ReviewFormats.MergePatch:
+		var patch bson.D
+		if patch, err = buildMergePatch(changes); err != nil {
+			return err
+		}
+		data, err = extjson.NewCanonicalMarshaller().WithIndent(" ").Marshal(patch)
+	case ReviewFormats.ChangesJSON:
+		records := make(bson.A, 0, changes.Len())
+		for _, ch := range changes {
+			records = append(records, toChangeRecord(ch))
+		}
+		data, err = extjson.NewCanonicalMarshaller().WithIndent(" ").Marshal(bson.D{{Key: changesKey, Value: records}})
+	default:
+		return fmt.Errorf("unsupported patch format: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", format, err)
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
+
+// buildJSONPatch returns JSON Patch operations of the changes.
+// Updates are written per changed field (or as replacement of the whole document if fields are unknown),
+// renamed documents are added under their new identifiers first, then removed under the previous ones.
+// Values that are replaced or removed are checked via `test` operations first (if they are known),
+// so the patch fails as a whole if documents were changed after it was written.
+func buildJSONPatch(changes diff.Changes) []bsonpatch.Operation {
+	var ops []bsonpatch.Operation
+	for _, ch := range changes {
+		id := ch.Identifier()
+		switch ch.Action {
+		case diff.ActionAdded:
+			ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpAdd, Path: bsonpatch.Pointer(id), Value: ch.Data})
+		case diff.ActionDeleted:
+			ops = append(ops, testOps([]string{id}, ch.Original)...)
+			ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpRemove, Path: bsonpatch.Pointer(id)})
+		case diff.ActionRenamed:
+			from := ch.RenamedFromIdentifier()
+			ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpAdd, Path: bsonpatch.Pointer(id), Value: ch.Data})
+			ops = append(ops, testOps([]string{from}, ch.Original)...)
+			ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpRemove, Path: bsonpatch.Pointer(from)})
+		case diff.ActionUpdated:
+			if ch.FieldChanges.Len() == 0 {
+				ops = append(ops, testOps([]string{id}, ch.Original)...)
+				op := bsonpatch.Operation{Op: bsonpatch.OpReplace, Path: bsonpatch.Pointer(id), Value: ch.Data}
+				ops = append(ops, op)
+				continue
+			}
+
+			for _, fc := range ch.FieldChanges {
+				tokens := append([]string{id}, strings.Split(fc.Path, diff.PathSeparator)...)
+				path := bsonpatch.Pointer(tokens...)
+				switch fc.Action {
+				case diff.FieldAdded:
+					ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpAdd, Path: path, Value: fc.After})
+				case diff.FieldModified:
+					ops = append(ops, testOps(tokens, fc.Before)...)
+					ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpReplace, Path: path, Value: fc.After})
+				case diff.FieldRemoved:
+					ops = append(ops, testOps(tokens, fc.Before)...)
+					ops = append(ops, bsonpatch.Operation{Op: bsonpatch.OpRemove, Path: path})
+				}
+			}
+		}
+	}
+
+	return ops
+}
+
+// testOps returns `test` operations checking the value under the path.
+// Masked values are unknown, so documents having them are checked field by field, skipping the masked ones.
+// Unknown documents (nil) are not checked at all.
+func testOps(tokens []string, value any) []bsonpatch.Operation {
+	if doc, ok := value.(bson.D); ok && doc == nil {
+		return nil
+	}
+	if !diff.HasMaskPlaceholder(value) {
+		return []bsonpatch.Operation{{Op: bsonpatch.OpTest, Path: bsonpatch.Pointer(tokens...), Value: value}}
+	}
+
+	doc, ok := value.(bson.D)
+	if !ok {
+		return nil
+	}
+
+	var ops []bsonpatch.Operation
+	for _, e := range doc {
+		ops = append(ops, testOps(append(slices.Clone(tokens), e.Key), e.Value)...)
+	}
+	return ops
+}
+
+// buildMergePatch returns JSON Merge Patch of the changes.
+// Merge patches can't check current values of documents, the only checks are done by identity fields:
+// new documents have them, while updates of existing ones don't (see calculatePatchedChanges).
+// Null means removal in merge patches, so fields set to null can't be written.
+// Note: updates with unknown changed fields can't remove fields, their documents are merged as a whole.
+func buildMergePatch(changes diff.Changes) (bson.D, error) {
+	patch := bson.D{}
+	for _, ch := range changes {
+		switch ch.Action {
+		case diff.ActionAdded:
+			patch = append(patch, bson.E{Key: ch.Identifier(), Value: ch.Data})
+		case diff.ActionDeleted:
+			patch = append(patch, bson.E{Key: ch.Identifier(), Value: nil})
+		case diff.ActionRenamed:
+			patch = append(patch,
+				bson.E{Key: ch.Identifier(), Value: ch.Data},
+				bson.E{Key: ch.RenamedFromIdentifier(), Value: nil},
+			)
+		case diff.ActionUpdated:
+			if ch.FieldChanges.Len() == 0 {
+				identityFields := hashing.IdentityFields(ch.IdentifiedBy)
+				doc := slices.DeleteFunc(slices.Clone(ch.Data), func(e bson.E) bool {
+					return e.Key == "_id" || slices.Contains(identityFields, e.Key)
+				})
+				patch = append(patch, bson.E{Key: ch.Identifier(), Value: doc})
+				continue
+			}
+
+			doc := bson.D{}
+			for _, fc := range ch.FieldChanges {
+				var value any
+				if fc.Action != diff.FieldRemoved {
+					value = fc.After
+				}
+				doc = setPatchPath(doc, strings.Split(fc.Path, diff.PathSeparator), value)
+			}
+			patch = append(patch, bson.E{Key: ch.Identifier(), Value: doc})
+		}
+
+		if path, ok := mergePatchNull(patch[len(patch)-1].Value, ch); ok {
+			return nil, fmt.Errorf("document %s sets %s to null, which JSON Merge Patch can't express "+
+				"(it's a removal there), use JSON Patch instead", ch.Identifier(), path)
+		}
+	}
+
+	return patch, nil
+}
+
+// mergePatchNull returns the path of a field set to null by the change in its merge patch document.
+// Removed fields are nulls as well, so they are skipped. Arrays are replaced as a whole, so nulls in them are kept.
+func mergePatchNull(value any, ch *diff.Change) (string, bool) {
+	doc, ok := value.(bson.D)
+	if !ok {
+		return "", false
+	}
+
+	removed := make(map[string]bool)
+	for _, fc := range ch.FieldChanges {
+		removed[fc.Path] = fc.Action == diff.FieldRemoved
+	}
+
+	var find func(prefix string, doc bson.D) (string, bool)
+	find = func(prefix string, doc bson.D) (string, bool) {
+		for _, e := range doc {
+			path := joinPath(prefix, e.Key)
+			if e.Value == nil && !removed[path] {
+				return path, true
+			}
+			if nested, ok := e.Value.(bson.D); ok {
+				if path, found := find(path, nested); found {
+					return path, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	return find("", doc)
+}
+
+// setPatchPath sets the value under the path of the merge patch document, creating nested documents.
+func setPatchPath(doc bson.D, path []string, value any) bson.D {
+	i := slices.IndexFunc(doc, func(e bson.E) bool { return e.Key == path[0] })
+	if len(path) == 1 {
+		if i >= 0 {
+			doc[i].Value = value
+			return doc
+		}
+		return append(doc, bson.E{Key: path[0], Value: value})
+	}
+
+	if i < 0 {
+		doc = append(doc, bson.E{Key: path[0], Value: bson.D{}})
+		i = len(doc) - 1
+	}
+	nested, _ := doc[i].Value.(bson.D)
+	doc[i].Value = setPatchPath(nested, path[1:], value)
+
+	return doc
+}
+
+// marshalJSONPatch marshals operations as a JSON array, an operation per line.
+func marshalJSONPatch(ops []bsonpatch.Operation) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, op := range ops {
+		doc := bson.D{{Key: "op", Value: op.Op}, {Key: "path", Value: op.Path}}
+		if op.From != "" {
+			doc = append(doc, bson.E{Key: "from", Value: op.From})
+		}
+		if op.Op == bsonpatch.OpAdd || op.Op == bsonpatch.OpReplace || op.Op == bsonpatch.OpTest {
+			doc = append(doc, bson.E{Key: "value", Value: op.Value})
+		}
+
+		data, err := extjson.NewCanonicalMarshaller().WithCompact(true).Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("operation [%d]: %w", i, err)
+		}
+
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n ")
+		buf.Write(data)
+	}
+	buf.WriteString("\n]")
+
+	return buf.Bytes(), nil
+}
+
+// ApplyPatchFile applies changes stored in the given file in one of machine-readable review formats
+// (JSON Patch, JSON Merge Patch or changes-json). Format is detected by the content of the file.
+// Patches are applied to the current versions of documents, so the session is not needed.
+// Patches written for other versions of documents are refused with ErrStalePatch: JSON Patch is checked via its
+// `test` operations, changes-json via originals of its changes, merge patches only via existence of documents.
+// Fields protected via WithProtected must not be edited by the patch (see WithAllowProtectedEdits).
+func (app *App) ApplyPatchFile(ctx context.Context, path string, opts ...ApplyOption) error {
+	if app.dbClient == nil {
+		return errors.New("db not connected")
+	}
+	if app.collectionName == "" {
+		return errors.New("collection name is required")
+	}
+	if app.dbName == "" {
+		return errors.New("db name is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read patch file: %w", err)
+	}
+
+	col := app.dbClient.Database(app.dbName).Collection(app.collectionName)
+
+	changes, err := app.patchChanges(ctx, col, data)
+	if err != nil {
+		return fmt.Errorf("invalid patch file %s: %w", path, err)
+	}
+	changes = changes.EffectiveOnes()
+	if len(app.protectedFields) > 0 {
+		if err := fetchOriginals(ctx, col, changes); err != nil {
+			return err
+		}
+		diff.FlagProtectedEdits(changes, app.protectedFields)
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "// Effective changes: %d\n", changes.Len())
+
+	applyOpts := newApplyOptions(opts...)
+	if err := checkProtectedEdits(changes, applyOpts.allowProtectedEdits); err != nil {
+		return err
+	}
+	if err := app.unmaskChanges(ctx, col, changes); err != nil {
+		return err
+	}
+
+	if applyOpts.dryRun {
+		// Patches are applied to current versions of documents, so there are no conflicts
+		return app.dryRun(ctx, col, changes, false)
+	}
+
+	if !applyOpts.skipValidation {
+		if err := app.validateChanges(ctx, col, changes); err != nil {
+			return err
+		}
+	}
+
+	applyErrors, err := app.writeChanges(ctx, col, changes, applyOpts)
+	if err != nil {
+		return err
+	}
+	if len(applyErrors) > 0 {
+		return fmt.Errorf("failed to apply %d change(s)", len(applyErrors))
+	}
+
+	return nil
+}
+
+// patchChanges decodes the patch and calculates changes it makes to the documents of the collection.
+func (app *App) patchChanges(ctx context.Context, col *mongo.Collection, data []byte) (diff.Changes, error) {
+	decoded, err := decodePatch(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch patch := decoded.(type) {
+	case bson.A:
+		ops, err := parseJSONPatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return app.patchedChanges(ctx, col, ops, nil)
+	case bson.D:
+		if len(patch) == 1 && patch[0].Key == changesKey {
+			changes, err := parseChangesJSON(patch[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			return changes, checkStaleChanges(ctx, col, changes)
+		}
+		return app.patchedChanges(ctx, col, nil, patch)
+	default:
+		return nil, errors.New("patch must be an array (JSON Patch) or an object (JSON Merge Patch or changes-json)")
+	}
+}
+
+// decodePatch decodes the patch file: it's either an array (JSON Patch) or a document.
+func decodePatch(data []byte) (any, error) {
+	data = bytes.TrimSpace(data)
+
+	// Patch is wrapped into a document, as only documents can be decoded from ExtJSON
+	var wrapper bson.D
+	if err := bson.UnmarshalExtJSON(append(append([]byte(`{"patch":`), data...), '}'), true, &wrapper); err != nil {
+		return nil, fmt.Errorf("could not decode patch: %w", err)
+	}
+	if len(wrapper) != 1 {
+		return nil, errors.New("could not decode patch")
+	}
+
+	return wrapper[0].Value, nil
+}
+
+// parseJSONPatch parses decoded JSON Patch operations.
+func parseJSONPatch(patch bson.A) ([]bsonpatch.Operation, error) {
+	ops := make([]bsonpatch.Operation, 0, len(patch))
+	for i, raw := range patch {
+		doc, ok := raw.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("operation [%d] must be an object", i)
+		}
+
+		fields := topLevelFields(doc)
+		op := bsonpatch.Operation{Value: fields["value"]}
+		op.Op, _ = fields["op"].(string)
+		op.Path, ok = fields["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("operation [%d] has no path", i)
+		}
+		op.From, _ = fields["from"].(string)
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// parseChangesJSON parses changes of changes-json format.
+func parseChangesJSON(value any) (diff.Changes, error) {
+	records, ok := value.(bson.A)
+	if !ok {
+		return nil, errors.New("changes must be an array")
+	}
+
+	changes := make(diff.Changes, 0, len(records))
+	for i, record := range records {
+		recordDoc, ok := record.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("change [%d] must be an object", i)
+		}
+
+		ch, err := fromChangeRecord(topLevelFields(recordDoc))
+		if err != nil {
+			return nil, fmt.Errorf("change [%d]: %w", i, err)
+		}
+		changes = append(changes, ch)
+	}
+
+	return changes, nil
+}
+
+// patchedChanges applies JSON Patch operations (or JSON Merge Patch) to current versions of documents
+// addressed by the patch and calculates changes between current and patched versions.
+func (app *App) patchedChanges(
+	ctx context.Context,
+	col *mongo.Collection,
+	ops []bsonpatch.Operation,
+	mergePatch bson.D,
+) (diff.Changes, error) {
+	// Documents are addressed by the first token of paths
+	var ids []string
+	for _, op := range ops {
+		for _, pointer := range []string{op.Path, op.From} {
+			tokens, err := bsonpatch.ParsePointer(pointer)
+			if err != nil {
+				return nil, err
+			}
+			if len(tokens) > 0 {
+				ids = append(ids, tokens[0])
+			}
+		}
+	}
+	for _, e := range mergePatch {
+		ids = append(ids, e.Key)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	current, identifiedBy, err := fetchPatchedDocuments(ctx, col, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return calculatePatchedChanges(current, identifiedBy, ops, mergePatch)
+}
+
+// calculatePatchedChanges patches current documents (keyed by their identifiers)
+// and calculates changes between current and patched versions.
+func calculatePatchedChanges(
+	current bson.D,
+	identifiedBy string,
+	ops []bsonpatch.Operation,
+	mergePatch bson.D,
+) (diff.Changes, error) {
+	source := make(map[string]*hashing.HashData, len(current))
+	originals := make(map[string]bson.D, len(current))
+	var identifyBy []string
+	if identifiedBy != "" {
+		identifyBy = hashing.IdentityFields(identifiedBy)
+	}
+	for _, e := range current {
+		doc, _ := e.Value.(bson.D)
+		hashData, err := hashing.Hash(doc, identifyBy...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash document %s: %w", e.Key, err)
+		}
+		source[e.Key] = hashData
+		originals[e.Key] = doc
+	}
+
+	if err := checkPatchedDocuments(current, identifiedBy, ops, mergePatch); err != nil {
+		return nil, err
+	}
+
+	var patched any = current
+	if ops != nil {
+		var err error
+		if patched, err = bsonpatch.Apply(current, ops); err != nil {
+			return nil, err
+		}
+	} else {
+		patched = bsonpatch.MergePatch(current, mergePatch)
+	}
+
+	patchedDocs, ok := patched.(bson.D)
+	if !ok {
+		return nil, errors.New("patch must not replace the whole collection")
+	}
+
+	destination := make([]bson.D, 0, len(patchedDocs))
+	for _, e := range patchedDocs {
+		doc, ok := e.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("document %s must be an object", e.Key)
+		}
+
+		// Documents are identified by their content, so it must match the identifier they are patched under
+		hashData, err := hashing.Hash(doc, identifyBy...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document %s: %w", e.Key, err)
+		}
+		if hashData.GetIdentifier() != e.Key {
+			return nil, fmt.Errorf("document %s is identified as %s", e.Key, hashData.GetIdentifier())
+		}
+		destination = append(destination, doc)
+	}
+
+	return diff.CalculateChanges(source, destination,
+		diff.WithOriginals(originals),
+		diff.WithIdentifyBy(identifyBy),
+	)
+}
+
+// checkPatchedDocuments checks that documents added by the patch don't exist and the updated ones do,
+// otherwise the patch was written for other versions of them: e.g. an added document would replace an existing one.
+// JSON Patch adds documents via `add` (or `move` and `copy`) of top-level paths,
+// while merge patches do via documents having identity fields (see buildMergePatch).
+func checkPatchedDocuments(current bson.D, identifiedBy string, ops []bsonpatch.Operation, mergePatch bson.D) error {
+	existing := make(map[string]bool, len(current))
+	for _, e := range current {
+		existing[e.Key] = true
+	}
+
+	for _, op := range ops {
+		if from, err := bsonpatch.ParsePointer(op.From); err == nil && op.Op == bsonpatch.OpMove && len(from) == 1 {
+			delete(existing, from[0])
+		}
+
+		tokens, err := bsonpatch.ParsePointer(op.Path)
+		if err != nil || len(tokens) != 1 {
+			continue
+		}
+
+		switch op.Op {
+		case bsonpatch.OpAdd, bsonpatch.OpMove, bsonpatch.OpCopy:
+			if existing[tokens[0]] {
+				return fmt.Errorf("%w: document %s already exists", ErrStalePatch, tokens[0])
+			}
+			existing[tokens[0]] = true
+		case bsonpatch.OpRemove:
+			delete(existing, tokens[0])
+		}
+	}
+
+	identityFields := hashing.IdentityFields(identifiedBy)
+	for _, e := range mergePatch {
+		doc, ok := e.Value.(bson.D)
+		if !ok {
+			continue
+		}
+
+		hasIdentity := !slices.ContainsFunc(identityFields, func(field string) bool {
+			_, ok := diff.LookupPath(doc, field)
+			return !ok
+		})
+		switch {
+		case hasIdentity && existing[e.Key]:
+			return fmt.Errorf("%w: document %s already exists", ErrStalePatch, e.Key)
+		case !hasIdentity && !existing[e.Key]:
+			return fmt.Errorf("%w: document %s doesn't exist", ErrStalePatch, e.Key)
+		}
+	}
+
+	return nil
+}
+
+// checkStaleChanges checks that documents of changes-json changes weren't changed after the changes were written:
+// added documents must not exist, others must match the originals the changes were made to (if they are known).
+// Masked values of originals are unknown, so they aren't compared.
+func checkStaleChanges(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	for _, ch := range changes {
+		var existing, live bson.D
+		var err error
+		if ch.Action == diff.ActionAdded || ch.Action == diff.ActionRenamed {
+			if existing, err = findDocument(ctx, col, ch.Filter()); err != nil {
+				return fmt.Errorf("failed to fetch document %s: %w", ch.Identifier(), err)
+			}
+		}
+		if ch.Action != diff.ActionAdded && ch.Original != nil {
+			filter := ch.Filter()
+			if ch.Action == diff.ActionRenamed {
+				filter = ch.RenamedFromFilter()
+			}
+			if live, err = findDocument(ctx, col, filter); err != nil {
+				return fmt.Errorf("failed to fetch document %s: %w", ch.Identifier(), err)
+			}
+		}
+
+		if err := staleChange(ch, existing, live); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// staleChange returns ErrStalePatch if the change can't be applied as it was written:
+// `existing` is the current document under the identifier of an added or renamed document,
+// `live` is the current version of the document the change was made to (nil if either is missing).
+func staleChange(ch *diff.Change, existing, live bson.D) error {
+	if (ch.Action == diff.ActionAdded || ch.Action == diff.ActionRenamed) && existing != nil {
+		return fmt.Errorf("%w: document %s already exists", ErrStalePatch, ch.Identifier())
+	}
+	if ch.Action == diff.ActionAdded || ch.Original == nil {
+		return nil
+	}
+
+	id := ch.Identifier()
+	if ch.Action == diff.ActionRenamed {
+		id = ch.RenamedFromIdentifier()
+	}
+	if live == nil {
+		return fmt.Errorf("%w: document %s doesn't exist", ErrStalePatch, id)
+	}
+
+	// Fields originals don't have are not compared, as originals may be projected
+	live = slices.DeleteFunc(slices.Clone(live), func(e bson.E) bool {
+		_, ok := diff.LookupPath(ch.Original, e.Key)
+		return !ok
+	})
+	if !sameUnmaskedContent(ch.Original, live) {
+		return fmt.Errorf("%w: document %s was changed", ErrStalePatch, id)
+	}
+
+	return nil
+}
+
+// findDocument returns the document matching the filter (nil if there is none).
+func findDocument(ctx context.Context, col *mongo.Collection, filter any) (bson.D, error) {
+	var doc bson.D
+	err := col.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	return doc, err
+}
+
+// fetchPatchedDocuments fetches current versions of documents by their full identifiers.
+// Documents are returned as a single document keyed by identifiers (missing documents are skipped),
+// along with the identity all the identifiers share.
+func fetchPatchedDocuments(ctx context.Context, col *mongo.Collection, ids []string) (bson.D, string, error) {
+	current := bson.D{}
+	var identifiedBy string
+	for _, id := range ids {
+		identifierBy, identifierValueStr, found := strings.Cut(id, hashing.IdentifierSeparator)
+		if !found {
+			return nil, "", fmt.Errorf("invalid document identifier %q (e.g. `_id::1` is expected)", id)
+		}
+		if identifiedBy != "" && identifierBy != identifiedBy {
+			return nil, "", fmt.Errorf("documents are identified differently: by %s and by %s",
+				identifiedBy, identifierBy)
+		}
+		identifiedBy = identifierBy
+
+		identifierValue, err := hashing.ParseIdentifierValue(identifierValueStr)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid document identifier %q: %w", id, err)
+		}
+
+		filter := diff.NewChange(identifiedBy, identifierValue.Value, diff.ActionNoop).Filter()
+
+		var doc bson.D
+		err = col.FindOne(ctx, filter).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to fetch document %s: %w", id, err)
+		}
+		current = append(current, bson.E{Key: id, Value: doc})
+	}
+
+	return current, identifiedBy, nil
+}
@@ -0,0 +1,354 @@
+package pho_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+	"pho/pkg/bsonpatch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// patchTestChanges returns an update, an add, a delete and a rename of documents.
+func patchTestChanges() diff.Changes {
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "new"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}}},
+	})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+		{Path: "address.city", Action: diff.FieldAdded, After: "Lviv"},
+		{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+	}
+
+	added := diff.NewChange("_id", "doc2", diff.ActionAdded, bson.D{
+		{Key: "_id", Value: "doc2"},
+		{Key: "name", Value: "fresh"},
+	})
+	deleted := diff.NewChange("_id", "doc3", diff.ActionDeleted)
+	deleted.Original = bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "stale"}}
+
+	renamed := diff.NewChange("_id", "doc5", diff.ActionRenamed, bson.D{
+		{Key: "_id", Value: "doc5"},
+		{Key: "name", Value: "moved"},
+	})
+	renamed.RenamedFrom = "doc4"
+	renamed.Original = bson.D{{Key: "_id", Value: "doc4"}, {Key: "name", Value: "moved"}}
+
+	return diff.Changes{updated, added, deleted, renamed}
+}
+
+// patchTestCurrent returns current versions of documents patchTestChanges are made to.
+func patchTestCurrent() bson.D {
+	return bson.D{
+		{Key: "_id::doc1", Value: bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "old"},
+			{Key: "legacy", Value: true},
+			{Key: "address", Value: bson.D{{Key: "zip", Value: "79000"}}},
+		}},
+		{Key: "_id::doc3", Value: bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "stale"}}},
+		{Key: "_id::doc4", Value: bson.D{{Key: "_id", Value: "doc4"}, {Key: "name", Value: "moved"}}},
+	}
+}
+
+func TestWritePatch_JSONPatch(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, pho.WritePatch(&out, patchTestChanges(), pho.ReviewFormats.JSONPatch))
+
+	expected := `[
+ {"op":"test","path":"/_id::doc1/name","value":"old"},
+ {"op":"replace","path":"/_id::doc1/name","value":"new"},
+ {"op":"add","path":"/_id::doc1/address/city","value":"Lviv"},
+ {"op":"test","path":"/_id::doc1/legacy","value":true},
+ {"op":"remove","path":"/_id::doc1/legacy"},
+ {"op":"add","path":"/_id::doc2","value":{"_id":"doc2","name":"fresh"}},
+ {"op":"test","path":"/_id::doc3","value":{"_id":"doc3","name":"stale"}},
+ {"op":"remove","path":"/_id::doc3"},
+ {"op":"add","path":"/_id::doc5","value":{"_id":"doc5","name":"moved"}},
+ {"op":"test","path":"/_id::doc4","value":{"_id":"doc4","name":"moved"}},
+ {"op":"remove","path":"/_id::doc4"}
+]
+`
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWritePatch_MergePatch(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, pho.WritePatch(&out, patchTestChanges(), pho.ReviewFormats.MergePatch))
+
+	decoded, err := pho.DecodePatch(out.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "_id::doc1", Value: bson.D{
+			{Key: "name", Value: "new"},
+			{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}}},
+			{Key: "legacy", Value: nil},
+		}},
+		{Key: "_id::doc2", Value: bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "fresh"}}},
+		{Key: "_id::doc3", Value: nil},
+		{Key: "_id::doc5", Value: bson.D{{Key: "_id", Value: "doc5"}, {Key: "name", Value: "moved"}}},
+		{Key: "_id::doc4", Value: nil},
+	}, decoded)
+}
+
+func TestWritePatch_ChangesJSON(t *testing.T) {
+	changes := patchTestChanges()
+
+	var out bytes.Buffer
+	require.NoError(t, pho.WritePatch(&out, changes, pho.ReviewFormats.ChangesJSON))
+
+	decoded, err := pho.DecodePatch(out.Bytes())
+	require.NoError(t, err)
+	doc, ok := decoded.(bson.D)
+	require.True(t, ok)
+	require.Len(t, doc, 1)
+
+	parsed, err := pho.ParseChangesJSON(doc[0].Value)
+	require.NoError(t, err)
+	require.Len(t, parsed, len(changes))
+	for i, ch := range changes {
+		assert.Equal(t, ch.Action, parsed[i].Action)
+		assert.Equal(t, ch.Identifier(), parsed[i].Identifier())
+		assert.Equal(t, ch.Data, parsed[i].Data)
+		assert.Equal(t, ch.FieldChanges.Len(), parsed[i].FieldChanges.Len())
+		assert.Equal(t, ch.Original, parsed[i].Original)
+	}
+	assert.Equal(t, "_id::doc4", parsed[3].RenamedFromIdentifier())
+}
+
+func TestCalculatePatchedChanges(t *testing.T) {
+	changes := patchTestChanges()
+
+	tests := []struct {
+		name   string
+		format pho.ReviewFormat
+	}{
+		{name: "json patch", format: pho.ReviewFormats.JSONPatch},
+		{name: "merge patch", format: pho.ReviewFormats.MergePatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, pho.WritePatch(&out, changes, tt.format))
+
+			decoded, err := pho.DecodePatch(out.Bytes())
+			require.NoError(t, err)
+
+			var patched diff.Changes
+			if ops, ok := decoded.(bson.A); ok {
+				parsedOps, err := pho.ParseJSONPatch(ops)
+				require.NoError(t, err)
+				patched, err = pho.CalculatePatchedChanges(patchTestCurrent(), "_id", parsedOps, nil)
+				require.NoError(t, err)
+			} else {
+				patched, err = pho.CalculatePatchedChanges(patchTestCurrent(), "_id", nil, decoded.(bson.D))
+				require.NoError(t, err)
+			}
+
+			actions := make(map[string]diff.Action)
+			for _, ch := range patched.EffectiveOnes() {
+				actions[ch.Identifier()] = ch.Action
+			}
+			assert.Equal(t, map[string]diff.Action{
+				"_id::doc1": diff.ActionUpdated,
+				"_id::doc2": diff.ActionAdded,
+				"_id::doc3": diff.ActionDeleted,
+				"_id::doc5": diff.ActionRenamed,
+			}, actions)
+
+			for _, ch := range patched {
+				if ch.Action == diff.ActionUpdated {
+					assert.Equal(t, bson.D{
+						{Key: "_id", Value: "doc1"},
+						{Key: "name", Value: "new"},
+						{Key: "address", Value: bson.D{{Key: "zip", Value: "79000"}, {Key: "city", Value: "Lviv"}}},
+					}, ch.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculatePatchedChanges_IdentifierMismatch(t *testing.T) {
+	current := bson.D{{Key: "_id::doc1", Value: bson.D{{Key: "_id", Value: "doc1"}}}}
+	ops := []bsonpatch.Operation{{Op: bsonpatch.OpReplace, Path: "/_id::doc1/_id", Value: "doc2"}}
+
+	_, err := pho.CalculatePatchedChanges(current, "_id", ops, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "identified as _id::doc2")
+}
+
+func TestCalculatePatchedChanges_Stale(t *testing.T) {
+	current := patchTestCurrent()
+	current[0].Value = bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "edited meanwhile"}}
+
+	tests := []struct {
+		name       string
+		ops        []bsonpatch.Operation
+		mergePatch bson.D
+		wantErr    error
+	}{
+		{
+			name: "json patch test fails",
+			ops: []bsonpatch.Operation{
+				{Op: bsonpatch.OpTest, Path: "/_id::doc1/name", Value: "old"},
+				{Op: bsonpatch.OpReplace, Path: "/_id::doc1/name", Value: "new"},
+			},
+			wantErr: bsonpatch.ErrTestFailed,
+		},
+		{
+			name: "json patch adds existing document",
+			ops: []bsonpatch.Operation{
+				{Op: bsonpatch.OpAdd, Path: "/_id::doc3", Value: bson.D{{Key: "_id", Value: "doc3"}}},
+			},
+			wantErr: pho.ErrStalePatch,
+		},
+		{
+			name: "merge patch adds existing document",
+			mergePatch: bson.D{
+				{Key: "_id::doc3", Value: bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "x"}}},
+			},
+			wantErr: pho.ErrStalePatch,
+		},
+		{
+			name:       "merge patch updates missing document",
+			mergePatch: bson.D{{Key: "_id::doc9", Value: bson.D{{Key: "name", Value: "x"}}}},
+			wantErr:    pho.ErrStalePatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pho.CalculatePatchedChanges(current, "_id", tt.ops, tt.mergePatch)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	// Document may be re-added once removed
+	ops := []bsonpatch.Operation{
+		{Op: bsonpatch.OpRemove, Path: "/_id::doc3"},
+		{Op: bsonpatch.OpAdd, Path: "/_id::doc3", Value: bson.D{{Key: "_id", Value: "doc3"}}},
+	}
+	_, err := pho.CalculatePatchedChanges(current, "_id", ops, nil)
+	require.NoError(t, err)
+}
+
+func TestBuildJSONPatch_Masked(t *testing.T) {
+	deleted := diff.NewChange("_id", "doc1", diff.ActionDeleted)
+	deleted.Original = bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "auth", Value: bson.D{{Key: "user", Value: "alice"}, {Key: "token", Value: diff.MaskPlaceholder}}},
+	}
+
+	// Masked values are unknown, so they are not tested
+	assert.Equal(t, []bsonpatch.Operation{
+		{Op: bsonpatch.OpTest, Path: "/_id::doc1/_id", Value: "doc1"},
+		{Op: bsonpatch.OpTest, Path: "/_id::doc1/auth/user", Value: "alice"},
+		{Op: bsonpatch.OpRemove, Path: "/_id::doc1"},
+	}, pho.BuildJSONPatch(diff.Changes{deleted}))
+}
+
+func TestBuildMergePatch_Nulls(t *testing.T) {
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "_id", Value: "doc1"}})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+		{Path: "address.city", Action: diff.FieldModified, Before: "Lviv", After: nil},
+	}
+	_, err := pho.BuildMergePatch(diff.Changes{updated})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "document _id::doc1 sets address.city to null")
+
+	added := diff.NewChange("_id", "doc2", diff.ActionAdded,
+		bson.D{{Key: "_id", Value: "doc2"}, {Key: "note", Value: nil}})
+	_, err = pho.BuildMergePatch(diff.Changes{added})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "document _id::doc2 sets note to null")
+
+	// Removed fields are nulls, as well as nulls in arrays are kept as they are
+	updated.FieldChanges = updated.FieldChanges[:1]
+	added.Data = bson.D{{Key: "_id", Value: "doc2"}, {Key: "tags", Value: bson.A{nil}}}
+	patch, err := pho.BuildMergePatch(diff.Changes{updated, added})
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "_id::doc1", Value: bson.D{{Key: "legacy", Value: nil}}},
+		{Key: "_id::doc2", Value: bson.D{{Key: "_id", Value: "doc2"}, {Key: "tags", Value: bson.A{nil}}}},
+	}, patch)
+
+	// Identity fields are not written for updates of whole documents, as they mark added documents
+	whole := diff.NewChange("_id", "doc3", diff.ActionUpdated,
+		bson.D{{Key: "_id", Value: "doc3"}, {Key: "name", Value: "x"}})
+	patch, err = pho.BuildMergePatch(diff.Changes{whole})
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "_id::doc3", Value: bson.D{{Key: "name", Value: "x"}}}}, patch)
+}
+
+func TestStaleChange(t *testing.T) {
+	original := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "old"},
+		{Key: "token", Value: diff.MaskPlaceholder},
+	}
+
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "_id", Value: "doc1"}})
+	updated.Original = original
+	added := diff.NewChange("_id", "doc2", diff.ActionAdded, bson.D{{Key: "_id", Value: "doc2"}})
+	renamed := diff.NewChange("_id", "doc2", diff.ActionRenamed, bson.D{{Key: "_id", Value: "doc2"}})
+	renamed.RenamedFrom = "doc1"
+	renamed.Original = original
+	unknown := diff.NewChange("_id", "doc1", diff.ActionDeleted)
+
+	live := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "old"}, {Key: "token", Value: "secret"}}
+	// Fields the original doesn't have are not compared, as originals may be projected
+	projected := append(slices.Clone(live), bson.E{Key: "extra", Value: 1})
+	edited := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "new"}, {Key: "token", Value: "secret"}}
+
+	tests := []struct {
+		name     string
+		ch       *diff.Change
+		existing bson.D
+		live     bson.D
+		wantErr  string
+	}{
+		{name: "update of unchanged", ch: updated, live: live},
+		{name: "update of projected", ch: updated, live: projected},
+		{name: "update of changed", ch: updated, live: edited, wantErr: "document _id::doc1 was changed"},
+		{name: "update of missing", ch: updated, wantErr: "document _id::doc1 doesn't exist"},
+		{name: "add", ch: added},
+		{name: "add of existing", ch: added, existing: live, wantErr: "document _id::doc2 already exists"},
+		{name: "rename", ch: renamed, live: live},
+		{
+			name: "rename to existing", ch: renamed, existing: live, live: live,
+			wantErr: "document _id::doc2 already exists",
+		},
+		{name: "rename of changed", ch: renamed, live: edited, wantErr: "document _id::doc1 was changed"},
+		{name: "unknown original", ch: unknown, live: edited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pho.StaleChange(tt.ch, tt.existing, tt.live)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, pho.ErrStalePatch)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParseJSONPatch_Invalid(t *testing.T) {
+	_, err := pho.ParseJSONPatch(bson.A{"not an operation"})
+	require.Error(t, err)
+
+	_, err = pho.ParseJSONPatch(bson.A{bson.D{{Key: "op", Value: "remove"}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrUnsupportedPipeline = errors.New("unsupported pipeline")
+
+// pipelineStageKinds lists aggregation stages that keep documents of the source collection
+// (with their _id) as output, so the results can be edited and applied back.
+var pipelineStageKinds = map[string]pipelineStageKind{
+	"$match":       stageFilter,
+	"$sort":        stageFilter,
+	"$limit":       stageFilter,
+	"$skip":        stageFilter,
+	"$sample":      stageFilter,
+	"$lookup":      stageLookup,
+	"$graphLookup": stageLookup,
+	"$addFields":   stageAddFields,
+	"$set":         stageAddFields,
+}
+
+// pipelineStageKind tells how a pipeline stage affects the shape of documents.
+type pipelineStageKind int
+
+const (
+	stageFilter    pipelineStageKind = iota // filters or reorders documents, keeping them as they are
+	stageLookup                             // adds a context field (given in "as") with joined documents
+	stageAddFields                          // adds computed context fields
+)
+
+// parsePipeline parses a pipeline given as a JSON array of stages (ExtJSON is supported).
+func parsePipeline(in string) ([]bson.D, error) {
+	// Top-level array is wrapped into a document, as ExtJSON is unmarshalled into documents only
+	var wrapper struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(`{"pipeline":`+in+`}`), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("error parsing pipeline: %w", err)
+	}
+
+	return wrapper.Pipeline, nil
+}
+
+// validatePipeline checks that the pipeline outputs documents of the source collection
+// and returns the fields it adds to them. Such fields are context only: they are read-only in the dump.
+func validatePipeline(stages []bson.D) ([]string, error) {
+	var readOnly []string
+	for i, stage := range stages {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("%w: stage [%d] must have exactly one operator", ErrUnsupportedPipeline, i)
+		}
+
+		operator := stage[0].Key
+		kind, ok := pipelineStageKinds[operator]
+		if !ok {
+			return nil, fmt.Errorf("%w: stage [%d] %s doesn't keep documents of the source collection",
+				ErrUnsupportedPipeline, i, operator)
+		}
+
+		var fields []string
+		switch kind {
+		case stageFilter:
+			continue
+		case stageLookup:
+			spec, ok := stage[0].Value.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("%w: stage [%d] %s must be a document", ErrUnsupportedPipeline, i, operator)
+			}
+			as, _ := spec.Map()["as"].(string)
+			if as == "" {
+				return nil, fmt.Errorf("%w: stage [%d] %s must have \"as\" field", ErrUnsupportedPipeline, i, operator)
+			}
+			fields = []string{as}
+		case stageAddFields:
+			spec, ok := stage[0].Value.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("%w: stage [%d] %s must be a document", ErrUnsupportedPipeline, i, operator)
+			}
+			for _, e := range spec {
+				fields = append(fields, e.Key)
+			}
+		}
+
+		for _, field := range fields {
+			if field == "_id" || strings.HasPrefix(field, "_id"+diff.PathSeparator) {
+				return nil, fmt.Errorf("%w: stage [%d] %s can't change _id", ErrUnsupportedPipeline, i, operator)
+			}
+			readOnly = append(readOnly, field)
+		}
+	}
+
+	return readOnly, nil
+}
+
+// overwriteCheckPipeline builds the pipeline finding a source document that already has some of the given fields
+// (added by the pipeline as context). Leading $match stages are kept, so only documents they match are checked.
+func overwriteCheckPipeline(stages []bson.D, fields []string) []bson.D {
+	var check []bson.D
+	for _, stage := range stages {
+		if stage[0].Key != "$match" {
+			break
+		}
+		check = append(check, stage)
+	}
+
+	exists := make(bson.A, 0, len(fields))
+	for _, field := range fields {
+		exists = append(exists, bson.D{{Key: field, Value: bson.D{{Key: "$exists", Value: true}}}})
+	}
+
+	return append(check,
+		bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: exists}}}},
+		bson.D{{Key: "$limit", Value: int64(1)}},
+	)
+}
+
+// checkOverwrittenFields returns an error if the pipeline overwrites fields of source documents.
+// Such fields would become read-only context, so their edits would be silently lost.
+func checkOverwrittenFields(ctx context.Context, col *mongo.Collection, stages []bson.D, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	cur, err := col.Aggregate(ctx, overwriteCheckPipeline(stages, fields))
+	if err != nil {
+		return fmt.Errorf("failed to check fields added by the pipeline: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	if !cur.Next(ctx) {
+		return cur.Err()
+	}
+
+	var doc bson.D
+	if err := cur.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to check fields added by the pipeline: %w", err)
+	}
+	for _, field := range fields {
+		if _, ok := diff.LookupPath(doc, field); ok {
+			return fmt.Errorf("%w: field %s of source documents is overwritten, add context under a new field",
+				ErrUnsupportedPipeline, field)
+		}
+	}
+
+	return nil
+}
+
+// withoutFields returns a copy of the document without the given (dot-notated) fields.
+func withoutFields(doc bson.D, fields []string) bson.D {
+	if len(fields) == 0 {
+		return doc
+	}
+
+	removals := make(diff.FieldChanges, 0, len(fields))
+	for _, field := range fields {
+		removals = append(removals, &diff.FieldChange{Path: field, Action: diff.FieldRemoved})
+	}
+
+	return diff.ApplyFieldChanges(doc, removals)
+}
+
+// RunPipeline executes an aggregation pipeline against the MongoDB collection.
+// Only pipelines that output documents of the collection itself are supported:
+// fields added by $lookup, $addFields, etc. are dumped as read-only context, so they must not overwrite source fields.
+func (app *App) RunPipeline(ctx context.Context, pipeline string, limit int64) (*mongo.Cursor, error) {
+	if app.dbClient == nil {
+		return nil, errors.New("db not connected")
+	}
+
+	stages, err := parsePipeline(pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse given pipeline: %w", err)
+	}
+
+	readOnly, err := validatePipeline(stages)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 {
+		stages = append(stages, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	col := app.dbClient.Database(app.dbName).Collection(app.collectionName)
+
+	if err := checkOverwrittenFields(ctx, col, stages, readOnly); err != nil {
+		return nil, err
+	}
+
+	cur, err := col.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform collection.Aggregate: %w", err)
+	}
+
+	app.readOnlyFields = readOnly
+
+	return cur, nil
+}
@@ -0,0 +1,244 @@
+package pho_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/internal/pho"
+	"pho/internal/render"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestParsePipeline(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		pipeline string
+		expected []bson.D
+		wantErr  bool
+	}{
+		{
+			name:     "empty pipeline",
+			pipeline: `[]`,
+			expected: []bson.D{},
+		},
+		{
+			name:     "stages keep their order",
+			pipeline: `[{"$match": {"active": true}}, {"$sort": {"b": 1, "a": -1}}]`,
+			expected: []bson.D{
+				{{Key: "$match", Value: bson.D{{Key: "active", Value: true}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(-1)}}}},
+			},
+		},
+		{
+			name:     "extjson values",
+			pipeline: `[{"$match": {"_id": {"$oid": "507f1f77bcf86cd799439011"}}}]`,
+			expected: []bson.D{
+				{{Key: "$match", Value: bson.D{{Key: "_id", Value: oid}}}},
+			},
+		},
+		{
+			name:     "not an array",
+			pipeline: `{"$match": {}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid JSON",
+			pipeline: `[{"$match": `,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, err := pho.ParsePipeline(tt.pipeline)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, stages)
+		})
+	}
+}
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		name             string
+		pipeline         string
+		expectedReadOnly []string
+		wantErr          bool
+	}{
+		{
+			name:     "filtering stages",
+			pipeline: `[{"$match": {"active": true}}, {"$sort": {"name": 1}}, {"$skip": 10}, {"$limit": 5}]`,
+		},
+		{
+			name: "lookup adds read-only field",
+			pipeline: `[{"$lookup": {"from": "orders", "localField": "_id", "foreignField": "userId", "as": "orders"}},
+				{"$match": {"orders.status": "failed"}}]`,
+			expectedReadOnly: []string{"orders"},
+		},
+		{
+			name:             "computed fields are read-only",
+			pipeline:         `[{"$addFields": {"total": {"$sum": "$items.price"}}}, {"$set": {"meta.count": 1}}]`,
+			expectedReadOnly: []string{"total", "meta.count"},
+		},
+		{
+			name:     "grouping doesn't keep source documents",
+			pipeline: `[{"$group": {"_id": "$status", "count": {"$sum": 1}}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "replacing root doesn't keep source documents",
+			pipeline: `[{"$replaceRoot": {"newRoot": "$profile"}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "_id can't be changed",
+			pipeline: `[{"$set": {"_id": "other"}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "lookup without as",
+			pipeline: `[{"$lookup": {"from": "orders", "localField": "_id", "foreignField": "userId"}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "stage with several operators",
+			pipeline: `[{"$match": {}, "$sort": {"_id": 1}}]`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, err := pho.ParsePipeline(tt.pipeline)
+			require.NoError(t, err)
+
+			readOnly, err := pho.ValidatePipeline(stages)
+			if tt.wantErr {
+				require.ErrorIs(t, err, pho.ErrUnsupportedPipeline)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedReadOnly, readOnly)
+		})
+	}
+}
+
+func TestOverwriteCheckPipeline(t *testing.T) {
+	stages, err := pho.ParsePipeline(`[{"$match": {"active": true}},
+		{"$set": {"name": {"$toUpper": "$name"}}}, {"$match": {"name": "ADMIN"}}]`)
+	require.NoError(t, err)
+	readOnly, err := pho.ValidatePipeline(stages)
+	require.NoError(t, err)
+
+	// Overwritten name would become read-only, so source documents having it are looked for
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.D{{Key: "active", Value: true}}}},
+		{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: bson.D{{Key: "$exists", Value: true}}}},
+		}}}}},
+		{{Key: "$limit", Value: int64(1)}},
+	}, pho.OverwriteCheckPipeline(stages, readOnly))
+}
+
+func TestApp_Dump_marksReadOnlyFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ctx := context.Background()
+	cursor, err := mongo.NewCursorFromDocuments([]any{
+		bson.D{{Key: "_id", Value: int32(1)}, {Key: "name", Value: "alice"}, {Key: "orders", Value: bson.A{}}},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithExtJSONMode(render.ExtJSONModes.Relaxed))))
+	(&pho.AppReflect{App: app}).SetReadOnlyFields([]string{"orders"})
+	out, _, err := app.SetupDumpDestination()
+	require.NoError(t, err)
+	require.NoError(t, app.Dump(ctx, cursor, out))
+	require.NoError(t, out.Close())
+
+	dump, err := os.ReadFile(filepath.Join(tempDir, "_dump.jsonl"))
+	require.NoError(t, err)
+	assert.Contains(t, string(dump), "/* read-only, edits are not applied: orders */\n")
+}
+
+func TestApp_RunPipeline_errors(t *testing.T) {
+	_, err := pho.NewApp().RunPipeline(context.Background(), `[]`, 0)
+	require.ErrorContains(t, err, "db not connected")
+}
+
+func TestApp_extractChanges_readOnlyFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithAsValidJSON(false))))
+	ctx := context.Background()
+
+	// Originals and hashes are stored without read-only fields, while the dump has them
+	original := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"test"}`
+	untouched := `{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"other"}`
+	dump := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"renamed","orders":[{"total":10}]}` + "\n" +
+		`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"other","orders":[{"total":99}]}` + "\n"
+
+	lines := make(map[string]*hashing.HashData)
+	for _, doc := range []string{original, untouched} {
+		var dumpDoc pho.DumpDoc
+		require.NoError(t, dumpDoc.UnmarshalJSON([]byte(doc)))
+		hashData, err := hashing.Hash(bson.D(dumpDoc))
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+	}
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		Pipeline:   `[{"$lookup":{"from":"orders","localField":"_id","foreignField":"userId","as":"orders"}}]`,
+		ReadOnly:   []string{"orders"},
+		DumpFile:   "_dump.jsonl",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	parsed := &pho.SessionConfig{}
+	require.NoError(t, parsed.FromSessionConf(sessionConf))
+	assert.Equal(t, sessionConfig.Pipeline, parsed.Pipeline)
+	assert.Equal(t, sessionConfig.ReadOnly, parsed.ReadOnly)
+
+	originals := original + "\n" + untouched + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoOriginalsFile()), []byte(originals), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.jsonl"), []byte(dump), 0600))
+
+	ar := pho.AppReflect{App: app}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+
+	// Edits of read-only fields are ignored
+	assert.Equal(t, 1, changes.FilterByAction(diff.ActionNoop).Len())
+
+	updates := changes.FilterByAction(diff.ActionUpdated)
+	require.Len(t, updates, 1)
+	assert.Equal(t, []string{"name"}, updates[0].FieldChanges.Paths())
+	assert.NotContains(t, updates[0].Data, "orders")
+}
@@ -0,0 +1,93 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrHiddenFieldsLost is returned when documents of a projected dump would be written as a whole
+// by outputs that can't take fields hidden by the projection from live documents.
+var ErrHiddenFieldsLost = errors.New("fields hidden by the projection would be lost")
+
+// writesWhole reports whether the change writes its document as a whole (replaced or renamed ones).
+func writesWhole(ch *diff.Change) bool {
+	return ch.Action == diff.ActionRenamed || ch.Action == diff.ActionUpdated && ch.FieldChanges.Len() == 0
+}
+
+// keepHiddenFields adds fields hidden by the projection of the dump to documents that are written as a whole,
+// taking them from the live documents: otherwise they would be removed.
+// Only fields that were not dumped are added, so the ones removed in the dump stay removed.
+func (app *App) keepHiddenFields(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	if app.projection == "" {
+		return nil
+	}
+
+	for _, ch := range changes {
+		if !writesWhole(ch) {
+			continue
+		}
+
+		filter := ch.Filter()
+		if ch.Action == diff.ActionRenamed {
+			filter = ch.RenamedFromFilter()
+		}
+
+		var live bson.D
+		err := col.FindOne(ctx, filter).Decode(&live)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Nothing to keep: the change itself will fail to be applied
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch hidden fields of %s: %w", ch.Identifier(), err)
+		}
+
+		dumped := ch.Original
+		if dumped == nil {
+			dumped = ch.Data
+		}
+		ch.Data = withHiddenFields(ch.Data, dumped, live)
+	}
+
+	return nil
+}
+
+// withHiddenFields returns the document with the top-level fields of the live one that were not dumped.
+func withHiddenFields(doc, dumped, live bson.D) bson.D {
+	result := slices.Clone(doc)
+	for _, e := range live {
+		if !hasTopLevelField(dumped, e.Key) && !hasTopLevelField(doc, e.Key) {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// hasTopLevelField reports whether the document has the top-level field.
+func hasTopLevelField(doc bson.D, key string) bool {
+	return slices.ContainsFunc(doc, func(e bson.E) bool { return e.Key == key })
+}
+
+// checkProjectedWrites returns an error if changes write documents of a projected dump as a whole,
+// for outputs that can't keep fields hidden by the projection (e.g. mongosh scripts).
+func (app *App) checkProjectedWrites(changes diff.Changes) error {
+	if app.projection == "" {
+		return nil
+	}
+
+	for _, ch := range changes {
+		if writesWhole(ch) {
+			return fmt.Errorf("document %s is written as a whole, apply it via pho instead: %w",
+				ch.Identifier(), ErrHiddenFieldsLost)
+		}
+	}
+
+	return nil
+}
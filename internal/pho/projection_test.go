@@ -0,0 +1,100 @@
+package pho_test
+
+import (
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWithHiddenFields(t *testing.T) {
+	dumped := bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "Alice"}, {Key: "age", Value: 30}}
+	live := bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "name", Value: "Alice"},
+		{Key: "age", Value: 30},
+		{Key: "password", Value: "secret"},
+		{Key: "tokens", Value: bson.A{"a", "b"}},
+	}
+
+	tests := []struct {
+		name string
+		doc  bson.D
+		want bson.D
+	}{
+		{
+			name: "hidden fields are kept",
+			doc:  bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "Bob"}, {Key: "age", Value: 30}},
+			want: bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "name", Value: "Bob"},
+				{Key: "age", Value: 30},
+				{Key: "password", Value: "secret"},
+				{Key: "tokens", Value: bson.A{"a", "b"}},
+			},
+		},
+		{
+			name: "dumped fields removed in the dump stay removed",
+			doc:  bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "Alice"}},
+			want: bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "name", Value: "Alice"},
+				{Key: "password", Value: "secret"},
+				{Key: "tokens", Value: bson.A{"a", "b"}},
+			},
+		},
+		{
+			name: "hidden fields set in the dump are not overwritten",
+			doc:  bson.D{{Key: "_id", Value: 1}, {Key: "password", Value: "changed"}},
+			want: bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "password", Value: "changed"},
+				{Key: "tokens", Value: bson.A{"a", "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pho.WithHiddenFields(tt.doc, dumped, live))
+		})
+	}
+}
+
+func TestApp_checkProjectedWrites(t *testing.T) {
+	fieldsUpdate := diff.NewChange("_id", 1, diff.ActionUpdated, bson.D{{Key: "_id", Value: 1}})
+	fieldsUpdate.FieldChanges = diff.FieldChanges{{Path: "name", Action: diff.FieldModified, After: "Bob"}}
+	replacement := diff.NewChange("_id", 2, diff.ActionUpdated, bson.D{{Key: "_id", Value: 2}})
+	renamed := diff.NewChange("_id", 3, diff.ActionRenamed, bson.D{{Key: "_id", Value: 3}})
+	added := diff.NewChange("_id", 4, diff.ActionAdded, bson.D{{Key: "_id", Value: 4}})
+
+	projection := `{"password":0}`
+	tests := []struct {
+		name       string
+		projection string
+		changes    diff.Changes
+		wantErr    bool
+	}{
+		{name: "no projection", changes: diff.Changes{replacement, renamed}},
+		{name: "field-level updates", projection: projection, changes: diff.Changes{fieldsUpdate, added}},
+		{name: "replacement", projection: projection, changes: diff.Changes{fieldsUpdate, replacement}, wantErr: true},
+		{name: "rename", projection: projection, changes: diff.Changes{renamed}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := pho.AppReflect{App: pho.NewApp()}
+			ar.SetProjection(tt.projection)
+
+			err := ar.CheckProjectedWrites(tt.changes)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, pho.ErrHiddenFieldsLost)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"pho/internal/diff"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ParseFieldPaths parses comma-separated dotted paths of fields, e.g. `createdAt, audit.by`.
+func ParseFieldPaths(s string) ([]string, error) {
+	var paths []string
+	for _, path := range strings.Split(s, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		for _, key := range strings.Split(path, diff.PathSeparator) {
+			if key == "" || strings.HasPrefix(key, "$") {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// fetchOriginals sets originals of updated and renamed changes that have none (e.g. read from changes-json)
+// to the current versions of their documents, so that edits of protected fields can be flagged on them.
+// Documents that are missing are skipped: changes of them fail on apply anyway.
+func fetchOriginals(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	for _, ch := range changes {
+		if (ch.Action != diff.ActionUpdated && ch.Action != diff.ActionRenamed) || ch.Original != nil {
+			continue
+		}
+
+		filter := ch.Filter()
+		if ch.Action == diff.ActionRenamed {
+			filter = ch.RenamedFromFilter()
+		}
+
+		var live bson.D
+		err := col.FindOne(ctx, filter).Decode(&live)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch document %s: %w", ch.Identifier(), err)
+		}
+		ch.Original = live
+	}
+
+	return nil
+}
+
+// checkProtectedEdits reports changes editing protected fields (see WithProtected).
+// ErrProtectedEdit is returned if there are any, unless their edits are allowed.
+func checkProtectedEdits(changes diff.Changes, allow bool) error {
+	edits := changes.WithProtectedEdits()
+	if edits.Len() == 0 {
+		return nil
+	}
+
+	writeProtectedEdits(os.Stderr, edits)
+	if allow {
+		_, _ = fmt.Fprintln(os.Stderr, "// Edits of protected fields are allowed, so they are applied")
+		return nil
+	}
+
+	return fmt.Errorf("%w in %d document(s), nothing applied", diff.ErrProtectedEdit, edits.Len())
+}
+
+// writeProtectedEdits writes changes editing protected fields as comments.
+func writeProtectedEdits(out io.Writer, changes diff.Changes) {
+	if changes.Len() == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(out, "// WARNING: %d document(s) edit protected fields:\n", changes.Len())
+	for _, ch := range changes {
+		_, _ = fmt.Fprintf(out, "//   %s %s\n", ch.Identifier(), strings.Join(ch.ProtectedEdits.Paths(), ", "))
+	}
+}
@@ -0,0 +1,117 @@
+package pho_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/internal/pho"
+	"pho/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseFieldPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "empty", input: "", expected: nil},
+		{name: "single", input: "createdAt", expected: []string{"createdAt"}},
+		{name: "nested with spaces", input: " createdAt , audit.by ,", expected: []string{"createdAt", "audit.by"}},
+		{name: "empty segment", input: "audit..by", wantErr: true},
+		{name: "operator", input: "$set", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := pho.ParseFieldPaths(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, paths)
+		})
+	}
+}
+
+func TestSessionConfig_Protected(t *testing.T) {
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Protected:  []string{"createdAt", "audit.by"},
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+	assert.Contains(t, string(sessionConf), "Protected: createdAt, audit.by\n")
+
+	var parsed pho.SessionConfig
+	require.NoError(t, parsed.FromSessionConf(sessionConf))
+	assert.Equal(t, []string{"createdAt", "audit.by"}, parsed.Protected)
+	assert.Equal(t, []string{"createdAt", "audit.by"}, parsed.ToParsedMeta().Protected)
+}
+
+func TestApp_extractChanges_protectedFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	renderer := render.NewRenderer(render.WithShowLineNumbers(true))
+	app := pho.NewApp(pho.WithRenderer(renderer))
+	ctx := context.Background()
+
+	original := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"test","audit":{"by":"admin","at":1}}`
+	edited := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"renamed","audit":{"by":"me","at":1}}`
+
+	var originalDoc pho.DumpDoc
+	require.NoError(t, originalDoc.UnmarshalJSON([]byte(original)))
+	hashData, err := hashing.Hash(bson.D(originalDoc))
+	require.NoError(t, err)
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Lines:      map[string]*hashing.HashData{hashData.GetIdentifier(): hashData},
+		Protected:  []string{"audit.by", "createdAt"},
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	dump := "/* 0 */\n/* protected, must not be edited: audit.by */\n" + edited + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, pho.GetPhoOriginalsFile()), []byte(original+"\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "_dump.jsonl"), []byte(dump), 0600))
+
+	ar := pho.AppReflect{App: app}
+	changes, err := ar.ExtractChanges(ctx)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	assert.Equal(t, []string{"audit.by", "name"}, changes[0].FieldChanges.Paths())
+	assert.Equal(t, []string{"audit.by"}, changes[0].ProtectedEdits.Paths())
+
+	err = pho.CheckProtectedEdits(changes, false)
+	require.ErrorIs(t, err, diff.ErrProtectedEdit)
+	assert.Contains(t, err.Error(), "in 1 document(s), nothing applied")
+	require.NoError(t, pho.CheckProtectedEdits(changes, true))
+
+	var out bytes.Buffer
+	pho.WriteProtectedEdits(&out, changes.WithProtectedEdits())
+	assert.Equal(t, "// WARNING: 1 document(s) edit protected fields:\n"+
+		"//   _id::ObjectID(\"507f1f77bcf86cd799439011\") audit.by\n", out.String())
+}
@@ -0,0 +1,230 @@
+package pho
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"pho/internal/diff"
+	"pho/internal/render"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReviewFormat is the format changes are reviewed in.
+type ReviewFormat string
+
+// ReviewFormats is a dictionary mapping review format names to their corresponding values.
+var ReviewFormats = struct {
+	Shell       ReviewFormat
+	Diff        ReviewFormat
+	JSONPatch   ReviewFormat
+	MergePatch  ReviewFormat
+	ChangesJSON ReviewFormat
+}{
+	Shell:       "shell",
+	Diff:        "diff",
+	JSONPatch:   "json-patch",
+	MergePatch:  "merge-patch",
+	ChangesJSON: "changes-json",
+}
+
+// ParseReviewFormat returns the review format of the given name.
+func ParseReviewFormat(s string) (ReviewFormat, error) {
+	switch format := ReviewFormat(s); format {
+	case ReviewFormats.Shell, ReviewFormats.Diff,
+		ReviewFormats.JSONPatch, ReviewFormats.MergePatch, ReviewFormats.ChangesJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid review format: %s "+
+			"(valid: shell, diff, json-patch, merge-patch, changes-json)", s)
+	}
+}
+
+// IsPatch reports if the format is a machine-readable patch (it can be applied via ApplyPatchFile).
+func (f ReviewFormat) IsPatch() bool {
+	return f == ReviewFormats.JSONPatch || f == ReviewFormats.MergePatch || f == ReviewFormats.ChangesJSON
+}
+
+// reviewOptions holds settings of a single ReviewChanges run.
+type reviewOptions struct {
+	// format is the format changes are written in
+	format ReviewFormat
+
+	// color turns on ANSI colors of the diff
+	color bool
+
+	// script is the file a standalone mongosh script is written into (instead of reviewing)
+	script string
+
+	// scriptTransaction wraps writes of the script into a single transaction
+	scriptTransaction bool
+}
+
+// ReviewOption represents an option for configuring ReviewChanges.
+type ReviewOption func(*reviewOptions)
+
+func newReviewOptions(opts ...ReviewOption) *reviewOptions {
+	o := &reviewOptions{format: ReviewFormats.Shell}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithReviewFormat sets the format changes are reviewed in (mongo shell commands by default).
+func WithReviewFormat(v ReviewFormat) ReviewOption { return func(o *reviewOptions) { o.format = v } }
+
+// WithColor turns on ANSI colors of the reviewed diff.
+func WithColor(v bool) ReviewOption { return func(o *reviewOptions) { o.color = v } }
+
+// WithScript makes ReviewChanges write changes into the given file as a standalone mongosh script.
+func WithScript(path string) ReviewOption { return func(o *reviewOptions) { o.script = path } }
+
+// WithScriptTransaction wraps writes of the script (see WithScript) into a single transaction.
+func WithScriptTransaction(v bool) ReviewOption {
+	return func(o *reviewOptions) { o.scriptTransaction = v }
+}
+
+// ANSI escape codes used to colorize the diff.
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiCyan  = "\033[36m"
+)
+
+// diffWriter writes changes as unified diffs of documents (original vs edited).
+type diffWriter struct {
+	out    io.Writer
+	render *render.Renderer
+	color  bool
+}
+
+// newDiffWriter returns the diff writer rendering documents in the format of the dump.
+// Documents are always rendered with indentation (a field per line), so the diff is per field.
+// Tabular dumps have no per-document representation, so their documents are rendered as JSON.
+func (app *App) newDiffWriter(out io.Writer, color bool) *diffWriter {
+	cfg := render.NewConfiguration()
+	if app.render != nil {
+		cfg = app.render.GetConfiguration()
+	}
+
+	format := cfg.Format
+	if format == render.Formats.CSV || format == render.Formats.TSV {
+		format = render.Formats.JSON
+	}
+	mode := cfg.ExtJSONMode
+	if mode == "" {
+		mode = render.ExtJSONModes.Canonical
+	}
+
+	return &diffWriter{
+		out:    out,
+		render: render.NewRenderer(render.WithFormat(format), render.WithExtJSONMode(mode)),
+		color:  color,
+	}
+}
+
+// Write writes the diff of the given change.
+func (w *diffWriter) Write(ch *diff.Change) error {
+	var before, after bson.D
+	oldLabel, newLabel := ch.Identifier(), ch.Identifier()
+	var note string
+
+	switch ch.Action {
+	case diff.ActionAdded:
+		after, oldLabel = ch.Data, "/dev/null"
+	case diff.ActionDeleted:
+		before, newLabel = ch.Original, "/dev/null"
+		if before == nil {
+			note = "original document is unknown"
+		}
+	case diff.ActionUpdated:
+		before, after = ch.Original, ch.Data
+		if before == nil {
+			note = "original document is unknown, the whole document is written"
+		}
+	case diff.ActionRenamed:
+		before, after = ch.Original, ch.Data
+		oldLabel = ch.RenamedFromIdentifier()
+		note = "the new document is inserted, then the old one is deleted"
+	default:
+		return nil
+	}
+
+	oldLines, err := w.lines(before)
+	if err != nil {
+		return err
+	}
+	newLines, err := w.lines(after)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("diff %s %s", ch.Action, ch.Identifier())
+	if ch.Action == diff.ActionRenamed {
+		header = fmt.Sprintf("diff %s %s -> %s", ch.Action, oldLabel, newLabel)
+	}
+	if summary := fieldsSummary(ch.FieldChanges); summary != "" {
+		header += " (" + summary + ")"
+	}
+
+	w.writeLine(ansiBold, header)
+	if note != "" {
+		w.writeLine(ansiBold, "# "+note)
+	}
+	w.writeLine(ansiBold, "--- "+oldLabel)
+	w.writeLine(ansiBold, "+++ "+newLabel)
+
+	for _, hunk := range diff.UnifiedDiff(oldLines, newLines, diff.DefaultContextLines) {
+		w.writeLine(ansiCyan, hunk.Header())
+		for _, line := range hunk.Lines {
+			switch line.Op {
+			case diff.LineRemoved:
+				w.writeLine(ansiRed, line.String())
+			case diff.LineAdded:
+				w.writeLine(ansiGreen, line.String())
+			default:
+				w.writeLine("", line.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// lines renders the document and splits it into lines (no lines for a missing document).
+func (w *diffWriter) lines(doc bson.D) ([]string, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	b, err := w.render.FormatResult(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render document: %w", err)
+	}
+
+	// YAML documents start with `---` separator, it's not a part of the document
+	b = bytes.TrimPrefix(b, []byte("---\n"))
+
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"), nil
+}
+
+// writeLine writes the line in the given color (if colors are on).
+func (w *diffWriter) writeLine(color, line string) {
+	if w.color && color != "" {
+		line = color + line + ansiReset
+	}
+	_, _ = fmt.Fprintln(w.out, line)
+}
+
+// fieldsSummary lists changed fields, e.g. `name: modified, legacy: removed`.
+func fieldsSummary(fieldChanges diff.FieldChanges) string {
+	parts := make([]string, 0, fieldChanges.Len())
+	for _, fc := range fieldChanges {
+		parts = append(parts, fc.Path+": "+strings.ToLower(fc.Action.String()))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,113 @@
+package pho_test
+
+import (
+	"bytes"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+	"pho/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseReviewFormat(t *testing.T) {
+	format, err := pho.ParseReviewFormat("diff")
+	require.NoError(t, err)
+	assert.Equal(t, pho.ReviewFormats.Diff, format)
+
+	format, err = pho.ParseReviewFormat("shell")
+	require.NoError(t, err)
+	assert.Equal(t, pho.ReviewFormats.Shell, format)
+
+	format, err = pho.ParseReviewFormat("json-patch")
+	require.NoError(t, err)
+	assert.Equal(t, pho.ReviewFormats.JSONPatch, format)
+	assert.True(t, format.IsPatch())
+	assert.False(t, pho.ReviewFormats.Diff.IsPatch())
+
+	_, err = pho.ParseReviewFormat("patch")
+	require.Error(t, err)
+}
+
+func TestApp_writeDiff(t *testing.T) {
+	original := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "old"},
+		{Key: "legacy", Value: true},
+		{Key: "city", Value: "Kyiv"},
+	}
+	edited := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "new"},
+		{Key: "city", Value: "Kyiv"},
+	}
+
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, edited)
+	updated.Original = original
+	updated.FieldChanges = diff.CompareDocuments(original, edited)
+
+	ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer(
+		render.WithExtJSONMode(render.ExtJSONModes.Relaxed),
+	)))}
+
+	var out bytes.Buffer
+	require.NoError(t, ar.WriteDiff(&out, updated, false))
+	assert.Equal(t, `diff UPDATED _id::doc1 (legacy: removed, name: modified)
+--- _id::doc1
++++ _id::doc1
+@@ -1,6 +1,5 @@
+ {
+  "_id": "doc1",
+- "name": "old",
+- "legacy": true,
++ "name": "new",
+  "city": "Kyiv"
+ }
+`, out.String())
+
+	t.Run("colorized", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, ar.WriteDiff(&out, updated, true))
+		assert.Contains(t, out.String(), "\033[36m@@ -1,6 +1,5 @@\033[0m\n")
+		assert.Contains(t, out.String(), "\033[31m- \"name\": \"old\",\033[0m\n")
+		assert.Contains(t, out.String(), "\033[32m+ \"name\": \"new\",\033[0m\n")
+		assert.Contains(t, out.String(), "\n  \"city\": \"Kyiv\"\n")
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		renamed := bson.D{{Key: "_id", Value: "doc2"}, {Key: "name", Value: "old"}}
+		ch := diff.NewChange("_id", "doc2", diff.ActionRenamed, renamed)
+		ch.RenamedFrom = "doc1"
+		ch.Original = bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "old"}}
+		ch.FieldChanges = diff.CompareDocuments(ch.Original, renamed)
+
+		var out bytes.Buffer
+		require.NoError(t, ar.WriteDiff(&out, ch, false))
+		assert.Equal(t, `diff RENAMED _id::doc1 -> _id::doc2 (_id: modified)
+# the new document is inserted, then the old one is deleted
+--- _id::doc1
++++ _id::doc2
+@@ -1,4 +1,4 @@
+ {
+- "_id": "doc1",
++ "_id": "doc2",
+  "name": "old"
+ }
+`, out.String())
+	})
+
+	t.Run("added in YAML", func(t *testing.T) {
+		ar := pho.AppReflect{App: pho.NewApp(pho.WithRenderer(render.NewRenderer(
+			render.WithFormat(render.Formats.YAML),
+		)))}
+		ch := diff.NewChange("_id", "doc3", diff.ActionAdded, bson.D{{Key: "_id", Value: "doc3"}})
+
+		var out bytes.Buffer
+		require.NoError(t, ar.WriteDiff(&out, ch, false))
+		assert.Equal(t, "diff ADDED _id::doc3\n--- /dev/null\n+++ _id::doc3\n"+
+			"@@ -0,0 +1,1 @@\n+_id: doc3\n", out.String())
+	})
+}
@@ -0,0 +1,160 @@
+package pho
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"pho/pkg/bsonschema"
+	"pho/pkg/extjson"
+	"pho/pkg/jsonl"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// vscodeSettingsFormat associates the schema with documents of the dump in VS Code,
+// when the data dir is opened as a workspace (see schemaFileMatch).
+const vscodeSettingsFormat = `{
+  "json.schemas": [
+    {
+      "fileMatch": [%q],
+      "url": %q
+    }
+  ]
+}
+`
+
+// writeSchema writes the JSON Schema of dumped documents next to the dump, so editors with JSON language servers
+// complete field names and point at values of wrong types while editing.
+// The collection's $jsonSchema validator is used if there is one, otherwise the schema is inferred from the dump.
+// Only directory dumps of JSON documents have a schema, as a single-file dump holds many documents
+// (JSON lines are not a JSON document). The schema of a previous dump is removed otherwise.
+func (app *App) writeSchema(ctx context.Context) error {
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return fmt.Errorf("could not get pho data dir: %w", err)
+	}
+	schemaPath := filepath.Join(dataDir, phoSchemaFile)
+
+	mode := extjson.Mode(app.render.GetConfiguration().ExtJSONMode)
+	if !app.directoryDump || app.render.IsYAML() || (mode != extjson.Canonical && mode != extjson.Relaxed) {
+		if err := os.Remove(schemaPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed removing schema of the previous dump: %w", err)
+		}
+		return nil
+	}
+
+	var schema *bsonschema.Schema
+	if validator := app.fetchDumpValidator(ctx); validator != nil {
+		schema = validator.schema
+	} else {
+		// Dumped documents are not kept in memory, so the schema is inferred from their snapshot
+		originals, err := os.Open(filepath.Join(dataDir, phoOriginalsFile))
+		if err != nil {
+			return fmt.Errorf("could not open originals: %w", err)
+		}
+		defer originals.Close()
+
+		dumped, err := jsonl.DecodeAll[DumpDoc](originals)
+		if err != nil {
+			return fmt.Errorf("could not decode originals: %w", err)
+		}
+		docs := make([]bson.D, len(dumped))
+		for i, doc := range dumped {
+			docs[i] = bson.D(doc)
+		}
+		schema = bsonschema.Infer(docs)
+	}
+
+	jsonSchema, err := schema.ExtJSON(mode)
+	if err != nil {
+		return err
+	}
+	// Dumps may be projected, so fields are not required (the validator still checks them on apply)
+	jsonSchema = withoutFields(jsonSchema, []string{"required"})
+
+	b, err := extjson.NewRelaxedMarshaller().WithIndent("  ").Marshal(jsonSchema)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	if err := os.WriteFile(schemaPath, append(b, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed writing schema file: %w", err)
+	}
+
+	vscodeDir := filepath.Join(dataDir, ".vscode")
+	if err := os.MkdirAll(vscodeDir, 0750); err != nil {
+		return fmt.Errorf("failed creating .vscode dir: %w", err)
+	}
+	settings := fmt.Sprintf(vscodeSettingsFormat, "/"+app.schemaFileMatch(), "./"+phoSchemaFile)
+	if err := os.WriteFile(filepath.Join(vscodeDir, "settings.json"), []byte(settings), 0600); err != nil {
+		return fmt.Errorf("failed writing VS Code settings: %w", err)
+	}
+
+	return nil
+}
+
+// schemaFileMatch returns the pattern (relative to the data dir) of files the schema describes:
+// files of documents in the directory dump.
+func (app *App) schemaFileMatch() string {
+	return app.getDumpFilename() + "/*" + app.getDocFileExtension()
+}
+
+// fetchDumpValidator returns the validator of the dumped collection (nil if there is none or it can't be fetched).
+func (app *App) fetchDumpValidator(ctx context.Context) *collectionValidator {
+	if app.dbClient == nil {
+		return nil
+	}
+
+	validator, err := fetchValidator(ctx, app.dbClient.Database(app.dbName).Collection(app.collectionName))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not fetch collection validator, schema is inferred instead: %v\n", err)
+		return nil
+	}
+
+	return validator
+}
+
+// getSchemaPath returns the path of the dump's JSON Schema (false if the dump has none).
+func (app *App) getSchemaPath() (string, bool) {
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return "", false
+	}
+
+	schemaPath := filepath.Join(dataDir, phoSchemaFile)
+	if _, err := os.Stat(schemaPath); err != nil {
+		return "", false
+	}
+
+	return schemaPath, true
+}
+
+// nvimSchemaCommand returns the Neovim command associating the schema with files matching the pattern
+// in the JSON language server (jsonls): the association is added to its settings once it attaches to a file,
+// whatever way the server is configured. Editors without jsonls are not affected.
+func nvimSchemaCommand(filePattern, schemaPath string) string {
+	schemaURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(schemaPath)}).String()
+	association := fmt.Sprintf("{fileMatch = {%s}, url = %s}",
+		luaString(filepath.ToSlash(filePattern)), luaString(schemaURL))
+
+	return strings.Join([]string{
+		"lua vim.api.nvim_create_autocmd('LspAttach', {callback = function(ev)",
+		"local c = vim.lsp.get_client_by_id(ev.data.client_id)",
+		"if not c or c.name ~= 'jsonls' or c.pho_schema then return end",
+		"local s = c.settings or {}",
+		"s.json = s.json or {}",
+		"s.json.schemas = s.json.schemas or {}",
+		"table.insert(s.json.schemas, " + association + ")",
+		"c.settings = s",
+		"c.pho_schema = true",
+		"c:notify('workspace/didChangeConfiguration', {settings = s})",
+		"end})",
+	}, " ")
+}
+
+// luaString returns the Lua string literal of the given string.
+func luaString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`).Replace(s) + "'"
+}
@@ -0,0 +1,104 @@
+package pho_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"pho/internal/pho"
+	"pho/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestApp_Dump_writesSchema(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Set up isolated environment
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ctx := context.Background()
+	dump := func(directory bool, opts ...render.Option) string {
+		cursor, err := mongo.NewCursorFromDocuments([]any{
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "price", Value: int32(10)}},
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "tags", Value: bson.A{"soup"}}},
+		}, nil, nil)
+		require.NoError(t, err)
+
+		dumper := pho.NewApp(pho.WithRenderer(render.NewRenderer(opts...)), pho.WithDirectoryDump(directory))
+		if directory {
+			dirPath, err := dumper.SetupDumpDirectory()
+			require.NoError(t, err)
+			require.NoError(t, dumper.DumpToDirectory(ctx, cursor, dirPath))
+			return dirPath
+		}
+
+		out, path, err := dumper.SetupDumpDestination()
+		require.NoError(t, err)
+		require.NoError(t, dumper.Dump(ctx, cursor, out))
+		require.NoError(t, out.Close())
+		return path
+	}
+	schemaPath := filepath.Join(tempDir, pho.GetPhoSchemaFile())
+
+	dirPath := dump(true, render.WithExtJSONMode(render.ExtJSONModes.Canonical))
+	schema, err := os.ReadFile(schemaPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(schema), `"$schema": "http://json-schema.org/draft-04/schema#"`)
+	assert.Contains(t, string(schema), `"$oid": {`)
+	assert.Contains(t, string(schema), `"$numberInt": {`)
+	assert.Contains(t, string(schema), `"tags": {`)
+
+	// Schema of a document is associated with every document file of the dump (and nothing else)
+	settingsData, err := os.ReadFile(filepath.Join(tempDir, ".vscode", "settings.json"))
+	require.NoError(t, err)
+	var settings struct {
+		Schemas []struct {
+			FileMatch []string `json:"fileMatch"`
+			URL       string   `json:"url"`
+		} `json:"json.schemas"`
+	}
+	require.NoError(t, json.Unmarshal(settingsData, &settings))
+	require.Len(t, settings.Schemas, 1)
+	assert.Equal(t, "./_dump.schema.json", settings.Schemas[0].URL)
+	require.Len(t, settings.Schemas[0].FileMatch, 1)
+	fileMatch := settings.Schemas[0].FileMatch[0]
+
+	entries, err := os.ReadDir(dirPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		rel, err := filepath.Rel(tempDir, filepath.Join(dirPath, entry.Name()))
+		require.NoError(t, err)
+		matched, err := path.Match(fileMatch, "/"+filepath.ToSlash(rel))
+		require.NoError(t, err)
+		assert.True(t, matched, "%s doesn't match %s", rel, fileMatch)
+	}
+	matched, err := path.Match(fileMatch, "/"+pho.GetPhoSchemaFile())
+	require.NoError(t, err)
+	assert.False(t, matched)
+
+	// Single-file dump holds many documents, so it has no schema: the one of the previous dump is removed
+	dump(false, render.WithExtJSONMode(render.ExtJSONModes.Canonical))
+	assert.NoFileExists(t, schemaPath)
+
+	// Shell mode is not JSON
+	dump(true, render.WithExtJSONMode(render.ExtJSONModes.Shell))
+	assert.NoFileExists(t, schemaPath)
+}
+
+func TestNvimSchemaCommand(t *testing.T) {
+	command := pho.NvimSchemaCommand("/tmp/pho's/_dump/*.json", "/tmp/pho's/_dump.schema.json")
+
+	assert.Contains(t, command, "lua vim.api.nvim_create_autocmd('LspAttach'")
+	assert.Contains(t, command, `{fileMatch = {'/tmp/pho\'s/_dump/*.json'}, `+
+		`url = 'file:///tmp/pho%27s/_dump.schema.json'}`)
+	assert.NotContains(t, command, "\n")
+}
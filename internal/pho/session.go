@@ -8,13 +8,15 @@ import (
 	"os"
 	"path/filepath"
 	"pho/internal/hashing"
+	"regexp"
 	"strings"
 	"time"
 )
 
 var (
-	ErrNoSession   = errors.New("no session found")
-	ErrSessionLost = errors.New("session data lost")
+	ErrNoSession          = errors.New("no session found")
+	ErrSessionLost        = errors.New("session data lost")
+	ErrInvalidSessionName = errors.New("invalid session name")
 )
 
 // SessionMetadata contains information about the current editing session.
@@ -40,6 +42,7 @@ type QueryParameters struct {
 	Limit      int64  `json:"limit"`
 	Sort       string `json:"sort,omitempty"`
 	Projection string `json:"projection,omitempty"`
+	Pipeline   string `json:"pipeline,omitempty"`
 }
 
 // String returns a human-readable description of the session.
@@ -75,9 +78,105 @@ const (
 	SessionStatusNotFound                      // No registry entry found
 )
 
-// getCurrentSessionID returns the current session ID (for now, just "current").
-func getCurrentSessionID() string {
-	return "current"
+const (
+	defaultSessionID  = "current" // Session used when no named session is requested or switched to
+	activeSessionFile = "active"  // File in sessions dir that holds the name of the switched-to session
+)
+
+// sessionNameRegex restricts session names, so they are safe to be used as file and directory names.
+var sessionNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateSessionName returns an error if the given name can't be used as a session name.
+func ValidateSessionName(name string) error {
+	if !sessionNameRegex.MatchString(name) {
+		return fmt.Errorf("%w: %q (letters, digits, '.', '_' and '-' are allowed)", ErrInvalidSessionName, name)
+	}
+	return nil
+}
+
+// getActiveSessionPath returns the path to the file holding the name of the switched-to session.
+func getActiveSessionPath() (string, error) {
+	sessionsDir, err := getSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(sessionsDir, activeSessionFile), nil
+}
+
+// readActiveSession returns the name of the switched-to session (empty if none).
+func readActiveSession() string {
+	activePath, err := getActiveSessionPath()
+	if err != nil {
+		return ""
+	}
+
+	data, err := os.ReadFile(activePath)
+	if err != nil {
+		return ""
+	}
+
+	name := strings.TrimSpace(string(data))
+	if ValidateSessionName(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// getSessionID returns the ID of the session the app works with:
+// explicitly requested one, otherwise the switched-to one, otherwise the default one.
+func (app *App) getSessionID() string {
+	if app.sessionName != "" {
+		return app.sessionName
+	}
+	if name := readActiveSession(); name != "" {
+		return name
+	}
+	return defaultSessionID
+}
+
+// SessionID returns the ID of the session the app works with.
+func (app *App) SessionID() string { return app.getSessionID() }
+
+// getSessionDataDir returns the data directory of the given session.
+// Default session lives directly in the pho data dir, named ones in their own subdirectories.
+func getSessionDataDir(sessionID string) (string, error) {
+	baseDir, err := getPhoDataDir()
+	if err != nil {
+		return "", err
+	}
+
+	if sessionID == defaultSessionID {
+		return baseDir, nil
+	}
+	if err := ValidateSessionName(sessionID); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(baseDir, sessionsSubDir, sessionID), nil
+}
+
+// getDataDir returns the data directory of the app's session.
+func (app *App) getDataDir() (string, error) {
+	return getSessionDataDir(app.getSessionID())
+}
+
+// String returns a human-readable representation of the SessionStatus.
+func (s SessionStatus) String() string {
+	switch s {
+	case SessionStatusActive:
+		return "active"
+	case SessionStatusLost:
+		return "lost"
+	case SessionStatusNotFound:
+		return "not found"
+	default:
+		return fmt.Sprintf("SessionStatus(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, so the status is human-readable in JSON.
+func (s SessionStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
 }
 
 // getSessionRegistryPath returns the path to the session registry file.
@@ -155,7 +254,7 @@ func checkSessionStatus(registry *SessionRegistry) SessionStatus {
 
 // GetSessionStatus returns the current session status with diagnostic information.
 func (app *App) GetSessionStatus(_ context.Context) (SessionStatus, *SessionRegistry, error) {
-	sessionID := getCurrentSessionID()
+	sessionID := app.getSessionID()
 
 	// Try to load session registry
 	registry, err := loadSessionRegistry(sessionID)
@@ -173,7 +272,7 @@ func (app *App) GetSessionStatus(_ context.Context) (SessionStatus, *SessionRegi
 
 // RecoverSession attempts to recover a lost session by re-running the query.
 func (app *App) RecoverSession(ctx context.Context) (*SessionMetadata, error) {
-	sessionID := getCurrentSessionID()
+	sessionID := app.getSessionID()
 
 	// Load session registry to get the original query parameters
 	registry, err := loadSessionRegistry(sessionID)
@@ -263,12 +362,20 @@ func (app *App) SaveSession(_ context.Context, queryParams QueryParameters) erro
 
 	// Determine dump filename - use default if no renderer is available
 	dumpFilename := phoDumpBase + ".jsonl" // Default to JSONL format
+	var format, extJSONMode, dumpLayout string
+	if app.directoryDump {
+		dumpLayout = dumpLayoutDirectory
+	}
 	if app.render != nil {
 		dumpFilename = app.getDumpFilename()
+
+		// Syntax of the dump is kept, so review/apply can read it back regardless of their flags
+		format = string(app.render.GetConfiguration().Format)
+		extJSONMode = string(app.render.GetConfiguration().ExtJSONMode)
 	}
 
 	// Get the data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return fmt.Errorf("failed to get pho data dir: %w", err)
 	}
@@ -283,6 +390,10 @@ func (app *App) SaveSession(_ context.Context, queryParams QueryParameters) erro
 		Limit:         queryParams.Limit,
 		Sort:          queryParams.Sort,
 		Projection:    queryParams.Projection,
+		Pipeline:      queryParams.Pipeline,
+		Format:        format,
+		ExtJSONMode:   extJSONMode,
+		DumpLayout:    dumpLayout,
 		DumpFile:      dumpFilename,
 		DocumentCount: 0, // Will be updated when metadata is written
 		Lines:         make(map[string]*hashing.HashData),
@@ -294,6 +405,11 @@ func (app *App) SaveSession(_ context.Context, queryParams QueryParameters) erro
 		if err := existingConfig.FromSessionConf(data); err == nil {
 			// Preserve metadata that was already written
 			sessionConfig.DocumentCount = existingConfig.DocumentCount
+			sessionConfig.IdentifyBy = existingConfig.IdentifyBy
+			sessionConfig.ReadOnly = existingConfig.ReadOnly
+			sessionConfig.Protected = existingConfig.Protected
+			sessionConfig.Masked = existingConfig.Masked
+			sessionConfig.MaskPattern = existingConfig.MaskPattern
 			sessionConfig.Lines = existingConfig.Lines
 		}
 	}
@@ -308,7 +424,7 @@ func (app *App) SaveSession(_ context.Context, queryParams QueryParameters) erro
 	}
 
 	// Create session registry entry
-	sessionID := getCurrentSessionID()
+	sessionID := app.getSessionID()
 	registry := &SessionRegistry{
 		ID:            sessionID,
 		Created:       sessionConfig.Created,
@@ -323,6 +439,13 @@ func (app *App) SaveSession(_ context.Context, queryParams QueryParameters) erro
 		return fmt.Errorf("failed to save session registry: %w", err)
 	}
 
+	// Explicitly named session becomes the active one, so next commands continue working with it
+	if app.sessionName != "" {
+		if err := writeActiveSession(sessionID); err != nil {
+			return fmt.Errorf("failed to switch to session: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -370,7 +493,7 @@ func (app *App) LoadSession(ctx context.Context) (*SessionMetadata, error) {
 
 // ClearSession removes session metadata and associated files.
 func (app *App) ClearSession(_ context.Context) error {
-	sessionID := getCurrentSessionID()
+	sessionID := app.getSessionID()
 
 	// Remove session registry
 	registryPath, err := getSessionRegistryPath(sessionID)
@@ -385,7 +508,7 @@ func (app *App) ClearSession(_ context.Context) error {
 	}
 
 	// Get data directory
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return fmt.Errorf("failed to get pho data dir: %w", err)
 	}
@@ -398,6 +521,17 @@ func (app *App) ClearSession(_ context.Context) error {
 		}
 	}
 
+	originalsPath := filepath.Join(dataDir, phoOriginalsFile)
+	if _, err := os.Stat(originalsPath); err == nil {
+		if err := os.Remove(originalsPath); err != nil {
+			return fmt.Errorf("failed to remove originals file: %w", err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dataDir, phoSchemaFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove schema file: %w", err)
+	}
+
 	return nil
 }
 
@@ -425,7 +559,7 @@ func (app *App) ValidateSession(_ context.Context, session *SessionMetadata) err
 	}
 
 	// Get data directory path
-	dataDir, err := getPhoDataDir()
+	dataDir, err := app.getDataDir()
 	if err != nil {
 		return fmt.Errorf("could not get pho data dir: %w", err)
 	}
@@ -444,3 +578,107 @@ func (app *App) ValidateSession(_ context.Context, session *SessionMetadata) err
 
 	return nil
 }
+
+// writeActiveSession makes the given session the active one.
+func writeActiveSession(sessionID string) error {
+	activePath, err := getActiveSessionPath()
+	if err != nil {
+		return err
+	}
+
+	// Default session is active when no other one is switched to
+	if sessionID == defaultSessionID {
+		if err := os.Remove(activePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to reset active session: %w", err)
+		}
+		return nil
+	}
+
+	if err := ensureDirectoryExists(getSessionsDir, "sessions dir"); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(activePath, []byte(sessionID+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write active session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession returns the registry entry and the status of the given session.
+func (app *App) GetSession(_ context.Context, sessionID string) (*SessionRegistry, SessionStatus, error) {
+	if sessionID != defaultSessionID {
+		if err := ValidateSessionName(sessionID); err != nil {
+			return nil, SessionStatusNotFound, err
+		}
+	}
+
+	registry, err := loadSessionRegistry(sessionID)
+	if err != nil {
+		if errors.Is(err, ErrNoSession) {
+			return nil, SessionStatusNotFound, fmt.Errorf("session %q: %w", sessionID, ErrNoSession)
+		}
+		return nil, SessionStatusNotFound, fmt.Errorf("failed to load session registry: %w", err)
+	}
+
+	return registry, checkSessionStatus(registry), nil
+}
+
+// SwitchSession makes the given (existing) session the active one.
+func (app *App) SwitchSession(ctx context.Context, sessionID string) error {
+	if _, _, err := app.GetSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	return writeActiveSession(sessionID)
+}
+
+// DropSession removes the given session: its registry entry and its data files.
+// If the dropped session was the active one, the default session becomes active.
+func (app *App) DropSession(ctx context.Context, sessionID string) error {
+	registry, _, err := app.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	registryPath, err := getSessionRegistryPath(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session registry path: %w", err)
+	}
+	if err := os.Remove(registryPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove session registry: %w", err)
+	}
+
+	dataDir, err := getSessionDataDir(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session data dir: %w", err)
+	}
+
+	if sessionID == defaultSessionID {
+		// Default session shares its directory with named sessions, so only its files are removed
+		// (the dump is a directory of document files in directory mode)
+		files := []string{phoSessionConf, phoOriginalsFile, phoUndoFile, phoSchemaFile}
+		// Sessions without a dump file would resolve to the data dir itself, so it's never removed
+		if dumpName := filepath.Base(registry.DumpFile); registry.DumpFile != "" && !isDirName(dumpName) {
+			files = append(files, dumpName)
+		}
+		for _, name := range files {
+			if err := os.RemoveAll(filepath.Join(dataDir, name)); err != nil {
+				return fmt.Errorf("failed to remove session file %s: %w", name, err)
+			}
+		}
+	} else if err := os.RemoveAll(dataDir); err != nil {
+		return fmt.Errorf("failed to remove session data dir: %w", err)
+	}
+
+	if readActiveSession() == sessionID {
+		return writeActiveSession(defaultSessionID)
+	}
+
+	return nil
+}
+
+// isDirName reports whether the base name refers to a directory itself rather than a file in it.
+func isDirName(name string) bool {
+	return name == "." || name == ".." || name == string(filepath.Separator)
+}
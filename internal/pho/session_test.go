@@ -2,9 +2,12 @@ package pho_test
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"pho/internal/pho"
+	"pho/internal/render"
+	"strconv"
 	"testing"
 	"time"
 
@@ -218,3 +221,173 @@ func TestApp_ValidateSession(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "session dump file missing")
 }
+
+func TestValidateSessionName(t *testing.T) {
+	tests := []struct {
+		name    string
+		session string
+		wantErr bool
+	}{
+		{name: "simple name", session: "orders"},
+		{name: "with dots, dashes and underscores", session: "fix-2025.01_users"},
+		{name: "empty", session: "", wantErr: true},
+		{name: "path traversal", session: "../etc", wantErr: true},
+		{name: "with slash", session: "a/b", wantErr: true},
+		{name: "starts with dot", session: ".hidden", wantErr: true},
+		{name: "with spaces", session: "my session", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pho.ValidateSessionName(tt.session)
+			if tt.wantErr {
+				require.ErrorIs(t, err, pho.ErrInvalidSessionName)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSessionStatus_String(t *testing.T) {
+	assert.Equal(t, "active", pho.SessionStatusActive.String())
+	assert.Equal(t, "lost", pho.SessionStatusLost.String())
+	assert.Equal(t, "not found", pho.SessionStatusNotFound.String())
+}
+
+func TestApp_NamedSessions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Setenv("PHO_DATA_DIR", tempDir+"/data")
+	t.Setenv("PHO_CONFIG_DIR", tempDir+"/config")
+
+	ctx := context.Background()
+	saveSession := func(app *pho.App, collection string) {
+		t.Helper()
+		require.NoError(t, app.SaveSession(ctx, pho.QueryParameters{Database: "testdb", Collection: collection}))
+
+		dataDir, err := (&pho.AppReflect{App: app}).GetDataDir()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, "_dump.jsonl"), []byte("{}\n"), 0600))
+	}
+
+	defaultApp := pho.NewApp()
+	assert.Equal(t, "current", defaultApp.SessionID())
+	saveSession(defaultApp, "users")
+
+	ordersApp := pho.NewApp(pho.WithSession("orders"))
+	saveSession(ordersApp, "orders")
+
+	// Named session keeps its files in its own directory
+	ordersDir, err := (&pho.AppReflect{App: ordersApp}).GetDataDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "data", "sessions", "orders"), ordersDir)
+
+	// Explicitly named session becomes the active one
+	assert.Equal(t, "orders", pho.NewApp().SessionID())
+
+	session, err := pho.NewApp().LoadSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", session.QueryParams.Collection)
+
+	t.Run("get session", func(t *testing.T) {
+		registry, status, err := defaultApp.GetSession(ctx, "orders")
+		require.NoError(t, err)
+		assert.Equal(t, pho.SessionStatusActive, status)
+		assert.Equal(t, "orders", registry.QueryParams.Collection)
+
+		_, status, err = defaultApp.GetSession(ctx, "missing")
+		require.ErrorIs(t, err, pho.ErrNoSession)
+		assert.Equal(t, pho.SessionStatusNotFound, status)
+
+		_, _, err = defaultApp.GetSession(ctx, "../orders")
+		require.ErrorIs(t, err, pho.ErrInvalidSessionName)
+	})
+
+	t.Run("switch session", func(t *testing.T) {
+		require.NoError(t, defaultApp.SwitchSession(ctx, "current"))
+		assert.Equal(t, "current", pho.NewApp().SessionID())
+
+		require.ErrorIs(t, defaultApp.SwitchSession(ctx, "missing"), pho.ErrNoSession)
+		assert.Equal(t, "current", pho.NewApp().SessionID())
+
+		require.NoError(t, defaultApp.SwitchSession(ctx, "orders"))
+		assert.Equal(t, "orders", pho.NewApp().SessionID())
+	})
+
+	t.Run("drop session", func(t *testing.T) {
+		require.NoError(t, defaultApp.DropSession(ctx, "orders"))
+		assert.NoDirExists(t, ordersDir)
+
+		// Dropped active session makes the default one active again
+		assert.Equal(t, "current", pho.NewApp().SessionID())
+
+		sessions, err := defaultApp.ListSessions(ctx)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "current", sessions[0].ID)
+	})
+}
+
+func TestApp_DropSession_DirectoryDump(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Setenv("PHO_DATA_DIR", tempDir+"/data")
+	t.Setenv("PHO_CONFIG_DIR", tempDir+"/config")
+
+	ctx := context.Background()
+
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer()), pho.WithDirectoryDump(true))
+	require.NoError(t, app.SaveSession(ctx, pho.QueryParameters{Database: "testdb", Collection: "users"}))
+
+	dumpDir, err := app.SetupDumpDirectory()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dumpDir, "doc1.json"), []byte(`{"_id": "doc1"}`), 0600))
+
+	require.NoError(t, app.DropSession(ctx, "current"))
+	assert.NoDirExists(t, dumpDir)
+
+	_, _, err = app.GetSession(ctx, "current")
+	require.ErrorIs(t, err, pho.ErrNoSession)
+}
+
+func TestApp_DropSession_NoDumpFile(t *testing.T) {
+	for _, dumpFile := range []string{"", ".", "..", "/"} {
+		t.Run("dump file "+strconv.Quote(dumpFile), func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			t.Setenv("PHO_DATA_DIR", tempDir+"/data")
+			t.Setenv("PHO_CONFIG_DIR", tempDir+"/config")
+
+			ctx := context.Background()
+
+			app := pho.NewApp()
+			require.NoError(t, app.SaveSession(ctx, pho.QueryParameters{Database: "testdb", Collection: "users"}))
+
+			// Files of named sessions share the data dir of the default one
+			dataDir, err := (&pho.AppReflect{App: app}).GetDataDir()
+			require.NoError(t, err)
+			keptPath := filepath.Join(dataDir, "sessions", "orders", "_dump.jsonl")
+			require.NoError(t, os.MkdirAll(filepath.Dir(keptPath), 0750))
+			require.NoError(t, os.WriteFile(keptPath, []byte("{}\n"), 0600))
+
+			registryPath, err := pho.GetSessionRegistryPath("current")
+			require.NoError(t, err)
+			data, err := os.ReadFile(registryPath)
+			require.NoError(t, err)
+			var registry map[string]any
+			require.NoError(t, json.Unmarshal(data, &registry))
+			registry["dump_file"] = dumpFile
+			data, err = json.Marshal(registry)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(registryPath, data, 0600))
+
+			require.NoError(t, app.DropSession(ctx, "current"))
+			assert.DirExists(t, dataDir)
+			assert.FileExists(t, keptPath)
+
+			_, _, err = app.GetSession(ctx, "current")
+			require.ErrorIs(t, err, pho.ErrNoSession)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"pho/internal/diff"
+	"time"
+)
+
+// StatusReport summarises the state of a session.
+type StatusReport struct {
+	Session       string          `json:"session"`
+	Status        SessionStatus   `json:"status"`
+	Created       time.Time       `json:"created"`
+	AgeSeconds    int64           `json:"age_seconds"`
+	QueryParams   QueryParameters `json:"query_params"`
+	DumpPath      string          `json:"dump_path"`
+	DocumentCount int             `json:"document_count"`
+
+	// Changes are counted for active sessions only
+	Changes *ChangeCounts `json:"changes,omitempty"`
+
+	// ChangesError explains why changes could not be counted (e.g. unresolved conflicts in the dump)
+	ChangesError string `json:"changes_error,omitempty"`
+}
+
+// Age returns how long ago the session was created.
+func (r *StatusReport) Age() time.Duration {
+	return time.Duration(r.AgeSeconds) * time.Second
+}
+
+// ChangeCounts holds the number of documents per change action.
+type ChangeCounts struct {
+	Updated int `json:"updated"`
+	Added   int `json:"added"`
+	Deleted int `json:"deleted"`
+	Renamed int `json:"renamed"`
+	Noop    int `json:"noop"`
+}
+
+// String returns a human-readable representation of the counts.
+func (c *ChangeCounts) String() string {
+	return fmt.Sprintf("%d updated, %d added, %d deleted, %d renamed, %d noop",
+		c.Updated, c.Added, c.Deleted, c.Renamed, c.Noop)
+}
+
+// countChanges counts the given changes per action.
+func countChanges(changes diff.Changes) *ChangeCounts {
+	counts := &ChangeCounts{}
+	for _, ch := range changes {
+		switch ch.Action {
+		case diff.ActionUpdated:
+			counts.Updated++
+		case diff.ActionAdded:
+			counts.Added++
+		case diff.ActionDeleted:
+			counts.Deleted++
+		case diff.ActionRenamed:
+			counts.Renamed++
+		case diff.ActionNoop:
+			counts.Noop++
+		}
+	}
+
+	return counts
+}
+
+// Status reports the state of the session: its query, dump and the number of pending changes.
+func (app *App) Status(ctx context.Context) (*StatusReport, error) {
+	sessionID := app.getSessionID()
+
+	registry, err := loadSessionRegistry(sessionID)
+	if err != nil {
+		if errors.Is(err, ErrNoSession) {
+			return nil, fmt.Errorf("session %q: %w", sessionID, ErrNoSession)
+		}
+		return nil, fmt.Errorf("failed to load session registry: %w", err)
+	}
+
+	report := &StatusReport{
+		Session:       registry.ID,
+		Status:        checkSessionStatus(registry),
+		Created:       registry.Created,
+		AgeSeconds:    int64(time.Since(registry.Created).Seconds()),
+		QueryParams:   registry.QueryParams,
+		DumpPath:      filepath.Join(registry.DataPath, registry.DumpFile),
+		DocumentCount: registry.DocumentCount,
+	}
+
+	if report.Status != SessionStatusActive {
+		return report, nil
+	}
+
+	// Registry is written before the dump, so the actual number of dumped documents is taken from meta
+	if meta, err := app.readMeta(ctx); err == nil {
+		report.DocumentCount = len(meta.Lines)
+	}
+
+	changes, err := app.extractChanges(ctx)
+	if err != nil {
+		report.ChangesError = err.Error()
+		return report, nil
+	}
+	report.Changes = countChanges(changes)
+
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package pho_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"pho/internal/hashing"
+	"pho/internal/pho"
+	"pho/internal/render"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApp_Status(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Setenv("PHO_DATA_DIR", tempDir+"/data")
+	t.Setenv("PHO_CONFIG_DIR", tempDir+"/config")
+
+	app := pho.NewApp(pho.WithRenderer(render.NewRenderer(render.WithAsValidJSON(false))))
+	ctx := context.Background()
+
+	t.Run("no session", func(t *testing.T) {
+		_, err := app.Status(ctx)
+		require.ErrorIs(t, err, pho.ErrNoSession)
+	})
+
+	queryParams := pho.QueryParameters{Database: "testdb", Collection: "users", Query: "{}", Limit: 100}
+	require.NoError(t, app.SaveSession(ctx, queryParams))
+
+	t.Run("lost session", func(t *testing.T) {
+		report, err := app.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, pho.SessionStatusLost, report.Status)
+		assert.Nil(t, report.Changes)
+	})
+
+	docs := []string{
+		`{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"updated"}`,
+		`{"_id":{"$oid":"507f1f77bcf86cd799439012"},"name":"untouched"}`,
+		`{"_id":{"$oid":"507f1f77bcf86cd799439013"},"name":"deleted"}`,
+	}
+	lines := make(map[string]*hashing.HashData, len(docs))
+	for _, doc := range docs {
+		var dumpDoc pho.DumpDoc
+		require.NoError(t, dumpDoc.UnmarshalJSON([]byte(doc)))
+		hashData, err := hashing.Hash(bson.D(dumpDoc))
+		require.NoError(t, err)
+		lines[hashData.GetIdentifier()] = hashData
+	}
+
+	sessionConfig := &pho.SessionConfig{
+		Created:    time.Now(),
+		Database:   "testdb",
+		Collection: "users",
+		DumpFile:   "_dump.jsonl",
+		Lines:      lines,
+	}
+	sessionConf, err := sessionConfig.ToSessionConf()
+	require.NoError(t, err)
+
+	dump := `{"_id":{"$oid":"507f1f77bcf86cd799439011"},"name":"renamed"}` + "\n" +
+		docs[1] + "\n" +
+		`{"_id":{"$oid":"507f1f77bcf86cd799439014"},"name":"added"}` + "\n"
+
+	dataDir := filepath.Join(tempDir, "data")
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, pho.GetPhoSessionConf()), sessionConf, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "_dump.jsonl"), []byte(dump), 0600))
+
+	t.Run("active session", func(t *testing.T) {
+		report, err := app.Status(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, "current", report.Session)
+		assert.Equal(t, pho.SessionStatusActive, report.Status)
+		assert.Equal(t, queryParams, report.QueryParams)
+		assert.Equal(t, filepath.Join(dataDir, "_dump.jsonl"), report.DumpPath)
+		assert.Equal(t, 3, report.DocumentCount)
+		assert.Empty(t, report.ChangesError)
+		assert.Equal(t, &pho.ChangeCounts{Updated: 1, Added: 1, Deleted: 1, Noop: 1}, report.Changes)
+		assert.Equal(t, "1 updated, 1 added, 1 deleted, 0 renamed, 1 noop", report.Changes.String())
+
+		data, err := json.Marshal(report)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"status":"active"`)
+		assert.Contains(t, string(data), `"changes":{"updated":1,"added":1,"deleted":1,"renamed":0,"noop":1}`)
+	})
+
+	t.Run("unresolved conflicts", func(t *testing.T) {
+		conflicted := "<<<<<<< yours\n" + dump + "=======\n>>>>>>> database\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, "_dump.jsonl"), []byte(conflicted), 0600))
+
+		report, err := app.Status(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, report.Changes)
+		assert.Contains(t, report.ChangesError, pho.ErrUnresolvedConflicts.Error())
+	})
+}
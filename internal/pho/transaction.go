@@ -0,0 +1,61 @@
+package pho
+
+import (
+	"context"
+	"fmt"
+	"pho/internal/diff"
+	"pho/internal/restore"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ChangeError describes a change that failed to be applied.
+type ChangeError struct {
+	// Index of the change in the list of applied changes
+	Index int
+
+	// Change that failed
+	Change *diff.Change
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *ChangeError) Error() string {
+	return fmt.Sprintf("change #%d (%s %s) failed: %v", e.Index+1, e.Change.Action, e.Change.Identifier(), e.Err)
+}
+
+func (e *ChangeError) Unwrap() error { return e.Err }
+
+// applyAtomically applies all the changes inside a single multi-document transaction.
+// The transaction is aborted on the first failed change, so either all changes are applied or none.
+// Note: transactions require MongoDB replica set or sharded cluster.
+func (app *App) applyAtomically(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	session, err := app.dbClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	mongoClientRestorer := restore.NewMongoClientRestorer(col)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		for i, ch := range changes {
+			mongoCmd, err := mongoClientRestorer.Build(ch)
+			if err != nil {
+				return nil, &ChangeError{Index: i, Change: ch, Err: err}
+			}
+
+			if err := mongoCmd(sessCtx); err != nil {
+				return nil, &ChangeError{Index: i, Change: ch, Err: err}
+			}
+		}
+
+		return nil, nil //nolint:nilnil // transaction callback has no result
+	})
+	if err != nil {
+		return fmt.Errorf("transaction aborted: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package pho_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestChangeError(t *testing.T) {
+	err := &pho.ChangeError{
+		Index:  2,
+		Change: diff.NewChange("_id", "doc3", diff.ActionDeleted),
+		Err:    mongo.ErrNoDocuments,
+	}
+
+	assert.Equal(t, "change #3 (DELETED _id::doc3) failed: mongo: no documents in result", err.Error())
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	var changeErr *pho.ChangeError
+	wrapped := errors.Join(errors.New("transaction aborted"), err)
+	assert.ErrorAs(t, wrapped, &changeErr)
+	assert.Equal(t, "doc3", changeErr.Change.IdentifierValue)
+}
+
+func TestApp_writeChanges_AtomicAbort(t *testing.T) {
+	t.Setenv("PHO_DATA_DIR", t.TempDir())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// No server is needed: the transaction is aborted before anything is sent to it
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	ar := pho.AppReflect{App: pho.NewApp(
+		pho.WithURI("mongodb://127.0.0.1:1"),
+		pho.WithDatabase("testdb"),
+		pho.WithCollection("users"),
+	)}
+	ar.SetDBClient(client)
+
+	// Undo data of the previous apply
+	previous := diff.Changes{diff.NewChange("_id", "prev", diff.ActionDeleted)}
+	require.NoError(t, ar.WriteUndo(previous))
+
+	// Inserts don't need live documents to capture their undo data, the first one fails as it has no doc
+	changes := diff.Changes{
+		diff.NewChange("_id", "doc1", diff.ActionAdded),
+		diff.NewChange("_id", "doc2", diff.ActionAdded, bson.D{{Key: "_id", Value: "doc2"}}),
+	}
+	applyErrors, err := ar.WriteChanges(ctx, client.Database("testdb").Collection("users"), changes,
+		pho.WithAtomic(true))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nothing applied, all changes were rolled back")
+	assert.Contains(t, err.Error(), "change #1 (ADDED _id::doc1) failed")
+	assert.Empty(t, applyErrors)
+
+	var changeErr *pho.ChangeError
+	require.ErrorAs(t, err, &changeErr)
+	assert.Equal(t, 0, changeErr.Index)
+
+	// Nothing was applied, so undo data of the previous apply is neither replaced nor removed
+	undo, err := ar.ReadUndo()
+	require.NoError(t, err)
+	require.Len(t, undo.Changes, 1)
+	assert.Equal(t, diff.ActionDeleted, undo.Changes[0].Action)
+	assert.Equal(t, "prev", undo.Changes[0].IdentifierValue)
+}
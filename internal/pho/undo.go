@@ -0,0 +1,429 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pho/internal/diff"
+	"pho/internal/hashing"
+	"pho/internal/restore"
+	"pho/pkg/extjson"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrNoUndo = errors.New("no undo data")
+
+// UndoData holds the inverse change set of the last applied changes.
+type UndoData struct {
+	URI        string
+	Database   string
+	Collection string
+	Created    time.Time
+
+	// Changes revert applied changes (in reverse order)
+	Changes diff.Changes
+
+	// Masked and MaskPattern are sensitive fields of the applied changes (see WithMaskedFields, WithMaskPattern):
+	// values of documents are stored as they are, so they are masked on review
+	Masked      []string
+	MaskPattern string
+}
+
+// captureUndo fetches the pre-apply state of documents touched by the given changes
+// and builds their inverse changes: updated documents are restored,
+// deleted ones are re-inserted, added ones are deleted and renamed ones are renamed back.
+// Inverse changes are returned by indexes of the changes (nil if there is nothing to revert),
+// so only the ones of successfully applied changes are kept as undo data (see succeededUndo).
+func (app *App) captureUndo(ctx context.Context, col *mongo.Collection, changes diff.Changes) (diff.Changes, error) {
+	inverses := make(diff.Changes, len(changes))
+	for i, ch := range changes {
+		if ch.Action == diff.ActionAdded {
+			inverses[i] = diff.NewChange(ch.IdentifiedBy, ch.IdentifierValue, diff.ActionDeleted)
+			continue
+		}
+		filter := ch.Filter()
+		switch ch.Action {
+		case diff.ActionUpdated, diff.ActionDeleted:
+		case diff.ActionRenamed:
+			filter = ch.RenamedFromFilter()
+		default:
+			continue
+		}
+
+		// Full document is fetched (regardless of session projection), so it can be fully restored
+		var live bson.D
+		err := col.FindOne(ctx, filter).Decode(&live)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Nothing to restore: the change itself will fail to be applied
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch document %s:%v: %w", ch.IdentifiedBy, ch.IdentifierValue, err)
+		}
+		inverses[i] = app.invertChange(ch, live)
+	}
+
+	return inverses, nil
+}
+
+// succeededUndo returns inverse changes (see captureUndo) of the changes that didn't fail, in reverse order.
+// Failed changes are not reverted: e.g. the document a failed insert collided with must not be deleted.
+func succeededUndo(inverses diff.Changes, failed []*ChangeError) diff.Changes {
+	failedIndexes := make(map[int]struct{}, len(failed))
+	for _, changeErr := range failed {
+		failedIndexes[changeErr.Index] = struct{}{}
+	}
+
+	var undo diff.Changes
+	for i, inverse := range inverses {
+		if _, ok := failedIndexes[i]; ok || inverse == nil {
+			continue
+		}
+		undo = append(undo, inverse)
+	}
+	slices.Reverse(undo)
+
+	return undo
+}
+
+// invertChange builds the change reverting the given update, delete or rename from the pre-apply state
+// of its document. Sensitive values are stored as they are (the undo file is readable by its owner only):
+// the applied change may have edited them, so placeholders would restore the edited values.
+func (app *App) invertChange(ch *diff.Change, before bson.D) *diff.Change {
+	switch ch.Action {
+	case diff.ActionDeleted:
+		return diff.NewChange(ch.IdentifiedBy, ch.IdentifierValue, diff.ActionAdded, before)
+	case diff.ActionRenamed:
+		inverse := diff.NewChange(ch.IdentifiedBy, ch.RenamedFrom, diff.ActionRenamed, before)
+		inverse.RenamedFrom = ch.IdentifierValue
+		return inverse
+	default:
+		return invertUpdate(ch, before)
+	}
+}
+
+// invertUpdate builds the change that restores all paths touched by the update to their pre-apply values.
+// Updates without field-level changes replace the whole document, so they are reverted by replacing it back.
+func invertUpdate(ch *diff.Change, before bson.D) *diff.Change {
+	inverse := diff.NewChange(ch.IdentifiedBy, ch.IdentifierValue, diff.ActionUpdated, before)
+
+	paths := ch.FieldChanges.Paths()
+	if len(paths) == 0 {
+		return inverse
+	}
+
+	var fieldChanges diff.FieldChanges
+	for _, path := range paths {
+		value, ok := diff.LookupPath(before, path)
+		if !ok {
+			fieldChanges = append(fieldChanges, &diff.FieldChange{Path: path, Action: diff.FieldRemoved})
+			continue
+		}
+
+		fieldChanges = append(fieldChanges, &diff.FieldChange{Path: path, Action: diff.FieldModified, After: value})
+	}
+
+	inverse.FieldChanges = fieldChanges
+
+	return inverse
+}
+
+// maskChange returns a copy of the change with sensitive values of its document and field changes masked.
+func (app *App) maskChange(ch *diff.Change) *diff.Change {
+	masked := *ch
+	if ch.Data != nil {
+		masked.Data = app.mask(ch.Data)
+	}
+	if ch.FieldChanges.Len() == 0 {
+		return &masked
+	}
+
+	masked.FieldChanges = make(diff.FieldChanges, 0, ch.FieldChanges.Len())
+	for _, fc := range ch.FieldChanges {
+		maskedFc := *fc
+		if value, ok := diff.LookupPath(masked.Data, fc.Path); ok && fc.Action != diff.FieldRemoved {
+			maskedFc.After = value
+		}
+		masked.FieldChanges = append(masked.FieldChanges, &maskedFc)
+	}
+
+	return &masked
+}
+
+// writeUndo stores the inverse change set next to the session files.
+// It's stored as canonical ExtJSON, so no type information is lost.
+func (app *App) writeUndo(changes diff.Changes) error {
+	if err := app.setupPhoDir(); err != nil {
+		return err
+	}
+
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return fmt.Errorf("could not get pho data dir: %w", err)
+	}
+
+	records := make(bson.A, 0, len(changes))
+	for _, ch := range changes {
+		records = append(records, toChangeRecord(ch))
+	}
+
+	doc := bson.M{
+		"uri":        app.uri,
+		"database":   app.dbName,
+		"collection": app.collectionName,
+		"created":    primitive.NewDateTimeFromTime(time.Now()),
+		"changes":    records,
+	}
+	if len(app.maskedFields) > 0 {
+		doc["masked"] = app.maskedFields
+	}
+	if app.maskPattern != nil {
+		doc["maskPattern"] = app.maskPattern.String()
+	}
+
+	data, err := extjson.NewCanonicalMarshaller().WithIndent(" ").Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo data: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, phoUndoFile), data, 0600); err != nil {
+		return fmt.Errorf("failed writing undo file: %w", err)
+	}
+
+	return nil
+}
+
+// readUndo reads the inverse change set of the last applied changes.
+func (app *App) readUndo() (*UndoData, error) {
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get pho data dir: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, phoUndoFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not open undo file: %w", ErrNoUndo)
+		}
+		return nil, fmt.Errorf("could not open undo file: %w", err)
+	}
+
+	// Decoded as bson.D, so stored documents keep the order of their fields
+	var raw bson.D
+	if err := bson.UnmarshalExtJSON(data, true, &raw); err != nil {
+		return nil, fmt.Errorf("could not decode undo file: %w", err)
+	}
+	doc := topLevelFields(raw)
+
+	undo := &UndoData{}
+	undo.URI, _ = doc["uri"].(string)
+	undo.Database, _ = doc["database"].(string)
+	undo.Collection, _ = doc["collection"].(string)
+	if created, ok := doc["created"].(primitive.DateTime); ok {
+		undo.Created = created.Time()
+	}
+	masked, _ := doc["masked"].(bson.A)
+	for _, field := range masked {
+		if field, ok := field.(string); ok {
+			undo.Masked = append(undo.Masked, field)
+		}
+	}
+	undo.MaskPattern, _ = doc["maskPattern"].(string)
+
+	records, _ := doc["changes"].(bson.A)
+	for i, record := range records {
+		recordDoc, ok := record.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("corrupted undo change [%d]", i)
+		}
+
+		ch, err := fromChangeRecord(topLevelFields(recordDoc))
+		if err != nil {
+			return nil, fmt.Errorf("corrupted undo change [%d]: %w", i, err)
+		}
+		undo.Changes = append(undo.Changes, ch)
+	}
+
+	return undo, nil
+}
+
+// removeUndo removes the undo file (if any).
+func (app *App) removeUndo() error {
+	dataDir, err := app.getDataDir()
+	if err != nil {
+		return fmt.Errorf("could not get pho data dir: %w", err)
+	}
+
+	if err := os.Remove(filepath.Join(dataDir, phoUndoFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove undo file: %w", err)
+	}
+
+	return nil
+}
+
+// toChangeRecord converts the change into a document to be stored in the undo file
+// (or exported in changes-json format).
+func toChangeRecord(ch *diff.Change) bson.M {
+	record := bson.M{
+		"action":          ch.Action.String(),
+		"identifiedBy":    ch.IdentifiedBy,
+		"identifierValue": ch.IdentifierValue,
+	}
+	if ch.Data != nil {
+		record["data"] = ch.Data
+	}
+	if ch.RenamedFrom != nil {
+		record["renamedFrom"] = ch.RenamedFrom
+	}
+	if ch.Original != nil {
+		record["original"] = ch.Original
+	}
+
+	if ch.FieldChanges.Len() > 0 {
+		fieldChanges := make(bson.A, 0, ch.FieldChanges.Len())
+		for _, fc := range ch.FieldChanges {
+			fieldChange := bson.M{"path": fc.Path, "action": fc.Action.String()}
+			if fc.Action != diff.FieldRemoved {
+				fieldChange["value"] = fc.After
+			}
+			fieldChanges = append(fieldChanges, fieldChange)
+		}
+		record["fieldChanges"] = fieldChanges
+	}
+
+	return record
+}
+
+// fromChangeRecord does the reverse operation of toChangeRecord.
+func fromChangeRecord(record bson.M) (*diff.Change, error) {
+	actionStr, _ := record["action"].(string)
+	action, err := diff.ParseAction(actionStr)
+	if err != nil {
+		return nil, err
+	}
+
+	identifiedBy, _ := record["identifiedBy"].(string)
+	identifierValue, ok := record["identifierValue"]
+	if identifiedBy == "" || !ok {
+		return nil, errors.New("identifier is missing")
+	}
+
+	ch := diff.NewChange(identifiedBy, identifierValue, action)
+	if data, ok := record["data"].(bson.D); ok {
+		ch.Data = data
+	}
+	if original, ok := record["original"].(bson.D); ok {
+		ch.Original = original
+	}
+	if ch.Action == diff.ActionRenamed {
+		if ch.RenamedFrom, ok = record["renamedFrom"]; !ok {
+			return nil, errors.New("previous identifier of the renamed document is missing")
+		}
+	}
+
+	fieldChanges, _ := record["fieldChanges"].(bson.A)
+	for _, fieldChange := range fieldChanges {
+		fieldChangeD, ok := fieldChange.(bson.D)
+		if !ok {
+			return nil, errors.New("corrupted field change")
+		}
+		fieldChangeDoc := topLevelFields(fieldChangeD)
+
+		fc := &diff.FieldChange{After: fieldChangeDoc["value"]}
+		fc.Path, _ = fieldChangeDoc["path"].(string)
+		fieldActionStr, _ := fieldChangeDoc["action"].(string)
+		if err := fc.Action.UnmarshalText([]byte(fieldActionStr)); err != nil {
+			return nil, err
+		}
+		ch.FieldChanges = append(ch.FieldChanges, fc)
+	}
+
+	return ch, nil
+}
+
+// topLevelFields returns top-level fields of the document by their names (nested documents are kept as is).
+func topLevelFields(doc bson.D) bson.M {
+	fields := make(bson.M, len(doc))
+	for _, e := range doc {
+		fields[e.Key] = e.Value
+	}
+	return fields
+}
+
+// ConnectDBForUndo connects to the database the last changes were applied to.
+func (app *App) ConnectDBForUndo(ctx context.Context) error {
+	undo, err := app.readUndo()
+	if err != nil {
+		return err
+	}
+
+	app.uri = undo.URI
+	app.dbName = undo.Database
+	app.collectionName = undo.Collection
+
+	return app.ConnectDB(ctx)
+}
+
+// Undo reverts the last applied changes by applying their inverse change set.
+// On success the undo data is removed, so it can't be replayed twice.
+func (app *App) Undo(ctx context.Context) error {
+	if app.dbClient == nil {
+		return errors.New("db not connected")
+	}
+
+	undo, err := app.readUndo()
+	if err != nil {
+		return err
+	}
+
+	col := app.dbClient.Database(undo.Database).Collection(undo.Collection)
+
+	_, _ = fmt.Fprintf(os.Stdout, "// Undo changes: %d\n", undo.Changes.Len())
+
+	if err := app.unmaskChanges(ctx, col, undo.Changes); err != nil {
+		return err
+	}
+
+	if applyErrors := app.applyOneByOne(ctx, col, undo.Changes); len(applyErrors) > 0 {
+		return fmt.Errorf("failed to undo %d change(s), undo data is kept", len(applyErrors))
+	}
+
+	return app.removeUndo()
+}
+
+// ReviewUndo outputs the inverse change set of the last applied changes in mongo-shell format.
+func (app *App) ReviewUndo(_ context.Context) error {
+	undo, err := app.readUndo()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "// Undo changes: %d (for changes applied to %s.%s at %s)\n",
+		undo.Changes.Len(), undo.Database, undo.Collection, undo.Created.Format(time.RFC3339))
+
+	// Documents are stored with their sensitive values, they are not shown though
+	app.maskedFields = undo.Masked
+	if app.maskPattern, err = ParseMaskPattern(undo.MaskPattern); err != nil {
+		return err
+	}
+
+	mongoShellRestorer := restore.NewMongoShellRestorer(undo.Collection)
+
+	for _, ch := range undo.Changes {
+		app.identifyBy = hashing.IdentityFields(ch.IdentifiedBy)
+		if mongoCmd, err := mongoShellRestorer.Build(app.maskChange(ch)); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "could not build mongo shell command: %v\n", err)
+		} else {
+			_, _ = fmt.Fprintf(os.Stdout, "%s\n", mongoCmd)
+		}
+	}
+
+	return nil
+}
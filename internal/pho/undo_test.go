@@ -0,0 +1,220 @@
+package pho_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInvertUpdate(t *testing.T) {
+	before := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "test"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+		{Key: "legacy", Value: true},
+	}
+
+	t.Run("field-level update", func(t *testing.T) {
+		ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "_id", Value: "doc1"}})
+		ch.FieldChanges = diff.FieldChanges{
+			{Path: "address.city", Action: diff.FieldModified, Before: "Kyiv", After: "Lviv"},
+			{Path: "email", Action: diff.FieldAdded, After: "a@b.c"},
+			{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+		}
+
+		inverse := pho.InvertUpdate(ch, before)
+
+		assert.Equal(t, diff.ActionUpdated, inverse.Action)
+		assert.Equal(t, before, inverse.Data)
+		assert.Equal(t, diff.FieldChanges{
+			{Path: "address.city", Action: diff.FieldModified, After: "Kyiv"},
+			{Path: "email", Action: diff.FieldRemoved},
+			{Path: "legacy", Action: diff.FieldModified, After: true},
+		}, inverse.FieldChanges)
+	})
+
+	t.Run("full document update", func(t *testing.T) {
+		ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "renamed"},
+			{Key: "email", Value: "a@b.c"},
+		})
+
+		inverse := pho.InvertUpdate(ch, before)
+
+		// The document was replaced, so it's replaced back (restoring fields the update removed as well)
+		assert.Equal(t, diff.ActionUpdated, inverse.Action)
+		assert.Equal(t, before, inverse.Data)
+		assert.Empty(t, inverse.FieldChanges)
+	})
+}
+
+func TestSucceededUndo(t *testing.T) {
+	added := diff.NewChange("_id", "dup", diff.ActionAdded, bson.D{{Key: "_id", Value: "dup"}})
+	deleted := diff.NewChange("_id", "gone", diff.ActionDeleted)
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "name", Value: "new"}})
+	changes := diff.Changes{added, deleted, updated}
+
+	inverses := diff.Changes{
+		diff.NewChange("_id", "dup", diff.ActionDeleted),
+		diff.NewChange("_id", "gone", diff.ActionAdded, bson.D{{Key: "_id", Value: "gone"}}),
+		nil, // document to update didn't exist
+	}
+
+	// Failed insert (e.g. duplicate _id) must not delete the document it collided with
+	undo := pho.SucceededUndo(inverses, []*pho.ChangeError{{Index: 0, Change: changes[0], Err: errors.New("E11000")}})
+	require.Len(t, undo, 1)
+	assert.Equal(t, inverses[1], undo[0])
+
+	// Inverse changes revert applied ones in reverse order
+	undo = pho.SucceededUndo(inverses, nil)
+	assert.Equal(t, diff.Changes{inverses[1], inverses[0]}, undo)
+
+	assert.Empty(t, pho.SucceededUndo(inverses, []*pho.ChangeError{{Index: 0}, {Index: 1}}))
+}
+
+func TestApp_writeUndo_readUndo(t *testing.T) {
+	t.Setenv("PHO_DATA_DIR", t.TempDir())
+
+	ar := pho.AppReflect{App: pho.NewApp(
+		pho.WithURI("mongodb://localhost:27017"),
+		pho.WithDatabase("testdb"),
+		pho.WithCollection("users"),
+	)}
+
+	_, err := ar.ReadUndo()
+	require.ErrorIs(t, err, pho.ErrNoUndo)
+
+	oid := primitive.NewObjectID()
+	updated := diff.NewChange("_id", oid, diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "count", Value: int64(5)},
+	})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "count", Action: diff.FieldModified, After: int64(5)},
+		{Path: "email", Action: diff.FieldRemoved},
+	}
+	renamed := diff.NewChange("_id", "new-id", diff.ActionRenamed, bson.D{
+		{Key: "_id", Value: "new-id"},
+		{Key: "name", Value: "renamed"},
+	})
+	renamed.RenamedFrom = oid
+	changes := diff.Changes{
+		diff.NewChange("_id", "507f1f77bcf86cd799439011", diff.ActionDeleted),
+		updated,
+		diff.NewChange("_id", oid, diff.ActionAdded, bson.D{
+			{Key: "_id", Value: oid},
+			{Key: "name", Value: "restored"},
+		}),
+		renamed,
+	}
+
+	require.NoError(t, ar.WriteUndo(changes))
+
+	undo, err := ar.ReadUndo()
+	require.NoError(t, err)
+
+	assert.Equal(t, "mongodb://localhost:27017", undo.URI)
+	assert.Equal(t, "testdb", undo.Database)
+	assert.Equal(t, "users", undo.Collection)
+	assert.False(t, undo.Created.IsZero())
+	require.Len(t, undo.Changes, 4)
+
+	assert.Equal(t, diff.ActionDeleted, undo.Changes[0].Action)
+	assert.Equal(t, "507f1f77bcf86cd799439011", undo.Changes[0].IdentifierValue)
+	assert.Nil(t, undo.Changes[0].Data)
+
+	assert.Equal(t, diff.ActionUpdated, undo.Changes[1].Action)
+	assert.Equal(t, oid, undo.Changes[1].IdentifierValue)
+	assert.Equal(t, int64(5), field(undo.Changes[1].Data, "count"))
+	assert.Equal(t, updated.FieldChanges, undo.Changes[1].FieldChanges)
+
+	assert.Equal(t, diff.ActionAdded, undo.Changes[2].Action)
+	assert.Equal(t, bson.D{{Key: "_id", Value: oid}, {Key: "name", Value: "restored"}}, undo.Changes[2].Data)
+
+	assert.Equal(t, diff.ActionRenamed, undo.Changes[3].Action)
+	assert.Equal(t, "new-id", undo.Changes[3].IdentifierValue)
+	assert.Equal(t, oid, undo.Changes[3].RenamedFrom)
+	assert.Equal(t, renamed.Data, undo.Changes[3].Data)
+}
+
+func TestApp_undoMasked(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("PHO_DATA_DIR", tempDir)
+
+	ar := pho.AppReflect{App: pho.NewApp(
+		pho.WithDatabase("testdb"),
+		pho.WithCollection("users"),
+		pho.WithMaskedFields([]string{"password"}),
+		pho.WithMaskPattern(regexp.MustCompile(`(?i)token`)),
+	)}
+
+	before := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "alice"},
+		{Key: "password", Value: "pbkdf2-hash"},
+		{Key: "apiToken", Value: "gho-secret"},
+	}
+
+	// Updates of masked fields are reverted to their real values, placeholders would keep the edited ones
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "password", Value: "new-hash"}})
+	updated.FieldChanges = diff.FieldChanges{{Path: "password", Action: diff.FieldModified, After: "new-hash"}}
+	inverse := ar.InvertChange(updated, before)
+	assert.Equal(t, before, inverse.Data)
+	assert.Equal(t, diff.FieldChanges{{Path: "password", Action: diff.FieldModified, After: "pbkdf2-hash"}},
+		inverse.FieldChanges)
+
+	// They are masked on review though
+	masked := ar.MaskChange(inverse)
+	assert.Equal(t, diff.MaskPlaceholder, field(masked.Data, "password"))
+	assert.Equal(t, diff.MaskPlaceholder, field(masked.Data, "apiToken"))
+	assert.Equal(t, diff.MaskPlaceholder, masked.FieldChanges[0].After)
+	assert.Equal(t, "pbkdf2-hash", inverse.FieldChanges[0].After)
+
+	renamed := diff.NewChange("_id", "doc2", diff.ActionRenamed, bson.D{{Key: "_id", Value: "doc2"}})
+	renamed.RenamedFrom = "doc1"
+	assert.Equal(t, before, ar.InvertChange(renamed, before).Data)
+
+	// Deleted document is re-inserted with its masked values
+	deleted := diff.NewChange("_id", "doc1", diff.ActionDeleted)
+	require.NoError(t, ar.WriteUndo(diff.Changes{ar.InvertChange(deleted, before)}))
+
+	info, err := os.Stat(filepath.Join(tempDir, pho.GetPhoUndoFile()))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	undo, err := ar.ReadUndo()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password"}, undo.Masked)
+	assert.Equal(t, "(?i)token", undo.MaskPattern)
+	require.Len(t, undo.Changes, 1)
+
+	// Nothing is left to be filled from the database
+	require.NoError(t, ar.UnmaskChanges(context.Background(), nil, undo.Changes))
+	assert.Equal(t, diff.ActionAdded, undo.Changes[0].Action)
+	assert.Equal(t, before, undo.Changes[0].Data)
+}
+
+func TestApp_ReviewUndo_noUndo(t *testing.T) {
+	t.Setenv("PHO_DATA_DIR", t.TempDir())
+
+	err := pho.NewApp().ReviewUndo(context.Background())
+	require.ErrorIs(t, err, pho.ErrNoUndo)
+}
+
+func TestApp_Undo_notConnected(t *testing.T) {
+	err := pho.NewApp().Undo(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "db not connected")
+}
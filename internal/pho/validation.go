@@ -0,0 +1,276 @@
+package pho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"pho/internal/diff"
+	"pho/pkg/bsonschema"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrSchemaViolations is returned when edited documents violate the collection's validator.
+var ErrSchemaViolations = errors.New("documents violate the collection validator")
+
+// validationActionWarn is the validation action of collections that accept invalid documents (only logging them).
+const validationActionWarn = "warn"
+
+// validationLevelModerate is the validation level of collections that don't validate updates
+// of documents that are already invalid.
+const validationLevelModerate = "moderate"
+
+// SchemaViolation describes a field of an edited document violating the collection's $jsonSchema validator.
+type SchemaViolation struct {
+	// Change that makes the document invalid
+	Change *diff.Change
+
+	*bsonschema.Violation
+}
+
+// String returns a human-readable description of the violation, e.g. `_id::1 price: must be >= 0`.
+func (v *SchemaViolation) String() string {
+	return v.Change.Identifier() + " " + v.Violation.String()
+}
+
+// collectionValidator is the validator the collection was created with (see db.createCollection).
+type collectionValidator struct {
+	schema *bsonschema.Schema
+
+	// action is `error` (invalid documents are rejected) or `warn` (they are accepted, but logged)
+	action string
+
+	// level is `strict` (all inserts and updates are validated) or `moderate` (see checksUpdateOf)
+	level string
+}
+
+// checksUpdateOf reports if updates of the document (its live version) are validated:
+// with the moderate level, updates of documents that are already invalid are not.
+func (v *collectionValidator) checksUpdateOf(live bson.D) bool {
+	return v.level != validationLevelModerate || len(v.schema.Validate(live)) == 0
+}
+
+// fetchValidator fetches the $jsonSchema validator of the collection via listCollections.
+// It's nil if the collection has no validator or validation is off.
+// Note: only $jsonSchema is checked locally, other query operators of the validator are not.
+func fetchValidator(ctx context.Context, col *mongo.Collection) (*collectionValidator, error) {
+	cursor, err := col.Database().ListCollections(ctx, bson.D{{Key: "name", Value: col.Name()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return nil, cursor.Err()
+	}
+
+	var info bson.D
+	if err := cursor.Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode collection info: %w", err)
+	}
+
+	collectionOptions, _ := topLevelFields(info)["options"].(bson.D)
+	return parseValidator(collectionOptions), nil
+}
+
+// parseValidator returns the validator of the given collection options (nil if there is no $jsonSchema).
+func parseValidator(collectionOptions bson.D) *collectionValidator {
+	opts := topLevelFields(collectionOptions)
+	level, _ := opts["validationLevel"].(string)
+	if level == "off" {
+		return nil
+	}
+
+	validator, _ := opts["validator"].(bson.D)
+	schema, ok := topLevelFields(validator)["$jsonSchema"].(bson.D)
+	if !ok {
+		return nil
+	}
+
+	action, _ := opts["validationAction"].(string)
+	return &collectionValidator{schema: bsonschema.New(schema), action: action, level: level}
+}
+
+// findSchemaViolations validates documents the way they would be after the changes are applied.
+// Updated documents are re-fetched, so fields that are not in the dump (e.g. projected out) are validated as well.
+func findSchemaViolations(
+	ctx context.Context,
+	col *mongo.Collection,
+	changes diff.Changes,
+	validator *collectionValidator,
+) ([]*SchemaViolation, error) {
+	var violations []*SchemaViolation
+	for _, ch := range changes {
+		doc, err := resultingDocument(ctx, col, ch, validator)
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+
+		for _, violation := range validator.schema.Validate(doc) {
+			violations = append(violations, &SchemaViolation{Change: ch, Violation: violation})
+		}
+	}
+
+	return violations, nil
+}
+
+// resultingDocument returns the document the way it would be after the change is applied
+// (nil for deletes, for updates of documents that don't exist anymore and for inserts of masked values).
+// It's nil for updates the validator doesn't check as well (see checksUpdateOf).
+// Placeholders of masked values are filled from the live document, as they keep the values they stand for.
+func resultingDocument(
+	ctx context.Context,
+	col *mongo.Collection,
+	ch *diff.Change,
+	validator *collectionValidator,
+) (bson.D, error) {
+	filter := ch.Filter()
+	switch ch.Action {
+	case diff.ActionAdded:
+		// Masked values of inserted documents can't be kept, so such changes are never applied
+		if diff.HasMaskPlaceholder(ch.Data) {
+			return nil, nil
+		}
+		return ch.Data, nil
+	case diff.ActionRenamed:
+		if !diff.HasMaskPlaceholder(ch.Data) {
+			return ch.Data, nil
+		}
+		filter = ch.RenamedFromFilter()
+	case diff.ActionUpdated:
+	default:
+		return nil, nil
+	}
+
+	var live bson.D
+	err := col.FindOne(ctx, filter).Decode(&live)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch live document %s: %w", ch.Identifier(), err)
+	}
+
+	if ch.Action == diff.ActionRenamed {
+		return fillMaskedValues(ch.Data, live), nil
+	}
+	if !validator.checksUpdateOf(live) {
+		return nil, nil
+	}
+
+	return fillMaskedValues(updatedDocument(live, ch), live), nil
+}
+
+// fillMaskedValues replaces placeholders of masked values in the document with the values of the live one.
+// It returns nil if some of them have no live values (such changes are never applied).
+func fillMaskedValues(doc, live bson.D) bson.D {
+	if !diff.HasMaskPlaceholder(doc) {
+		return doc
+	}
+
+	filled, err := unmaskValue("", doc, live, true)
+	if err != nil {
+		return nil
+	}
+	result, _ := filled.(bson.D)
+
+	return result
+}
+
+// updatedDocument applies the updated change to the live version of its document.
+func updatedDocument(live bson.D, ch *diff.Change) bson.D {
+	if ch.FieldChanges.Len() > 0 {
+		return diff.ApplyFieldChanges(live, ch.FieldChanges)
+	}
+
+	// Without known field changes, the whole document is replaced (see keepHiddenFields for projected dumps)
+	return ch.Data
+}
+
+// validateChanges checks the changes against the collection's validator before anything is written.
+// All violations are reported, and ErrSchemaViolations is returned unless the collection only warns about them.
+func (app *App) validateChanges(ctx context.Context, col *mongo.Collection, changes diff.Changes) error {
+	validator, err := fetchValidator(ctx, col)
+	if err != nil {
+		return fmt.Errorf("failed to fetch collection validator: %w", err)
+	}
+	if validator == nil {
+		return nil
+	}
+	writeUncheckedPatterns(os.Stderr, validator.schema.UncheckedPatterns())
+
+	violations, err := findSchemaViolations(ctx, col, changes, validator)
+	if err != nil {
+		return fmt.Errorf("failed to validate documents: %w", err)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	writeViolations(os.Stderr, violations)
+	if validator.action == validationActionWarn {
+		_, _ = fmt.Fprintln(os.Stderr, "// Collection only warns about invalid documents (validationAction: warn)")
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d violation(s), nothing applied", ErrSchemaViolations, len(violations))
+}
+
+// reviewViolations writes violations of the collection's validator as warnings (nothing if there are none).
+func (app *App) reviewViolations(ctx context.Context, out io.Writer, changes diff.Changes) {
+	if app.dbClient == nil {
+		return
+	}
+	col := app.dbClient.Database(app.dbName).Collection(app.collectionName)
+
+	validator, err := fetchValidator(ctx, col)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not fetch collection validator: %v\n", err)
+		return
+	}
+	if validator == nil {
+		return
+	}
+
+	violations, err := findSchemaViolations(ctx, col, changes, validator)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not validate documents: %v\n", err)
+		return
+	}
+
+	writeViolations(out, violations)
+	writeUncheckedPatterns(out, validator.schema.UncheckedPatterns())
+}
+
+// writeViolations writes violations as comments.
+func writeViolations(out io.Writer, violations []*SchemaViolation) {
+	if len(violations) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(out, "// WARNING: %d violation(s) of the collection validator ($jsonSchema):\n", len(violations))
+	for _, violation := range violations {
+		_, _ = fmt.Fprintf(out, "//   %s\n", violation)
+	}
+}
+
+// writeUncheckedPatterns writes patterns of the validator that are not checked locally as comments
+// (nothing if there are none): the server may still reject documents violating them.
+func writeUncheckedPatterns(out io.Writer, patterns []string) {
+	if len(patterns) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(out,
+		"// NOTE: %d pattern(s) of the collection validator are not checked (unsupported by Go regexp):\n",
+		len(patterns))
+	for _, pattern := range patterns {
+		_, _ = fmt.Fprintf(out, "//   %s\n", pattern)
+	}
+}
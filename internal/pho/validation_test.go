@@ -0,0 +1,197 @@
+package pho_test
+
+import (
+	"bytes"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/pho"
+	"pho/pkg/bsonschema"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseValidator(t *testing.T) {
+	schema := bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"name"}},
+	}
+
+	tests := []struct {
+		name               string
+		options            bson.D
+		expectedOK         bool
+		expectedAction     string
+		expectedViolations []string
+	}{
+		{
+			name:       "no validator",
+			options:    bson.D{},
+			expectedOK: false,
+		},
+		{
+			name: "query expression validator",
+			options: bson.D{{Key: "validator", Value: bson.D{
+				{Key: "name", Value: bson.D{{Key: "$type", Value: "string"}}},
+			}}},
+			expectedOK: false,
+		},
+		{
+			name: "validation is off",
+			options: bson.D{
+				{Key: "validator", Value: bson.D{{Key: "$jsonSchema", Value: schema}}},
+				{Key: "validationLevel", Value: "off"},
+			},
+			expectedOK: false,
+		},
+		{
+			name: "json schema validator",
+			options: bson.D{
+				{Key: "validator", Value: bson.D{{Key: "$jsonSchema", Value: schema}}},
+				{Key: "validationLevel", Value: "strict"},
+				{Key: "validationAction", Value: "warn"},
+			},
+			expectedOK:         true,
+			expectedAction:     "warn",
+			expectedViolations: []string{"name: is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, violations, ok := pho.ParseValidator(tt.options, bson.D{{Key: "_id", Value: "doc1"}})
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedAction, action)
+			assert.Equal(t, tt.expectedViolations, violations)
+		})
+	}
+}
+
+func TestValidatorChecksUpdateOf(t *testing.T) {
+	validator := bson.D{{Key: "$jsonSchema", Value: bson.D{{Key: "required", Value: bson.A{"name"}}}}}
+	valid := bson.D{{Key: "_id", Value: "doc1"}, {Key: "name", Value: "Pho"}}
+	invalid := bson.D{{Key: "_id", Value: "doc2"}}
+
+	tests := []struct {
+		name            string
+		level           string
+		expectedValid   bool
+		expectedInvalid bool
+	}{
+		{name: "default level", level: "", expectedValid: true, expectedInvalid: true},
+		{name: "strict", level: "strict", expectedValid: true, expectedInvalid: true},
+		{name: "moderate", level: "moderate", expectedValid: true, expectedInvalid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := bson.D{{Key: "validator", Value: validator}}
+			if tt.level != "" {
+				options = append(options, bson.E{Key: "validationLevel", Value: tt.level})
+			}
+
+			assert.Equal(t, tt.expectedValid, pho.ValidatorChecksUpdateOf(options, valid))
+			assert.Equal(t, tt.expectedInvalid, pho.ValidatorChecksUpdateOf(options, invalid))
+		})
+	}
+}
+
+func TestUpdatedDocument(t *testing.T) {
+	live := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "old"},
+		{Key: "hidden", Value: "projected out"},
+	}
+
+	t.Run("field changes", func(t *testing.T) {
+		ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "name", Value: "new"}})
+		ch.FieldChanges = diff.FieldChanges{
+			{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+			{Path: "price", Action: diff.FieldAdded, After: int32(5)},
+		}
+
+		assert.Equal(t, bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "new"},
+			{Key: "hidden", Value: "projected out"},
+			{Key: "price", Value: int32(5)},
+		}, pho.UpdatedDocument(live, ch))
+	})
+
+	t.Run("whole document", func(t *testing.T) {
+		ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "new"},
+		})
+
+		// The document is replaced, fields hidden by the projection are added to it beforehand
+		assert.Equal(t, bson.D{
+			{Key: "_id", Value: "doc1"},
+			{Key: "name", Value: "new"},
+		}, pho.UpdatedDocument(live, ch))
+	})
+}
+
+func TestFillMaskedValues(t *testing.T) {
+	live := bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "password", Value: "pbkdf2-hash"},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "secret", Value: "s3cr3t"}}}},
+	}
+	schema := bsonschema.New(bson.D{{Key: "properties", Value: bson.D{
+		{Key: "password", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "pattern", Value: "^pbkdf2-"}}},
+	}}})
+
+	// Full update of the document with placeholders, e.g. after its array of masked items was edited
+	ch := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "password", Value: diff.MaskPlaceholder},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "secret", Value: diff.MaskPlaceholder}}, "new"}},
+	})
+	updated := pho.UpdatedDocument(live, ch)
+	assert.NotEmpty(t, schema.Validate(updated))
+
+	filled := pho.FillMaskedValues(updated, live)
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "password", Value: "pbkdf2-hash"},
+		{Key: "keys", Value: bson.A{bson.D{{Key: "secret", Value: "s3cr3t"}}, "new"}},
+	}, filled)
+	assert.Empty(t, schema.Validate(filled))
+
+	// Placeholders without live values can't be filled
+	assert.Nil(t, pho.FillMaskedValues(bson.D{{Key: "token", Value: diff.MaskPlaceholder}}, live))
+}
+
+func TestWriteViolations(t *testing.T) {
+	var out bytes.Buffer
+	pho.WriteViolations(&out, nil)
+	assert.Empty(t, out.String())
+
+	pho.WriteViolations(&out, []*pho.SchemaViolation{
+		{
+			Change:    diff.NewChange("_id", "doc1", diff.ActionUpdated),
+			Violation: &bsonschema.Violation{Path: "price", Message: "must be >= 0"},
+		},
+		{
+			Change:    diff.NewChange("_id", "doc2", diff.ActionAdded),
+			Violation: &bsonschema.Violation{Message: "must be of bsonType object, got string"},
+		},
+	})
+	assert.Equal(t, `// WARNING: 2 violation(s) of the collection validator ($jsonSchema):
+//   _id::doc1 price: must be >= 0
+//   _id::doc2 must be of bsonType object, got string
+`, out.String())
+}
+
+func TestWriteUncheckedPatterns(t *testing.T) {
+	var out bytes.Buffer
+	pho.WriteUncheckedPatterns(&out, nil)
+	assert.Empty(t, out.String())
+
+	pho.WriteUncheckedPatterns(&out, []string{"properties.name.pattern: ^(?!admin)"})
+	assert.Equal(t, `// NOTE: 1 pattern(s) of the collection validator are not checked (unsupported by Go regexp):
+//   properties.name.pattern: ^(?!admin)
+`, out.String())
+}
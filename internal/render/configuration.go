@@ -19,7 +19,29 @@ var ExtJSONModes = struct {
 	Shell:     "shell",
 }
 
+// Format represents the syntax documents are rendered in.
+type Format string
+
+// Formats is a dictionary mapping format names to their corresponding values.
+var Formats = struct {
+	JSON Format
+	YAML Format
+	CSV  Format
+	TSV  Format
+}{
+	JSON: "json",
+	YAML: "yaml",
+	CSV:  "csv",
+	TSV:  "tsv",
+}
+
 type Configuration struct {
+	// Format used for current rendering: JSON (default), YAML, CSV or TSV
+	// In YAML format documents are separated via `---` and BSON types are kept via tags (e.g. `!oid`)
+	// In CSV/TSV (tabular) formats documents are rows of a single table with typed columns (e.g. `price:double`)
+	// Note: JSON specific options (ExtJSONMode, AsValidJSON, etc.) are ignored for YAML and tabular formats
+	Format Format
+
 	// ShowLineNumbers turns on lines number via `/* 1 */` comments
 	// Note: this make JSON document not valid
 	ShowLineNumbers bool
@@ -66,6 +88,9 @@ func (c *Configuration) Clone() *Configuration {
 	return &clone
 }
 
+// WithFormat sets the Format option.
+func WithFormat(v Format) Option { return func(c *Configuration) { c.Format = v } }
+
 // WithShowLineNumbers sets the ShowLineNumbers option.
 func WithShowLineNumbers(v bool) Option { return func(c *Configuration) { c.ShowLineNumbers = v } }
 
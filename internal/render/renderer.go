@@ -2,9 +2,13 @@ package render
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"pho/pkg/bsoncsv"
+	"pho/pkg/bsonyaml"
 	"pho/pkg/extjson"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -28,19 +32,98 @@ func (r *Renderer) GetConfiguration() *Configuration {
 	return r.config
 }
 
+// IsYAML tells if documents are rendered in YAML format.
+func (r *Renderer) IsYAML() bool {
+	return r.config.Format == Formats.YAML
+}
+
+// IsTabular tells if documents are rendered as a table (CSV or TSV).
+// Tables are rendered as a whole via FormatTable, as columns depend on all the documents.
+func (r *Renderer) IsTabular() bool {
+	return r.config.Format == Formats.CSV || r.config.Format == Formats.TSV
+}
+
+// FormatComment renders a comment line in syntax of the current format.
+func (r *Renderer) FormatComment(comment string) []byte {
+	if r.IsYAML() {
+		return []byte(fmt.Sprintf("# %s\n", comment))
+	}
+
+	return []byte(fmt.Sprintf("/* %s */\n", comment))
+}
+
 func (r *Renderer) FormatLineNumber(lineNumber int) []byte {
-	// ignore if no line number needed or Valid JSON is required
+	// Tables have no comments, rows are numbered by the editor anyway
+	if !r.config.ShowLineNumbers || r.IsTabular() {
+		return nil
+	}
+	// ignore if Valid JSON is required
 	// MinimizedJSON implies valid json as well
-	if !r.config.ShowLineNumbers || r.config.AsValidJSON || r.config.MinimizedJSON {
+	if !r.IsYAML() && (r.config.AsValidJSON || r.config.MinimizedJSON) {
+		return nil
+	}
+
+	return r.FormatComment(fmt.Sprint(lineNumber))
+}
+
+// FormatProtectedFields renders a comment marking protected fields (dotted paths) present in the document,
+// so they are not edited by mistake. Nothing is rendered where comments are not allowed.
+func (r *Renderer) FormatProtectedFields(doc bson.D, paths []string) []byte {
+	return r.formatFieldsComment(doc, paths, "protected, must not be edited")
+}
+
+// FormatReadOnlyFields renders a comment marking read-only context fields (dotted paths) present in the document,
+// as their edits are not applied. Nothing is rendered where comments are not allowed.
+func (r *Renderer) FormatReadOnlyFields(doc bson.D, paths []string) []byte {
+	return r.formatFieldsComment(doc, paths, "read-only, edits are not applied")
+}
+
+// formatFieldsComment renders a comment with the label and fields (dotted paths) present in the document.
+func (r *Renderer) formatFieldsComment(doc bson.D, paths []string, label string) []byte {
+	if r.IsTabular() || (!r.IsYAML() && (r.config.AsValidJSON || r.config.MinimizedJSON)) {
 		return nil
 	}
 
-	return []byte(fmt.Sprintf("/* %d */\n", lineNumber))
+	var present []string
+	for _, path := range paths {
+		if hasPath(doc, path) {
+			present = append(present, path)
+		}
+	}
+	if len(present) == 0 {
+		return nil
+	}
+
+	return r.FormatComment(label + ": " + strings.Join(present, ", "))
+}
+
+// hasPath reports whether the document has a field at the given dotted path.
+func hasPath(doc bson.D, path string) bool {
+	key, rest, nested := strings.Cut(path, ".")
+	for _, e := range doc {
+		if e.Key != key {
+			continue
+		}
+		if !nested {
+			return true
+		}
+		sub, ok := e.Value.(bson.D)
+		return ok && hasPath(sub, rest)
+	}
+
+	return false
 }
 
 func (r *Renderer) FormatResult(result any) ([]byte, error) {
 	cfg := r.config
 
+	if r.IsYAML() {
+		return r.formatYAMLResult(result)
+	}
+	if r.IsTabular() {
+		return nil, errors.New("tabular formats can render documents only as a whole table")
+	}
+
 	// Create unified marshaller using pkg/extjson
 	var marshaller *extjson.Marshaller
 	switch cfg.ExtJSONMode {
@@ -78,12 +161,56 @@ func (r *Renderer) FormatResult(result any) ([]byte, error) {
 	return b, nil
 }
 
+// formatYAMLResult renders the result as a YAML document, starting with `---` separator.
+func (r *Renderer) formatYAMLResult(result any) ([]byte, error) {
+	b, err := bsonyaml.Marshal(result)
+	if err != nil {
+		if r.config.IgnoreFailures {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return append([]byte("---\n"), b...), nil
+}
+
+// FormatTable renders all the documents as a CSV/TSV table with typed columns.
+// Given columns (e.g. fields of the projection) go first, then the rest of the documents fields.
+func (r *Renderer) FormatTable(results []bson.D, columns []string) ([]byte, error) {
+	comma := bsoncsv.Comma
+	if r.config.Format == Formats.TSV {
+		comma = bsoncsv.Tab
+	}
+
+	b, err := bsoncsv.Marshal(results, bsoncsv.Columns(results, columns), comma)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal table: %w", err)
+	}
+
+	return b, nil
+}
+
+// ParseTable parses the CSV/TSV table rendered via FormatTable back into documents.
+func (r *Renderer) ParseTable(data []byte) ([]bson.D, error) {
+	comma := bsoncsv.Comma
+	if r.config.Format == Formats.TSV {
+		comma = bsoncsv.Tab
+	}
+
+	return bsoncsv.Unmarshal(data, comma)
+}
+
 func (r *Renderer) Format(ctx context.Context, cursor Cursor, out io.Writer) error {
 	cfg := r.config
 
+	if r.IsTabular() {
+		return r.formatTable(ctx, cursor, out)
+	}
+
 	lineNumber := 0
 	for cursor.Next(ctx) {
-		var result bson.M
+		var result bson.D
 		err := cursor.Decode(&result)
 		if err != nil {
 			if cfg.IgnoreFailures {
@@ -119,3 +246,30 @@ func (r *Renderer) Format(ctx context.Context, cursor Cursor, out io.Writer) err
 
 	return nil
 }
+
+// formatTable collects all the documents of the cursor and renders them as a single table.
+func (r *Renderer) formatTable(ctx context.Context, cursor Cursor, out io.Writer) error {
+	var results []bson.D
+	for cursor.Next(ctx) {
+		var result bson.D
+		if err := cursor.Decode(&result); err != nil {
+			if r.config.IgnoreFailures {
+				continue
+			}
+
+			return fmt.Errorf("failed to decode line [%d]: %w", len(results), err)
+		}
+		results = append(results, result)
+	}
+
+	b, err := r.FormatTable(results, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := out.Write(b); err != nil {
+		return fmt.Errorf("failed to write table: %w", err)
+	}
+
+	return nil
+}
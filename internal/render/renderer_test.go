@@ -9,6 +9,8 @@ import (
 
 	"pho/internal/render"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -32,11 +34,12 @@ func (c *mockCursor) Decode(v any) error {
 		return nil
 	}
 
-	// Simple decode implementation for testing
-	if target, ok := v.(*bson.M); ok {
-		*target = c.docs[c.current]
+	// Round-trip via BSON, as a real cursor decodes into any given target
+	b, err := bson.Marshal(c.docs[c.current])
+	if err != nil {
+		return err
 	}
-	return nil
+	return bson.Unmarshal(b, v)
 }
 
 func TestNewRenderer(t *testing.T) {
@@ -154,6 +157,13 @@ func TestRenderer_FormatLineNumber(t *testing.T) {
 			expected:    "/* -1 */\n",
 			shouldBeNil: false,
 		},
+		{
+			name:        "yaml format uses yaml comments",
+			options:     []render.Option{render.WithShowLineNumbers(true), render.WithFormat(render.Formats.YAML)},
+			lineNumber:  5,
+			expected:    "# 5\n",
+			shouldBeNil: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -178,6 +188,42 @@ func TestRenderer_FormatLineNumber(t *testing.T) {
 	}
 }
 
+func TestRenderer_FormatProtectedFields(t *testing.T) {
+	doc := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "audit", Value: bson.D{{Key: "by", Value: "admin"}}},
+		{Key: "createdAt", Value: "2025-01-11"},
+	}
+	paths := []string{"createdAt", "audit.by", "audit.at", "name.first"}
+
+	renderer := render.NewRenderer()
+	assert.Equal(t, "/* protected, must not be edited: createdAt, audit.by */\n",
+		string(renderer.FormatProtectedFields(doc, paths)))
+	assert.Nil(t, renderer.FormatProtectedFields(doc, []string{"audit.at"}))
+
+	yamlRenderer := render.NewRenderer(render.WithFormat(render.Formats.YAML))
+	assert.Equal(t, "# protected, must not be edited: createdAt\n",
+		string(yamlRenderer.FormatProtectedFields(doc, []string{"createdAt"})))
+
+	// Comments are not allowed in valid JSON and tables
+	assert.Nil(t, render.NewRenderer(render.WithAsValidJSON(true)).FormatProtectedFields(doc, paths))
+	assert.Nil(t, render.NewRenderer(render.WithFormat(render.Formats.CSV)).FormatProtectedFields(doc, paths))
+}
+
+func TestRenderer_FormatReadOnlyFields(t *testing.T) {
+	doc := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "orders", Value: bson.A{}},
+		{Key: "meta", Value: bson.D{{Key: "count", Value: int32(2)}}},
+	}
+	paths := []string{"orders", "meta.count", "total"}
+
+	assert.Equal(t, "/* read-only, edits are not applied: orders, meta.count */\n",
+		string(render.NewRenderer().FormatReadOnlyFields(doc, paths)))
+	assert.Nil(t, render.NewRenderer().FormatReadOnlyFields(doc, []string{"total"}))
+	assert.Nil(t, render.NewRenderer(render.WithAsValidJSON(true)).FormatReadOnlyFields(doc, paths))
+}
+
 func TestRenderer_FormatResult(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -253,6 +299,16 @@ func TestRenderer_FormatResult(t *testing.T) {
 			wantErr:     false,
 			wantContain: "name",
 		},
+		{
+			name: "yaml format",
+			options: []render.Option{
+				render.WithFormat(render.Formats.YAML),
+				render.WithExtJSONMode(render.ExtJSONModes.Relaxed),
+			},
+			input:       bson.M{"name": "test", "count": int64(1)},
+			wantErr:     false,
+			wantContain: "---\ncount: !long 1\nname: test\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -279,6 +335,33 @@ func TestRenderer_FormatResult(t *testing.T) {
 	}
 }
 
+func TestRenderer_FormatTable(t *testing.T) {
+	docs := []bson.D{
+		{{Key: "_id", Value: int32(1)}, {Key: "name", Value: "a\tb"}, {Key: "price", Value: 1.5}},
+		{{Key: "_id", Value: int32(2)}, {Key: "name", Value: "c"}},
+	}
+
+	csvRenderer := render.NewRenderer(render.WithFormat(render.Formats.CSV))
+	require.True(t, csvRenderer.IsTabular())
+	assert.Nil(t, csvRenderer.FormatLineNumber(1))
+
+	_, err := csvRenderer.FormatResult(docs[0])
+	require.Error(t, err)
+
+	table, err := csvRenderer.FormatTable(docs, []string{"price"})
+	require.NoError(t, err)
+	assert.Equal(t, "_id:int,price:double,name:string\n1,1.5,a\tb\n2,,c\n", string(table))
+
+	tsvRenderer := render.NewRenderer(render.WithFormat(render.Formats.TSV))
+	table, err = tsvRenderer.FormatTable(docs, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "_id:int\tname:string\tprice:double\n1\t\"a\tb\"\t1.5\n2\tc\t\n", string(table))
+
+	parsed, err := tsvRenderer.ParseTable(table)
+	require.NoError(t, err)
+	assert.Equal(t, docs, parsed)
+}
+
 func TestRenderer_FormatResult_IgnoreFailures(t *testing.T) {
 	// Test Shell mode with IgnoreFailures enabled - should work now that Shell mode is implemented
 	renderer := render.NewRenderer(
@@ -1,3 +1,9 @@
 package restore
 
-var CloneBsonM = cloneBsonM
+var CloneBsonD = cloneBsonD
+
+var BuildUpdateOperators = buildUpdateOperators
+var IsReplacement = isReplacement
+
+var MapBulkWriteError = mapBulkWriteError
+var CheckBulkWriteResult = checkBulkWriteResult
@@ -1,16 +1,65 @@
 package restore
 
 import (
-	"maps"
+	"errors"
+	"pho/internal/diff"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// cloneBsonM creates a shallow copy of bson.M to avoid mutating the original data
+// errCodeIllegalOperation is the server error code of transactions run on a standalone server.
+const errCodeIllegalOperation = 20
+
+// IsTransactionUnsupported reports if the error is caused by running a transaction on a standalone server.
+func IsTransactionUnsupported(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(errCodeIllegalOperation)
+}
+
+// cloneBsonD creates a shallow copy of bson.D to avoid mutating the original data
 // This is essential for restore operations where we need to modify data without
 // affecting the original document structure.
-func cloneBsonM(original bson.M) bson.M {
-	clone := make(bson.M, len(original))
-	maps.Copy(clone, original)
+func cloneBsonD(original bson.D) bson.D {
+	clone := make(bson.D, len(original))
+	copy(clone, original)
 	return clone
 }
+
+// isReplacement reports whether the updated change replaces the whole document:
+// without field-level changes it's unknown which paths were touched, so fields removed from the document
+// could only be removed by a replacement (identity fields and _id are kept as they are in the document).
+func isReplacement(c *diff.Change) bool {
+	return c.FieldChanges.Len() == 0
+}
+
+// buildUpdateOperators builds $set and $unset operator documents of field-level changes of the updated change
+// (see isReplacement for updates without them).
+func buildUpdateOperators(c *diff.Change) (bson.D, bson.D) {
+	set, unset := bson.D{}, bson.D{}
+	for _, fc := range c.FieldChanges {
+		if fc.Action == diff.FieldRemoved {
+			unset = append(unset, bson.E{Key: fc.Path, Value: ""})
+		} else {
+			set = append(set, bson.E{Key: fc.Path, Value: fc.After})
+		}
+	}
+
+	return set, unset
+}
+
+// buildUpdateDocument builds the update document ($set/$unset) for the given updated change.
+// Empty operators are omitted as MongoDB rejects them.
+func buildUpdateDocument(c *diff.Change) bson.D {
+	set, unset := buildUpdateOperators(c)
+
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+
+	return update
+}
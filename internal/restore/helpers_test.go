@@ -1,83 +1,80 @@
 package restore_test
 
 import (
+	"errors"
 	"fmt"
+	"pho/internal/diff"
 	"pho/internal/restore"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func TestCloneBsonM(t *testing.T) {
+func TestCloneBsonD(t *testing.T) {
 	tests := []struct {
 		name     string
-		input    bson.M
-		expected bson.M
+		input    bson.D
+		expected bson.D
 	}{
 		{
 			name:     "empty document",
-			input:    bson.M{},
-			expected: bson.M{},
+			input:    bson.D{},
+			expected: bson.D{},
 		},
 		{
 			name: "simple document",
-			input: bson.M{
-				"name":  "test",
-				"value": 42,
-				"flag":  true,
+			input: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "value", Value: 42},
+				{Key: "flag", Value: true},
 			},
-			expected: bson.M{
-				"name":  "test",
-				"value": 42,
-				"flag":  true,
+			expected: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "value", Value: 42},
+				{Key: "flag", Value: true},
 			},
 		},
 		{
 			name: "document with nested structure",
-			input: bson.M{
-				"_id": "12345",
-				"user": bson.M{
-					"name": "John",
-					"age":  30,
-				},
-				"tags": []string{"go", "mongodb"},
+			input: bson.D{
+				{Key: "_id", Value: "12345"},
+				{Key: "user", Value: bson.D{{Key: "name", Value: "John"}, {Key: "age", Value: 30}}},
+				{Key: "tags", Value: []string{"go", "mongodb"}},
 			},
-			expected: bson.M{
-				"_id": "12345",
-				"user": bson.M{
-					"name": "John",
-					"age":  30,
-				},
-				"tags": []string{"go", "mongodb"},
+			expected: bson.D{
+				{Key: "_id", Value: "12345"},
+				{Key: "user", Value: bson.D{{Key: "name", Value: "John"}, {Key: "age", Value: 30}}},
+				{Key: "tags", Value: []string{"go", "mongodb"}},
 			},
 		},
 		{
 			name: "document with nil values",
-			input: bson.M{
-				"name":    "test",
-				"deleted": nil,
-				"active":  false,
+			input: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "deleted", Value: nil},
+				{Key: "active", Value: false},
 			},
-			expected: bson.M{
-				"name":    "test",
-				"deleted": nil,
-				"active":  false,
+			expected: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "deleted", Value: nil},
+				{Key: "active", Value: false},
 			},
 		},
 		{
 			name:     "nil input",
 			input:    nil,
-			expected: bson.M{},
+			expected: bson.D{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := restore.CloneBsonM(tt.input)
+			result := restore.CloneBsonD(tt.input)
 
-			// Check that values are equal
+			// Check that values (and their order) are equal
 			assert.True(t, reflect.DeepEqual(result, tt.expected))
 
 			// Check that it's a different object (not same reference)
@@ -88,118 +85,123 @@ func TestCloneBsonM(t *testing.T) {
 	}
 }
 
-func TestCloneBsonM_MutationSafety(t *testing.T) {
+func TestCloneBsonD_MutationSafety(t *testing.T) {
 	// Test that modifying the clone doesn't affect the original
-	original := bson.M{
-		"name":  "original",
-		"value": 100,
-		"nested": bson.M{
-			"inner": "data",
-		},
+	original := bson.D{
+		{Key: "name", Value: "original"},
+		{Key: "value", Value: 100},
+		{Key: "nested", Value: bson.D{{Key: "inner", Value: "data"}}},
 	}
 
-	clone := restore.CloneBsonM(original)
+	clone := restore.CloneBsonD(original)
 
 	// Modify the clone
-	clone["name"] = "modified"
-	clone["newField"] = "added"
+	clone[0].Value = "modified"
+	clone = append(clone, bson.E{Key: "newField", Value: "added"})
 
 	// Original should remain unchanged
-	assert.Equal(t, "original", original["name"])
-	_, exists := original["newField"]
-	assert.False(t, exists, "Original document should not have newField")
+	assert.Equal(t, "original", original[0].Value)
+	assert.Len(t, original, 3, "Original document should not have newField")
 
 	// Clone should have the modifications
-	assert.Equal(t, "modified", clone["name"])
-	assert.Equal(t, "added", clone["newField"])
-}
-
-func TestCloneBsonM_NestedMutationBehavior(t *testing.T) {
-	// Test behavior with nested structures (shallow copy)
-	original := bson.M{
-		"nested": bson.M{
-			"inner": "value",
-		},
-		"array": []string{"a", "b"},
-	}
-
-	clone := restore.CloneBsonM(original)
-
-	// Modifying nested objects will affect both (shallow copy behavior)
-	if nested, ok := clone["nested"].(bson.M); ok {
-		nested["inner"] = "modified"
-	}
-
-	// This demonstrates shallow copy behavior - nested objects are shared
-	if originalNested, ok := original["nested"].(bson.M); ok {
-		// Document expected behavior: maps.Copy creates shallow copies
-		// so nested objects are shared between original and clone
-		_ = originalNested["inner"] // Access to document the expected behavior
-	}
-
-	// But top-level additions don't affect the original
-	clone["topLevel"] = "new"
-	_, exists := original["topLevel"]
-	assert.False(t, exists, "Top-level addition to clone should not affect original")
+	assert.Equal(t, "modified", clone[0].Value)
+	assert.Equal(t, bson.E{Key: "newField", Value: "added"}, clone[3])
 }
 
-func TestCloneBsonM_EmptyAndNilHandling(t *testing.T) {
-	// Test empty bson.M
-	empty := bson.M{}
-	clonedEmpty := restore.CloneBsonM(empty)
+func TestCloneBsonD_EmptyAndNilHandling(t *testing.T) {
+	// Test empty bson.D
+	empty := bson.D{}
+	clonedEmpty := restore.CloneBsonD(empty)
 
 	assert.Empty(t, clonedEmpty)
 
-	// Add to clone, shouldn't affect original
-	clonedEmpty["test"] = "value"
-	assert.Empty(t, empty)
-
 	// Test nil input
-	var nilDoc bson.M
-	clonedNil := restore.CloneBsonM(nilDoc)
+	var nilDoc bson.D
+	clonedNil := restore.CloneBsonD(nilDoc)
 
 	assert.NotNil(t, clonedNil)
 	assert.Empty(t, clonedNil)
 }
 
-func TestCloneBsonM_TypePreservation(t *testing.T) {
+func TestCloneBsonD_TypePreservation(t *testing.T) {
 	// Test that different types are preserved
-	original := bson.M{
-		"string": "text",
-		"int":    42,
-		"int64":  int64(9223372036854775807),
-		"float":  3.14159,
-		"bool":   true,
-		"bytes":  []byte("binary data"),
-		"slice":  []any{"a", 1, true},
-		"map":    map[string]any{"key": "value"},
+	original := bson.D{
+		{Key: "string", Value: "text"},
+		{Key: "int", Value: 42},
+		{Key: "int64", Value: int64(9223372036854775807)},
+		{Key: "float", Value: 3.14159},
+		{Key: "bool", Value: true},
+		{Key: "bytes", Value: []byte("binary data")},
+		{Key: "slice", Value: []any{"a", 1, true}},
+		{Key: "map", Value: map[string]any{"key": "value"}},
 	}
 
-	clone := restore.CloneBsonM(original)
+	clone := restore.CloneBsonD(original)
 
-	for key, originalValue := range original {
-		cloneValue, exists := clone[key]
-		assert.True(t, exists, "Clone missing key: %s", key)
-		assert.True(t, reflect.DeepEqual(originalValue, cloneValue),
+	for i, e := range original {
+		assert.Equal(t, e.Key, clone[i].Key, "Clone changed order of keys")
+		assert.True(t, reflect.DeepEqual(e.Value, clone[i].Value),
 			"Type not preserved for key %s: original = %v (%T), clone = %v (%T)",
-			key, originalValue, originalValue, cloneValue, cloneValue)
+			e.Key, e.Value, e.Value, clone[i].Value, clone[i].Value)
 	}
 }
 
-func TestCloneBsonM_CapacityOptimization(t *testing.T) {
+func TestCloneBsonD_CapacityOptimization(t *testing.T) {
 	// Test that the clone has appropriate capacity
-	large := make(bson.M, 100)
+	large := make(bson.D, 0, 100)
 	for i := range 100 {
-		large[fmt.Sprintf("key%d", i)] = i
+		large = append(large, bson.E{Key: fmt.Sprintf("key%d", i), Value: i})
 	}
 
-	clone := restore.CloneBsonM(large)
+	clone := restore.CloneBsonD(large)
 
 	assert.Len(t, clone, len(large))
+	assert.Equal(t, large, clone)
+}
+
+func TestBuildUpdateOperators(t *testing.T) {
+	t.Run("full document update without field changes", func(t *testing.T) {
+		data := bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "new"}, {Key: "age", Value: 30}}
+		change := diff.NewChange("_id", "1", diff.ActionUpdated, data)
+
+		// Removed fields are unknown, so the whole document is replaced instead
+		assert.True(t, restore.IsReplacement(change))
+	})
+
+	t.Run("field-level update", func(t *testing.T) {
+		original := bson.D{
+			{Key: "_id", Value: "1"},
+			{Key: "name", Value: "old"},
+			{Key: "obsolete", Value: true},
+			{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+		}
+		edited := bson.D{
+			{Key: "_id", Value: "1"},
+			{Key: "name", Value: "new"},
+			{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}}},
+		}
+
+		change := diff.NewChange("_id", "1", diff.ActionUpdated, edited)
+		change.Original = original
+		change.FieldChanges = diff.CompareDocuments(original, edited)
+
+		set, unset := restore.BuildUpdateOperators(change)
+
+		assert.False(t, restore.IsReplacement(change))
+		assert.Equal(t, bson.D{{Key: "address.city", Value: "Lviv"}, {Key: "name", Value: "new"}}, set)
+		assert.Equal(t, bson.D{{Key: "obsolete", Value: ""}}, unset)
+	})
+}
 
-	// Verify all elements are present
-	for key, value := range large {
-		cloneValue, exists := clone[key]
-		assert.True(t, exists && cloneValue == value, "Clone missing or incorrect value for key %s", key)
+func TestIsTransactionUnsupported(t *testing.T) {
+	standalone := mongo.CommandError{
+		Code:    20,
+		Message: "Transaction numbers are only allowed on a replica set member or mongos",
 	}
+
+	assert.True(t, restore.IsTransactionUnsupported(standalone))
+	assert.True(t, restore.IsTransactionUnsupported(fmt.Errorf("mongo.UpdateOne() failed: %w", standalone)))
+	assert.False(t, restore.IsTransactionUnsupported(mongo.CommandError{Code: 11000}))
+	assert.False(t, restore.IsTransactionUnsupported(errors.New("duplicate key")))
+	assert.False(t, restore.IsTransactionUnsupported(nil))
 }
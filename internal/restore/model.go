@@ -7,4 +7,8 @@ var (
 	// No real restore action is needed for noop.
 	// So only call restoring on effective changes.
 	ErrNoop = errors.New("noop")
+
+	// ErrNotExecuted is error meaning that change was not executed
+	// because of a previous failure (e.g. in ordered BulkWrite).
+	ErrNotExecuted = errors.New("not executed")
 )
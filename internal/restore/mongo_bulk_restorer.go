@@ -0,0 +1,322 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultBatchSize is the default number of changes sent in a single BulkWrite call.
+const DefaultBatchSize = 500
+
+// BulkResult holds the result of a single change applied via BulkWrite.
+type BulkResult struct {
+	// Change that was applied
+	Change *diff.Change
+
+	// Err is nil if the change was applied successfully
+	Err error
+
+	// Unconfirmed is set if the change was executed, but its batch matched fewer documents than expected:
+	// BulkWrite doesn't tell which writes matched none, so the change may not have been applied
+	// (see checkBulkWriteResult)
+	Unconfirmed error
+}
+
+// Identifier returns the identifier of the document the result is about (e.g. `_id::1`).
+func (r *BulkResult) Identifier() string { return r.Change.Identifier() }
+
+// MongoBulkRestorer restores changes via mongo go client in batches using BulkWrite.
+// Comparing to MongoClientRestorer it needs a single round-trip per batch instead of per change.
+type MongoBulkRestorer struct {
+	dbCollection *mongo.Collection
+
+	// batchSize is the max number of changes sent in a single BulkWrite call
+	batchSize int
+
+	// ordered makes BulkWrite stop on the first error (all further changes are not executed)
+	ordered bool
+}
+
+// BulkOption represents an option for configuring MongoBulkRestorer.
+type BulkOption func(*MongoBulkRestorer)
+
+// WithBatchSize sets the max number of changes sent in a single BulkWrite call.
+func WithBatchSize(v int) BulkOption { return func(r *MongoBulkRestorer) { r.batchSize = v } }
+
+// WithOrdered sets if changes are applied in order, stopping on the first error.
+func WithOrdered(v bool) BulkOption { return func(r *MongoBulkRestorer) { r.ordered = v } }
+
+func NewMongoBulkRestorer(dbCollection *mongo.Collection, opts ...BulkOption) *MongoBulkRestorer {
+	r := &MongoBulkRestorer{dbCollection: dbCollection, batchSize: DefaultBatchSize, ordered: true}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = DefaultBatchSize
+	}
+
+	return r
+}
+
+func (r *MongoBulkRestorer) GetDBCollection() *mongo.Collection { return r.dbCollection }
+func (r *MongoBulkRestorer) GetBatchSize() int                  { return r.batchSize }
+func (r *MongoBulkRestorer) IsOrdered() bool                    { return r.ordered }
+
+// Build builds the BulkWrite model for the given change.
+// For renamed documents it's the insert of the new document only:
+// the old one is deleted by Restore beforehand (and put back if the insert fails).
+func (r *MongoBulkRestorer) Build(c *diff.Change) (mongo.WriteModel, error) {
+	if c == nil {
+		return nil, errors.New("change cannot be nil")
+	}
+	if c.IdentifiedBy == "" || c.IdentifierValue == "" {
+		return nil, errors.New("change identifiedBy+identifierValue are required fields")
+	}
+
+	switch c.Action {
+	case diff.ActionUpdated:
+		if c.Data == nil {
+			return nil, errors.New("updated action requires a doc")
+		}
+
+		if isReplacement(c) {
+			return mongo.NewReplaceOneModel().
+				SetFilter(c.Filter()).
+				SetReplacement(c.Data), nil
+		}
+
+		return mongo.NewUpdateOneModel().
+			SetFilter(c.Filter()).
+			SetUpdate(buildUpdateDocument(c)), nil
+
+	case diff.ActionAdded:
+		if c.Data == nil {
+			return nil, errors.New("added action requires a doc")
+		}
+
+		return mongo.NewInsertOneModel().SetDocument(c.Data), nil
+
+	case diff.ActionRenamed:
+		if c.Data == nil {
+			return nil, errors.New("renamed action requires a doc")
+		}
+
+		return mongo.NewInsertOneModel().SetDocument(c.Data), nil
+
+	case diff.ActionDeleted:
+		return mongo.NewDeleteOneModel().SetFilter(c.Filter()), nil
+
+	case diff.ActionNoop:
+		return nil, ErrNoop
+
+	default:
+		return nil, fmt.Errorf("unknown action type: %v", c.Action)
+	}
+}
+
+// Restore applies the given changes in batches.
+// Results are returned per change (in the same order as changes are given),
+// changes of batches that matched fewer documents than expected are Unconfirmed.
+// Returned error is not nil only if something went wrong besides failures of individual changes
+// (e.g. connection issues), in such case results of not executed changes hold ErrNotExecuted.
+func (r *MongoBulkRestorer) Restore(ctx context.Context, changes diff.Changes) ([]*BulkResult, error) {
+	if r.dbCollection == nil {
+		return nil, errors.New("connected db collection is required")
+	}
+
+	results := make([]*BulkResult, len(changes))
+	for i, ch := range changes {
+		results[i] = &BulkResult{Change: ch}
+	}
+
+	bulkOptions := options.BulkWrite().SetOrdered(r.ordered)
+
+	stopped := false
+	for start := 0; start < len(changes); start += r.batchSize {
+		end := min(start+r.batchSize, len(changes))
+		batch := results[start:end]
+
+		if stopped {
+			markNotExecuted(batch)
+			continue
+		}
+
+		// Changes that can't be built are failed right away, so models are mapped back via indexes.
+		// In ordered mode, changes following the failed one are not executed (same as BulkWrite does).
+		// Old documents of renamed ones are deleted before the batch, so they are kept to be put back on failures
+		var models []mongo.WriteModel
+		var modelResults []*BulkResult
+		renamedFrom := make(map[*BulkResult]bson.D)
+		buildFailed := false
+		for i, result := range batch {
+			model, err := r.Build(result.Change)
+			if err == nil && result.Change.Action == diff.ActionRenamed {
+				renamedFrom[result], err = r.deleteRenamed(ctx, result.Change)
+			}
+			if err != nil {
+				result.Err = err
+				if r.ordered {
+					markNotExecuted(batch[i+1:])
+					buildFailed = true
+					break
+				}
+				continue
+			}
+			models = append(models, model)
+			modelResults = append(modelResults, result)
+		}
+
+		if len(models) == 0 {
+			stopped = buildFailed
+			continue
+		}
+
+		bulkResult, err := r.dbCollection.BulkWrite(ctx, models, bulkOptions)
+
+		stop, err := mapBulkWriteError(modelResults, err, r.ordered)
+		if err == nil {
+			// Batches with writes matching no documents are ambiguous, ordered mode stops on them
+			if mismatch := checkBulkWriteResult(modelResults, bulkResult); mismatch && r.ordered {
+				stop = true
+			}
+		}
+		r.putRenamedBack(ctx, renamedFrom)
+		if err != nil {
+			markNotExecuted(results[end:])
+			return results, err
+		}
+		stopped = stop || buildFailed
+	}
+
+	return results, nil
+}
+
+// deleteRenamed deletes the old document of the renamed change and returns it.
+// Identifiers can't be changed in place, and the old document is deleted before the new one is inserted,
+// as both of them would violate unique indexes of other fields otherwise.
+func (r *MongoBulkRestorer) deleteRenamed(ctx context.Context, c *diff.Change) (bson.D, error) {
+	var old bson.D
+	if err := r.dbCollection.FindOneAndDelete(ctx, c.RenamedFromFilter()).Decode(&old); err != nil {
+		return nil, fmt.Errorf("mongo.FindOneAndDelete() of %s failed: %w", c.RenamedFromIdentifier(), err)
+	}
+
+	return old, nil
+}
+
+// putRenamedBack inserts old documents of renamed changes back if their new documents were not inserted.
+func (r *MongoBulkRestorer) putRenamedBack(ctx context.Context, renamedFrom map[*BulkResult]bson.D) {
+	for result, old := range renamedFrom {
+		if result.Err == nil {
+			continue
+		}
+
+		if _, err := r.dbCollection.InsertOne(ctx, old); err != nil {
+			result.Err = fmt.Errorf("%w, putting %s back failed: %w",
+				result.Err, result.Change.RenamedFromIdentifier(), err)
+		}
+	}
+}
+
+// checkBulkWriteResult compares numbers of documents matched, deleted and inserted by a BulkWrite call
+// with the ones expected by its executed changes.
+// BulkWrite doesn't tell which writes matched no documents, so on a mismatch the batch is ambiguous:
+// executed writes of the kind are marked as Unconfirmed (with mongo.ErrNoDocuments), but not failed,
+// as most of them were applied. It returns true if there was a mismatch.
+func checkBulkWriteResult(results []*BulkResult, bulkResult *mongo.BulkWriteResult) bool {
+	if bulkResult == nil {
+		return false
+	}
+
+	kinds := map[string][]*BulkResult{}
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		switch result.Change.Action {
+		case diff.ActionDeleted:
+			kinds["deleted"] = append(kinds["deleted"], result)
+		case diff.ActionUpdated:
+			kinds["matched"] = append(kinds["matched"], result)
+		default:
+			kinds["inserted"] = append(kinds["inserted"], result)
+		}
+	}
+
+	mismatch := false
+	for kind, count := range map[string]int64{
+		"matched":  bulkResult.MatchedCount,
+		"deleted":  bulkResult.DeletedCount,
+		"inserted": bulkResult.InsertedCount,
+	} {
+		expected := int64(len(kinds[kind]))
+		if count >= expected {
+			continue
+		}
+
+		mismatch = true
+		err := fmt.Errorf("mongo.BulkWrite() %s %d of %d documents of the batch: %w",
+			kind, count, expected, mongo.ErrNoDocuments)
+		for _, result := range kinds[kind] {
+			result.Unconfirmed = err
+		}
+	}
+
+	return mismatch
+}
+
+// mapBulkWriteError maps the error of a BulkWrite call back to the results of individual changes.
+// It returns true if further changes must not be executed (ordered mode with a failed change).
+// Errors that can't be mapped to individual changes are returned as is.
+func mapBulkWriteError(results []*BulkResult, err error, ordered bool) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) {
+		err = fmt.Errorf("mongo.BulkWrite() failed: %w", err)
+		for _, result := range results {
+			if result.Err == nil {
+				result.Err = err
+			}
+		}
+		return true, err
+	}
+
+	failedIdx := len(results)
+	for _, writeErr := range bwe.WriteErrors {
+		if writeErr.Index < 0 || writeErr.Index >= len(results) {
+			continue
+		}
+
+		results[writeErr.Index].Err = fmt.Errorf("mongo.BulkWrite() failed: %w", writeErr)
+		failedIdx = min(failedIdx, writeErr.Index)
+	}
+
+	if bwe.WriteConcernError != nil {
+		return true, fmt.Errorf("mongo.BulkWrite() failed: %w", bwe.WriteConcernError)
+	}
+
+	// In ordered mode, BulkWrite stops on the first failed write
+	if ordered && failedIdx < len(results) {
+		markNotExecuted(results[failedIdx+1:])
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func markNotExecuted(results []*BulkResult) {
+	for _, result := range results {
+		if result.Err == nil {
+			result.Err = ErrNotExecuted
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package restore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/restore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestNewMongoBulkRestorer(t *testing.T) {
+	tests := []struct {
+		name              string
+		opts              []restore.BulkOption
+		expectedBatchSize int
+		expectedOrdered   bool
+	}{
+		{
+			name:              "defaults",
+			expectedBatchSize: restore.DefaultBatchSize,
+			expectedOrdered:   true,
+		},
+		{
+			name:              "custom options",
+			opts:              []restore.BulkOption{restore.WithBatchSize(10), restore.WithOrdered(false)},
+			expectedBatchSize: 10,
+			expectedOrdered:   false,
+		},
+		{
+			name:              "invalid batch size falls back to default",
+			opts:              []restore.BulkOption{restore.WithBatchSize(0)},
+			expectedBatchSize: restore.DefaultBatchSize,
+			expectedOrdered:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restorer := restore.NewMongoBulkRestorer(nil, tt.opts...)
+
+			assert.Nil(t, restorer.GetDBCollection())
+			assert.Equal(t, tt.expectedBatchSize, restorer.GetBatchSize())
+			assert.Equal(t, tt.expectedOrdered, restorer.IsOrdered())
+		})
+	}
+}
+
+func TestMongoBulkRestorer_Build(t *testing.T) {
+	restorer := restore.NewMongoBulkRestorer(nil)
+
+	updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: "doc1"},
+		{Key: "name", Value: "new"},
+	})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+		{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+	}
+
+	model, err := restorer.Build(updated)
+	require.NoError(t, err)
+	updateModel, ok := model.(*mongo.UpdateOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.M{"_id": "doc1"}, updateModel.Filter)
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: "new"}}},
+		{Key: "$unset", Value: bson.D{{Key: "legacy", Value: ""}}},
+	}, updateModel.Update)
+
+	// Without field-level changes the whole document is replaced, so removed fields are removed as well
+	replaced := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "_id", Value: "doc1"}})
+	model, err = restorer.Build(replaced)
+	require.NoError(t, err)
+	replaceModel, ok := model.(*mongo.ReplaceOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.M{"_id": "doc1"}, replaceModel.Filter)
+	assert.Equal(t, bson.D{{Key: "_id", Value: "doc1"}}, replaceModel.Replacement)
+
+	model, err = restorer.Build(diff.NewChange("_id", "doc2", diff.ActionAdded, bson.D{{Key: "_id", Value: "doc2"}}))
+	require.NoError(t, err)
+	insertModel, ok := model.(*mongo.InsertOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.D{{Key: "_id", Value: "doc2"}}, insertModel.Document)
+
+	model, err = restorer.Build(diff.NewChange("_id", "doc3", diff.ActionDeleted))
+	require.NoError(t, err)
+	deleteModel, ok := model.(*mongo.DeleteOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.M{"_id": "doc3"}, deleteModel.Filter)
+
+	identity := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}}
+	model, err = restorer.Build(diff.NewChange("tenant_id,sku", identity, diff.ActionDeleted))
+	require.NoError(t, err)
+	deleteModel, ok = model.(*mongo.DeleteOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.M{"tenant_id": "acme", "sku": "SKU-1"}, deleteModel.Filter)
+
+	// Old document of the renamed one is deleted by Restore before the new one is inserted
+	renamed := diff.NewChange("_id", "doc5", diff.ActionRenamed, bson.D{{Key: "_id", Value: "doc5"}})
+	renamed.RenamedFrom = "doc4"
+	model, err = restorer.Build(renamed)
+	require.NoError(t, err)
+	insertModel, ok = model.(*mongo.InsertOneModel)
+	require.True(t, ok)
+	assert.Equal(t, bson.D{{Key: "_id", Value: "doc5"}}, insertModel.Document)
+}
+
+func TestMongoBulkRestorer_Build_Errors(t *testing.T) {
+	restorer := restore.NewMongoBulkRestorer(nil)
+
+	tests := []struct {
+		name   string
+		change *diff.Change
+	}{
+		{name: "nil change", change: nil},
+		{name: "missing identifier", change: diff.NewChange("_id", "", diff.ActionDeleted)},
+		{name: "update without data", change: diff.NewChange("_id", "doc1", diff.ActionUpdated)},
+		{name: "insert without data", change: diff.NewChange("_id", "doc1", diff.ActionAdded)},
+		{name: "rename without data", change: diff.NewChange("_id", "doc1", diff.ActionRenamed)},
+		{name: "unknown action", change: diff.NewChange("_id", "doc1", diff.Action(99))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := restorer.Build(tt.change)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := restorer.Build(diff.NewChange("_id", "doc1", diff.ActionNoop))
+	assert.ErrorIs(t, err, restore.ErrNoop)
+}
+
+func TestMongoBulkRestorer_Restore_NilCollection(t *testing.T) {
+	restorer := restore.NewMongoBulkRestorer(nil)
+
+	_, err := restorer.Restore(context.Background(), diff.Changes{diff.NewChange("_id", "doc1", diff.ActionDeleted)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connected db collection is required")
+}
+
+func TestMapBulkWriteError(t *testing.T) {
+	newResults := func() []*restore.BulkResult {
+		return []*restore.BulkResult{
+			{Change: diff.NewChange("_id", "doc1", diff.ActionDeleted)},
+			{Change: diff.NewChange("_id", "doc2", diff.ActionDeleted)},
+			{Change: diff.NewChange("_id", "doc3", diff.ActionDeleted)},
+		}
+	}
+	bulkErr := mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "dup key"}}},
+	}
+
+	t.Run("no error", func(t *testing.T) {
+		results := newResults()
+		stop, err := restore.MapBulkWriteError(results, nil, true)
+		require.NoError(t, err)
+		assert.False(t, stop)
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+		}
+	})
+
+	t.Run("ordered write error", func(t *testing.T) {
+		results := newResults()
+		stop, err := restore.MapBulkWriteError(results, bulkErr, true)
+		require.NoError(t, err)
+		assert.True(t, stop)
+
+		assert.NoError(t, results[0].Err)
+		assert.ErrorContains(t, results[1].Err, "dup key")
+		assert.ErrorIs(t, results[2].Err, restore.ErrNotExecuted)
+		assert.Equal(t, "_id::doc2", results[1].Identifier())
+	})
+
+	t.Run("unordered write error", func(t *testing.T) {
+		results := newResults()
+		stop, err := restore.MapBulkWriteError(results, bulkErr, false)
+		require.NoError(t, err)
+		assert.False(t, stop)
+
+		assert.NoError(t, results[0].Err)
+		assert.ErrorContains(t, results[1].Err, "dup key")
+		assert.NoError(t, results[2].Err)
+	})
+
+	t.Run("general error", func(t *testing.T) {
+		results := newResults()
+		stop, err := restore.MapBulkWriteError(results, errors.New("connection lost"), false)
+		require.Error(t, err)
+		assert.True(t, stop)
+		for _, result := range results {
+			assert.ErrorContains(t, result.Err, "connection lost")
+		}
+	})
+}
+
+func TestCheckBulkWriteResult(t *testing.T) {
+	newResults := func() []*restore.BulkResult {
+		updated := diff.NewChange("_id", "doc1", diff.ActionUpdated, bson.D{{Key: "_id", Value: "doc1"}})
+		return []*restore.BulkResult{
+			{Change: updated},
+			{Change: diff.NewChange("_id", "doc2", diff.ActionDeleted)},
+			{Change: diff.NewChange("_id", "doc3", diff.ActionDeleted)},
+			{Change: diff.NewChange("_id", "doc4", diff.ActionAdded, bson.D{{Key: "_id", Value: "doc4"}})},
+		}
+	}
+
+	t.Run("all documents matched", func(t *testing.T) {
+		results := newResults()
+		mismatch := restore.CheckBulkWriteResult(results,
+			&mongo.BulkWriteResult{MatchedCount: 1, DeletedCount: 2, InsertedCount: 1})
+		assert.False(t, mismatch)
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+		}
+	})
+
+	t.Run("deletes matching no documents", func(t *testing.T) {
+		results := newResults()
+		mismatch := restore.CheckBulkWriteResult(results,
+			&mongo.BulkWriteResult{MatchedCount: 1, DeletedCount: 1, InsertedCount: 1})
+		assert.True(t, mismatch)
+
+		// It's unknown which delete matched nothing, so both are unconfirmed, but not failed
+		for _, result := range results {
+			assert.NoError(t, result.Err)
+		}
+		assert.NoError(t, results[0].Unconfirmed)
+		assert.ErrorIs(t, results[1].Unconfirmed, mongo.ErrNoDocuments)
+		assert.ErrorIs(t, results[2].Unconfirmed, mongo.ErrNoDocuments)
+		assert.ErrorContains(t, results[2].Unconfirmed, "deleted 1 of 2 documents")
+		assert.NoError(t, results[3].Unconfirmed)
+	})
+
+	t.Run("update matching no documents", func(t *testing.T) {
+		results := newResults()
+		mismatch := restore.CheckBulkWriteResult(results,
+			&mongo.BulkWriteResult{DeletedCount: 2, InsertedCount: 1})
+		assert.True(t, mismatch)
+
+		assert.NoError(t, results[0].Err)
+		assert.ErrorIs(t, results[0].Unconfirmed, mongo.ErrNoDocuments)
+		assert.NoError(t, results[1].Unconfirmed)
+		assert.NoError(t, results[2].Unconfirmed)
+		assert.NoError(t, results[3].Unconfirmed)
+	})
+
+	t.Run("failed changes are not expected to match", func(t *testing.T) {
+		results := newResults()
+		results[1].Err = restore.ErrNotExecuted
+		mismatch := restore.CheckBulkWriteResult(results,
+			&mongo.BulkWriteResult{MatchedCount: 1, DeletedCount: 1, InsertedCount: 1})
+		assert.False(t, mismatch)
+		assert.NoError(t, results[2].Err)
+		assert.NoError(t, results[2].Unconfirmed)
+	})
+}
@@ -39,13 +39,20 @@ func (r *MongoClientRestorer) Build(c *diff.Change) (func(ctx context.Context) e
 				return errors.New("updated action requires a doc")
 			}
 
-			// Clone data to avoid mutating the original
-			dataClone := cloneBsonM(c.Data)
-			delete(dataClone, c.IdentifiedBy)
+			filter := c.Filter()
+			if isReplacement(c) {
+				result, err := r.dbCollection.ReplaceOne(ctx, filter, c.Data)
+				if err != nil {
+					return fmt.Errorf("mongo.ReplaceOne() failed: %w", err)
+				}
+				if result.MatchedCount == 0 {
+					return fmt.Errorf("mongo.ReplaceOne() failed: %w", mongo.ErrNoDocuments)
+				}
+
+				return nil
+			}
 
-			filter := bson.M{c.IdentifiedBy: c.IdentifierValue}
-			update := bson.M{"$set": dataClone}
-			result, err := r.dbCollection.UpdateOne(ctx, filter, update)
+			result, err := r.dbCollection.UpdateOne(ctx, filter, buildUpdateDocument(c))
 			if err != nil {
 				return fmt.Errorf("mongo.UpdateOne() failed: %w", err)
 			}
@@ -71,8 +78,15 @@ func (r *MongoClientRestorer) Build(c *diff.Change) (func(ctx context.Context) e
 
 			return nil
 
+		case diff.ActionRenamed:
+			if c.Data == nil {
+				return errors.New("renamed action requires a doc")
+			}
+
+			return r.rename(ctx, c)
+
 		case diff.ActionDeleted:
-			filter := bson.M{c.IdentifiedBy: c.IdentifierValue}
+			filter := c.Filter()
 			result, err := r.dbCollection.DeleteOne(ctx, filter)
 			if err != nil {
 				return fmt.Errorf("mongo.DeleteOne() failed: %w", err)
@@ -94,3 +108,52 @@ func (r *MongoClientRestorer) Build(c *diff.Change) (func(ctx context.Context) e
 		}
 	}, nil
 }
+
+// rename replaces the old document of the renamed change with the new one.
+// Identifiers can't be changed in place, and the old document is deleted before the new one is inserted,
+// as both of them would violate unique indexes of other fields otherwise.
+// Both writes are done in a transaction (the one of the context, or a new one if the server supports them),
+// otherwise the old document is put back if the insert fails.
+func (r *MongoClientRestorer) rename(ctx context.Context, c *diff.Change) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return r.replaceRenamed(ctx, c, false)
+	}
+
+	session, err := r.dbCollection.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, r.replaceRenamed(sessCtx, c, false)
+	})
+	if !IsTransactionUnsupported(err) {
+		return err
+	}
+
+	return r.replaceRenamed(ctx, c, true)
+}
+
+// replaceRenamed deletes the old document of the renamed change and inserts the new one.
+// If putBack is set, the old document is inserted back when the insert of the new one fails.
+func (r *MongoClientRestorer) replaceRenamed(ctx context.Context, c *diff.Change, putBack bool) error {
+	var old bson.D
+	if err := r.dbCollection.FindOneAndDelete(ctx, c.RenamedFromFilter()).Decode(&old); err != nil {
+		return fmt.Errorf("mongo.FindOneAndDelete() of %s failed: %w", c.RenamedFromIdentifier(), err)
+	}
+
+	_, err := r.dbCollection.InsertOne(ctx, c.Data)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("mongo.InsertOne() failed: %w", err)
+	if !putBack {
+		return err
+	}
+
+	if _, putBackErr := r.dbCollection.InsertOne(ctx, old); putBackErr != nil {
+		return fmt.Errorf("%w, putting %s back failed: %w", err, c.RenamedFromIdentifier(), putBackErr)
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package restore_test
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -102,9 +103,9 @@ func TestMongoClientRestorer_Build_ActionValidation(t *testing.T) {
 				Action:          diff.ActionUpdated,
 				IdentifiedBy:    "_id",
 				IdentifierValue: "test123",
-				Data: bson.M{
-					"_id":  "test123",
-					"name": "updated",
+				Data: bson.D{
+					{Key: "_id", Value: "test123"},
+					{Key: "name", Value: "updated"},
 				},
 			},
 			shouldBuildSucceed: false, // Will fail due to nil collection
@@ -116,9 +117,9 @@ func TestMongoClientRestorer_Build_ActionValidation(t *testing.T) {
 				Action:          diff.ActionAdded,
 				IdentifiedBy:    "_id",
 				IdentifierValue: "test123",
-				Data: bson.M{
-					"_id":  "test123",
-					"name": "new",
+				Data: bson.D{
+					{Key: "_id", Value: "test123"},
+					{Key: "name", Value: "new"},
 				},
 			},
 			shouldBuildSucceed: false, // Will fail due to nil collection
@@ -232,10 +233,10 @@ func TestMongoClientRestorer_DataCloning(t *testing.T) {
 	// Test that the cloning logic works correctly
 	// We can test this by examining what would be passed to the update operation
 
-	originalData := bson.M{
-		"_id":   "test123",
-		"name":  "original",
-		"value": 42,
+	originalData := bson.D{
+		{Key: "_id", Value: "test123"},
+		{Key: "name", Value: "original"},
+		{Key: "value", Value: 42},
 	}
 
 	change := &diff.Change{
@@ -257,16 +258,13 @@ func TestMongoClientRestorer_DataCloning(t *testing.T) {
 	}
 
 	// Original data should remain unchanged
-	if originalData["name"] != "original" {
-		t.Errorf("Original data was modified: name = %v, want 'original'", originalData["name"])
+	expected := bson.D{
+		{Key: "_id", Value: "test123"},
+		{Key: "name", Value: "original"},
+		{Key: "value", Value: 42},
 	}
-
-	if _, exists := originalData["_id"]; !exists {
-		t.Error("Original data should still contain _id field")
-	}
-
-	if originalData["value"] != 42 {
-		t.Errorf("Original data was modified: value = %v, want 42", originalData["value"])
+	if !reflect.DeepEqual(originalData, expected) {
+		t.Errorf("Original data was modified: %v, want %v", originalData, expected)
 	}
 }
 
@@ -369,7 +367,7 @@ func TestMongoClientRestorer_FunctionSignature(t *testing.T) {
 		Action:          diff.ActionUpdated,
 		IdentifiedBy:    "_id",
 		IdentifierValue: "test",
-		Data:            bson.M{"name": "test"},
+		Data:            bson.D{{Key: "name", Value: "test"}},
 	}
 
 	fn, err := restorer.Build(change)
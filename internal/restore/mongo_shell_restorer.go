@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"pho/internal/diff"
 	"pho/pkg/extjson"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // MongoShellRestorer restores changes as mongo-shell commands
@@ -32,25 +35,50 @@ func (r *MongoShellRestorer) Build(c *diff.Change) (string, error) {
 
 	switch c.Action {
 	case diff.ActionUpdated:
-
-		var marshalledData []byte
 		if c.Data == nil {
 			return "", errors.New("updated action requires a doc")
 		}
 
-		// Clone data to avoid mutating the original
-		dataClone := cloneBsonM(c.Data)
-		delete(dataClone, c.IdentifiedBy)
+		filter, err := shellFilter(c, c.IdentifierValue)
+		if err != nil {
+			return "", err
+		}
 
-		var err error
-		if marshalledData, err = extjson.NewCanonicalMarshaller().Marshal(dataClone); err != nil {
-			return "", fmt.Errorf("could not marshal given obj value: %w", err)
+		if isReplacement(c) {
+			marshalledData, err := extjson.NewCanonicalMarshaller().Marshal(c.Data)
+			if err != nil {
+				return "", fmt.Errorf("could not marshal given obj value: %w", err)
+			}
+
+			return fmt.Sprintf(`db.getCollection("%s").replaceOne(%s,%s);`,
+				r.collectionName,
+				filter,
+				marshalledData,
+			), nil
 		}
 
-		return fmt.Sprintf(`db.getCollection("%s").updateOne({%s:%v},{$set:%s});`,
+		set, unset := buildUpdateOperators(c)
+
+		var operators []string
+		for _, op := range []struct {
+			name string
+			doc  bson.D
+		}{{"$set", set}, {"$unset", unset}} {
+			if len(op.doc) == 0 {
+				continue
+			}
+
+			marshalledData, err := extjson.NewCanonicalMarshaller().Marshal(op.doc)
+			if err != nil {
+				return "", fmt.Errorf("could not marshal given obj value: %w", err)
+			}
+			operators = append(operators, fmt.Sprintf("%s:%s", op.name, marshalledData))
+		}
+
+		return fmt.Sprintf(`db.getCollection("%s").updateOne(%s,{%s});`,
 			r.collectionName,
-			c.IdentifiedBy, c.IdentifierValue,
-			marshalledData,
+			filter,
+			strings.Join(operators, ","),
 		), nil
 	case diff.ActionAdded:
 
@@ -66,10 +94,47 @@ func (r *MongoShellRestorer) Build(c *diff.Change) (string, error) {
 			r.collectionName,
 			marshalledData,
 		), nil
+	case diff.ActionRenamed:
+		if c.Data == nil {
+			return "", errors.New("renamed action requires a doc")
+		}
+
+		marshalledData, err := extjson.NewCanonicalMarshaller().Marshal(c.Data)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal given obj value: %w", err)
+		}
+
+		filter, err := shellFilter(c, c.RenamedFrom)
+		if err != nil {
+			return "", err
+		}
+
+		// Identifiers can't be changed in place: the old document is deleted first (so both don't clash
+		// on unique indexes of other fields), and it's put back if the insert of the new one fails
+		return fmt.Sprintf("// %s renamed to %s: delete the old document, then insert the new one\n"+
+			"{\n"+
+			`  const old = db.getCollection("%s").findOneAndDelete(%s);`+"\n"+
+			"  try {\n"+
+			`    db.getCollection("%s").insertOne(%s);`+"\n"+
+			"  } catch (e) {\n"+
+			`    db.getCollection("%s").insertOne(old);`+"\n"+
+			"    throw e;\n"+
+			"  }\n"+
+			"}",
+			c.RenamedFromIdentifier(), c.Identifier(),
+			r.collectionName, filter,
+			r.collectionName, marshalledData,
+			r.collectionName,
+		), nil
 	case diff.ActionDeleted:
-		return fmt.Sprintf(`db.getCollection("%s").remove({"%s":%v});`,
+		filter, err := shellFilter(c, c.IdentifierValue)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(`db.getCollection("%s").remove(%s);`,
 			r.collectionName,
-			c.IdentifiedBy, c.IdentifierValue,
+			filter,
 		), nil
 	case diff.ActionNoop:
 		// it's considered caller not to request commands for Noop actions
@@ -78,3 +143,20 @@ func (r *MongoShellRestorer) Build(c *diff.Change) (string, error) {
 		return "", errors.New("invalid action type")
 	}
 }
+
+// shellFilter renders the filter of the change by the given identifier value as an ExtJSON document,
+// so identifiers of any type (strings, UUIDs, documents, etc.) are written in valid syntax.
+// Composite identities are rendered as documents of their fields.
+func shellFilter(c *diff.Change, identifierValue any) (string, error) {
+	filter := identifierValue
+	if !c.IsComposite() {
+		filter = bson.D{{Key: c.IdentifiedBy, Value: identifierValue}}
+	}
+
+	marshalledFilter, err := extjson.NewCanonicalMarshaller().Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal identifier: %w", err)
+	}
+
+	return string(marshalledFilter), nil
+}
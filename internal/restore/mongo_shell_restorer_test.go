@@ -9,6 +9,7 @@ import (
 	"pho/internal/restore"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestNewMongoShellRestorer(t *testing.T) {
@@ -119,19 +120,16 @@ func TestMongoShellRestorer_Build_UpdateAction(t *testing.T) {
 				Action:          diff.ActionUpdated,
 				IdentifiedBy:    "_id",
 				IdentifierValue: "12345",
-				Data: bson.M{
-					"_id":  "12345",
-					"name": "John Doe",
-					"age":  30,
+				Data: bson.D{
+					{Key: "_id", Value: "12345"},
+					{Key: "name", Value: "John Doe"},
+					{Key: "age", Value: 30},
 				},
 			},
 			wantErr: false,
 			wantContains: []string{
-				"db.getCollection(\"users\").updateOne(",
-				"_id:12345",
-				"$set:",
-				"name",
-				"John Doe",
+				`db.getCollection("users").replaceOne({"_id":"12345"},{"_id":"12345","name":"John Doe",`,
+				`"age":{"$numberInt":"30"}});`,
 			},
 		},
 		{
@@ -151,17 +149,15 @@ func TestMongoShellRestorer_Build_UpdateAction(t *testing.T) {
 				Action:          diff.ActionUpdated,
 				IdentifiedBy:    "email",
 				IdentifierValue: "user@example.com",
-				Data: bson.M{
-					"email": "user@example.com",
-					"name":  "Jane Doe",
+				Data: bson.D{
+					{Key: "email", Value: "user@example.com"},
+					{Key: "name", Value: "Jane Doe"},
 				},
 			},
 			wantErr: false,
 			wantContains: []string{
-				"db.getCollection(\"users\").updateOne(",
-				"email:user@example.com",
-				"$set:",
-				"name",
+				`db.getCollection("users").replaceOne({"email":"user@example.com"},`,
+				`{"email":"user@example.com","name":"Jane Doe"});`,
 			},
 		},
 	}
@@ -189,26 +185,6 @@ func TestMongoShellRestorer_Build_UpdateAction(t *testing.T) {
 				}
 			}
 
-			// Ensure _id field is excluded from $set operation (it shouldn't be updated)
-			if tt.change.Data != nil {
-				if _, hasID := tt.change.Data["_id"]; hasID && tt.change.IdentifiedBy == "_id" {
-					// The original data should still have _id, but the command shouldn't include it in $set
-					lines := strings.Split(result, ":")
-					setIndex := -1
-					for i, line := range lines {
-						if strings.Contains(line, "$set") {
-							setIndex = i
-							break
-						}
-					}
-					if setIndex != -1 && setIndex+1 < len(lines) {
-						setContent := strings.Join(lines[setIndex+1:], ":")
-						if strings.Contains(setContent, "\"_id\"") || strings.Contains(setContent, "_id:") {
-							t.Error("Update command should not include _id field in $set operation")
-						}
-					}
-				}
-			}
 		})
 	}
 }
@@ -228,10 +204,10 @@ func TestMongoShellRestorer_Build_AddAction(t *testing.T) {
 				Action:          diff.ActionAdded,
 				IdentifiedBy:    "_id",
 				IdentifierValue: "12345",
-				Data: bson.M{
-					"_id":   "12345",
-					"name":  "Product A",
-					"price": 99.99,
+				Data: bson.D{
+					{Key: "_id", Value: "12345"},
+					{Key: "name", Value: "Product A"},
+					{Key: "price", Value: 99.99},
 				},
 			},
 			wantErr: false,
@@ -299,7 +275,7 @@ func TestMongoShellRestorer_Build_DeleteAction(t *testing.T) {
 			},
 			wantContains: []string{
 				"db.getCollection(\"logs\").remove(",
-				"\"_id\":12345",
+				`{"_id":"12345"}`,
 			},
 		},
 		{
@@ -311,7 +287,7 @@ func TestMongoShellRestorer_Build_DeleteAction(t *testing.T) {
 			},
 			wantContains: []string{
 				"db.getCollection(\"logs\").remove(",
-				"\"email\":user@example.com",
+				`{"email":"user@example.com"}`,
 			},
 		},
 		{
@@ -323,7 +299,7 @@ func TestMongoShellRestorer_Build_DeleteAction(t *testing.T) {
 			},
 			wantContains: []string{
 				"db.getCollection(\"logs\").remove(",
-				"\"user_id\":12345",
+				`{"user_id":{"$numberInt":"12345"}}`,
 			},
 		},
 	}
@@ -445,10 +421,10 @@ func TestMongoShellRestorer_Build_DataCloning(t *testing.T) {
 	// Test that data cloning works and doesn't mutate original
 	restorer := restore.NewMongoShellRestorer("test")
 
-	originalData := bson.M{
-		"_id":  "12345",
-		"name": "original",
-		"tags": []string{"a", "b"},
+	originalData := bson.D{
+		{Key: "_id", Value: "12345"},
+		{Key: "name", Value: "original"},
+		{Key: "tags", Value: []string{"a", "b"}},
 	}
 
 	change := &diff.Change{
@@ -465,11 +441,11 @@ func TestMongoShellRestorer_Build_DataCloning(t *testing.T) {
 	}
 
 	// Check that original data wasn't modified
-	if originalData["name"] != "original" {
+	if len(originalData) != 3 || originalData[1].Value != "original" {
 		t.Error("Original data was modified during build")
 	}
 
-	if _, exists := originalData["_id"]; !exists {
+	if originalData[0].Key != "_id" {
 		t.Error("Original data should still contain _id field")
 	}
 }
@@ -481,12 +457,12 @@ func TestMongoShellRestorer_Build_ComplexData(t *testing.T) {
 		Action:          diff.ActionAdded,
 		IdentifiedBy:    "_id",
 		IdentifierValue: "12345",
-		Data: bson.M{
-			"_id":    "12345",
-			"nested": bson.M{"field": "value"},
-			"array":  []any{1, "two", true},
-			"number": 42.5,
-			"bool":   false,
+		Data: bson.D{
+			{Key: "_id", Value: "12345"},
+			{Key: "nested", Value: bson.D{{Key: "field", Value: "value"}}},
+			{Key: "array", Value: []any{1, "two", true}},
+			{Key: "number", Value: 42.5},
+			{Key: "bool", Value: false},
 		},
 	}
 
@@ -514,7 +490,7 @@ func TestMongoShellRestorer_Build_EmptyData(t *testing.T) {
 		Action:          diff.ActionAdded,
 		IdentifiedBy:    "_id",
 		IdentifierValue: "12345",
-		Data:            bson.M{},
+		Data:            bson.D{},
 	}
 
 	result, err := restorer.Build(change)
@@ -527,3 +503,187 @@ func TestMongoShellRestorer_Build_EmptyData(t *testing.T) {
 		t.Error("Build() should generate insertOne command for empty data")
 	}
 }
+
+func TestMongoShellRestorer_Build_FieldLevelUpdate(t *testing.T) {
+	restorer := restore.NewMongoShellRestorer("users")
+
+	original := bson.D{
+		{Key: "_id", Value: "12345"},
+		{Key: "name", Value: "John"},
+		{Key: "legacy", Value: true},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}, {Key: "zip", Value: "01001"}}},
+	}
+	edited := bson.D{
+		{Key: "_id", Value: "12345"},
+		{Key: "name", Value: "John"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Lviv"}, {Key: "zip", Value: "01001"}}},
+	}
+
+	change := diff.NewChange("_id", "12345", diff.ActionUpdated, edited)
+	change.Original = original
+	change.FieldChanges = diff.CompareDocuments(original, edited)
+
+	result, err := restorer.Build(change)
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+
+	expected := `db.getCollection("users").updateOne({"_id":"12345"},` +
+		`{$set:{"address.city":"Lviv"},$unset:{"legacy":""}});`
+	if result != expected {
+		t.Errorf("Build() result = %v, want %v", result, expected)
+	}
+}
+
+func TestMongoShellRestorer_Build_FieldLevelUnsetOnly(t *testing.T) {
+	restorer := restore.NewMongoShellRestorer("users")
+
+	original := bson.D{{Key: "_id", Value: "12345"}, {Key: "name", Value: "John"}, {Key: "legacy", Value: true}}
+	edited := bson.D{{Key: "_id", Value: "12345"}, {Key: "name", Value: "John"}}
+
+	change := diff.NewChange("_id", "12345", diff.ActionUpdated, edited)
+	change.FieldChanges = diff.CompareDocuments(original, edited)
+
+	result, err := restorer.Build(change)
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+
+	if strings.Contains(result, "$set") {
+		t.Errorf("Build() result = %v, should not contain $set", result)
+	}
+	if !strings.Contains(result, `$unset:{"legacy":""}`) {
+		t.Errorf("Build() result = %v, want to contain $unset of legacy", result)
+	}
+}
+
+func TestMongoShellRestorer_Build_CompositeIdentity(t *testing.T) {
+	restorer := restore.NewMongoShellRestorer("products")
+
+	identity := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}}
+	original := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: 10}}
+	edited := bson.D{{Key: "tenant_id", Value: "acme"}, {Key: "sku", Value: "SKU-1"}, {Key: "price", Value: 12}}
+
+	change := diff.NewChange("tenant_id,sku", identity, diff.ActionUpdated, edited)
+	change.FieldChanges = diff.CompareDocuments(original, edited)
+
+	result, err := restorer.Build(change)
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+
+	expected := `db.getCollection("products").updateOne({"tenant_id":"acme","sku":"SKU-1"},` +
+		`{$set:{"price":{"$numberInt":"12"}}});`
+	if result != expected {
+		t.Errorf("Build() result = %v, want %v", result, expected)
+	}
+
+	result, err = restorer.Build(diff.NewChange("tenant_id,sku", identity, diff.ActionDeleted))
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+
+	expected = `db.getCollection("products").remove({"tenant_id":"acme","sku":"SKU-1"});`
+	if result != expected {
+		t.Errorf("Build() result = %v, want %v", result, expected)
+	}
+}
+
+func TestMongoShellRestorer_Build_RenamedAction(t *testing.T) {
+	restorer := restore.NewMongoShellRestorer("users")
+
+	change := diff.NewChange("_id", "new", diff.ActionRenamed, bson.D{
+		{Key: "_id", Value: "new"},
+		{Key: "name", Value: "Alice"},
+	})
+	change.RenamedFrom = "old"
+
+	result, err := restorer.Build(change)
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+
+	expected := `// _id::old renamed to _id::new: delete the old document, then insert the new one
+{
+  const old = db.getCollection("users").findOneAndDelete({"_id":"old"});
+  try {
+    db.getCollection("users").insertOne({"_id":"new","name":"Alice"});
+  } catch (e) {
+    db.getCollection("users").insertOne(old);
+    throw e;
+  }
+}`
+	if result != expected {
+		t.Errorf("Build() result = %v, want %v", result, expected)
+	}
+
+	if _, err := restorer.Build(diff.NewChange("_id", "new", diff.ActionRenamed)); err == nil {
+		t.Error("Build() expected error for renamed action without data")
+	}
+}
+
+func TestMongoShellRestorer_Build_IdentifierTypes(t *testing.T) {
+	restorer := restore.NewMongoShellRestorer("users")
+
+	uuid := primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{
+		0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc,
+	}}
+	decimal, err := primitive.ParseDecimal128("1.50")
+	if err != nil {
+		t.Fatalf("ParseDecimal128() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		identifier     any
+		expectedFilter string
+	}{
+		{
+			name:           "string",
+			identifier:     "user-1",
+			expectedFilter: `{"_id":"user-1"}`,
+		},
+		{
+			name:           "UUID",
+			identifier:     uuid,
+			expectedFilter: `{"_id":{"$binary":{"base64":"EjRWeBI0EjQSNBI0VniavA==","subType":"04"}}}`,
+		},
+		{
+			name:           "Decimal128",
+			identifier:     decimal,
+			expectedFilter: `{"_id":{"$numberDecimal":"1.50"}}`,
+		},
+		{
+			name:           "document",
+			identifier:     bson.D{{Key: "region", Value: "eu"}, {Key: "seq", Value: int64(7)}},
+			expectedFilter: `{"_id":{"region":"eu","seq":{"$numberLong":"7"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := diff.NewChange("_id", tt.identifier, diff.ActionUpdated, bson.D{{Key: "name", Value: "new"}})
+			updated.FieldChanges = diff.FieldChanges{
+				{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+			}
+
+			result, err := restorer.Build(updated)
+			if err != nil {
+				t.Fatalf("Build() unexpected error: %v", err)
+			}
+			expected := `db.getCollection("users").updateOne(` + tt.expectedFilter + `,{$set:{"name":"new"}});`
+			if result != expected {
+				t.Errorf("Build() result = %v, want %v", result, expected)
+			}
+
+			result, err = restorer.Build(diff.NewChange("_id", tt.identifier, diff.ActionDeleted))
+			if err != nil {
+				t.Fatalf("Build() unexpected error: %v", err)
+			}
+			expected = `db.getCollection("users").remove(` + tt.expectedFilter + `);`
+			if result != expected {
+				t.Errorf("Build() result = %v, want %v", result, expected)
+			}
+		})
+	}
+}
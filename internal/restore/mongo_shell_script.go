@@ -0,0 +1,219 @@
+package restore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pho/internal/diff"
+	"pho/pkg/extjson"
+	"strings"
+)
+
+// MongoShellScript builds a standalone mongosh script applying changes,
+// so they can be applied by someone else (e.g. a DBA) in environments pho can't reach.
+// Comparing to MongoShellRestorer, values are written in shell syntax (`ObjectId(...)`, `NumberLong(...)`),
+// filters of writes are asserted to match exactly one document, and a summary is printed at the end.
+type MongoShellScript struct {
+	dbName         string
+	collectionName string
+
+	// transaction wraps all the writes into a single transaction (it requires a replica set)
+	transaction bool
+}
+
+// ScriptOption represents an option for configuring MongoShellScript.
+type ScriptOption func(*MongoShellScript)
+
+// WithTransaction sets if all the writes of the script are done in a single transaction.
+func WithTransaction(v bool) ScriptOption { return func(s *MongoShellScript) { s.transaction = v } }
+
+func NewMongoShellScript(dbName, collectionName string, opts ...ScriptOption) *MongoShellScript {
+	s := &MongoShellScript{dbName: dbName, collectionName: collectionName}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// scriptPrelude declares the summary of the script and the assertion of writes.
+const scriptPrelude = `const phoSummary = { updated: 0, added: 0, deleted: 0, renamed: 0 };
+
+// phoAssertOne stops the script unless exactly one document is matched.
+// Filters are counted before writes, as updateOne and deleteOne never match more than one document
+function phoAssertOne(count, what) {
+  if (count !== 1) {
+    throw new Error(what + ": expected to match exactly 1 document, matched " + count);
+  }
+}
+`
+
+// scriptSummary prints the summary of the script.
+const scriptSummary = `print("pho: " + phoSummary.updated + " updated, " + phoSummary.added + " added, " +
+  phoSummary.deleted + " deleted, " + phoSummary.renamed + " renamed");
+`
+
+// Build builds the script applying the given changes (noop ones are skipped).
+func (s *MongoShellScript) Build(changes diff.Changes) (string, error) {
+	if s.dbName == "" || s.collectionName == "" {
+		return "", errors.New("db and collection names are required")
+	}
+
+	var body strings.Builder
+	for _, ch := range changes.EffectiveOnes() {
+		statements, err := s.buildStatements(ch)
+		if err != nil {
+			return "", fmt.Errorf("could not build script of %s: %w", ch.Identifier(), err)
+		}
+
+		body.WriteString("\n  // " + ch.Action.String() + " " + scriptComment(ch.Identifier()) + "\n")
+		for _, statement := range statements {
+			body.WriteString("  " + statement + "\n")
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Applies %d change(s) to %s.%s\n", changes.EffectiveOnes().Len(),
+		scriptComment(s.dbName), scriptComment(s.collectionName))
+	sb.WriteString("// Run it via: mongosh <connection string> <this file>\n")
+	if s.transaction {
+		sb.WriteString("// All the writes are done in a single transaction: nothing is written if any of them fails\n")
+	} else {
+		sb.WriteString("// Writes are not transactional: ones done before a failure stay applied\n")
+	}
+	fmt.Fprintf(&sb, "\ndb = db.getSiblingDB(%s); // use %s\n\n", jsString(s.dbName), scriptComment(s.dbName))
+	sb.WriteString(scriptPrelude)
+	sb.WriteString("\nfunction phoApply(coll) {\n  let res;\n")
+	sb.WriteString(body.String())
+	sb.WriteString("}\n\n")
+
+	if s.transaction {
+		fmt.Fprintf(&sb, `const phoSession = db.getMongo().startSession();
+phoSession.startTransaction();
+try {
+  phoApply(phoSession.getDatabase(%s).getCollection(%s));
+  phoSession.commitTransaction();
+} catch (e) {
+  phoSession.abortTransaction();
+  throw e;
+} finally {
+  phoSession.endSession();
+}
+`, jsString(s.dbName), jsString(s.collectionName))
+	} else {
+		fmt.Fprintf(&sb, "phoApply(db.getCollection(%s));\n", jsString(s.collectionName))
+	}
+
+	sb.WriteString("\n" + scriptSummary)
+
+	return sb.String(), nil
+}
+
+// buildStatements builds statements of the script applying the given change.
+func (s *MongoShellScript) buildStatements(c *diff.Change) ([]string, error) {
+	marshaller := extjson.NewShellMarshaller().WithCompact(true)
+	what := func(action string, identifier string) string { return jsString(action + " of " + identifier) }
+
+	switch c.Action {
+	case diff.ActionUpdated:
+		if c.Data == nil {
+			return nil, errors.New("updated action requires a doc")
+		}
+
+		filter, err := marshaller.Marshal(c.Filter())
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal filter: %w", err)
+		}
+
+		write, doc := "updateOne", buildUpdateDocument(c)
+		if isReplacement(c) {
+			write, doc = "replaceOne", c.Data
+		}
+		update, err := marshaller.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal update: %w", err)
+		}
+
+		return []string{
+			fmt.Sprintf("phoAssertOne(coll.countDocuments(%s), %s);", filter, what("update", c.Identifier())),
+			fmt.Sprintf("res = coll.%s(%s, %s);", write, filter, update),
+			fmt.Sprintf("phoAssertOne(res.matchedCount, %s);", what("update", c.Identifier())),
+			"phoSummary.updated++;",
+		}, nil
+	case diff.ActionAdded:
+		if c.Data == nil {
+			return nil, errors.New("added action requires a doc")
+		}
+
+		doc, err := marshaller.Marshal(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal doc: %w", err)
+		}
+
+		return []string{
+			fmt.Sprintf("coll.insertOne(%s);", doc),
+			"phoSummary.added++;",
+		}, nil
+	case diff.ActionDeleted:
+		filter, err := marshaller.Marshal(c.Filter())
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal filter: %w", err)
+		}
+
+		return []string{
+			fmt.Sprintf("phoAssertOne(coll.countDocuments(%s), %s);", filter, what("delete", c.Identifier())),
+			fmt.Sprintf("res = coll.deleteOne(%s);", filter),
+			fmt.Sprintf("phoAssertOne(res.deletedCount, %s);", what("delete", c.Identifier())),
+			"phoSummary.deleted++;",
+		}, nil
+	case diff.ActionRenamed:
+		if c.Data == nil {
+			return nil, errors.New("renamed action requires a doc")
+		}
+
+		doc, err := marshaller.Marshal(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal doc: %w", err)
+		}
+		filter, err := marshaller.Marshal(c.RenamedFromFilter())
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal filter: %w", err)
+		}
+
+		// The old document is deleted first, so both don't clash on unique indexes of other fields.
+		// If the insert fails, the transaction is aborted, otherwise the old document is put back
+		statements := []string{
+			fmt.Sprintf("phoAssertOne(coll.countDocuments(%s), %s);",
+				filter, what("delete", c.RenamedFromIdentifier())),
+			fmt.Sprintf("res = coll.findOneAndDelete(%s);", filter),
+			fmt.Sprintf("phoAssertOne(res === null ? 0 : 1, %s);", what("delete", c.RenamedFromIdentifier())),
+		}
+		if s.transaction {
+			statements = append(statements, fmt.Sprintf("coll.insertOne(%s);", doc))
+		} else {
+			statements = append(statements,
+				"try {",
+				fmt.Sprintf("  coll.insertOne(%s);", doc),
+				"} catch (e) {",
+				"  coll.insertOne(res);",
+				"  throw e;",
+				"}",
+			)
+		}
+
+		return append(statements, "phoSummary.renamed++;"), nil
+	default:
+		return nil, errors.New("invalid action type")
+	}
+}
+
+// jsString returns the JavaScript string literal of the given string.
+func jsString(s string) string {
+	// JSON strings are valid JavaScript strings (line separators are escaped as well)
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// scriptComment makes the given string safe to be written in a single-line comment.
+func scriptComment(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,178 @@
+package restore_test
+
+import (
+	"strings"
+	"testing"
+
+	"pho/internal/diff"
+	"pho/internal/restore"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMongoShellScript_Build(t *testing.T) {
+	updated := diff.NewChange("_id", int64(1), diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: int64(1)},
+		{Key: "name", Value: "new"},
+	})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+		{Path: "legacy", Action: diff.FieldRemoved, Before: true},
+	}
+
+	renamed := diff.NewChange("_id", "b", diff.ActionRenamed, bson.D{{Key: "_id", Value: "b"}})
+	renamed.RenamedFrom = "a"
+
+	changes := diff.Changes{
+		updated,
+		diff.NewChange("_id", "new", diff.ActionAdded, bson.D{{Key: "_id", Value: "new"}}),
+		diff.NewChange("_id", "gone", diff.ActionDeleted),
+		renamed,
+		diff.NewChange("_id", "same", diff.ActionNoop),
+	}
+
+	script, err := restore.NewMongoShellScript("shop", "users").Build(changes)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	expected := `// Applies 4 change(s) to shop.users
+// Run it via: mongosh <connection string> <this file>
+// Writes are not transactional: ones done before a failure stay applied
+
+db = db.getSiblingDB("shop"); // use shop
+
+const phoSummary = { updated: 0, added: 0, deleted: 0, renamed: 0 };
+
+// phoAssertOne stops the script unless exactly one document is matched.
+// Filters are counted before writes, as updateOne and deleteOne never match more than one document
+function phoAssertOne(count, what) {
+  if (count !== 1) {
+    throw new Error(what + ": expected to match exactly 1 document, matched " + count);
+  }
+}
+
+function phoApply(coll) {
+  let res;
+
+  // UPDATED _id::NumberLong("1")
+  phoAssertOne(coll.countDocuments({"_id":NumberLong("1")}), "update of _id::NumberLong(\"1\")");
+  res = coll.updateOne({"_id":NumberLong("1")}, {"$set":{"name":"new"},"$unset":{"legacy":""}});
+  phoAssertOne(res.matchedCount, "update of _id::NumberLong(\"1\")");
+  phoSummary.updated++;
+
+  // ADDED _id::new
+  coll.insertOne({"_id":"new"});
+  phoSummary.added++;
+
+  // DELETED _id::gone
+  phoAssertOne(coll.countDocuments({"_id":"gone"}), "delete of _id::gone");
+  res = coll.deleteOne({"_id":"gone"});
+  phoAssertOne(res.deletedCount, "delete of _id::gone");
+  phoSummary.deleted++;
+
+  // RENAMED _id::b
+  phoAssertOne(coll.countDocuments({"_id":"a"}), "delete of _id::a");
+  res = coll.findOneAndDelete({"_id":"a"});
+  phoAssertOne(res === null ? 0 : 1, "delete of _id::a");
+  try {
+    coll.insertOne({"_id":"b"});
+  } catch (e) {
+    coll.insertOne(res);
+    throw e;
+  }
+  phoSummary.renamed++;
+}
+
+phoApply(db.getCollection("users"));
+
+print("pho: " + phoSummary.updated + " updated, " + phoSummary.added + " added, " +
+  phoSummary.deleted + " deleted, " + phoSummary.renamed + " renamed");
+`
+	if script != expected {
+		t.Errorf("Build() result =\n%s\nwant\n%s", script, expected)
+	}
+}
+
+func TestMongoShellScript_Build_Transaction(t *testing.T) {
+	renamed := diff.NewChange("_id", "b", diff.ActionRenamed, bson.D{{Key: "_id", Value: "b"}})
+	renamed.RenamedFrom = "a"
+	changes := diff.Changes{diff.NewChange("_id", "gone", diff.ActionDeleted), renamed}
+
+	script, err := restore.NewMongoShellScript("shop", "users", restore.WithTransaction(true)).Build(changes)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"phoSession.startTransaction();",
+		`phoApply(phoSession.getDatabase("shop").getCollection("users"));`,
+		"phoSession.commitTransaction();",
+		"phoSession.abortTransaction();",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Build() result doesn't contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, `phoApply(db.getCollection("users"));`) {
+		t.Errorf("Build() result applies changes outside of the transaction:\n%s", script)
+	}
+	// Failed inserts of renamed documents abort the transaction, so old documents are not put back
+	if !strings.Contains(script, "  coll.insertOne({\"_id\":\"b\"});\n  phoSummary.renamed++;") ||
+		strings.Contains(script, "coll.insertOne(res);") {
+		t.Errorf("Build() result puts renamed documents back within the transaction:\n%s", script)
+	}
+}
+
+func TestMongoShellScript_Build_Errors(t *testing.T) {
+	if _, err := restore.NewMongoShellScript("", "users").Build(nil); err == nil {
+		t.Error("Build() without db name expected error")
+	}
+
+	changes := diff.Changes{diff.NewChange("_id", "x", diff.ActionUpdated)}
+	if _, err := restore.NewMongoShellScript("shop", "users").Build(changes); err == nil {
+		t.Error("Build() of update without doc expected error")
+	}
+}
+
+func TestMongoShellScript_Build_IdentifierTypes(t *testing.T) {
+	uuid := primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{
+		0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc,
+	}}
+	updated := diff.NewChange("_id", uuid, diff.ActionUpdated, bson.D{
+		{Key: "_id", Value: uuid},
+		{Key: "name", Value: "new"},
+	})
+	updated.FieldChanges = diff.FieldChanges{
+		{Path: "name", Action: diff.FieldModified, Before: "old", After: "new"},
+	}
+	decimal, err := primitive.ParseDecimal128("1.50")
+	if err != nil {
+		t.Fatalf("ParseDecimal128() error = %v", err)
+	}
+
+	replaced := diff.NewChange("_id", int32(2), diff.ActionUpdated, bson.D{{Key: "_id", Value: int32(2)}})
+	changes := diff.Changes{
+		updated,
+		replaced,
+		diff.NewChange("_id", decimal, diff.ActionDeleted),
+		diff.NewChange("_id", bson.D{{Key: "region", Value: "eu"}, {Key: "seq", Value: int32(7)}}, diff.ActionDeleted),
+	}
+
+	script, err := restore.NewMongoShellScript("shop", "users").Build(changes)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`res = coll.updateOne({"_id":BinData(4, "EjRWeBI0EjQSNBI0VniavA==")}, {"$set":{"name":"new"}});`,
+		`res = coll.replaceOne({"_id":NumberInt("2")}, {"_id":NumberInt("2")});`,
+		`res = coll.deleteOne({"_id":NumberDecimal("1.50")});`,
+		`res = coll.deleteOne({"_id":{"region":"eu","seq":NumberInt("7")}});`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Build() result doesn't contain %q:\n%s", want, script)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+// Package bsoncsv provides marshalling/unmarshalling of flat BSON documents as CSV/TSV tables.
+// Each row is a document, each column is a (dot-notated for nested documents) field.
+// Types are declared in the header row, so values are read back into the same BSON types:
+//
+//	_id:oid,name:string,price:double,stock.count:int,updated:date
+//	507f1f77bcf86cd799439011,Pen,1.5,10,2025-01-11T14:30:00.000Z
+//
+// Supported column types are string, int, long, double, bool, decimal, oid, date and json.
+// Columns with values of mixed (or non-scalar) types are declared as json: every cell there is an ExtJSON value.
+// Empty cell means the field is absent in the document (for string columns it is an empty string).
+// Column without a declared type is considered to be a string one.
+package bsoncsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Separators of supported table formats.
+const (
+	Comma = ','
+	Tab   = '\t'
+)
+
+// Column types declared in the header row.
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeLong     = "long"
+	TypeDouble   = "double"
+	TypeBool     = "bool"
+	TypeDecimal  = "decimal"
+	TypeObjectID = "oid"
+	TypeDate     = "date"
+	TypeJSON     = "json"
+)
+
+const (
+	pathSeparator = "."
+	typeSeparator = ":"
+	nullValue     = "null"
+	dateLayout    = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// Columns returns columns of the table for the given documents.
+// Preferred columns (e.g. fields of a projection) go first (after _id),
+// then the rest of fields in order of their appearance in documents.
+// Nested documents are flattened into dot-notated columns.
+func Columns(docs []bson.D, preferred []string) []string {
+	var paths []string
+	for _, doc := range docs {
+		paths = collectPaths(doc, "", paths)
+	}
+
+	// Field that is a document in one row and a scalar in another one is kept as a whole (json) column
+	pathSet := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		pathSet[path] = struct{}{}
+	}
+	paths = slices.DeleteFunc(paths, func(path string) bool {
+		for parent := parentPath(path); parent != ""; parent = parentPath(parent) {
+			if _, ok := pathSet[parent]; ok {
+				return true
+			}
+		}
+		return false
+	})
+
+	columns := make([]string, 0, len(paths)+len(preferred)+1)
+	covered := func(path string) bool {
+		return slices.ContainsFunc(columns, func(column string) bool {
+			return path == column || strings.HasPrefix(path, column+pathSeparator)
+		})
+	}
+
+	if slices.Contains(paths, "_id") {
+		columns = append(columns, "_id")
+	}
+	for _, column := range preferred {
+		if !covered(column) {
+			columns = append(columns, column)
+		}
+	}
+
+	rest := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !covered(path) {
+			rest = append(rest, path)
+		}
+	}
+
+	return append(columns, rest...)
+}
+
+// collectPaths adds dot-notated paths of leaf values of the document, that are not collected yet.
+// New nested paths are placed next to the already collected ones of the same parent.
+func collectPaths(doc bson.D, prefix string, paths []string) []string {
+	for _, e := range doc {
+		path := prefix + e.Key
+		if nested, ok := asDocument(e.Value); ok && len(nested) > 0 {
+			paths = collectPaths(nested, path+pathSeparator, paths)
+			continue
+		}
+		if slices.Contains(paths, path) {
+			continue
+		}
+
+		i := len(paths)
+		for parent := parentPath(path); parent != ""; parent = parentPath(parent) {
+			if j := lastIndexWithPrefix(paths, parent+pathSeparator); j >= 0 {
+				i = j + 1
+				break
+			}
+		}
+		paths = slices.Insert(paths, i, path)
+	}
+
+	return paths
+}
+
+// lastIndexWithPrefix returns the index of the last path with the given prefix (or -1).
+func lastIndexWithPrefix(paths []string, prefix string) int {
+	for i := len(paths) - 1; i >= 0; i-- {
+		if strings.HasPrefix(paths[i], prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parentPath returns the path of the parent field ("" for top-level fields).
+func parentPath(path string) string {
+	i := strings.LastIndex(path, pathSeparator)
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// asDocument returns the value as bson.D if it's a document (maps are turned into documents with sorted keys).
+func asDocument(v any) (bson.D, bool) {
+	switch doc := v.(type) {
+	case bson.D:
+		return doc, true
+	case bson.M:
+		keys := slices.Sorted(maps.Keys(doc))
+		d := make(bson.D, len(keys))
+		for i, key := range keys {
+			d[i] = bson.E{Key: key, Value: doc[key]}
+		}
+		return d, true
+	default:
+		return nil, false
+	}
+}
+
+// lookup returns the value of the dot-notated field.
+func lookup(doc bson.D, path string) (any, bool) {
+	key, rest, nested := strings.Cut(path, pathSeparator)
+	i := slices.IndexFunc(doc, func(e bson.E) bool { return e.Key == key })
+	if i < 0 {
+		return nil, false
+	}
+	if !nested {
+		return doc[i].Value, true
+	}
+
+	sub, ok := asDocument(doc[i].Value)
+	if !ok {
+		return nil, false
+	}
+	return lookup(sub, rest)
+}
+
+// Marshal renders documents as a table with the given columns.
+func Marshal(docs []bson.D, columns []string, comma rune) ([]byte, error) {
+	types := make([]string, len(columns))
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		types[i] = columnType(docs, column)
+		header[i] = column + typeSeparator + types[i]
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for i, doc := range docs {
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			value, ok := lookup(doc, column)
+			if !ok {
+				continue
+			}
+
+			cell, err := formatCell(value, types[j])
+			if err != nil {
+				return nil, fmt.Errorf("row [%d] column %s: %w", i, column, err)
+			}
+			row[j] = cell
+		}
+
+		if err := writer.Write(row); err != nil {
+			return nil, fmt.Errorf("failed to write row [%d]: %w", i, err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write table: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// valueType returns the column type of the value (json for values with no plain representation).
+func valueType(v any) string {
+	switch v.(type) {
+	case string:
+		return TypeString
+	case int32:
+		return TypeInt
+	case int64:
+		return TypeLong
+	case float64:
+		return TypeDouble
+	case bool:
+		return TypeBool
+	case primitive.Decimal128:
+		return TypeDecimal
+	case primitive.ObjectID:
+		return TypeObjectID
+	case primitive.DateTime:
+		return TypeDate
+	default:
+		return TypeJSON
+	}
+}
+
+// columnType returns the type all values of the column have.
+// Null and absent values are allowed in typed columns, except string ones, as it would be ambiguous there.
+func columnType(docs []bson.D, column string) string {
+	typ := ""
+	hasNull, hasAbsent := false, false
+	for _, doc := range docs {
+		value, ok := lookup(doc, column)
+		switch {
+		case !ok:
+			hasAbsent = true
+		case value == nil:
+			hasNull = true
+		case typ == "":
+			typ = valueType(value)
+		case typ != valueType(value):
+			return TypeJSON
+		}
+	}
+
+	if typ == "" || (typ == TypeString && (hasNull || hasAbsent)) {
+		return TypeJSON
+	}
+
+	return typ
+}
+
+// formatCell renders the value as a cell of the column of the given type.
+func formatCell(v any, typ string) (string, error) {
+	if v == nil && typ != TypeJSON {
+		return nullValue, nil
+	}
+
+	switch typ {
+	case TypeString:
+		return v.(string), nil
+	case TypeInt:
+		return strconv.FormatInt(int64(v.(int32)), 10), nil
+	case TypeLong:
+		return strconv.FormatInt(v.(int64), 10), nil
+	case TypeDouble:
+		return strconv.FormatFloat(v.(float64), 'g', -1, 64), nil
+	case TypeBool:
+		return strconv.FormatBool(v.(bool)), nil
+	case TypeDecimal:
+		return v.(primitive.Decimal128).String(), nil
+	case TypeObjectID:
+		return v.(primitive.ObjectID).Hex(), nil
+	case TypeDate:
+		return v.(primitive.DateTime).Time().UTC().Format(dateLayout), nil
+	default:
+		b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, true, false)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal value: %w", err)
+		}
+		// Value is taken out of the wrapping document: {"v":...}
+		return string(b[len(`{"v":`) : len(b)-1]), nil
+	}
+}
+
+// Unmarshal parses the table into documents.
+func Unmarshal(data []byte, comma rune) ([]bson.D, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.LazyQuotes = true // quotes in unquoted cells are kept, as edited JSON cells are often not re-quoted
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("header row is missing")
+	}
+
+	columns := make([]string, len(records[0]))
+	types := make([]string, len(records[0]))
+	for i, cell := range records[0] {
+		columns[i], types[i] = parseHeaderCell(cell)
+		if columns[i] == "" {
+			return nil, fmt.Errorf("column [%d] has no name", i)
+		}
+	}
+
+	docs := make([]bson.D, 0, len(records)-1)
+	for i, record := range records[1:] {
+		doc := bson.D{}
+		for j, cell := range record {
+			if cell == "" && types[j] != TypeString {
+				continue
+			}
+
+			value, err := parseCell(cell, types[j])
+			if err != nil {
+				return nil, fmt.Errorf("row [%d] column %s: invalid %s value %q: %w",
+					i, columns[j], types[j], cell, err)
+			}
+			if doc, err = setPath(doc, columns[j], value); err != nil {
+				return nil, fmt.Errorf("row [%d] column %s: %w", i, columns[j], err)
+			}
+		}
+
+		// Row with no values is not a document
+		if len(doc) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// parseHeaderCell parses `name:type` header cell.
+func parseHeaderCell(cell string) (string, string) {
+	cell = strings.TrimSpace(cell)
+	i := strings.LastIndex(cell, typeSeparator)
+	if i < 0 {
+		return cell, TypeString
+	}
+	return cell[:i], cell[i+1:]
+}
+
+// parseCell parses the cell of the column of the given type.
+func parseCell(cell, typ string) (any, error) {
+	if cell == nullValue && typ != TypeString && typ != TypeJSON {
+		return nil, nil
+	}
+
+	switch typ {
+	case TypeString:
+		return cell, nil
+	case TypeInt:
+		i, err := strconv.ParseInt(cell, 10, 32)
+		return int32(i), err
+	case TypeLong:
+		return strconv.ParseInt(cell, 10, 64)
+	case TypeDouble:
+		return strconv.ParseFloat(cell, 64)
+	case TypeBool:
+		return strconv.ParseBool(cell)
+	case TypeDecimal:
+		return primitive.ParseDecimal128(cell)
+	case TypeObjectID:
+		return primitive.ObjectIDFromHex(cell)
+	case TypeDate:
+		t, err := time.Parse(time.RFC3339Nano, cell)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	case TypeJSON:
+		var wrapper struct {
+			V any `bson:"v"`
+		}
+		if err := bson.UnmarshalExtJSON([]byte(`{"v":`+cell+`}`), false, &wrapper); err != nil {
+			return nil, err
+		}
+		return wrapper.V, nil
+	default:
+		return nil, fmt.Errorf("unknown column type %s", typ)
+	}
+}
+
+// setPath sets the value of the dot-notated field, creating intermediate documents.
+func setPath(doc bson.D, path string, value any) (bson.D, error) {
+	key, rest, nested := strings.Cut(path, pathSeparator)
+	i := slices.IndexFunc(doc, func(e bson.E) bool { return e.Key == key })
+	if !nested {
+		if i >= 0 {
+			return nil, fmt.Errorf("field %s is set twice", key)
+		}
+		return append(doc, bson.E{Key: key, Value: value}), nil
+	}
+
+	sub := bson.D{}
+	if i >= 0 {
+		var ok bool
+		if sub, ok = doc[i].Value.(bson.D); !ok {
+			return nil, fmt.Errorf("field %s is not a document", key)
+		}
+	}
+
+	sub, err := setPath(sub, rest, value)
+	if err != nil {
+		return nil, err
+	}
+	if i >= 0 {
+		doc[i].Value = sub
+	} else {
+		doc = append(doc, bson.E{Key: key, Value: sub})
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,239 @@
+package bsoncsv_test
+
+import (
+	"pho/pkg/bsoncsv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name      string
+		docs      []bson.D
+		preferred []string
+		expected  []string
+	}{
+		{
+			name: "union of fields, _id first",
+			docs: []bson.D{
+				{{Key: "_id", Value: 1}, {Key: "name", Value: "a"}},
+				{{Key: "_id", Value: 2}, {Key: "price", Value: 1.5}},
+			},
+			expected: []string{"_id", "name", "price"},
+		},
+		{
+			name: "nested documents are flattened",
+			docs: []bson.D{
+				{
+					{Key: "_id", Value: 1},
+					{Key: "stock", Value: bson.D{
+						{Key: "count", Value: 1},
+						{Key: "warehouse", Value: bson.D{{Key: "city", Value: "x"}}},
+					}},
+				},
+			},
+			expected: []string{"_id", "stock.count", "stock.warehouse.city"},
+		},
+		{
+			name: "field that is not always a document is kept as a whole",
+			docs: []bson.D{
+				{{Key: "_id", Value: 1}, {Key: "meta", Value: bson.D{{Key: "a", Value: 1}}}},
+				{{Key: "_id", Value: 2}, {Key: "meta", Value: "none"}},
+			},
+			expected: []string{"_id", "meta"},
+		},
+		{
+			name: "preferred columns go first",
+			docs: []bson.D{
+				{
+					{Key: "_id", Value: 1},
+					{Key: "name", Value: "a"},
+					{Key: "price", Value: 1.5},
+					{Key: "stock", Value: bson.D{{Key: "count", Value: 1}}},
+				},
+			},
+			preferred: []string{"price", "stock"},
+			expected:  []string{"_id", "price", "stock", "name"},
+		},
+		{
+			name: "fields keep order of documents",
+			docs: []bson.D{
+				{{Key: "_id", Value: 1}, {Key: "zeta", Value: 1}, {Key: "alpha", Value: 2}},
+				{{Key: "beta", Value: 1}, {Key: "_id", Value: 2}},
+			},
+			expected: []string{"_id", "zeta", "alpha", "beta"},
+		},
+		{
+			name: "new nested fields are placed next to their siblings",
+			docs: []bson.D{
+				{
+					{Key: "_id", Value: 1},
+					{Key: "stock", Value: bson.D{{Key: "count", Value: 1}}},
+					{Key: "name", Value: "a"},
+				},
+				{{Key: "_id", Value: 2}, {Key: "stock", Value: bson.D{{Key: "city", Value: "x"}}}},
+			},
+			expected: []string{"_id", "stock.count", "stock.city", "name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, bsoncsv.Columns(tt.docs, tt.preferred))
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	updated := primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 0, time.UTC))
+
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: oid},
+			{Key: "name", Value: "Pen, blue"},
+			{Key: "price", Value: 1.5},
+			{Key: "stock", Value: bson.D{{Key: "count", Value: int32(10)}}},
+			{Key: "updated", Value: updated},
+		},
+		{
+			{Key: "_id", Value: oid},
+			{Key: "name", Value: ""},
+			{Key: "price", Value: nil},
+			{Key: "stock", Value: bson.D{{Key: "count", Value: int32(0)}}},
+			{Key: "tags", Value: bson.A{"a"}},
+		},
+	}
+	columns := []string{"_id", "name", "price", "stock.count", "tags", "updated"}
+
+	result, err := bsoncsv.Marshal(docs, columns, bsoncsv.Comma)
+	require.NoError(t, err)
+
+	expected := "_id:oid,name:string,price:double,stock.count:int,tags:json,updated:date\n" +
+		`507f1f77bcf86cd799439011,"Pen, blue",1.5,10,,2025-01-11T14:30:00.000Z` + "\n" +
+		`507f1f77bcf86cd799439011,,null,0,"[""a""]",` + "\n"
+	assert.Equal(t, expected, string(result))
+}
+
+func TestMarshal_columnTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		docs     []bson.D
+		expected string
+	}{
+		{
+			name:     "mixed types",
+			docs:     []bson.D{{{Key: "v", Value: int32(1)}}, {{Key: "v", Value: true}}},
+			expected: "v:json\n\"{\"\"$numberInt\"\":\"\"1\"\"}\"\ntrue\n",
+		},
+		{name: "sparse strings", docs: []bson.D{{{Key: "v", Value: "a"}}, {}}, expected: "v:json\n\"\"\"a\"\"\"\n\n"},
+		{name: "sparse numbers", docs: []bson.D{{{Key: "v", Value: int64(1)}}, {}}, expected: "v:long\n1\n\n"},
+		{name: "nulls only", docs: []bson.D{{{Key: "v", Value: nil}}}, expected: "v:json\nnull\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := bsoncsv.Marshal(tt.docs, []string{"v"}, bsoncsv.Comma)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	decimal, err := primitive.ParseDecimal128("9.99")
+	require.NoError(t, err)
+
+	input := "_id:oid\tprice:decimal\tactive:bool\tstock.count:long\tstock.city\tnote:json\n" +
+		"507f1f77bcf86cd799439011\t9.99\ttrue\t3\tBerlin\t{\"$numberInt\":\"1\"}\n" +
+		"\tnull\t\t\t\t\n" +
+		"\t\t\t\t\t\n"
+
+	docs, err := bsoncsv.Unmarshal([]byte(input), bsoncsv.Tab)
+	require.NoError(t, err)
+
+	expected := []bson.D{
+		{
+			{Key: "_id", Value: oid},
+			{Key: "price", Value: decimal},
+			{Key: "active", Value: true},
+			{Key: "stock", Value: bson.D{{Key: "count", Value: int64(3)}, {Key: "city", Value: "Berlin"}}},
+			{Key: "note", Value: int32(1)},
+		},
+		// Untyped (string) column keeps empty strings
+		{{Key: "price", Value: nil}, {Key: "stock", Value: bson.D{{Key: "city", Value: ""}}}},
+		{{Key: "stock", Value: bson.D{{Key: "city", Value: ""}}}},
+	}
+	assert.Equal(t, expected, docs)
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "unknown type", input: "a:foo\n1\n"},
+		{name: "invalid int", input: "a:int\nx\n"},
+		{name: "int out of range", input: "a:int\n3000000000\n"},
+		{name: "invalid oid", input: "a:oid\nxyz\n"},
+		{name: "invalid json", input: "a:json\n{\n"},
+		{name: "wrong number of cells", input: "a:int,b:int\n1\n"},
+		{name: "field is both a value and a document", input: "a:int,a.b:int\n1,2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bsoncsv.Unmarshal([]byte(tt.input), bsoncsv.Comma)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	decimal, err := primitive.ParseDecimal128("-0.001")
+	require.NoError(t, err)
+
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "multi\nline \"quoted\""},
+			{Key: "count", Value: int32(-1)},
+			{Key: "big", Value: int64(1) << 40},
+			{Key: "ratio", Value: 0.1},
+			{Key: "price", Value: decimal},
+			{Key: "active", Value: false},
+			{Key: "created", Value: primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 123e6, time.UTC))},
+			{Key: "nested", Value: bson.D{
+				{Key: "tags", Value: bson.A{"a", int32(1)}},
+				{Key: "empty", Value: bson.D{}},
+			}},
+			{Key: "mixed", Value: "text"},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "null"},
+			{Key: "count", Value: nil},
+			{Key: "ratio", Value: 2.0},
+			{Key: "nested", Value: bson.D{{Key: "bin", Value: primitive.Binary{Subtype: 5, Data: []byte{1}}}}},
+			{Key: "mixed", Value: int64(5)},
+		},
+	}
+
+	for _, comma := range []rune{bsoncsv.Comma, bsoncsv.Tab} {
+		b, err := bsoncsv.Marshal(docs, bsoncsv.Columns(docs, nil), comma)
+		require.NoError(t, err)
+
+		result, err := bsoncsv.Unmarshal(b, comma)
+		require.NoError(t, err)
+		assert.Equal(t, docs, result)
+	}
+}
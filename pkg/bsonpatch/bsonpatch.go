@@ -0,0 +1,387 @@
+// Package bsonpatch applies JSON Patch (RFC 6902) and JSON Merge Patch (RFC 7396) to BSON values.
+// Objects are ordered documents (bson.D) and arrays are bson.A, any other value is a scalar one.
+// Patched values are never modified in place: changed documents and arrays are copied.
+//
+// Locations are JSON Pointers (RFC 6901), e.g. `/address/city` or `/tags/0`.
+package bsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operations of JSON Patch.
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+// ErrTestFailed is returned when the value of a `test` operation doesn't match.
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation is a single operation of JSON Patch.
+type Operation struct {
+	Op   string
+	Path string
+
+	// From is the source location of `move` and `copy` operations
+	From string
+
+	// Value is the value of `add`, `replace` and `test` operations
+	Value any
+}
+
+// Apply applies operations one by one to the given value and returns the patched value.
+// Operations are atomic as a whole: on error the given value is left untouched.
+func Apply(doc any, ops []Operation) (any, error) {
+	var err error
+	for i, op := range ops {
+		if doc, err = ApplyOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("operation [%d] %s %s: %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// ApplyOperation applies a single operation to the given value and returns the patched value.
+func ApplyOperation(doc any, op Operation) (any, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case OpAdd:
+		return add(doc, path, op.Value)
+	case OpRemove:
+		return remove(doc, path)
+	case OpReplace:
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+
+		// Fields of documents are replaced in place by `add`, while array elements are inserted
+		if len(path) > 0 {
+			if parent, _ := get(doc, path[:len(path)-1]); isArray(parent) {
+				if doc, err = remove(doc, path); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return add(doc, path, op.Value)
+	case OpMove, OpCopy:
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == OpMove {
+			if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+				return nil, errors.New("value can't be moved into one of its children")
+			}
+			if doc, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		}
+		return add(doc, path, value)
+	case OpTest:
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(value, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// Get returns the value at the given location.
+func Get(doc any, pointer string) (any, error) {
+	path, err := ParsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	return get(doc, path)
+}
+
+// MergePatch applies JSON Merge Patch to the target value and returns the patched value:
+// fields of patch documents are merged recursively, null fields are removed, any other value replaces the target.
+func MergePatch(target, patch any) any {
+	patchDoc, ok := patch.(bson.D)
+	if !ok {
+		return patch
+	}
+
+	targetDoc, ok := target.(bson.D)
+	if !ok {
+		targetDoc = bson.D{}
+	}
+
+	result := slices.Clone(targetDoc)
+	for _, e := range patchDoc {
+		i := slices.IndexFunc(result, func(f bson.E) bool { return f.Key == e.Key })
+		switch {
+		case e.Value == nil:
+			if i >= 0 {
+				result = slices.Delete(result, i, i+1)
+			}
+		case i >= 0:
+			result[i].Value = MergePatch(result[i].Value, e.Value)
+		default:
+			result = append(result, bson.E{Key: e.Key, Value: MergePatch(nil, e.Value)})
+		}
+	}
+
+	return result
+}
+
+// Pointer builds JSON Pointer of the given reference tokens (e.g. field names), escaping them.
+func Pointer(tokens ...string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return sb.String()
+}
+
+// ParsePointer splits JSON Pointer into unescaped reference tokens (no tokens for the whole document).
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q: must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// Equal reports if the values are equal as JSON values:
+// documents are equal regardless of the order of their fields, numbers are compared by their values.
+func Equal(a, b any) bool {
+	switch a := a.(type) {
+	case bson.D:
+		b, ok := b.(bson.D)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for _, e := range a {
+			value, ok := lookup(b, e.Key)
+			if !ok || !Equal(e.Value, value) {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		b, ok := b.(bson.A)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !Equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// get returns the value at the given path.
+func get(doc any, path []string) (any, error) {
+	for i, token := range path {
+		switch container := doc.(type) {
+		case bson.D:
+			value, ok := lookup(container, token)
+			if !ok {
+				return nil, fmt.Errorf("path %s doesn't exist", Pointer(path[:i+1]...))
+			}
+			doc = value
+		case bson.A:
+			idx, err := index(token, len(container)-1)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %w", Pointer(path[:i+1]...), err)
+			}
+			doc = container[idx]
+		default:
+			return nil, fmt.Errorf("path %s doesn't exist", Pointer(path[:i+1]...))
+		}
+	}
+
+	return doc, nil
+}
+
+// add sets the value at the given path: existing fields are replaced, array elements are inserted.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch container := doc.(type) {
+	case bson.D:
+		i := slices.IndexFunc(container, func(e bson.E) bool { return e.Key == token })
+		if i < 0 {
+			if len(rest) > 0 {
+				return nil, fmt.Errorf("parent of %s doesn't exist", Pointer(path...))
+			}
+			return append(slices.Clone(container), bson.E{Key: token, Value: value}), nil
+		}
+
+		child, err := add(container[i].Value, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		result := slices.Clone(container)
+		result[i].Value = child
+		return result, nil
+	case bson.A:
+		if len(rest) == 0 {
+			idx := len(container)
+			if token != "-" {
+				var err error
+				if idx, err = index(token, len(container)); err != nil {
+					return nil, err
+				}
+			}
+			return slices.Insert(slices.Clone(container), idx, value), nil
+		}
+
+		idx, err := index(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(container[idx], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		result := slices.Clone(container)
+		result[idx] = child
+		return result, nil
+	default:
+		return nil, fmt.Errorf("parent of %s is not a document or an array", Pointer(path...))
+	}
+}
+
+// remove removes the value at the given path (it must exist).
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("whole document can't be removed")
+	}
+
+	token, rest := path[0], path[1:]
+	switch container := doc.(type) {
+	case bson.D:
+		i := slices.IndexFunc(container, func(e bson.E) bool { return e.Key == token })
+		if i < 0 {
+			return nil, fmt.Errorf("path %s doesn't exist", Pointer(path...))
+		}
+		if len(rest) == 0 {
+			return slices.Delete(slices.Clone(container), i, i+1), nil
+		}
+
+		child, err := remove(container[i].Value, rest)
+		if err != nil {
+			return nil, err
+		}
+		result := slices.Clone(container)
+		result[i].Value = child
+		return result, nil
+	case bson.A:
+		idx, err := index(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return slices.Delete(slices.Clone(container), idx, idx+1), nil
+		}
+
+		child, err := remove(container[idx], rest)
+		if err != nil {
+			return nil, err
+		}
+		result := slices.Clone(container)
+		result[idx] = child
+		return result, nil
+	default:
+		return nil, fmt.Errorf("path %s doesn't exist", Pointer(path...))
+	}
+}
+
+// index parses the array index token (it must be in [0, maxIndex]).
+func index(token string, maxIndex int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if idx > maxIndex {
+		return 0, fmt.Errorf("array index %d is out of bounds", idx)
+	}
+	return idx, nil
+}
+
+// lookup returns the value of the top-level field.
+func lookup(doc bson.D, key string) (any, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// number returns the value of a numeric BSON value.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, !math.IsNaN(n)
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// isArray reports if the value is an array.
+func isArray(v any) bool {
+	_, ok := v.(bson.A)
+	return ok
+}
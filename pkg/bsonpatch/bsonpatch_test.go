@@ -0,0 +1,182 @@
+package bsonpatch_test
+
+import (
+	"pho/pkg/bsonpatch"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApply(t *testing.T) {
+	doc := bson.D{
+		{Key: "name", Value: "Alice"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "age", Value: int32(30)},
+	}
+
+	tests := []struct {
+		name     string
+		ops      []bsonpatch.Operation
+		expected any
+		wantErr  bool
+	}{
+		{
+			name: "add field",
+			ops:  []bsonpatch.Operation{{Op: bsonpatch.OpAdd, Path: "/email", Value: "a@b.c"}},
+			expected: bson.D{
+				{Key: "name", Value: "Alice"},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+				{Key: "tags", Value: bson.A{"a", "b"}},
+				{Key: "age", Value: int32(30)},
+				{Key: "email", Value: "a@b.c"},
+			},
+		},
+		{
+			name: "replace nested field keeps order",
+			ops:  []bsonpatch.Operation{{Op: bsonpatch.OpReplace, Path: "/name", Value: "Bob"}},
+			expected: bson.D{
+				{Key: "name", Value: "Bob"},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+				{Key: "tags", Value: bson.A{"a", "b"}},
+				{Key: "age", Value: int32(30)},
+			},
+		},
+		{
+			name: "array operations",
+			ops: []bsonpatch.Operation{
+				{Op: bsonpatch.OpAdd, Path: "/tags/1", Value: "x"},
+				{Op: bsonpatch.OpAdd, Path: "/tags/-", Value: "z"},
+				{Op: bsonpatch.OpReplace, Path: "/tags/0", Value: "y"},
+				{Op: bsonpatch.OpRemove, Path: "/tags/2"},
+			},
+			expected: bson.D{
+				{Key: "name", Value: "Alice"},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Kyiv"}}},
+				{Key: "tags", Value: bson.A{"y", "x", "z"}},
+				{Key: "age", Value: int32(30)},
+			},
+		},
+		{
+			name: "move, copy and test",
+			ops: []bsonpatch.Operation{
+				{Op: bsonpatch.OpTest, Path: "/age", Value: int64(30)},
+				{Op: bsonpatch.OpMove, From: "/address/city", Path: "/city"},
+				{Op: bsonpatch.OpCopy, From: "/city", Path: "/address/town"},
+				{Op: bsonpatch.OpRemove, Path: "/tags"},
+			},
+			expected: bson.D{
+				{Key: "name", Value: "Alice"},
+				{Key: "address", Value: bson.D{{Key: "town", Value: "Kyiv"}}},
+				{Key: "age", Value: int32(30)},
+				{Key: "city", Value: "Kyiv"},
+			},
+		},
+		{
+			name:    "failed test",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpTest, Path: "/name", Value: "Bob"}},
+			wantErr: true,
+		},
+		{
+			name:    "remove missing field",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpRemove, Path: "/missing"}},
+			wantErr: true,
+		},
+		{
+			name:    "replace missing field",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpReplace, Path: "/missing", Value: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "add into missing parent",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpAdd, Path: "/missing/field", Value: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "array index out of bounds",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpAdd, Path: "/tags/5", Value: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "move into own child",
+			ops:     []bsonpatch.Operation{{Op: bsonpatch.OpMove, From: "/address", Path: "/address/inner"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operation",
+			ops:     []bsonpatch.Operation{{Op: "merge", Path: "/name"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := bsonpatch.Apply(doc, tt.ops)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	// Patched document is a copy
+	assert.Equal(t, "Kyiv", doc[1].Value.(bson.D)[0].Value)
+	assert.Equal(t, bson.A{"a", "b"}, doc[2].Value)
+}
+
+func TestMergePatch(t *testing.T) {
+	target := bson.D{
+		{Key: "title", Value: "Goodbye!"},
+		{Key: "author", Value: bson.D{{Key: "givenName", Value: "John"}, {Key: "familyName", Value: "Doe"}}},
+		{Key: "tags", Value: bson.A{"example", "sample"}},
+		{Key: "content", Value: "This will be unchanged"},
+	}
+	patch := bson.D{
+		{Key: "title", Value: "Hello!"},
+		{Key: "phoneNumber", Value: "+01-123-456-7890"},
+		{Key: "author", Value: bson.D{{Key: "familyName", Value: nil}}},
+		{Key: "tags", Value: bson.A{"example"}},
+	}
+
+	// Example from RFC 7396
+	assert.Equal(t, bson.D{
+		{Key: "title", Value: "Hello!"},
+		{Key: "author", Value: bson.D{{Key: "givenName", Value: "John"}}},
+		{Key: "tags", Value: bson.A{"example"}},
+		{Key: "content", Value: "This will be unchanged"},
+		{Key: "phoneNumber", Value: "+01-123-456-7890"},
+	}, bsonpatch.MergePatch(target, patch))
+
+	assert.Equal(t, bson.D{{Key: "a", Value: bson.D{{Key: "b", Value: "c"}}}},
+		bsonpatch.MergePatch("scalar", bson.D{{Key: "a", Value: bson.D{{Key: "b", Value: "c"}}}}))
+	assert.Equal(t, bson.A{int32(1)}, bsonpatch.MergePatch(bson.D{{Key: "a", Value: "b"}}, bson.A{int32(1)}))
+}
+
+func TestPointer(t *testing.T) {
+	assert.Equal(t, "/a~1b/m~0n", bsonpatch.Pointer("a/b", "m~n"))
+	assert.Empty(t, bsonpatch.Pointer())
+
+	tokens, err := bsonpatch.ParsePointer("/a~1b/m~0n/~01")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b", "m~n", "~1"}, tokens)
+
+	tokens, err = bsonpatch.ParsePointer("")
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	_, err = bsonpatch.ParsePointer("a/b")
+	require.Error(t, err)
+}
+
+func TestEqual(t *testing.T) {
+	assert.True(t, bsonpatch.Equal(
+		bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: bson.A{"x"}}},
+		bson.D{{Key: "b", Value: bson.A{"x"}}, {Key: "a", Value: float64(1)}},
+	))
+	assert.False(t, bsonpatch.Equal(bson.D{{Key: "a", Value: int32(1)}}, bson.D{{Key: "a", Value: "1"}}))
+	assert.False(t, bsonpatch.Equal(bson.A{"x"}, bson.A{"x", "y"}))
+}
@@ -0,0 +1,573 @@
+// Package bsonschema validates BSON values against MongoDB `$jsonSchema` documents (draft 4 with BSON types).
+// Supported keywords are the ones MongoDB supports: bsonType, type, enum, required, properties,
+// additionalProperties, patternProperties, minProperties, maxProperties, dependencies, items, additionalItems,
+// minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf,
+// minLength, maxLength, pattern, allOf, anyOf, oneOf and not. Annotations (title, description) are ignored.
+// Schemas can be inferred from sample documents, and turned into JSON Schemas of Extended JSON (for editors).
+package bsonschema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Violation describes a value that doesn't satisfy the schema.
+type Violation struct {
+	// Path of the value in dot notation (e.g. `address.city` or `tags.0`), empty for the validated value itself
+	Path string
+
+	// Message explains the violation (e.g. `must be >= 0`)
+	Message string
+}
+
+func (v *Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Schema is a `$jsonSchema` document.
+type Schema struct {
+	doc bson.D
+}
+
+// New returns the schema of the given `$jsonSchema` document.
+func New(doc bson.D) *Schema {
+	return &Schema{doc: doc}
+}
+
+// Validate returns all violations of the schema by the given value (nil if the value is valid).
+func (s *Schema) Validate(value any) []*Violation {
+	return validate(s.doc, value, "")
+}
+
+// UncheckedPatterns returns the patterns of the schema that can't be checked, as Go regexp (RE2) doesn't support them
+// (e.g. lookarounds or backreferences), each with its location, e.g. `properties.name.pattern: ^(?!x)`.
+// Strings are not validated against such patterns, and fields matching such patternProperties are allowed.
+func (s *Schema) UncheckedPatterns() []string {
+	return uncheckedPatterns(s.doc, "")
+}
+
+// uncheckedPatterns collects the patterns of the schema document Go regexp can't compile.
+func uncheckedPatterns(schema bson.D, path string) []string {
+	var unchecked []string
+	for _, e := range schema {
+		keywordPath := join(path, e.Key)
+		switch e.Key {
+		case "pattern":
+			if pattern, ok := e.Value.(string); ok && !isSupportedPattern(pattern) {
+				unchecked = append(unchecked, keywordPath+": "+pattern)
+			}
+		case "patternProperties":
+			patterns, _ := e.Value.(bson.D)
+			for _, pattern := range patterns {
+				if !isSupportedPattern(pattern.Key) {
+					unchecked = append(unchecked, keywordPath+": "+pattern.Key)
+				}
+				if sub, ok := pattern.Value.(bson.D); ok {
+					unchecked = append(unchecked, uncheckedPatterns(sub, join(keywordPath, pattern.Key))...)
+				}
+			}
+		case "properties", "dependencies":
+			subschemas, _ := e.Value.(bson.D)
+			for _, property := range subschemas {
+				if sub, ok := property.Value.(bson.D); ok {
+					unchecked = append(unchecked, uncheckedPatterns(sub, join(keywordPath, property.Key))...)
+				}
+			}
+		case "items", "additionalItems", "additionalProperties", "not", "allOf", "anyOf", "oneOf":
+			switch sub := e.Value.(type) {
+			case bson.D:
+				unchecked = append(unchecked, uncheckedPatterns(sub, keywordPath)...)
+			case bson.A:
+				for i, item := range sub {
+					if item, ok := item.(bson.D); ok {
+						itemPath := join(keywordPath, strconv.Itoa(i))
+						unchecked = append(unchecked, uncheckedPatterns(item, itemPath)...)
+					}
+				}
+			}
+		}
+	}
+
+	return unchecked
+}
+
+// isSupportedPattern reports if Go regexp can compile the pattern.
+func isSupportedPattern(pattern string) bool {
+	_, err := regexp.Compile(pattern)
+	return err == nil
+}
+
+// validate validates the value against the schema document, the value is located at the given path.
+func validate(schema bson.D, value any, path string) []*Violation {
+	var violations []*Violation
+	addf := func(format string, args ...any) {
+		violations = append(violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, e := range schema {
+		switch e.Key {
+		case "bsonType":
+			if expected := names(e.Value); !slices.ContainsFunc(expected, func(t string) bool {
+				return matchesBSONType(t, value)
+			}) {
+				addf("must be of bsonType %s, got %s", strings.Join(expected, " or "), BSONType(value))
+			}
+		case "type":
+			if expected := names(e.Value); !slices.ContainsFunc(expected, func(t string) bool {
+				return matchesJSONType(t, value)
+			}) {
+				addf("must be of type %s, got %s", strings.Join(expected, " or "), BSONType(value))
+			}
+		case "enum":
+			options, _ := e.Value.(bson.A)
+			if !slices.ContainsFunc(options, func(option any) bool { return equal(option, value) }) {
+				addf("must be one of the enum values")
+			}
+		case "allOf", "anyOf", "oneOf":
+			violations = append(violations, validateCombination(e.Key, e.Value, value, path)...)
+		case "not":
+			if sub, ok := e.Value.(bson.D); ok && len(validate(sub, value, path)) == 0 {
+				addf("must not match the schema of `not`")
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		violations = append(violations, validateObject(schema, v, path)...)
+	case bson.A:
+		violations = append(violations, validateArray(schema, v, path)...)
+	case string:
+		violations = append(violations, validateString(schema, v, path)...)
+	default:
+		if n, ok := number(value); ok {
+			violations = append(violations, validateNumber(schema, n, path)...)
+		}
+	}
+
+	return violations
+}
+
+// validateCombination validates the value against subschemas of allOf, anyOf or oneOf.
+func validateCombination(keyword string, subschemas any, value any, path string) []*Violation {
+	list, _ := subschemas.(bson.A)
+
+	matched := 0
+	var allViolations []*Violation
+	for _, raw := range list {
+		sub, ok := raw.(bson.D)
+		if !ok {
+			continue
+		}
+		subViolations := validate(sub, value, path)
+		if len(subViolations) == 0 {
+			matched++
+		}
+		allViolations = append(allViolations, subViolations...)
+	}
+
+	switch keyword {
+	case "allOf":
+		return allViolations
+	case "anyOf":
+		if matched == 0 {
+			return []*Violation{{Path: path, Message: "must match at least one schema of `anyOf`"}}
+		}
+	case "oneOf":
+		if matched != 1 {
+			return []*Violation{{
+				Path:    path,
+				Message: fmt.Sprintf("must match exactly one schema of `oneOf`, matched %d", matched),
+			}}
+		}
+	}
+
+	return nil
+}
+
+// validateObject validates object keywords.
+func validateObject(schema bson.D, doc bson.D, path string) []*Violation {
+	var violations []*Violation
+	addf := func(format string, args ...any) {
+		violations = append(violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	properties, _ := lookup(schema, "properties").(bson.D)
+	patternProperties, _ := lookup(schema, "patternProperties").(bson.D)
+
+	for _, e := range schema {
+		switch e.Key {
+		case "required":
+			for _, name := range names(e.Value) {
+				if !slices.ContainsFunc(doc, func(f bson.E) bool { return f.Key == name }) {
+					violations = append(violations, &Violation{Path: join(path, name), Message: "is required"})
+				}
+			}
+		case "minProperties":
+			if limit, ok := number(e.Value); ok && float64(len(doc)) < limit {
+				addf("must have at least %s fields", format(limit))
+			}
+		case "maxProperties":
+			if limit, ok := number(e.Value); ok && float64(len(doc)) > limit {
+				addf("must have at most %s fields", format(limit))
+			}
+		case "dependencies":
+			dependencies, _ := e.Value.(bson.D)
+			for _, dependency := range dependencies {
+				if !slices.ContainsFunc(doc, func(f bson.E) bool { return f.Key == dependency.Key }) {
+					continue
+				}
+				if sub, ok := dependency.Value.(bson.D); ok {
+					violations = append(violations, validate(sub, doc, path)...)
+					continue
+				}
+				for _, name := range names(dependency.Value) {
+					if !slices.ContainsFunc(doc, func(f bson.E) bool { return f.Key == name }) {
+						violations = append(violations, &Violation{
+							Path:    join(path, name),
+							Message: fmt.Sprintf("is required when %s is present", dependency.Key),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	additional, hasAdditional := lookup(schema, "additionalProperties"), hasKey(schema, "additionalProperties")
+	for _, field := range doc {
+		fieldPath := join(path, field.Key)
+
+		matched := false
+		if sub, ok := lookup(properties, field.Key).(bson.D); ok {
+			matched = true
+			violations = append(violations, validate(sub, field.Value, fieldPath)...)
+		} else if hasKey(properties, field.Key) {
+			matched = true
+		}
+		for _, pattern := range patternProperties {
+			re, err := regexp.Compile(pattern.Key)
+			if err != nil {
+				// The field may match the pattern, so it's not reported as an additional one (see UncheckedPatterns)
+				matched = true
+				continue
+			}
+			if !re.MatchString(field.Key) {
+				continue
+			}
+			matched = true
+			if sub, ok := pattern.Value.(bson.D); ok {
+				violations = append(violations, validate(sub, field.Value, fieldPath)...)
+			}
+		}
+
+		if matched || !hasAdditional {
+			continue
+		}
+		switch additional := additional.(type) {
+		case bool:
+			if !additional {
+				violations = append(violations, &Violation{Path: fieldPath, Message: "is not allowed"})
+			}
+		case bson.D:
+			violations = append(violations, validate(additional, field.Value, fieldPath)...)
+		}
+	}
+
+	return violations
+}
+
+// validateArray validates array keywords.
+func validateArray(schema bson.D, arr bson.A, path string) []*Violation {
+	var violations []*Violation
+	addf := func(format string, args ...any) {
+		violations = append(violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, e := range schema {
+		switch e.Key {
+		case "items":
+			switch items := e.Value.(type) {
+			case bson.D:
+				for i, item := range arr {
+					violations = append(violations, validate(items, item, join(path, strconv.Itoa(i)))...)
+				}
+			case bson.A:
+				// Tuple: items are validated by position, the rest ones by additionalItems
+				for i, item := range arr {
+					itemPath := join(path, strconv.Itoa(i))
+					if i < len(items) {
+						if sub, ok := items[i].(bson.D); ok {
+							violations = append(violations, validate(sub, item, itemPath)...)
+						}
+						continue
+					}
+
+					switch additional := lookup(schema, "additionalItems").(type) {
+					case bool:
+						if !additional {
+							violations = append(violations, &Violation{Path: itemPath, Message: "is not allowed"})
+						}
+					case bson.D:
+						violations = append(violations, validate(additional, item, itemPath)...)
+					}
+				}
+			}
+		case "minItems":
+			if limit, ok := number(e.Value); ok && float64(len(arr)) < limit {
+				addf("must have at least %s items", format(limit))
+			}
+		case "maxItems":
+			if limit, ok := number(e.Value); ok && float64(len(arr)) > limit {
+				addf("must have at most %s items", format(limit))
+			}
+		case "uniqueItems":
+			if unique, _ := e.Value.(bool); unique && hasDuplicates(arr) {
+				addf("must have unique items")
+			}
+		}
+	}
+
+	return violations
+}
+
+// validateString validates string keywords.
+func validateString(schema bson.D, s string, path string) []*Violation {
+	var violations []*Violation
+	addf := func(format string, args ...any) {
+		violations = append(violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := float64(utf8.RuneCountInString(s))
+	for _, e := range schema {
+		switch e.Key {
+		case "minLength":
+			if limit, ok := number(e.Value); ok && length < limit {
+				addf("must be at least %s characters long", format(limit))
+			}
+		case "maxLength":
+			if limit, ok := number(e.Value); ok && length > limit {
+				addf("must be at most %s characters long", format(limit))
+			}
+		case "pattern":
+			// Patterns Go regexp can't compile are not checked (see UncheckedPatterns)
+			pattern, _ := e.Value.(string)
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+				addf("must match pattern %q", pattern)
+			}
+		}
+	}
+
+	return violations
+}
+
+// validateNumber validates numeric keywords.
+func validateNumber(schema bson.D, n float64, path string) []*Violation {
+	var violations []*Violation
+	addf := func(format string, args ...any) {
+		violations = append(violations, &Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	exclusiveMinimum, _ := lookup(schema, "exclusiveMinimum").(bool)
+	exclusiveMaximum, _ := lookup(schema, "exclusiveMaximum").(bool)
+	for _, e := range schema {
+		limit, ok := number(e.Value)
+		if !ok {
+			continue
+		}
+
+		switch e.Key {
+		case "minimum":
+			if exclusiveMinimum && n <= limit {
+				addf("must be > %s", format(limit))
+			} else if n < limit {
+				addf("must be >= %s", format(limit))
+			}
+		case "maximum":
+			if exclusiveMaximum && n >= limit {
+				addf("must be < %s", format(limit))
+			} else if n > limit {
+				addf("must be <= %s", format(limit))
+			}
+		case "multipleOf":
+			if limit > 0 && math.Abs(math.Remainder(n, limit)) > 1e-9 {
+				addf("must be a multiple of %s", format(limit))
+			}
+		}
+	}
+
+	return violations
+}
+
+// BSONType returns the name of the BSON type of the value (as used by `bsonType`).
+func BSONType(value any) string {
+	switch value.(type) {
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case bson.D, bson.M:
+		return "object"
+	case bson.A:
+		return "array"
+	case primitive.Binary:
+		return "binData"
+	case primitive.Undefined:
+		return "undefined"
+	case primitive.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case primitive.DateTime:
+		return "date"
+	case nil, primitive.Null:
+		return "null"
+	case primitive.Regex:
+		return "regex"
+	case primitive.DBPointer:
+		return "dbPointer"
+	case primitive.JavaScript:
+		return "javascript"
+	case primitive.Symbol:
+		return "symbol"
+	case primitive.CodeWithScope:
+		return "javascriptWithScope"
+	case int32:
+		return "int"
+	case primitive.Timestamp:
+		return "timestamp"
+	case int64, int:
+		return "long"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.MinKey:
+		return "minKey"
+	case primitive.MaxKey:
+		return "maxKey"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// matchesBSONType reports if the value is of the given BSON type (`number` is an alias of all numeric types).
+func matchesBSONType(name string, value any) bool {
+	if name == "number" {
+		_, ok := number(value)
+		return ok
+	}
+	return BSONType(value) == name
+}
+
+// matchesJSONType reports if the value is of the given JSON type.
+func matchesJSONType(name string, value any) bool {
+	switch name {
+	case "object", "array", "string", "null":
+		return BSONType(value) == name
+	case "boolean":
+		return BSONType(value) == "bool"
+	case "number":
+		_, ok := number(value)
+		return ok
+	default:
+		return false
+	}
+}
+
+// names returns the name (or the list of names) the keyword is given.
+func names(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case bson.A:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// number returns the value of a numeric BSON value.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// equal reports if the values are equal (numbers are compared by their values).
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+
+	aBytes, aErr := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	bBytes, bErr := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	return aErr == nil && bErr == nil && string(aBytes) == string(bBytes)
+}
+
+// hasDuplicates reports if any two items of the array are equal.
+func hasDuplicates(arr bson.A) bool {
+	for i := range arr {
+		for j := i + 1; j < len(arr); j++ {
+			if equal(arr[i], arr[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookup returns the value of the top-level field (nil if it's missing).
+func lookup(doc bson.D, key string) any {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// hasKey reports if the document has the top-level field.
+func hasKey(doc bson.D, key string) bool {
+	return slices.ContainsFunc(doc, func(e bson.E) bool { return e.Key == key })
+}
+
+// join joins the path and the field name in dot notation.
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// format formats the numeric limit of a keyword.
+func format(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
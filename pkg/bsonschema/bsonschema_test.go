@@ -0,0 +1,227 @@
+package bsonschema_test
+
+import (
+	"testing"
+
+	"pho/pkg/bsonschema"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	schema := bsonschema.New(bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"name", "price"}},
+		{Key: "additionalProperties", Value: false},
+		{Key: "properties", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "bsonType", Value: "objectId"}}},
+			{Key: "name", Value: bson.D{
+				{Key: "bsonType", Value: "string"},
+				{Key: "minLength", Value: int32(2)},
+				{Key: "pattern", Value: "^[A-Z]"},
+			}},
+			{Key: "price", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"int", "double", "decimal"}},
+				{Key: "minimum", Value: int32(0)},
+			}},
+			{Key: "status", Value: bson.D{{Key: "enum", Value: bson.A{"active", "archived"}}}},
+			{Key: "tags", Value: bson.D{
+				{Key: "bsonType", Value: "array"},
+				{Key: "maxItems", Value: int32(2)},
+				{Key: "uniqueItems", Value: true},
+				{Key: "items", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+			}},
+			{Key: "address", Value: bson.D{
+				{Key: "bsonType", Value: "object"},
+				{Key: "required", Value: bson.A{"city"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "zip", Value: bson.D{{Key: "type", Value: "string"}}},
+				}},
+			}},
+		}},
+	})
+
+	tests := []struct {
+		name     string
+		doc      bson.D
+		expected []string
+	}{
+		{
+			name: "valid document",
+			doc: bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "name", Value: "Pho"},
+				{Key: "price", Value: 9.5},
+				{Key: "status", Value: "active"},
+				{Key: "tags", Value: bson.A{"soup", "hot"}},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Hanoi"}}},
+			},
+			expected: nil,
+		},
+		{
+			name: "required and additional fields",
+			doc: bson.D{
+				{Key: "name", Value: "Pho"},
+				{Key: "legacy", Value: true},
+			},
+			expected: []string{"price: is required", "legacy: is not allowed"},
+		},
+		{
+			name: "scalar keywords",
+			doc: bson.D{
+				{Key: "name", Value: "p"},
+				{Key: "price", Value: int64(-1)},
+				{Key: "status", Value: "deleted"},
+			},
+			expected: []string{
+				"name: must be at least 2 characters long",
+				`name: must match pattern "^[A-Z]"`,
+				"price: must be of bsonType int or double or decimal, got long",
+				"price: must be >= 0",
+				"status: must be one of the enum values",
+			},
+		},
+		{
+			name: "nested documents and arrays",
+			doc: bson.D{
+				{Key: "name", Value: "Pho"},
+				{Key: "price", Value: int32(1)},
+				{Key: "tags", Value: bson.A{"a", int32(1), "a"}},
+				{Key: "address", Value: bson.D{{Key: "zip", Value: int32(100000)}}},
+			},
+			expected: []string{
+				"tags: must have at most 2 items",
+				"tags: must have unique items",
+				"tags.1: must be of bsonType string, got int",
+				"address.city: is required",
+				"address.zip: must be of type string, got int",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			for _, violation := range schema.Validate(tt.doc) {
+				actual = append(actual, violation.String())
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSchema_Validate_Combinations(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   bson.D
+		value    any
+		expected []string
+	}{
+		{
+			name: "anyOf matched",
+			schema: bson.D{{Key: "anyOf", Value: bson.A{
+				bson.D{{Key: "bsonType", Value: "string"}},
+				bson.D{{Key: "bsonType", Value: "null"}},
+			}}},
+			value: nil,
+		},
+		{
+			name: "anyOf not matched",
+			schema: bson.D{{Key: "anyOf", Value: bson.A{
+				bson.D{{Key: "bsonType", Value: "string"}},
+				bson.D{{Key: "bsonType", Value: "null"}},
+			}}},
+			value:    int32(1),
+			expected: []string{"must match at least one schema of `anyOf`"},
+		},
+		{
+			name: "oneOf matched twice",
+			schema: bson.D{{Key: "oneOf", Value: bson.A{
+				bson.D{{Key: "bsonType", Value: "number"}},
+				bson.D{{Key: "minimum", Value: int32(0)}},
+			}}},
+			value:    int32(1),
+			expected: []string{"must match exactly one schema of `oneOf`, matched 2"},
+		},
+		{
+			name:     "not",
+			schema:   bson.D{{Key: "not", Value: bson.D{{Key: "bsonType", Value: "string"}}}},
+			value:    "x",
+			expected: []string{"must not match the schema of `not`"},
+		},
+		{
+			name: "exclusive maximum and multipleOf",
+			schema: bson.D{
+				{Key: "maximum", Value: int32(10)},
+				{Key: "exclusiveMaximum", Value: true},
+				{Key: "multipleOf", Value: int32(4)},
+			},
+			value:    int32(10),
+			expected: []string{"must be < 10", "must be a multiple of 4"},
+		},
+		{
+			name: "dependencies",
+			schema: bson.D{{Key: "dependencies", Value: bson.D{
+				{Key: "card", Value: bson.A{"billing"}},
+			}}},
+			value:    bson.D{{Key: "card", Value: "4242"}},
+			expected: []string{"billing: is required when card is present"},
+		},
+		{
+			name: "pattern properties",
+			schema: bson.D{
+				{Key: "patternProperties", Value: bson.D{
+					{Key: "^x_", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+				}},
+				{Key: "additionalProperties", Value: false},
+			},
+			value:    bson.D{{Key: "x_note", Value: int32(1)}, {Key: "other", Value: "y"}},
+			expected: []string{"x_note: must be of bsonType string, got int", "other: is not allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			for _, violation := range bsonschema.New(tt.schema).Validate(tt.value) {
+				actual = append(actual, violation.String())
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSchema_UncheckedPatterns(t *testing.T) {
+	schema := bsonschema.New(bson.D{
+		{Key: "properties", Value: bson.D{
+			{Key: "name", Value: bson.D{{Key: "pattern", Value: "^(?!admin)"}}},
+			{Key: "code", Value: bson.D{{Key: "pattern", Value: "^[A-Z]+$"}}},
+			{Key: "tags", Value: bson.D{{Key: "items", Value: bson.D{{Key: "pattern", Value: `(a)\1`}}}}},
+		}},
+		{Key: "patternProperties", Value: bson.D{
+			{Key: "^(?=x)", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+		}},
+		{Key: "additionalProperties", Value: false},
+	})
+
+	assert.Equal(t, []string{
+		"properties.name.pattern: ^(?!admin)",
+		`properties.tags.items.pattern: (a)\1`,
+		"patternProperties: ^(?=x)",
+	}, schema.UncheckedPatterns())
+
+	// Unchecked patterns are not violated, and fields they may match are not reported as additional ones
+	assert.Empty(t, schema.Validate(bson.D{{Key: "name", Value: "admin"}, {Key: "x_note", Value: int32(1)}}))
+}
+
+func TestBSONType(t *testing.T) {
+	assert.Equal(t, "int", bsonschema.BSONType(int32(1)))
+	assert.Equal(t, "long", bsonschema.BSONType(int64(1)))
+	assert.Equal(t, "double", bsonschema.BSONType(1.5))
+	assert.Equal(t, "objectId", bsonschema.BSONType(primitive.NewObjectID()))
+	assert.Equal(t, "date", bsonschema.BSONType(primitive.DateTime(0)))
+	assert.Equal(t, "null", bsonschema.BSONType(nil))
+	assert.Equal(t, "object", bsonschema.BSONType(bson.D{}))
+}
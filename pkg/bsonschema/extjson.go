@@ -0,0 +1,249 @@
+package bsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"pho/pkg/extjson"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// draft4 is the JSON Schema dialect of `$jsonSchema`, so its keywords (e.g. boolean exclusiveMinimum) are kept as is.
+const draft4 = "http://json-schema.org/draft-04/schema#"
+
+// ExtJSON returns the JSON Schema of values valid against the schema, as they are written in Extended JSON
+// of the given mode: e.g. `{"bsonType": "objectId"}` becomes the schema of `{"$oid": "..."}` objects.
+// It's meant for editors (completion, type hints), so keywords are kept as they are, and BSON types are
+// turned into their JSON shapes. Shell mode is not JSON, so it has no JSON Schema.
+func (s *Schema) ExtJSON(mode extjson.Mode) (bson.D, error) {
+	if mode != extjson.Canonical && mode != extjson.Relaxed {
+		return nil, fmt.Errorf("%s mode is not JSON, it has no JSON Schema", mode)
+	}
+
+	c := &extJSONConverter{canonical: mode == extjson.Canonical}
+	return append(bson.D{{Key: "$schema", Value: draft4}}, c.convert(s.doc)...), nil
+}
+
+// extJSONConverter converts `$jsonSchema` documents into JSON Schemas of Extended JSON.
+type extJSONConverter struct {
+	canonical bool
+}
+
+// convert converts the schema document.
+// Keywords of objects and arrays go into the shapes of `object` and `array` types,
+// as other BSON types (e.g. objectId) are JSON objects as well.
+func (c *extJSONConverter) convert(schema bson.D) bson.D {
+	var result, objectKeywords, arrayKeywords bson.D
+	var types []string
+	for _, e := range schema {
+		switch e.Key {
+		case "bsonType":
+			types = append(types, names(e.Value)...)
+		case "type":
+			for _, name := range names(e.Value) {
+				if name == "boolean" {
+					name = "bool"
+				}
+				types = append(types, name)
+			}
+		case "properties", "patternProperties", "dependencies":
+			objectKeywords = append(objectKeywords, bson.E{Key: e.Key, Value: c.convertEach(e.Value)})
+		case "additionalProperties":
+			objectKeywords = append(objectKeywords, bson.E{Key: e.Key, Value: c.convertValue(e.Value)})
+		case "required", "minProperties", "maxProperties":
+			objectKeywords = append(objectKeywords, e)
+		case "items", "additionalItems":
+			arrayKeywords = append(arrayKeywords, bson.E{Key: e.Key, Value: c.convertValue(e.Value)})
+		case "minItems", "maxItems", "uniqueItems":
+			arrayKeywords = append(arrayKeywords, e)
+		case "allOf", "anyOf", "oneOf", "not":
+			result = append(result, bson.E{Key: e.Key, Value: c.convertValue(e.Value)})
+		case "enum":
+			result = append(result, bson.E{Key: e.Key, Value: c.convertEnum(e.Value)})
+		default:
+			result = append(result, e)
+		}
+	}
+
+	var shapes []bson.D
+	for i := 0; i < len(types); i++ {
+		t := types[i]
+		if t == "number" {
+			types = append(types, "int", "long", "double", "decimal")
+			continue
+		}
+
+		for _, shape := range c.typeShapes(t) {
+			switch t {
+			case "object":
+				shape = append(shape, objectKeywords...)
+			case "array":
+				shape = append(shape, arrayKeywords...)
+			}
+			if !slices.ContainsFunc(shapes, func(s bson.D) bool { return equal(s, shape) }) {
+				shapes = append(shapes, shape)
+			}
+		}
+	}
+
+	switch {
+	case len(shapes) == 0:
+		return append(append(result, objectKeywords...), arrayKeywords...)
+	case len(shapes) == 1:
+		return append(shapes[0], result...)
+	case hasKey(result, "anyOf"):
+		// Shapes can't be listed in anyOf of the schema itself
+		return append(bson.D{{Key: "allOf", Value: bson.A{bson.D{{Key: "anyOf", Value: shapes}}}}}, result...)
+	default:
+		return append(bson.D{{Key: "anyOf", Value: shapes}}, result...)
+	}
+}
+
+// convertValue converts the keyword value: a schema, a list of schemas or a boolean.
+func (c *extJSONConverter) convertValue(v any) any {
+	switch v := v.(type) {
+	case bson.D:
+		return c.convert(v)
+	case bson.A:
+		schemas := make(bson.A, len(v))
+		for i, item := range v {
+			schemas[i] = c.convertValue(item)
+		}
+		return schemas
+	default:
+		return v
+	}
+}
+
+// convertEach converts schemas of the keyword's document (e.g. of `properties`), keeping other values as is.
+func (c *extJSONConverter) convertEach(v any) any {
+	doc, ok := v.(bson.D)
+	if !ok {
+		return v
+	}
+
+	result := make(bson.D, len(doc))
+	for i, e := range doc {
+		if schema, ok := e.Value.(bson.D); ok {
+			e.Value = c.convert(schema)
+		}
+		result[i] = e
+	}
+	return result
+}
+
+// convertEnum converts values of the enum into their Extended JSON representations.
+func (c *extJSONConverter) convertEnum(v any) any {
+	values, ok := v.(bson.A)
+	if !ok {
+		return v
+	}
+
+	result := make(bson.A, len(values))
+	for i, value := range values {
+		result[i] = value
+		b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, c.canonical, false)
+		if err != nil {
+			continue
+		}
+		var wrapped struct{ V any }
+		if err := json.Unmarshal(b, &wrapped); err == nil {
+			result[i] = wrapped.V
+		}
+	}
+	return result
+}
+
+// typeShapes returns schemas of the Extended JSON representations of the BSON type (none for unknown types).
+// See https://www.mongodb.com/docs/manual/reference/mongodb-extended-json/
+func (c *extJSONConverter) typeShapes(name string) []bson.D {
+	str := bson.D{{Key: "type", Value: "string"}}
+	integer := bson.D{{Key: "type", Value: "integer"}}
+	numberString := bson.D{{Key: "type", Value: "string"}, {Key: "pattern", Value: "^-?[0-9]+$"}}
+	numberLong := wrapper("$numberLong", numberString)
+	objectID := wrapper("$oid", bson.D{{Key: "type", Value: "string"}, {Key: "pattern", Value: "^[0-9a-fA-F]{24}$"}})
+
+	switch name {
+	case "double":
+		if c.canonical {
+			return []bson.D{wrapper("$numberDouble", str)}
+		}
+		special := bson.D{{Key: "enum", Value: bson.A{"Infinity", "-Infinity", "NaN"}}}
+		return []bson.D{{{Key: "type", Value: "number"}}, wrapper("$numberDouble", special)}
+	case "int":
+		if c.canonical {
+			return []bson.D{wrapper("$numberInt", numberString)}
+		}
+		return []bson.D{integer}
+	case "long":
+		if c.canonical {
+			return []bson.D{numberLong}
+		}
+		return []bson.D{integer}
+	case "decimal":
+		return []bson.D{wrapper("$numberDecimal", str)}
+	case "string":
+		return []bson.D{str}
+	case "bool":
+		return []bson.D{{{Key: "type", Value: "boolean"}}}
+	case "null":
+		return []bson.D{{{Key: "type", Value: "null"}}}
+	case "object":
+		return []bson.D{{{Key: "type", Value: "object"}}}
+	case "array":
+		return []bson.D{{{Key: "type", Value: "array"}}}
+	case "objectId":
+		return []bson.D{objectID}
+	case "date":
+		if c.canonical {
+			return []bson.D{wrapper("$date", numberLong)}
+		}
+		iso := bson.D{{Key: "type", Value: "string"}, {Key: "format", Value: "date-time"}}
+		return []bson.D{wrapper("$date", bson.D{{Key: "anyOf", Value: bson.A{iso, numberLong}}})}
+	case "binData":
+		return []bson.D{wrapper("$binary", object(bson.D{{Key: "base64", Value: str}, {Key: "subType", Value: str}}))}
+	case "regex":
+		regex := object(bson.D{{Key: "pattern", Value: str}, {Key: "options", Value: str}})
+		return []bson.D{wrapper("$regularExpression", regex)}
+	case "timestamp":
+		return []bson.D{wrapper("$timestamp", object(bson.D{{Key: "t", Value: integer}, {Key: "i", Value: integer}}))}
+	case "javascript":
+		return []bson.D{wrapper("$code", str)}
+	case "javascriptWithScope":
+		scope := bson.D{{Key: "type", Value: "object"}}
+		return []bson.D{object(bson.D{{Key: "$code", Value: str}, {Key: "$scope", Value: scope}})}
+	case "symbol":
+		return []bson.D{wrapper("$symbol", str)}
+	case "dbPointer":
+		return []bson.D{wrapper("$dbPointer", object(bson.D{{Key: "$ref", Value: str}, {Key: "$id", Value: objectID}}))}
+	case "undefined":
+		return []bson.D{wrapper("$undefined", bson.D{{Key: "enum", Value: bson.A{true}}})}
+	case "minKey":
+		return []bson.D{wrapper("$minKey", bson.D{{Key: "enum", Value: bson.A{int32(1)}}})}
+	case "maxKey":
+		return []bson.D{wrapper("$maxKey", bson.D{{Key: "enum", Value: bson.A{int32(1)}}})}
+	default:
+		return nil
+	}
+}
+
+// object returns the schema of objects having exactly the given properties.
+func object(properties bson.D) bson.D {
+	required := make(bson.A, len(properties))
+	for i, e := range properties {
+		required[i] = e.Key
+	}
+
+	return bson.D{
+		{Key: "type", Value: "object"},
+		{Key: "properties", Value: properties},
+		{Key: "required", Value: required},
+		{Key: "additionalProperties", Value: false},
+	}
+}
+
+// wrapper returns the schema of objects wrapping a value into the given key, e.g. `{"$oid": "..."}`.
+func wrapper(key string, value bson.D) bson.D {
+	return object(bson.D{{Key: key, Value: value}})
+}
@@ -0,0 +1,103 @@
+package bsonschema_test
+
+import (
+	"testing"
+
+	"pho/pkg/bsonschema"
+	"pho/pkg/extjson"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSchema_ExtJSON(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("64b64c7e1f4d2a3b4c5d6e7f")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		schema   bson.D
+		mode     extjson.Mode
+		expected string
+	}{
+		{
+			name:   "objectId",
+			schema: bson.D{{Key: "bsonType", Value: "objectId"}},
+			mode:   extjson.Relaxed,
+			expected: `{"type":"object","properties":{"$oid":{"type":"string","pattern":"^[0-9a-fA-F]{24}$"}},` +
+				`"required":["$oid"],"additionalProperties":false}`,
+		},
+		{
+			name:   "int in canonical mode",
+			schema: bson.D{{Key: "bsonType", Value: "int"}, {Key: "minimum", Value: int32(0)}},
+			mode:   extjson.Canonical,
+			expected: `{"type":"object","properties":{"$numberInt":{"type":"string","pattern":"^-?[0-9]+$"}},` +
+				`"required":["$numberInt"],"additionalProperties":false,"minimum":0}`,
+		},
+		{
+			name:   "number in relaxed mode",
+			schema: bson.D{{Key: "bsonType", Value: "number"}},
+			mode:   extjson.Relaxed,
+			expected: `{"anyOf":[{"type":"integer"},{"type":"number"},{"type":"object","properties":{"$numberDouble":` +
+				`{"enum":["Infinity","-Infinity","NaN"]}},"required":["$numberDouble"],"additionalProperties":false},` +
+				`{"type":"object","properties":{"$numberDecimal":{"type":"string"}},"required":["$numberDecimal"],` +
+				`"additionalProperties":false}]}`,
+		},
+		{
+			name: "object keywords go to the object type",
+			schema: bson.D{
+				{Key: "bsonType", Value: bson.A{"object", "null"}},
+				{Key: "required", Value: bson.A{"city"}},
+				{Key: "properties", Value: bson.D{{Key: "city", Value: bson.D{{Key: "type", Value: "string"}}}}},
+				{Key: "description", Value: "Address"},
+			},
+			mode: extjson.Canonical,
+			expected: `{"anyOf":[{"type":"object","required":["city"],"properties":{"city":{"type":"string"}}},` +
+				`{"type":"null"}],"description":"Address"}`,
+		},
+		{
+			name:     "enum values",
+			schema:   bson.D{{Key: "enum", Value: bson.A{"a", oid, nil}}},
+			mode:     extjson.Canonical,
+			expected: `{"enum":["a",{"$oid":"64b64c7e1f4d2a3b4c5d6e7f"},null]}`,
+		},
+		{
+			name: "no types",
+			schema: bson.D{
+				{Key: "items", Value: bson.D{{Key: "bsonType", Value: "bool"}}},
+				{Key: "minItems", Value: int32(1)},
+			},
+			mode:     extjson.Relaxed,
+			expected: `{"items":{"type":"boolean"},"minItems":1}`,
+		},
+		{
+			name: "types and anyOf",
+			schema: bson.D{
+				{Key: "bsonType", Value: bson.A{"string", "bool"}},
+				{Key: "anyOf", Value: bson.A{bson.D{{Key: "minLength", Value: int32(1)}}}},
+			},
+			mode:     extjson.Relaxed,
+			expected: `{"allOf":[{"anyOf":[{"type":"string"},{"type":"boolean"}]}],"anyOf":[{"minLength":1}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := bsonschema.New(tt.schema).ExtJSON(tt.mode)
+			require.NoError(t, err)
+			require.Equal(t, bson.E{Key: "$schema", Value: "http://json-schema.org/draft-04/schema#"}, doc[0])
+
+			b, err := extjson.NewRelaxedMarshaller().WithCompact(true).Marshal(doc[1:])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(b))
+		})
+	}
+}
+
+func TestSchema_ExtJSON_ShellMode(t *testing.T) {
+	_, err := bsonschema.New(bson.D{}).ExtJSON(extjson.Shell)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shell mode is not JSON")
+}
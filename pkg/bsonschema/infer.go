@@ -0,0 +1,81 @@
+package bsonschema
+
+import (
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Infer infers the schema of the given documents: BSON types of their fields, nested documents and arrays included.
+// Fields are never required, as documents of a sample may miss fields that other documents have.
+func Infer(docs []bson.D) *Schema {
+	values := make([]any, len(docs))
+	for i, doc := range docs {
+		values[i] = doc
+	}
+
+	return New(infer(values))
+}
+
+// infer infers the schema of the values located at the same path.
+func infer(values []any) bson.D {
+	var types []string
+	var objects []bson.D
+	var items []any
+	for _, value := range values {
+		if t := BSONType(value); !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+
+		switch v := value.(type) {
+		case bson.D:
+			objects = append(objects, v)
+		case bson.A:
+			items = append(items, v...)
+		}
+	}
+
+	var schema bson.D
+	switch len(types) {
+	case 0:
+		return schema
+	case 1:
+		schema = append(schema, bson.E{Key: "bsonType", Value: types[0]})
+	default:
+		bsonTypes := make(bson.A, len(types))
+		for i, t := range types {
+			bsonTypes[i] = t
+		}
+		schema = append(schema, bson.E{Key: "bsonType", Value: bsonTypes})
+	}
+
+	if properties := inferProperties(objects); len(properties) > 0 {
+		schema = append(schema, bson.E{Key: "properties", Value: properties})
+	}
+	if len(items) > 0 {
+		schema = append(schema, bson.E{Key: "items", Value: infer(items)})
+	}
+
+	return schema
+}
+
+// inferProperties infers schemas of fields of the documents (in order of their first appearance).
+func inferProperties(docs []bson.D) bson.D {
+	var keys []string
+	values := make(map[string][]any)
+	for _, doc := range docs {
+		for _, e := range doc {
+			if _, ok := values[e.Key]; !ok {
+				keys = append(keys, e.Key)
+			}
+			values[e.Key] = append(values[e.Key], e.Value)
+		}
+	}
+
+	properties := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		properties = append(properties, bson.E{Key: key, Value: infer(values[key])})
+	}
+
+	return properties
+}
@@ -0,0 +1,73 @@
+package bsonschema_test
+
+import (
+	"testing"
+
+	"pho/pkg/bsonschema"
+	"pho/pkg/extjson"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInfer(t *testing.T) {
+	schema := bsonschema.Infer([]bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "price", Value: int32(10)},
+			{Key: "tags", Value: bson.A{"soup"}},
+			{Key: "address", Value: bson.D{{Key: "city", Value: "Hanoi"}}},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "price", Value: 9.5},
+			{Key: "tags", Value: bson.A{}},
+			{Key: "address", Value: nil},
+			{Key: "note", Value: "new"},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "tags", Value: bson.A{int32(1)}},
+			{Key: "address", Value: bson.D{{Key: "zip", Value: "100000"}}},
+		},
+	})
+
+	// Inferred schema is a valid $jsonSchema of the collection
+	doc, err := schema.ExtJSON(extjson.Relaxed)
+	require.NoError(t, err)
+	b, err := extjson.NewRelaxedMarshaller().WithCompact(true).Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"price":{"anyOf":[{"type":"integer"},{"type":"number"},`)
+
+	// Documents of the sample are valid against it, while other types are not
+	assert.Empty(t, schema.Validate(bson.D{
+		{Key: "price", Value: int32(1)},
+		{Key: "tags", Value: bson.A{"a", int32(2)}},
+	}))
+	assert.Equal(t,
+		[]string{
+			"tags.0: must be of bsonType string or int, got bool",
+			"address.city: must be of bsonType string, got int",
+		},
+		violations(schema.Validate(bson.D{
+			{Key: "tags", Value: bson.A{true}},
+			{Key: "address", Value: bson.D{{Key: "city", Value: int32(1)}}},
+		})),
+	)
+}
+
+func TestInfer_Empty(t *testing.T) {
+	doc, err := bsonschema.Infer(nil).ExtJSON(extjson.Canonical)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "$schema", Value: "http://json-schema.org/draft-04/schema#"}}, doc)
+}
+
+func violations(vs []*bsonschema.Violation) []string {
+	var result []string
+	for _, v := range vs {
+		result = append(result, v.String())
+	}
+	return result
+}
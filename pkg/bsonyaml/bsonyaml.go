@@ -0,0 +1,427 @@
+// Package bsonyaml provides marshalling/unmarshalling of BSON documents as YAML.
+// BSON types that have no YAML counterpart are preserved via tags, so documents round-trip losslessly:
+//
+//	!oid 507f1f77bcf86cd799439011                 ObjectID
+//	!date 2025-01-11T14:30:00.000Z                DateTime
+//	!long 9007199254740993                        int64 (plain integers are int32 when they fit)
+//	!decimal 12.50                                Decimal128
+//	!uuid 01234567-89ab-cdef-0123-456789abcdef    Binary (subtype 4)
+//	!bindata {subtype: 5, data: AQID}             Binary (other subtypes, subtype 0 is !!binary)
+//	!regex /^a.*z$/i                              Regex
+//	!ts {t: 1736605800, i: 1}                     Timestamp
+//	!minkey, !maxkey, !undefined                  MinKey, MaxKey, Undefined
+//
+// Plain floats are always written with a decimal point, so they are not confused with integers.
+package bsonyaml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+// Tags used for BSON types.
+const (
+	TagObjectID   = "!oid"
+	TagDate       = "!date"
+	TagLong       = "!long"
+	TagInt        = "!int"
+	TagDouble     = "!double"
+	TagDecimal    = "!decimal"
+	TagUUID       = "!uuid"
+	TagBinData    = "!bindata"
+	TagRegex      = "!regex"
+	TagTimestamp  = "!ts"
+	TagMinKey     = "!minkey"
+	TagMaxKey     = "!maxkey"
+	TagUndefined  = "!undefined"
+	dateLayout    = "2006-01-02T15:04:05.000Z07:00"
+	yamlIndent    = 2
+	uuidByteCount = 16
+)
+
+// Marshal returns the YAML encoding of the given document.
+func Marshal(doc any) ([]byte, error) {
+	node, err := toNode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, errors.New("only documents can be marshalled")
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("failed to encode yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode yaml: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses a single YAML document into v.
+func Unmarshal(data []byte, v any) error {
+	decoder := NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("no document found")
+		}
+		return err
+	}
+
+	if err := decoder.Decode(&bson.D{}); !errors.Is(err, io.EOF) {
+		return errors.New("more than one document found")
+	}
+
+	return nil
+}
+
+// Decoder reads and decodes a stream of YAML documents (separated by `---`).
+type Decoder struct {
+	decoder *yaml.Decoder
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{decoder: yaml.NewDecoder(r)}
+}
+
+// Decode reads the next document from the input and stores it in v.
+// Empty documents are skipped. When there are no more documents, io.EOF is returned.
+func (d *Decoder) Decode(v any) error {
+	for {
+		var node yaml.Node
+		if err := d.decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.EOF
+			}
+			return fmt.Errorf("failed to parse yaml: %w", err)
+		}
+
+		root := &node
+		if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+			root = root.Content[0]
+		}
+		if root.Kind == yaml.DocumentNode || root.ShortTag() == "!!null" {
+			continue
+		}
+		if root.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: document must be a mapping", root.Line)
+		}
+
+		value, err := fromNode(root)
+		if err != nil {
+			return err
+		}
+
+		return decodeDocument(value.(bson.D), v)
+	}
+}
+
+// decodeDocument converts the parsed document into v via BSON,
+// so v is populated the same way as if it was read from the database.
+func decodeDocument(doc bson.D, v any) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal parsed document: %w", err)
+	}
+
+	if err := bson.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to unmarshal parsed document: %w", err)
+	}
+
+	return nil
+}
+
+// scalar returns a scalar node with the given tag and value.
+func scalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// mapping returns a mapping node with the given keys and values.
+func mapping(keys []string, valueAt func(int) any) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i, key := range keys {
+		value, err := toNode(valueAt(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		node.Content = append(node.Content, scalar("!!str", key), value)
+	}
+	return node, nil
+}
+
+// flowMapping returns a tagged mapping node written in flow style: `!tag {key: value}`.
+func flowMapping(tag string, kv ...string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: tag, Style: yaml.FlowStyle}
+	for i := 0; i+1 < len(kv); i += 2 {
+		node.Content = append(node.Content, scalar("!!str", kv[i]), scalar("", kv[i+1]))
+	}
+	return node
+}
+
+// toNode converts a BSON value into a YAML node.
+func toNode(v any) (*yaml.Node, error) {
+	switch val := v.(type) {
+	case nil, primitive.Null:
+		return scalar("!!null", "null"), nil
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(val)), nil
+	case string:
+		return scalar("!!str", val), nil
+	case int32:
+		return scalar("!!int", strconv.FormatInt(int64(val), 10)), nil
+	case int:
+		return scalar("!!int", strconv.Itoa(val)), nil
+	case int64:
+		return scalar(TagLong, strconv.FormatInt(val, 10)), nil
+	case float64:
+		return scalar("!!float", formatFloat(val)), nil
+	case primitive.ObjectID:
+		return scalar(TagObjectID, val.Hex()), nil
+	case primitive.DateTime:
+		return scalar(TagDate, val.Time().UTC().Format(dateLayout)), nil
+	case time.Time:
+		return scalar(TagDate, val.UTC().Format(dateLayout)), nil
+	case primitive.Decimal128:
+		return scalar(TagDecimal, val.String()), nil
+	case primitive.Binary:
+		return binaryNode(val), nil
+	case primitive.Regex:
+		return scalar(TagRegex, "/"+val.Pattern+"/"+val.Options), nil
+	case primitive.Timestamp:
+		return flowMapping(TagTimestamp, "t", strconv.FormatUint(uint64(val.T), 10),
+			"i", strconv.FormatUint(uint64(val.I), 10)), nil
+	case primitive.MinKey:
+		return scalar(TagMinKey, ""), nil
+	case primitive.MaxKey:
+		return scalar(TagMaxKey, ""), nil
+	case primitive.Undefined:
+		return scalar(TagUndefined, ""), nil
+	case bson.D:
+		keys := make([]string, len(val))
+		for i, e := range val {
+			keys[i] = e.Key
+		}
+		return mapping(keys, func(i int) any { return val[i].Value })
+	}
+
+	// Maps (bson.M and alike) and slices (bson.A and alike)
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		mapKeys := make(map[string]reflect.Value, rv.Len())
+		for _, key := range rv.MapKeys() {
+			mapKeys[key.String()] = key
+		}
+		// Keys are sorted, so marshalling is stable
+		keys := slices.Sorted(maps.Keys(mapKeys))
+		return mapping(keys, func(i int) any { return rv.MapIndex(mapKeys[keys[i]]).Interface() })
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i := range rv.Len() {
+			item, err := toNode(rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			node.Content = append(node.Content, item)
+		}
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+// formatFloat formats the float, so it's never read back as an integer.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return ".nan"
+	case math.IsInf(v, 1):
+		return ".inf"
+	case math.IsInf(v, -1):
+		return "-.inf"
+	}
+
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// binaryNode converts binary data into a YAML node.
+func binaryNode(b primitive.Binary) *yaml.Node {
+	switch {
+	case b.Subtype == bson.TypeBinaryGeneric:
+		return scalar("!!binary", base64.StdEncoding.EncodeToString(b.Data))
+	case b.Subtype == bson.TypeBinaryUUID && len(b.Data) == uuidByteCount:
+		h := hex.EncodeToString(b.Data)
+		return scalar(TagUUID, h[0:8]+"-"+h[8:12]+"-"+h[12:16]+"-"+h[16:20]+"-"+h[20:])
+	default:
+		return flowMapping(TagBinData, "subtype", strconv.Itoa(int(b.Subtype)),
+			"data", base64.StdEncoding.EncodeToString(b.Data))
+	}
+}
+
+// fromNode converts a YAML node into a BSON value.
+func fromNode(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return fromNode(n.Alias)
+	case yaml.SequenceNode:
+		arr := make(bson.A, 0, len(n.Content))
+		for _, item := range n.Content {
+			value, err := fromNode(item)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		return fromMappingNode(n)
+	case yaml.ScalarNode:
+		value, err := fromScalarNode(n)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s value %q: %w", n.Line, n.ShortTag(), n.Value, err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("line %d: unexpected yaml node", n.Line)
+	}
+}
+
+// fromMappingNode converts a mapping node into a document (or a tagged BSON value).
+func fromMappingNode(n *yaml.Node) (any, error) {
+	fields := make(map[string]string, len(n.Content)/2)
+	doc := make(bson.D, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: keys must be scalars", key.Line)
+		}
+
+		value, err := fromNode(n.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: key.Value, Value: value})
+		fields[key.Value] = n.Content[i+1].Value
+	}
+
+	switch n.ShortTag() {
+	case TagTimestamp:
+		t, errT := strconv.ParseUint(fields["t"], 10, 32)
+		i, errI := strconv.ParseUint(fields["i"], 10, 32)
+		if err := errors.Join(errT, errI); err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s value: %w", n.Line, TagTimestamp, err)
+		}
+		return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+	case TagBinData:
+		subtype, errSubtype := strconv.ParseUint(fields["subtype"], 10, 8)
+		data, errData := base64.StdEncoding.DecodeString(fields["data"])
+		if err := errors.Join(errSubtype, errData); err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s value: %w", n.Line, TagBinData, err)
+		}
+		return primitive.Binary{Subtype: byte(subtype), Data: data}, nil
+	case "!!map":
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("line %d: unknown tag %s", n.Line, n.ShortTag())
+	}
+}
+
+// fromScalarNode converts a scalar node into a BSON value.
+func fromScalarNode(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!str":
+		return n.Value, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int", TagInt:
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			return nil, err
+		}
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i), nil
+		}
+		if n.ShortTag() == TagInt {
+			return nil, errors.New("out of int32 range")
+		}
+		return i, nil
+	case TagLong:
+		return strconv.ParseInt(n.Value, 10, 64)
+	case "!!float", TagDouble:
+		return parseFloat(n.Value)
+	case "!!binary":
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(n.Value), ""))
+		return primitive.Binary{Subtype: bson.TypeBinaryGeneric, Data: data}, err
+	case "!!timestamp", TagDate:
+		var t time.Time
+		if err := n.Decode(&t); err != nil {
+			return nil, err
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	case TagObjectID:
+		return primitive.ObjectIDFromHex(n.Value)
+	case TagDecimal:
+		return primitive.ParseDecimal128(n.Value)
+	case TagUUID:
+		data, err := hex.DecodeString(strings.ReplaceAll(n.Value, "-", ""))
+		if err == nil && len(data) != uuidByteCount {
+			err = errors.New("UUID must be 16 bytes long")
+		}
+		return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: data}, err
+	case TagRegex:
+		end := strings.LastIndex(n.Value, "/")
+		if !strings.HasPrefix(n.Value, "/") || end < 1 {
+			return nil, errors.New("expected /pattern/options")
+		}
+		return primitive.Regex{Pattern: n.Value[1:end], Options: n.Value[end+1:]}, nil
+	case TagMinKey:
+		return primitive.MinKey{}, nil
+	case TagMaxKey:
+		return primitive.MaxKey{}, nil
+	case TagUndefined:
+		return primitive.Undefined{}, nil
+	default:
+		return nil, errors.New("unknown tag")
+	}
+}
+
+// parseFloat parses a YAML float (including .inf and .nan).
+func parseFloat(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case ".nan":
+		return math.NaN(), nil
+	case ".inf", "+.inf":
+		return math.Inf(1), nil
+	case "-.inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,211 @@
+package bsonyaml_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	"pho/pkg/bsonyaml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMarshal(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	decimal, err := primitive.ParseDecimal128("12.50")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		input    any
+		expected string
+	}{
+		{
+			name:     "plain values",
+			input:    bson.M{"name": "test", "active": true, "none": nil, "tags": bson.A{"a", "b"}},
+			expected: "active: true\nname: test\nnone: null\ntags:\n  - a\n  - b\n",
+		},
+		{
+			name:     "numbers",
+			input:    bson.D{{Key: "int", Value: int32(1)}, {Key: "long", Value: int64(2)}, {Key: "double", Value: 3.0}},
+			expected: "int: 1\nlong: !long 2\ndouble: 3.0\n",
+		},
+		{
+			name:     "ambiguous strings are quoted",
+			input:    bson.D{{Key: "a", Value: "true"}, {Key: "b", Value: "42"}, {Key: "c", Value: "null"}},
+			expected: "a: \"true\"\nb: \"42\"\nc: \"null\"\n",
+		},
+		{
+			name: "tagged types",
+			input: bson.D{
+				{Key: "_id", Value: oid},
+				{Key: "created", Value: primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 0, time.UTC))},
+				{Key: "price", Value: decimal},
+				{Key: "re", Value: primitive.Regex{Pattern: "^a", Options: "i"}},
+				{Key: "ts", Value: primitive.Timestamp{T: 1, I: 2}},
+			},
+			expected: "_id: !oid 507f1f77bcf86cd799439011\n" +
+				"created: !date 2025-01-11T14:30:00.000Z\n" +
+				"price: !decimal 12.50\n" +
+				"re: !regex /^a/i\n" +
+				"ts: !ts {t: 1, i: 2}\n",
+		},
+		{
+			name: "binary",
+			input: bson.D{
+				{Key: "bin", Value: primitive.Binary{Subtype: 0, Data: []byte{1, 2, 3}}},
+				{Key: "other", Value: primitive.Binary{Subtype: 5, Data: []byte{1, 2, 3}}},
+			},
+			expected: "bin: !!binary AQID\nother: !bindata {subtype: 5, data: AQID}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := bsonyaml.Marshal(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	_, err := bsonyaml.Marshal("not a document")
+	require.Error(t, err)
+
+	_, err = bsonyaml.Marshal(bson.M{"code": primitive.JavaScript("x")})
+	require.Error(t, err)
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bson.D
+	}{
+		{
+			name:  "plain values",
+			input: "name: test\nscore: 1.5\ncount: 3\nbig: 3000000000\nnone: ~\n",
+			expected: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "score", Value: 1.5},
+				{Key: "count", Value: int32(3)},
+				{Key: "big", Value: int64(3000000000)},
+				{Key: "none", Value: nil},
+			},
+		},
+		{
+			name:  "flow style and nesting",
+			input: "nested: {a: [1, two]}\n",
+			expected: bson.D{
+				{Key: "nested", Value: bson.D{{Key: "a", Value: bson.A{int32(1), "two"}}}},
+			},
+		},
+		{
+			name:  "special floats and implicit timestamps",
+			input: "inf: -.inf\ndate: 2025-01-11\n",
+			expected: bson.D{
+				{Key: "inf", Value: math.Inf(-1)},
+				{Key: "date", Value: primitive.DateTime(1736553600000)},
+			},
+		},
+		{
+			name:  "special keys",
+			input: "min: !minkey\nmax: !maxkey\nundef: !undefined\nuuid: !uuid 01234567-89ab-cdef-0123-456789abcdef\n",
+			expected: bson.D{
+				{Key: "min", Value: primitive.MinKey{}},
+				{Key: "max", Value: primitive.MaxKey{}},
+				{Key: "undef", Value: primitive.Undefined{}},
+				{Key: "uuid", Value: primitive.Binary{Subtype: 4, Data: []byte{
+					0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result bson.D
+			require.NoError(t, bsonyaml.Unmarshal([]byte(tt.input), &result))
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "not a mapping", input: "- a\n- b\n"},
+		{name: "invalid yaml", input: "a: [1, 2\n"},
+		{name: "unknown tag", input: "a: !foo bar\n"},
+		{name: "invalid object id", input: "a: !oid xyz\n"},
+		{name: "invalid regex", input: "a: !regex abc\n"},
+		{name: "int out of range", input: "a: !int 3000000000\n"},
+		{name: "several documents", input: "a: 1\n---\nb: 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result bson.D
+			require.Error(t, bsonyaml.Unmarshal([]byte(tt.input), &result))
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	oid := primitive.NewObjectID()
+	decimal, err := primitive.ParseDecimal128("-0.000123")
+	require.NoError(t, err)
+
+	doc := bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "created", Value: primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 123e6, time.UTC))},
+		{Key: "int", Value: int32(-7)},
+		{Key: "long", Value: int64(5)},
+		{Key: "double", Value: 2.0},
+		{Key: "tiny", Value: 1e-300},
+		{Key: "inf", Value: math.Inf(1)},
+		{Key: "decimal", Value: decimal},
+		{Key: "multiline", Value: "line 1\nline 2"},
+		{Key: "ambiguous", Value: "!oid 123"},
+		{Key: "bin", Value: primitive.Binary{Subtype: 0x80, Data: []byte("custom")}},
+		{Key: "re", Value: primitive.Regex{Pattern: "a/b", Options: "ms"}},
+		{Key: "ts", Value: primitive.Timestamp{T: math.MaxUint32, I: 1}},
+		{Key: "nested", Value: bson.D{{Key: "arr", Value: bson.A{bson.D{{Key: "x", Value: nil}}, bson.A{}}}}},
+	}
+
+	b, err := bsonyaml.Marshal(doc)
+	require.NoError(t, err)
+
+	var result bson.D
+	require.NoError(t, bsonyaml.Unmarshal(b, &result))
+	assert.Equal(t, doc, result)
+}
+
+func TestDecoder(t *testing.T) {
+	input := "# 0\n---\na: 1\n---\n# 1\n---\nb: !long 2\n---\n"
+
+	decoder := bsonyaml.NewDecoder(strings.NewReader(input))
+
+	var docs []bson.M
+	for {
+		var doc bson.M
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+
+	assert.Equal(t, []bson.M{{"a": int32(1)}, {"b": int64(2)}}, docs)
+}
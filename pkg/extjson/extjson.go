@@ -10,7 +10,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -33,6 +36,7 @@ type Marshaller struct {
 	canonical  bool
 	escapeHTML bool
 	compact    bool
+	sortKeys   bool
 
 	prefix string
 	indent string
@@ -62,13 +66,19 @@ func (m *Marshaller) WithIndent(v string) *Marshaller { m.indent = v; return m }
 
 func (m *Marshaller) WithCompact(compact bool) *Marshaller { m.compact = compact; return m }
 
+// WithSortedKeys makes keys of ordered documents (bson.D) sorted as well,
+// so documents differing only in the order of fields are marshalled the same way (e.g. for checksums).
+func (m *Marshaller) WithSortedKeys(v bool) *Marshaller { m.sortKeys = v; return m }
+
 // Marshal provides a stable marshalling across all ExtJSON modes
-// "stable" here means that resulting []byte will always be the same (order of keys inside won't change).
+// "stable" here means that resulting []byte will always be the same (order of keys inside won't change):
+// keys of maps are sorted, while ordered documents (bson.D) keep their order (unless WithSortedKeys is set).
 func (m *Marshaller) Marshal(result any) ([]byte, error) {
 	// For better error handling, let's detect when result is a slice
 	// As bson.MarshalExtJson can only handle single objects
 	// TODO(1): handle it automagically via loop here
-	{
+	// Ordered documents (bson.D) are slices as well, but they are objects
+	if _, isDoc := result.(bson.D); !isDoc {
 		t := reflect.TypeOf(result)
 		k := reflect.TypeOf(result).Kind()
 		if k == reflect.Slice || k == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
@@ -81,7 +91,35 @@ func (m *Marshaller) Marshal(result any) ([]byte, error) {
 		return m.marshalShellExtJSON(result)
 	}
 
-	// Handle Canonical and Relaxed modes with stable marshalling
+	if m.sortKeys {
+		return m.marshalSorted(result)
+	}
+
+	marshalled, err := bson.MarshalExtJSON(ordered(result), m.canonical, m.escapeHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	// Formatting is applied to the marshalled JSON as is, so the order of keys is kept
+	var buf bytes.Buffer
+	if m.compact || (m.indent == "" && m.prefix == "") {
+		err = json.Compact(&buf, marshalled)
+	} else {
+		indentStr := m.indent
+		if indentStr == "" {
+			indentStr = " " // Default single space indent
+		}
+		err = json.Indent(&buf, marshalled, m.prefix, indentStr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to format marshalled bson: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// marshalSorted marshals the value with all keys sorted (including ones of ordered documents).
+func (m *Marshaller) marshalSorted(result any) ([]byte, error) {
 	var marshalled []byte
 	var err error
 	if m.indent != "" || m.prefix != "" {
@@ -94,11 +132,7 @@ func (m *Marshaller) Marshal(result any) ([]byte, error) {
 		return nil, err
 	}
 
-	// bson.MarshalExtJson is not stable
-	// It's not trivial to rewrite it
-	// So for Day One solution we're completely OK with not the most efficient
-	// but working solution
-	// So, as json.Marshal() does provide a stable marshalling into a map
+	// As json.Marshal() does provide a stable marshalling of a map
 	// And as ExtJSON (v2) is a valid json - let's simply make a round-trip marshalling
 	// TODO(2): rewrite so it's a efficient solution
 
@@ -125,6 +159,45 @@ func (m *Marshaller) Marshal(result any) ([]byte, error) {
 	return marshalled, nil
 }
 
+// ordered returns the value with all maps (recursively) turned into documents with sorted keys,
+// as bson marshals maps in random order.
+func ordered(v any) any {
+	switch val := v.(type) {
+	case bson.M:
+		return orderedMap(val)
+	case map[string]any:
+		return orderedMap(val)
+	case bson.D:
+		doc := make(bson.D, len(val))
+		for i, e := range val {
+			doc[i] = bson.E{Key: e.Key, Value: ordered(e.Value)}
+		}
+		return doc
+	case bson.A:
+		arr := make(bson.A, len(val))
+		for i, item := range val {
+			arr[i] = ordered(item)
+		}
+		return arr
+	case []any:
+		arr := make([]any, len(val))
+		for i, item := range val {
+			arr[i] = ordered(item)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+func orderedMap(m map[string]any) bson.D {
+	doc := make(bson.D, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		doc = append(doc, bson.E{Key: key, Value: ordered(m[key])})
+	}
+	return doc
+}
+
 // marshalShellExtJSON converts BSON documents to MongoDB Shell ExtJSON v1 format
 // This format uses constructors like ObjectId(), ISODate(), NumberLong() etc.
 func (m *Marshaller) marshalShellExtJSON(v any) ([]byte, error) {
@@ -171,12 +244,39 @@ func (m *Marshaller) marshalShellValue(v any, buf *bytes.Buffer, indent int) err
 		buf.WriteString(`")`)
 
 	case float64:
-		buf.WriteString(strconv.FormatFloat(val, 'g', -1, 64))
+		switch {
+		case math.IsNaN(val):
+			buf.WriteString("NaN")
+		case math.IsInf(val, 1):
+			buf.WriteString("Infinity")
+		case math.IsInf(val, -1):
+			buf.WriteString("-Infinity")
+		default:
+			buf.WriteString(strconv.FormatFloat(val, 'g', -1, 64))
+		}
+
+	case primitive.Decimal128:
+		buf.WriteString(`NumberDecimal("`)
+		buf.WriteString(val.String())
+		buf.WriteString(`")`)
+
+	case primitive.Timestamp:
+		fmt.Fprintf(buf, "Timestamp(%d, %d)", val.T, val.I)
+
+	case primitive.MinKey:
+		buf.WriteString("MinKey()")
+
+	case primitive.MaxKey:
+		buf.WriteString("MaxKey()")
+
+	case primitive.Undefined:
+		buf.WriteString("undefined")
+
+	case primitive.Null:
+		buf.WriteString("null")
 
 	case string:
-		buf.WriteString(`"`)
-		buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(val, `\`, `\\`), `"`, `\"`))
-		buf.WriteString(`"`)
+		writeShellString(buf, val)
 
 	case bool:
 		if val {
@@ -193,47 +293,39 @@ func (m *Marshaller) marshalShellValue(v any, buf *bytes.Buffer, indent int) err
 		buf.WriteString(`")`)
 
 	case primitive.Regex:
+		// Patterns are written as they are: the ones a literal can't hold are passed to the constructor
+		if !isRegexLiteral(val.Pattern) {
+			buf.WriteString(`RegExp(`)
+			writeShellString(buf, val.Pattern)
+			if val.Options != "" {
+				buf.WriteString(`, `)
+				writeShellString(buf, val.Options)
+			}
+			buf.WriteString(`)`)
+			break
+		}
 		buf.WriteString(`/`)
 		buf.WriteString(val.Pattern)
 		buf.WriteString(`/`)
 		buf.WriteString(val.Options)
 
 	case bson.M:
-		buf.WriteString("{")
-		if !m.compact {
-			buf.WriteString("\n")
-		}
-		indentStr := strings.Repeat("  ", indent+1)
-		first := true
-		for k, v := range val {
-			if !first {
-				buf.WriteString(",")
-				if !m.compact {
-					buf.WriteString("\n")
-				}
-			}
-			first = false
-			if !m.compact {
-				buf.WriteString(indentStr)
-			}
-			buf.WriteString(`"`)
-			buf.WriteString(k)
-			buf.WriteString(`"`)
-			if m.compact {
-				buf.WriteString(":")
-			} else {
-				buf.WriteString(" : ")
-			}
-			err := m.marshalShellValue(v, buf, indent+1)
-			if err != nil {
-				return err
-			}
+		// Keys are sorted, so marshalling is stable
+		keys := slices.Sorted(maps.Keys(val))
+		return m.marshalShellDocument(buf, indent, keys, func(i int) any { return val[keys[i]] })
+
+	case bson.D:
+		if m.sortKeys {
+			val = slices.SortedStableFunc(slices.Values(val), func(a, b bson.E) int {
+				return strings.Compare(a.Key, b.Key)
+			})
 		}
-		if !m.compact {
-			buf.WriteString("\n")
-			buf.WriteString(strings.Repeat("  ", indent))
+
+		keys := make([]string, len(val))
+		for i, e := range val {
+			keys[i] = e.Key
 		}
-		buf.WriteString("}")
+		return m.marshalShellDocument(buf, indent, keys, func(i int) any { return val[i].Value })
 
 	case []any:
 		buf.WriteString("[")
@@ -267,40 +359,14 @@ func (m *Marshaller) marshalShellValue(v any, buf *bytes.Buffer, indent int) err
 		rv := reflect.ValueOf(v)
 		switch rv.Kind() {
 		case reflect.Map:
-			buf.WriteString("{")
-			if !m.compact {
-				buf.WriteString("\n")
-			}
-			indentStr := strings.Repeat("  ", indent+1)
-			keys := rv.MapKeys()
-			for i, key := range keys {
-				if i > 0 {
-					buf.WriteString(",")
-					if !m.compact {
-						buf.WriteString("\n")
-					}
-				}
-				if !m.compact {
-					buf.WriteString(indentStr)
-				}
-				buf.WriteString(`"`)
-				fmt.Fprintf(buf, "%v", key.Interface())
-				buf.WriteString(`"`)
-				if m.compact {
-					buf.WriteString(":")
-				} else {
-					buf.WriteString(" : ")
-				}
-				err := m.marshalShellValue(rv.MapIndex(key).Interface(), buf, indent+1)
-				if err != nil {
-					return err
-				}
-			}
-			if !m.compact {
-				buf.WriteString("\n")
-				buf.WriteString(strings.Repeat("  ", indent))
+			mapKeys := make(map[string]reflect.Value, rv.Len())
+			for _, key := range rv.MapKeys() {
+				mapKeys[fmt.Sprintf("%v", key.Interface())] = key
 			}
-			buf.WriteString("}")
+			keys := slices.Sorted(maps.Keys(mapKeys))
+			return m.marshalShellDocument(buf, indent, keys, func(i int) any {
+				return rv.MapIndex(mapKeys[keys[i]]).Interface()
+			})
 
 		case reflect.Slice, reflect.Array:
 			buf.WriteString("[")
@@ -329,11 +395,90 @@ func (m *Marshaller) marshalShellValue(v any, buf *bytes.Buffer, indent int) err
 			}
 			buf.WriteString("]")
 
-		default:
-			// Fallback to string representation
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32:
 			fmt.Fprintf(buf, "%v", v)
+
+		default:
+			// E.g. JavaScript code or DBPointer: there is no shell syntax to read them back
+			return fmt.Errorf("%T can't be represented in shell syntax", v)
 		}
 	}
 
 	return nil
 }
+
+// marshalShellDocument marshals a document with the given keys in Shell format.
+func (m *Marshaller) marshalShellDocument(buf *bytes.Buffer, indent int, keys []string, valueAt func(int) any) error {
+	buf.WriteString("{")
+	if !m.compact {
+		buf.WriteString("\n")
+	}
+	indentStr := strings.Repeat("  ", indent+1)
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(",")
+			if !m.compact {
+				buf.WriteString("\n")
+			}
+		}
+		if !m.compact {
+			buf.WriteString(indentStr)
+		}
+		writeShellString(buf, key)
+		if m.compact {
+			buf.WriteString(":")
+		} else {
+			buf.WriteString(" : ")
+		}
+		if err := m.marshalShellValue(valueAt(i), buf, indent+1); err != nil {
+			return err
+		}
+	}
+	if !m.compact {
+		buf.WriteString("\n")
+		buf.WriteString(strings.Repeat("  ", indent))
+	}
+	buf.WriteString("}")
+
+	return nil
+}
+
+// writeShellString writes the string quoted and escaped as in JSON.
+func writeShellString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s) // encoding a string never fails
+
+	// Encoder terminates each value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+// isRegexLiteral reports whether the pattern can be written as a regex literal as it is:
+// it must not have unescaped slashes (outside of character classes), line breaks or a trailing backslash,
+// and it must not be empty (`//` starts a comment).
+func isRegexLiteral(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+
+	escaped, inClass := false, false
+	for _, c := range pattern {
+		switch {
+		case c == '\n' || c == '\r':
+			return false
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			return false
+		}
+	}
+
+	return !escaped
+}
@@ -48,3 +48,45 @@ func TestMarshaller_Marshal_OnArray(t *testing.T) {
 	_, err := extjson.NewCanonicalMarshaller().Marshal(testData)
 	assert.Error(t, err, "marshal expects to fail yet as not supported")
 }
+
+func TestMarshaller_Marshal_KeepsOrder(t *testing.T) {
+	doc := bson.D{
+		{Key: "_id", Value: "1"},
+		{Key: "name", Value: "Bar"},
+		{Key: "count", Value: int64(1) << 60},
+		{Key: "nested", Value: bson.D{{Key: "z", Value: 1.0}, {Key: "a", Value: bson.M{"y": "<", "x": nil}}}},
+	}
+
+	tests := []struct {
+		name       string
+		marshaller *extjson.Marshaller
+		expected   string
+	}{
+		{
+			name:       "relaxed",
+			marshaller: extjson.NewRelaxedMarshaller(),
+			expected: `{"_id":"1","name":"Bar","count":1152921504606846976,` +
+				`"nested":{"z":1.0,"a":{"x":null,"y":"<"}}}`,
+		},
+		{
+			name:       "canonical sorted",
+			marshaller: extjson.NewCanonicalMarshaller().WithSortedKeys(true),
+			expected: `{"_id":"1","count":{"$numberLong":"1152921504606846976"},"name":"Bar",` +
+				`"nested":{"a":{"x":null,"y":"\u003c"},"z":{"$numberDouble":"1.0"}}}`,
+		},
+		{
+			name:       "shell sorted",
+			marshaller: extjson.NewShellMarshaller().WithCompact(true).WithSortedKeys(true),
+			expected: `{"_id":"1","count":NumberLong("1152921504606846976"),"name":"Bar",` +
+				`"nested":{"a":{"x":null,"y":"<"},"z":1}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.marshaller.Marshal(doc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(got))
+		})
+	}
+}
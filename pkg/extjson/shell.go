@@ -0,0 +1,766 @@
+package extjson
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShellSyntaxError describes a problem found while parsing MongoDB Shell syntax.
+type ShellSyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ShellSyntaxError) Error() string {
+	return fmt.Sprintf("shell syntax error at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// UnmarshalShell parses a single document written in MongoDB Shell syntax (ExtJSON v1) into v.
+// Besides JSON, the syntax supports constructors (ObjectId, ISODate, NumberLong, etc.),
+// unquoted keys, single-quoted strings, regex literals, comments and trailing commas.
+// As in the shell, plain numbers are doubles: NumberInt and NumberLong must be used for integers.
+func UnmarshalShell(data []byte, v any) error {
+	p := &shellParser{data: data}
+
+	doc, err := p.parseDocument()
+	if err != nil {
+		return err
+	}
+
+	if p.skipSpace(); p.pos < len(p.data) {
+		return p.errorf("unexpected %q after the document", p.data[p.pos])
+	}
+
+	return decodeShellDocument(doc, v)
+}
+
+// ShellDecoder reads and decodes a stream of documents written in MongoDB Shell syntax.
+// Documents may be separated by whitespace and comments (e.g. line number comments of the dump).
+type ShellDecoder struct {
+	r io.Reader
+	p *shellParser
+}
+
+// NewShellDecoder returns a new decoder that reads from r.
+func NewShellDecoder(r io.Reader) *ShellDecoder {
+	return &ShellDecoder{r: r}
+}
+
+// Decode reads the next document from the input and stores it in v.
+// When there are no more documents, io.EOF is returned.
+func (d *ShellDecoder) Decode(v any) error {
+	if d.p == nil {
+		data, err := io.ReadAll(d.r)
+		if err != nil {
+			return fmt.Errorf("failed to read shell input: %w", err)
+		}
+		d.p = &shellParser{data: data}
+	}
+
+	if d.p.skipSpace(); d.p.pos >= len(d.p.data) {
+		return io.EOF
+	}
+
+	doc, err := d.p.parseDocument()
+	if err != nil {
+		return err
+	}
+
+	return decodeShellDocument(doc, v)
+}
+
+// decodeShellDocument converts the parsed document into v via BSON,
+// so v is populated the same way as if it was read from the database.
+func decodeShellDocument(doc bson.D, v any) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal parsed document: %w", err)
+	}
+
+	if err := bson.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to unmarshal parsed document: %w", err)
+	}
+
+	return nil
+}
+
+// shellParser is a recursive descent parser of MongoDB Shell syntax.
+type shellParser struct {
+	data []byte
+	pos  int
+}
+
+// errorf returns a syntax error pointing to the current position.
+func (p *shellParser) errorf(format string, args ...any) error {
+	line, column := 1, 1
+	for _, c := range p.data[:min(p.pos, len(p.data))] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return &ShellSyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipSpace skips whitespace and comments.
+func (p *shellParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '/' && p.peekAt(1) == '/':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.peekAt(1) == '*':
+			end := strings.Index(string(p.data[p.pos+2:]), "*/")
+			if end < 0 {
+				p.pos = len(p.data)
+				return
+			}
+			p.pos += 2 + end + 2
+		default:
+			return
+		}
+	}
+}
+
+// peekAt returns the byte at the given offset from the current position (0 if out of range).
+func (p *shellParser) peekAt(offset int) byte {
+	if p.pos+offset < len(p.data) {
+		return p.data[p.pos+offset]
+	}
+	return 0
+}
+
+// expect skips whitespace and consumes the given byte.
+func (p *shellParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return p.errorf("expected %q, got end of input", c)
+	}
+	if p.data[p.pos] != c {
+		return p.errorf("expected %q, got %q", c, p.data[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// parseDocument parses a value that must be a document.
+func (p *shellParser) parseDocument() (bson.D, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != '{' {
+		return nil, p.errorf("expected a document")
+	}
+
+	return p.parseObject()
+}
+
+// parseValue parses any value.
+func (p *shellParser) parseValue() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '/':
+		return p.parseRegex()
+	case c == '-' || c == '+' || c == '.' || isDigit(c):
+		return p.parseNumber()
+	case isIdentStart(c):
+		return p.parseIdentValue()
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+// parseObject parses a document: `{key: value, ...}`. Keys may be unquoted, trailing comma is allowed.
+func (p *shellParser) parseObject() (bson.D, error) {
+	p.pos++ // {
+
+	doc := bson.D{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated document")
+		}
+		if p.data[p.pos] == '}' {
+			p.pos++
+			return doc, nil
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: key, Value: value})
+
+		if done, err := p.parseSeparator('}'); err != nil || done {
+			return doc, err
+		}
+	}
+}
+
+// parseArray parses an array: `[value, ...]`. Trailing comma is allowed.
+func (p *shellParser) parseArray() (bson.A, error) {
+	p.pos++ // [
+
+	arr := bson.A{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+
+		if done, err := p.parseSeparator(']'); err != nil || done {
+			return arr, err
+		}
+	}
+}
+
+// parseSeparator consumes a comma between items or the closing bracket.
+// It reports true when the closing bracket is consumed.
+func (p *shellParser) parseSeparator(closing byte) (bool, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return false, p.errorf("expected ',' or %q, got end of input", closing)
+	}
+
+	switch p.data[p.pos] {
+	case ',':
+		p.pos++
+		return false, nil
+	case closing:
+		p.pos++
+		return true, nil
+	default:
+		return false, p.errorf("expected ',' or %q, got %q", closing, p.data[p.pos])
+	}
+}
+
+// parseKey parses a document key: a quoted string or an unquoted identifier (or number).
+func (p *shellParser) parseKey() (string, error) {
+	c := p.data[p.pos]
+	if c == '"' || c == '\'' {
+		return p.parseString()
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && (isIdentPart(p.data[p.pos]) || p.data[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a key, got %q", c)
+	}
+
+	return string(p.data[start:p.pos]), nil
+}
+
+// parseString parses a single- or double-quoted string with JavaScript escapes.
+func (p *shellParser) parseString() (string, error) {
+	quote := p.data[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.data[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '\n':
+			return "", p.errorf("unescaped line break in string")
+		case c != '\\':
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		// Escape sequence
+		p.pos++
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		esc := p.data[p.pos]
+		p.pos++
+		switch esc {
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '0':
+			sb.WriteByte(0)
+		case 'x':
+			r, err := p.parseHexRune(2)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		case 'u':
+			r, err := p.parseHexRune(4)
+			if err != nil {
+				return "", err
+			}
+			// Surrogate pair is given as two sequential \u escapes
+			if utf16.IsSurrogate(r) && p.peekAt(0) == '\\' && p.peekAt(1) == 'u' {
+				p.pos += 2
+				r2, err := p.parseHexRune(4)
+				if err != nil {
+					return "", err
+				}
+				r = utf16.DecodeRune(r, r2)
+			}
+			if !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			sb.WriteRune(r)
+		case '\n':
+			// Line continuation
+		default:
+			// \", \', \\, \/ and any other escaped character stand for the character itself
+			sb.WriteByte(esc)
+		}
+	}
+}
+
+// parseHexRune parses a rune given as n hex digits.
+func (p *shellParser) parseHexRune(n int) (rune, error) {
+	if p.pos+n > len(p.data) {
+		return 0, p.errorf("invalid escape sequence")
+	}
+
+	v, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape sequence")
+	}
+	p.pos += n
+
+	return rune(v), nil
+}
+
+// parseRegex parses a regular expression literal: `/pattern/flags`.
+func (p *shellParser) parseRegex() (primitive.Regex, error) {
+	p.pos++ // /
+
+	var pattern strings.Builder
+	inClass := false
+	for {
+		if p.pos >= len(p.data) || p.data[p.pos] == '\n' {
+			return primitive.Regex{}, p.errorf("unterminated regular expression")
+		}
+
+		c := p.data[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.data):
+			// Escapes are kept as they are (as in JavaScript, where `/a\/b/.source` is `a\/b`)
+			pattern.WriteByte(c)
+			pattern.WriteByte(p.data[p.pos])
+			p.pos++
+			continue
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			start := p.pos
+			for p.pos < len(p.data) && isLetter(p.data[p.pos]) {
+				p.pos++
+			}
+			return primitive.Regex{Pattern: pattern.String(), Options: string(p.data[start:p.pos])}, nil
+		}
+		pattern.WriteByte(c)
+	}
+}
+
+// parseNumber parses a number literal. As in the shell, plain numbers are doubles.
+func (p *shellParser) parseNumber() (float64, error) {
+	start := p.pos
+	if c := p.data[p.pos]; c == '-' || c == '+' {
+		p.pos++
+	}
+
+	// Signed special values
+	if isIdentStart(p.peekAt(0)) {
+		ident := p.parseIdent()
+		if ident != "Infinity" {
+			return 0, p.errorf("invalid number %q", string(p.data[start:p.pos]))
+		}
+		if p.data[start] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	}
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if !isDigit(c) && c != '.' && c != 'e' && c != 'E' &&
+			!((c == '-' || c == '+') && (p.data[p.pos-1] == 'e' || p.data[p.pos-1] == 'E')) {
+			break
+		}
+		p.pos++
+	}
+
+	literal := string(p.data[start:p.pos])
+	v, err := strconv.ParseFloat(strings.TrimPrefix(literal, "+"), 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", literal)
+	}
+
+	return v, nil
+}
+
+// parseIdent parses an identifier.
+func (p *shellParser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentPart(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// parseIdentValue parses a keyword (true, null, etc.) or a constructor call (e.g. `ObjectId("...")`).
+func (p *shellParser) parseIdentValue() (any, error) {
+	start := p.pos
+	ident := p.parseIdent()
+
+	// `new Date(...)` is the same as `Date(...)`
+	if ident == "new" {
+		p.skipSpace()
+		if p.pos >= len(p.data) || !isIdentStart(p.data[p.pos]) {
+			return nil, p.errorf("expected a constructor after new")
+		}
+		start = p.pos
+		ident = p.parseIdent()
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != '(' {
+		switch ident {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "undefined":
+			return primitive.Undefined{}, nil
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "MinKey":
+			return primitive.MinKey{}, nil
+		case "MaxKey":
+			return primitive.MaxKey{}, nil
+		}
+		p.pos = start
+		return nil, p.errorf("unexpected identifier %q", ident)
+	}
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	constructor, ok := shellConstructors[ident]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("unknown constructor %s", ident)
+	}
+
+	value, err := constructor(args)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid %s: %v", ident, err)
+	}
+
+	return value, nil
+}
+
+// parseArgs parses arguments of a constructor call: `(arg, ...)`.
+func (p *shellParser) parseArgs() ([]any, error) {
+	p.pos++ // (
+
+	var args []any
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated constructor call")
+		}
+		if p.data[p.pos] == ')' {
+			p.pos++
+			return args, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+
+		if done, err := p.parseSeparator(')'); err != nil || done {
+			return args, err
+		}
+	}
+}
+
+// shellConstructors build BSON values from arguments of shell constructors.
+var shellConstructors = map[string]func(args []any) (any, error){
+	"ObjectId": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.ObjectIDFromHex(s)
+	},
+	"ISODate":       newShellDate,
+	"Date":          newShellDate,
+	"NumberLong":    func(args []any) (any, error) { return intArg(args, 64) },
+	"NumberInt":     func(args []any) (any, error) { v, err := intArg(args, 32); return int32(v), err },
+	"NumberDecimal": newShellDecimal,
+	"Decimal128":    newShellDecimal,
+	"BinData": func(args []any) (any, error) {
+		subtype, data, err := binaryArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Subtype: subtype, Data: decoded}, nil
+	},
+	"HexData": func(args []any) (any, error) {
+		subtype, data, err := binaryArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Binary{Subtype: subtype, Data: decoded}, nil
+	},
+	"UUID": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded) != 16 {
+			return nil, errors.New("UUID must be 16 bytes long")
+		}
+		return primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: decoded}, nil
+	},
+	"Timestamp": func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, errors.New("expected 2 arguments")
+		}
+		t, err := uint32Arg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		i, err := uint32Arg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Timestamp{T: t, I: i}, nil
+	},
+	"RegExp": func(args []any) (any, error) {
+		if len(args) == 0 || len(args) > 2 {
+			return nil, errors.New("expected 1 or 2 arguments")
+		}
+		pattern, ok := args[0].(string)
+		if !ok {
+			return nil, errors.New("pattern must be a string")
+		}
+		var options string
+		if len(args) == 2 {
+			if options, ok = args[1].(string); !ok {
+				return nil, errors.New("flags must be a string")
+			}
+		}
+		return primitive.Regex{Pattern: pattern, Options: options}, nil
+	},
+	"MinKey": func(args []any) (any, error) { return primitive.MinKey{}, noArgs(args) },
+	"MaxKey": func(args []any) (any, error) { return primitive.MaxKey{}, noArgs(args) },
+}
+
+// shellDateLayouts are accepted formats of ISODate strings.
+var shellDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// newShellDate builds a date from a date string or milliseconds since epoch.
+func newShellDate(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected 1 argument")
+	}
+
+	switch v := args[0].(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, errors.New("milliseconds must be an integer")
+		}
+		return primitive.DateTime(int64(v)), nil
+	case int64:
+		return primitive.DateTime(v), nil
+	case int32:
+		return primitive.DateTime(int64(v)), nil
+	case string:
+		for _, layout := range shellDateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return primitive.NewDateTimeFromTime(t), nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported date format %q", v)
+	default:
+		return nil, errors.New("expected a string or a number")
+	}
+}
+
+// newShellDecimal builds a Decimal128 from a string (or a number).
+func newShellDecimal(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected 1 argument")
+	}
+
+	switch v := args[0].(type) {
+	case string:
+		return primitive.ParseDecimal128(v)
+	case float64:
+		return primitive.ParseDecimal128(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		return nil, errors.New("expected a string or a number")
+	}
+}
+
+// stringArg returns the i-th argument that must be a string, checking the number of arguments.
+func stringArg(args []any, i, expected int) (string, error) {
+	if len(args) != expected {
+		return "", fmt.Errorf("expected %d argument(s)", expected)
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be a string", i+1)
+	}
+	return s, nil
+}
+
+// intArg returns the only argument (a string or an integral number) as an integer of the given bit size.
+func intArg(args []any, bitSize int) (int64, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected 1 argument")
+	}
+
+	switch v := args[0].(type) {
+	case string:
+		return strconv.ParseInt(v, 10, bitSize)
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, errors.New("expected an integer")
+		}
+		return strconv.ParseInt(strconv.FormatFloat(v, 'f', -1, 64), 10, bitSize)
+	default:
+		return 0, errors.New("expected a string or a number")
+	}
+}
+
+// uint32Arg returns the argument (an integral number) as uint32.
+func uint32Arg(arg any) (uint32, error) {
+	v, ok := arg.(float64)
+	if !ok || v != math.Trunc(v) || v < 0 || v > math.MaxUint32 {
+		return 0, errors.New("expected an unsigned 32-bit integer")
+	}
+	return uint32(v), nil
+}
+
+// binaryArgs returns the subtype and the encoded data of binary constructors.
+func binaryArgs(args []any) (byte, string, error) {
+	if len(args) != 2 {
+		return 0, "", errors.New("expected 2 arguments")
+	}
+	subtype, ok := args[0].(float64)
+	if !ok || subtype != math.Trunc(subtype) || subtype < 0 || subtype > math.MaxUint8 {
+		return 0, "", errors.New("subtype must be a byte")
+	}
+	data, ok := args[1].(string)
+	if !ok {
+		return 0, "", errors.New("data must be a string")
+	}
+	return byte(subtype), data, nil
+}
+
+// noArgs checks that no arguments are given.
+func noArgs(args []any) error {
+	if len(args) != 0 {
+		return errors.New("expected no arguments")
+	}
+	return nil
+}
+
+func isDigit(c byte) bool      { return c >= '0' && c <= '9' }
+func isLetter(c byte) bool     { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isIdentStart(c byte) bool { return isLetter(c) || c == '_' || c == '$' }
+func isIdentPart(c byte) bool  { return isIdentStart(c) || isDigit(c) }
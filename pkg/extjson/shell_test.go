@@ -0,0 +1,237 @@
+package extjson_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	"pho/pkg/extjson"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUnmarshalShell(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	date := primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 0, time.UTC))
+	decimal, err := primitive.ParseDecimal128("12.50")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected bson.D
+	}{
+		{
+			name:  "plain JSON",
+			input: `{"name": "test", "active": true, "score": 1.5, "tags": ["a", "b"], "none": null}`,
+			expected: bson.D{
+				{Key: "name", Value: "test"},
+				{Key: "active", Value: true},
+				{Key: "score", Value: 1.5},
+				{Key: "tags", Value: bson.A{"a", "b"}},
+				{Key: "none", Value: nil},
+			},
+		},
+		{
+			name:     "plain numbers are doubles",
+			input:    `{"a": 1, "b": -2e3, "c": .5}`,
+			expected: bson.D{{Key: "a", Value: 1.0}, {Key: "b", Value: -2000.0}, {Key: "c", Value: 0.5}},
+		},
+		{
+			name:     "constructors",
+			input:    `{"_id": ObjectId("507f1f77bcf86cd799439011"), "created": ISODate("2025-01-11T14:30:00.000Z")}`,
+			expected: bson.D{{Key: "_id", Value: oid}, {Key: "created", Value: date}},
+		},
+		{
+			name:  "date variants",
+			input: `{"a": new Date("2025-01-11T14:30:00Z"), "b": Date(1736605800000), "c": ISODate("2025-01-11")}`,
+			expected: bson.D{
+				{Key: "a", Value: date},
+				{Key: "b", Value: date},
+				{Key: "c", Value: primitive.DateTime(1736553600000)},
+			},
+		},
+		{
+			name:  "numeric constructors",
+			input: `{"long": NumberLong("9007199254740993"), "int": NumberInt(42), "dec": NumberDecimal("12.50")}`,
+			expected: bson.D{
+				{Key: "long", Value: int64(9007199254740993)},
+				{Key: "int", Value: int32(42)},
+				{Key: "dec", Value: decimal},
+			},
+		},
+		{
+			name: "binary constructors",
+			input: `{"bin": BinData(0, "AQID"), "hex": HexData(5, "0102"), ` +
+				`"uuid": UUID("0123456789abcdef0123456789abcdef")}`,
+			expected: bson.D{
+				{Key: "bin", Value: primitive.Binary{Subtype: 0, Data: []byte{1, 2, 3}}},
+				{Key: "hex", Value: primitive.Binary{Subtype: 5, Data: []byte{1, 2}}},
+				{Key: "uuid", Value: primitive.Binary{Subtype: 4, Data: []byte{
+					0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				}}},
+			},
+		},
+		{
+			name:  "special values",
+			input: `{"ts": Timestamp(1736605800, 2), "min": MinKey(), "max": MaxKey, "undef": undefined}`,
+			expected: bson.D{
+				{Key: "ts", Value: primitive.Timestamp{T: 1736605800, I: 2}},
+				{Key: "min", Value: primitive.MinKey{}},
+				{Key: "max", Value: primitive.MaxKey{}},
+				{Key: "undef", Value: primitive.Undefined{}},
+			},
+		},
+		{
+			name:  "unquoted keys, single quotes and trailing commas",
+			input: `{name: 'it\'s', $set: {"a.b": 'x',}, list: [1, 2,],}`,
+			expected: bson.D{
+				{Key: "name", Value: "it's"},
+				{Key: "$set", Value: bson.D{{Key: "a.b", Value: "x"}}},
+				{Key: "list", Value: bson.A{1.0, 2.0}},
+			},
+		},
+		{
+			name:  "regex literals",
+			input: `{"a": /^test$/i, "b": /a\/b[/]/, "c": RegExp("x+", "m")}`,
+			expected: bson.D{
+				{Key: "a", Value: primitive.Regex{Pattern: "^test$", Options: "i"}},
+				{Key: "b", Value: primitive.Regex{Pattern: "a\\/b[/]"}},
+				{Key: "c", Value: primitive.Regex{Pattern: "x+", Options: "m"}},
+			},
+		},
+		{
+			name:     "comments and escapes",
+			input:    "{\n  // comment\n  \"a\": \"line\\nbreak \\u00e9\\ud83d\\ude00\", /* inline */ \"b\": 1\n}",
+			expected: bson.D{{Key: "a", Value: "line\nbreak é😀"}, {Key: "b", Value: 1.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc bson.D
+			require.NoError(t, extjson.UnmarshalShell([]byte(tt.input), &doc))
+			assert.Equal(t, tt.expected, doc)
+		})
+	}
+}
+
+func TestUnmarshalShell_SpecialNumbers(t *testing.T) {
+	var doc bson.M
+	require.NoError(t, extjson.UnmarshalShell([]byte(`{a: NaN, b: Infinity, c: -Infinity}`), &doc))
+
+	assert.True(t, math.IsNaN(doc["a"].(float64)))
+	assert.True(t, math.IsInf(doc["b"].(float64), 1))
+	assert.True(t, math.IsInf(doc["c"].(float64), -1))
+}
+
+func TestUnmarshalShell_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		errorContains string
+	}{
+		{name: "not a document", input: `[1, 2]`, errorContains: "expected a document"},
+		{name: "unterminated document", input: `{"a": 1`, errorContains: "expected ',' or '}'"},
+		{name: "missing colon", input: `{"a" 1}`, errorContains: "expected ':'"},
+		{name: "unknown constructor", input: `{"a": Foo(1)}`, errorContains: "unknown constructor Foo"},
+		{name: "invalid ObjectId", input: `{"a": ObjectId("xyz")}`, errorContains: "invalid ObjectId"},
+		{name: "NumberInt overflow", input: `{"a": NumberInt("3000000000")}`, errorContains: "invalid NumberInt"},
+		{name: "unterminated string", input: `{"a": "x}`, errorContains: "unterminated string"},
+		{name: "trailing data", input: `{"a": 1} {"b": 2}`, errorContains: "after the document"},
+		{name: "position", input: "{\n  \"a\": 1,\n  \"b\": oops\n}", errorContains: "line 3, column 8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc bson.M
+			err := extjson.UnmarshalShell([]byte(tt.input), &doc)
+			require.ErrorContains(t, err, tt.errorContains)
+
+			var syntaxErr *extjson.ShellSyntaxError
+			assert.True(t, errors.As(err, &syntaxErr))
+		})
+	}
+}
+
+func TestShellDecoder(t *testing.T) {
+	input := "/* 0 */\n{\n  \"_id\" : NumberInt(\"1\"),\n  \"name\" : \"a\"\n}\n" +
+		"/* 1 */\n{_id: NumberInt(2), name: 'b'}\n"
+
+	decoder := extjson.NewShellDecoder(strings.NewReader(input))
+
+	var docs []bson.M
+	for {
+		var doc bson.M
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+
+	assert.Equal(t, []bson.M{{"_id": int32(1), "name": "a"}, {"_id": int32(2), "name": "b"}}, docs)
+}
+
+func TestShellMarshaller_RoundTrip(t *testing.T) {
+	oid, err := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	require.NoError(t, err)
+	decimal, err := primitive.ParseDecimal128("12.50")
+	require.NoError(t, err)
+
+	doc := bson.M{
+		"_id":     oid,
+		"created": primitive.NewDateTimeFromTime(time.Date(2025, 1, 11, 14, 30, 0, 123000000, time.UTC)),
+		"count":   int32(7),
+		"big":     int64(9007199254740993),
+		"score":   1.0,
+		"price":   decimal,
+		"ts":      primitive.Timestamp{T: 1736605800, I: 1},
+		"text":    "quote \" backslash \\ newline \n tab \t <html>",
+		"re":      primitive.Regex{Pattern: "a/b", Options: "i"},
+		"reEsc":   primitive.Regex{Pattern: `a\/b\d`},
+		"reEmpty": primitive.Regex{},
+		"reLines": primitive.Regex{Pattern: "a\nb", Options: "m"},
+		"bin":     primitive.Binary{Subtype: 0, Data: []byte{1, 2, 3}},
+		"nested":  bson.M{"list": bson.A{int32(1), "two", bson.M{"three": nil}}},
+		"min":     primitive.MinKey{},
+	}
+
+	for _, compact := range []bool{true, false} {
+		marshalled, err := extjson.NewShellMarshaller().WithCompact(compact).Marshal(doc)
+		require.NoError(t, err)
+
+		var parsed bson.M
+		require.NoError(t, extjson.UnmarshalShell(marshalled, &parsed), string(marshalled))
+		assert.Equal(t, doc, parsed)
+	}
+}
+
+func TestShellMarshaller_Unrepresentable(t *testing.T) {
+	values := []any{
+		primitive.JavaScript("function() { return 1; }"),
+		primitive.CodeWithScope{Code: "x", Scope: bson.M{"x": 1}},
+		primitive.DBPointer{DB: "db.coll", Pointer: primitive.NewObjectID()},
+		primitive.Symbol("sym"),
+	}
+
+	for _, v := range values {
+		_, err := extjson.NewShellMarshaller().Marshal(bson.M{"v": v})
+		assert.Error(t, err, "%T", v)
+	}
+}
+
+func TestShellMarshaller_Stable(t *testing.T) {
+	doc := bson.M{"b": 1.0, "a": bson.M{"z": 1.0, "y": 2.0}, "c": 3.0}
+
+	got, err := extjson.NewShellMarshaller().WithCompact(true).Marshal(doc)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":{"y":2,"z":1},"b":1,"c":3}`, string(got))
+}
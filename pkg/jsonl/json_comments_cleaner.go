@@ -14,6 +14,9 @@ type JSONCommentsCleaner struct {
 	reader           *bufio.Reader
 	insideComment    bool
 	jsonNestingLevel int
+
+	// pending keeps cleaned data that did not fit into the caller's buffer yet
+	pending bytes.Buffer
 }
 
 var _ io.Reader = &JSONCommentsCleaner{}
@@ -25,25 +28,25 @@ func NewJSONCommentsCleaner(r io.Reader) *JSONCommentsCleaner {
 
 // Read reads data from the underlying input source and removes comments.
 func (cr *JSONCommentsCleaner) Read(p []byte) (int, error) {
-	var buf bytes.Buffer
-	for {
+	for cr.pending.Len() == 0 {
 		line, err := cr.reader.ReadString('\n')
 		if err != nil && !errors.Is(err, io.EOF) {
 			return 0, err
 		}
-		buf.WriteString(cr.removeComments(line))
+		cr.pending.WriteString(cr.removeComments(line))
 
 		if errors.Is(err, io.EOF) {
 			break
 		}
 	}
 
-	if buf.Len() == 0 {
+	if cr.pending.Len() == 0 {
 		return 0, io.EOF
 	}
 
-	// Copy the data from the buffer to the provided byte slice
-	n, err := buf.Read(p)
+	// Copy the data from the pending buffer to the provided byte slice
+	// Whatever doesn't fit stays pending for the next Read call
+	n, err := cr.pending.Read(p)
 	if err != nil && !errors.Is(err, io.EOF) {
 		return n, err
 	}
@@ -1,8 +1,11 @@
 package jsonl_test
 
 import (
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"pho/pkg/jsonl"
 
@@ -45,3 +48,16 @@ func TestJsonlDecoding(t *testing.T) {
 		assert.Equal(t, "Sample 7", decoded[2].Name)
 	}
 }
+
+func TestJSONCommentsCleaner_SmallReads(t *testing.T) {
+	input := "// comment\n{\"a\": 1}\n/* block */ {\"b\": 2}\n"
+
+	// Cleaned data that doesn't fit into the caller's buffer is kept for the next reads
+	cleaned, err := io.ReadAll(iotest.OneByteReader(jsonl.NewJSONCommentsCleaner(strings.NewReader(input))))
+	require.NoError(t, err)
+
+	expected, err := io.ReadAll(jsonl.NewJSONCommentsCleaner(strings.NewReader(input)))
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(cleaned))
+	assert.Contains(t, string(cleaned), `{"b": 2}`)
+}